@@ -0,0 +1,23 @@
+// Command fakeofd запускает локальную замену ОФД для проверки доставки чеков без сети:
+//
+//	go run ./cmd/fakeofd -addr :9090 -failure-rate 0.2
+//
+// и OFD_ENABLED=true OFD_URL=http://localhost:9090 для сервера.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/idkOybek/internal/ofd/fake"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	failureRate := flag.Float64("failure-rate", 0, "share of requests answered with 503, 0..1")
+	flag.Parse()
+
+	log.Printf("Fake OFD listening on %s (failure rate %.2f)", *addr, *failureRate)
+	log.Fatal(http.ListenAndServe(*addr, fake.NewServer(*failureRate)))
+}
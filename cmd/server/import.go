@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+)
+
+const importUsage = "usage: import terminals|fiscal_modules [-dry-run] FILE"
+
+// runImport выполняет подкоманду import: проверяет файл CSV/XLSX и, если не задан -dry-run,
+// создаёт все объекты из него в одной транзакции
+func runImport(ctx context.Context, service *services.ImportService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(importUsage)
+	}
+	kind := models.ImportKind(args[0])
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the file")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf(importUsage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	job, table, err := service.Prepare(ctx, kind, filepath.Base(flags.Arg(0)), *dryRun, file)
+	if err != nil {
+		return err
+	}
+	if err := service.Run(ctx, job, table, models.AuditMeta{}); err != nil {
+		return err
+	}
+
+	printImport(job)
+	if job.ErrorCount > 0 {
+		return fmt.Errorf("import job %d has %d error(s)", job.ID, job.ErrorCount)
+	}
+	return nil
+}
+
+func printImport(job *models.ImportJob) {
+	mode := "import"
+	if job.DryRun {
+		mode = "dry run"
+	}
+	fmt.Printf("Import job %d (%s of %s from %s): %s\n", job.ID, mode, job.Kind, job.FileName, job.Status)
+	fmt.Printf("  rows: %d, imported: %d, errors: %d\n", job.TotalRows, job.ImportedRows, job.ErrorCount)
+	for _, e := range job.Errors {
+		field := e.Field
+		if field == "" {
+			field = "-"
+		}
+		fmt.Printf("  row %d\t%s\t%s\n", e.Row, field, e.Message)
+	}
+}
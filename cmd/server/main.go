@@ -1,23 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 
 	_ "github.com/idkOybek/docs"
+	"github.com/idkOybek/internal/config"
 	"github.com/idkOybek/internal/handlers"
+	"github.com/idkOybek/internal/health"
 	"github.com/idkOybek/internal/logger"
 	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/migrate"
+	"github.com/idkOybek/internal/ofd"
 	"github.com/idkOybek/internal/repository"
 	"github.com/idkOybek/internal/services"
 	"github.com/idkOybek/internal/utils"
+	"github.com/idkOybek/migrations"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+// readinessTimeout ограничивает время всех проверок /readyz
+const readinessTimeout = 5 * time.Second
+
 // @title New Terminal API
 // @version 1.0
 // @description This is a new terminal API server.
@@ -39,54 +52,167 @@ import (
 func main() {
 	logger.InitLogger()
 
-	err := godotenv.Load()
+	// .env необязателен: в окружении развёртывания переменные задаются напрямую
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.ErrorLogger.Fatalf("Error loading .env file: %v", err)
+	}
+
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		logger.ErrorLogger.Fatal("Error loading .env file")
+		logger.ErrorLogger.Fatalf("Configuration error: %v", err)
 	}
+	logger.InfoLogger.Printf("Effective configuration:\n%s", cfg.Redacted())
 
-	db, err := repository.NewPostgresDB()
+	utils.SetJWTSecret(cfg.Auth.JWTSecret)
+
+	db, err := repository.NewPostgresDB(cfg.Database)
 	if err != nil {
 		logger.ErrorLogger.Fatalf("Could not connect to the database: %v", err)
 	}
 
+	migrator, err := migrate.NewRunner(db, migrations.FS)
+	if err != nil {
+		logger.ErrorLogger.Fatalf("Could not load migrations: %v", err)
+	}
+
+	// server [flags] migrate up|down|status|to N|force N
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(context.Background(), migrator, args[1:]); err != nil {
+			logger.ErrorLogger.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	// server [flags] import terminals|fiscal_modules [-dry-run] FILE
+	if len(args) > 0 && args[0] == "import" {
+		importService := services.NewImportService(repository.NewImportRepository(db))
+		if err := runImport(context.Background(), importService, args[1:]); err != nil {
+			logger.ErrorLogger.Fatalf("Import failed: %v", err)
+		}
+		return
+	}
+	if len(args) > 0 {
+		logger.ErrorLogger.Fatalf("Unknown command %q", args[0])
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.ErrorLogger.Fatalf("Could not apply migrations: %v", err)
+		}
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	fiscalRepo := repository.NewFiscalRepository(db)
 	terminalRepo := repository.NewTerminalRepository(db)
-
-	authService := services.NewAuthService(userRepo)
-	userService := services.NewUserService(userRepo)
+	sessionRepo := repository.NewSessionRepository(db)
+	receiptRepo := repository.NewReceiptRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	taxIDRepo := repository.NewTaxIDRepository(db)
+	companyRepo := repository.NewCompanyRepository(db)
+	unitOfWork := services.NewSQLUnitOfWork(repository.NewUnitOfWork(db))
+
+	authService := services.NewAuthService(userRepo, sessionRepo, cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	userService := services.NewUserService(userRepo, authService, unitOfWork)
 	fiscalService := services.NewFiscalService(fiscalRepo)
-	terminalService := services.NewTerminalService(terminalRepo, fiscalService)
+	terminalService := services.NewTerminalService(terminalRepo, fiscalService, unitOfWork)
+	receiptService := services.NewReceiptService(receiptRepo, fiscalService)
+	ofdService := services.NewOFDService(outboxRepo)
+	auditService := services.NewAuditService(auditRepo)
+	importService := services.NewImportService(importRepo)
+	taxIDService := services.NewTaxIDService(taxIDRepo)
+	companyService := services.NewCompanyService(companyRepo, terminalService, fiscalService)
+
+	// Готовность: база доступна, схема на последней миграции, фоновые обработчики не зависли
+	checker := health.NewChecker(readinessTimeout)
+	checker.Add("database", db.PingContext)
+	checker.Add("migrations", migrator.Verify)
+
+	bg := newWorkers()
+	sweeperHeartbeat := health.NewHeartbeat(3 * cfg.Terminals.SweepInterval)
+	checker.Add("offline_sweeper", sweeperHeartbeat.Check)
+	bg.Go(func(ctx context.Context) {
+		terminalService.RunOfflineSweeper(ctx, cfg.Terminals.SweepInterval, cfg.Terminals.OfflineWindow, sweeperHeartbeat)
+	})
+
+	if cfg.OFD.Enabled {
+		dispatcher := ofd.NewDispatcher(outboxRepo, ofd.NewHTTPClient(cfg.OFD.URL), ofd.Config{
+			Workers:        cfg.OFD.Workers,
+			BatchSize:      cfg.OFD.BatchSize,
+			PollInterval:   cfg.OFD.PollInterval,
+			RequestTimeout: cfg.OFD.RequestTimeout,
+			MaxAttempts:    cfg.OFD.MaxAttempts,
+			BaseBackoff:    cfg.OFD.BaseBackoff,
+			MaxBackoff:     cfg.OFD.MaxBackoff,
+		})
+		// Отправка отмечается не реже раза в RequestTimeout на документ и запись результата
+		dispatcherHeartbeat := health.NewHeartbeat(3*cfg.OFD.PollInterval + 2*cfg.OFD.RequestTimeout)
+		checker.Add("ofd_dispatcher", dispatcherHeartbeat.Check)
+		bg.Go(func(ctx context.Context) {
+			dispatcher.Run(ctx, dispatcherHeartbeat)
+		})
+	} else {
+		logger.InfoLogger.Printf("OFD delivery is disabled; documents stay queued in ofd_outbox")
+	}
 
 	authHandler := handlers.NewAuthHandler(authService)
 	userHandler := handlers.NewUserHandler(userService)
 	fiscalHandler := handlers.NewFiscalHandler(fiscalService)
 	terminalHandler := handlers.NewTerminalHandler(terminalService)
+	receiptHandler := handlers.NewReceiptHandler(receiptService)
+	ofdHandler := handlers.NewOFDHandler(ofdService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	importHandler := handlers.NewImportHandler(importService)
+	taxIDHandler := handlers.NewTaxIDHandler(taxIDService)
+	companyHandler := handlers.NewCompanyHandler(companyService)
+	healthHandler := handlers.NewHealthHandler(checker)
 
 	r := chi.NewRouter()
+	r.Use(chiMiddleware.RequestID)
+	r.Use(middleware.RequestInfo)
 	r.Use(chiMiddleware.Logger)
 	r.Use(chiMiddleware.Recoverer)
 	r.Use(utils.JSONMiddleware)
-	r.Use(middleware.CORSMiddleware)
+	r.Use(middleware.CORSMiddleware(cfg.CORS.AllowedOrigins))
 	r.Use(utils.LoggerMiddleware)
 
+	authenticate := middleware.AuthMiddleware(authService)
+
 	r.Route("/api", func(r chi.Router) {
-		r.Mount("/auth", authHandler.AuthRoutes())
+		r.Mount("/auth", authHandler.AuthRoutes(authenticate))
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware)
+			r.Use(authenticate)
 			r.Mount("/users", userHandler.Routes())
 			r.Mount("/fiscal", fiscalHandler.Routes())
 			r.Mount("/terminal", terminalHandler.Routes())
+			r.Mount("/receipts", receiptHandler.Routes())
+			r.Mount("/ofd", ofdHandler.Routes())
+			r.Mount("/audit", auditHandler.Routes())
+			r.Mount("/imports", importHandler.Routes())
+			r.Mount("/tax-ids", taxIDHandler.Routes())
+			r.Mount("/companies", companyHandler.Routes())
 		})
 	})
 
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
 
-	port := os.Getenv("SERVER_PORT")
-	if port == "" {
-		port = "8080"
+	// Пробы обслуживаются до журналирования и прочих middleware
+	root := chi.NewRouter()
+	root.Get("/healthz", healthHandler.Healthz)
+	root.Get("/readyz", healthHandler.Readyz)
+	root.Mount("/", r)
+
+	server := &http.Server{
+		Addr:         ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:      root,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
-
-	logger.InfoLogger.Printf("Server starting on port %s", port)
-	logger.ErrorLogger.Fatal(http.ListenAndServe(":"+port, r))
+	if err := serve(server, bg, cfg.Server.ShutdownTimeout); err != nil {
+		db.Close()
+		logger.ErrorLogger.Fatalf("Server stopped with error: %v", err)
+	}
+	db.Close()
+	logger.InfoLogger.Printf("Server stopped")
 }
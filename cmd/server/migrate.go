@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/idkOybek/internal/migrate"
+)
+
+const migrateUsage = "usage: migrate up|down|status|to N|force N"
+
+// runMigrate выполняет подкоманду migrate
+func runMigrate(ctx context.Context, runner *migrate.Runner, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		return runner.Up(ctx)
+	case "down":
+		return runner.Down(ctx)
+	case "status":
+		status, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(status)
+		return nil
+	case "to", "force":
+		if len(args) != 2 {
+			return fmt.Errorf(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if args[0] == "force" {
+			return runner.Force(ctx, version)
+		}
+		return runner.To(ctx, version)
+	default:
+		return fmt.Errorf("unknown migrate command %q; %s", args[0], migrateUsage)
+	}
+}
+
+func printStatus(status *migrate.Status) {
+	state := "clean"
+	if status.Dirty {
+		state = "dirty"
+	}
+	fmt.Printf("Current version: %d (%s)\n", status.Version, state)
+	for _, m := range status.Migrations {
+		mark := "pending"
+		switch {
+		case m.Version == status.Version && status.Dirty:
+			mark = "dirty"
+		case m.Version <= status.Version:
+			mark = "applied"
+		}
+		fmt.Printf("  %04d_%s\t%s\n", m.Version, m.Name, mark)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/idkOybek/internal/logger"
+)
+
+// workers — фоновые обработчики сервера с общим контекстом остановки
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// Go запускает обработчик; run должна вернуться после отмены ctx
+func (w *workers) Go(run func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+	}()
+}
+
+// Stop отменяет контекст обработчиков и ждёт их завершения, но не дольше ctx
+func (w *workers) Stop(ctx context.Context) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background workers did not stop: %w", ctx.Err())
+	}
+}
+
+// serve обслуживает запросы до SIGTERM или SIGINT, после чего перестаёт принимать
+// соединения, дожидается начатых запросов и затем останавливает фоновые обработчики.
+// На всю остановку отводится timeout; повторный сигнал завершает процесс сразу.
+func serve(server *http.Server, bg *workers, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	logger.InfoLogger.Printf("Server starting on %s", server.Addr)
+
+	select {
+	case err := <-serverErr:
+		bg.cancel()
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	logger.InfoLogger.Printf("Shutting down: draining connections for up to %s", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		err = fmt.Errorf("draining connections: %w", err)
+	}
+	if stopErr := bg.Stop(shutdownCtx); stopErr != nil {
+		err = errors.Join(err, stopErr)
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Code — стабильный машиночитаемый код ошибки, возвращаемый клиенту
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodePreconditionRequired Code = "precondition_required"
+	CodeInvalidReference     Code = "invalid_reference"
+	CodeValidation           Code = "validation_failed"
+	CodeRequestCanceled      Code = "request_canceled"
+	CodeUnavailable          Code = "service_unavailable"
+	CodeInternal             Code = "internal_error"
+)
+
+// StatusClientClosedRequest — нестандартный статус (nginx) для запросов, отменённых клиентом
+const StatusClientClosedRequest = 499
+
+var codeStatuses = map[Code]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeNotFound:             http.StatusNotFound,
+	CodeConflict:             http.StatusConflict,
+	CodePreconditionFailed:   http.StatusPreconditionFailed,
+	CodePreconditionRequired: http.StatusPreconditionRequired,
+	CodeInvalidReference:     http.StatusUnprocessableEntity,
+	CodeValidation:           http.StatusUnprocessableEntity,
+	CodeRequestCanceled:      StatusClientClosedRequest,
+	CodeUnavailable:          http.StatusServiceUnavailable,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+// FieldError — нарушение правила проверки в одном поле запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error — доменная ошибка с кодом, сообщением для клиента и, при необходимости, полем.
+// Fields перечисляет все нарушения, если проверка запроса нашла их несколько.
+type Error struct {
+	Code    Code
+	Message string
+	Field   string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status возвращает HTTP статус, соответствующий коду ошибки
+func (e *Error) Status() int {
+	return StatusForCode(e.Code)
+}
+
+// New создаёт доменную ошибку
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// NotFound оборачивает err как отсутствие сущности, если err — sql.ErrNoRows;
+// остальные ошибки возвращаются без изменений
+func NotFound(err error, message string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Code: CodeNotFound, Message: message, Err: err}
+	}
+	return err
+}
+
+// StatusForCode возвращает HTTP статус для кода ошибки
+func StatusForCode(code Code) int {
+	if status, ok := codeStatuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus подбирает код ошибки по HTTP статусу
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusPreconditionRequired:
+		return CodePreconditionRequired
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case StatusClientClosedRequest:
+		return CodeRequestCanceled
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Classify приводит произвольную ошибку слоёв ниже к доменной ошибке.
+// Для неизвестных ошибок возвращается internal_error с пустым сообщением.
+func Classify(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &Error{Code: CodeNotFound, Message: "Resource not found", Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: CodeRequestCanceled, Message: "Request canceled", Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeUnavailable, Message: "Request timed out", Err: err}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return &Error{Code: CodeUnavailable, Message: "Database unavailable", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return classifyPostgres(pqErr)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return &Error{Code: CodeUnavailable, Message: "Database unavailable", Err: err}
+	}
+
+	return &Error{Code: CodeInternal, Err: err}
+}
+
+func classifyPostgres(err *pq.Error) *Error {
+	switch err.Code {
+	case "23505": // unique_violation
+		field := constraintField(err.Table, err.Constraint, "_key")
+		return &Error{Code: CodeConflict, Message: field + " already exists", Field: field, Err: err}
+	case "23503": // foreign_key_violation
+		if strings.Contains(err.Detail, "is still referenced") {
+			// Удаление или изменение строки, на которую ссылаются другие таблицы
+			return &Error{Code: CodeConflict, Message: "Resource is still referenced by " + err.Table, Err: err}
+		}
+		field := constraintField(err.Table, err.Constraint, "_fkey")
+		return &Error{Code: CodeInvalidReference, Message: "Referenced " + field + " does not exist", Field: field, Err: err}
+	case "23502": // not_null_violation
+		return &Error{Code: CodeValidation, Message: err.Column + " is required", Field: err.Column, Err: err}
+	case "23514": // check_violation
+		return &Error{Code: CodeValidation, Message: "Constraint " + err.Constraint + " violated", Err: err}
+	case "57014": // query_canceled
+		return &Error{Code: CodeRequestCanceled, Message: "Request canceled", Err: err}
+	}
+
+	switch err.Code.Class() {
+	case "08", "53", "57": // connection exception, insufficient resources, operator intervention
+		return &Error{Code: CodeUnavailable, Message: "Database unavailable", Err: err}
+	}
+	return &Error{Code: CodeInternal, Err: err}
+}
+
+// constraintField извлекает имя столбца из имени ограничения по соглашению Postgres,
+// например terminals_cash_register_number_key -> cash_register_number
+func constraintField(table, constraint, suffix string) string {
+	field := strings.TrimSuffix(constraint, suffix)
+	field = strings.TrimPrefix(field, table+"_")
+	if field == "" {
+		return constraint
+	}
+	return field
+}
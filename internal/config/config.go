@@ -0,0 +1,350 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config — действующая конфигурация сервера. Значения применяются в порядке:
+// значения по умолчанию, YAML файл, переменные окружения, флаги командной строки.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Terminals TerminalsConfig `yaml:"terminals"`
+	OFD       OFDConfig       `yaml:"ofd"`
+}
+
+type ServerConfig struct {
+	Port         int           `yaml:"port"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout ограничивает ожидание незавершённых запросов и фоновых обработчиков при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// AutoMigrate включает применение встроенных миграций при старте сервера
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+type TerminalsConfig struct {
+	OfflineWindow time.Duration `yaml:"offline_window"`
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+// OFDConfig задаёт доставку документов оператору фискальных данных
+type OFDConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	URL            string        `yaml:"url"`
+	Workers        int           `yaml:"workers"`
+	BatchSize      int           `yaml:"batch_size"`
+	PollInterval   time.Duration `yaml:"poll_interval"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	BaseBackoff    time.Duration `yaml:"base_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// Default возвращает конфигурацию по умолчанию. Секреты и учётные данные БД по умолчанию пусты.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "require",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		CORS: CORSConfig{AllowedOrigins: []string{"*"}},
+		Terminals: TerminalsConfig{
+			OfflineWindow: 10 * time.Minute,
+			SweepInterval: time.Minute,
+		},
+		OFD: OFDConfig{
+			Workers:        4,
+			BatchSize:      50,
+			PollInterval:   2 * time.Second,
+			RequestTimeout: 10 * time.Second,
+			MaxAttempts:    12,
+			BaseBackoff:    5 * time.Second,
+			MaxBackoff:     time.Hour,
+		},
+	}
+}
+
+// Load собирает конфигурацию из файла, окружения и флагов args и проверяет её.
+// Путь к файлу задаётся флагом -config или переменной CONFIG_FILE; файл необязателен.
+// Вторым значением возвращаются позиционные аргументы, оставшиеся после флагов.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+	port := fs.Int("port", 0, "HTTP port (overrides SERVER_PORT)")
+	dbHost := fs.String("db-host", "", "database host (overrides DB_HOST)")
+	dbSSLMode := fs.String("db-sslmode", "", "database SSL mode (overrides DB_SSLMODE)")
+	autoMigrate := fs.Bool("migrate", false, "apply pending migrations on startup (overrides DB_AUTO_MIGRATE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+	if *dbHost != "" {
+		cfg.Database.Host = *dbHost
+	}
+	if *dbSSLMode != "" {
+		cfg.Database.SSLMode = *dbSSLMode
+	}
+	if *autoMigrate {
+		cfg.Database.AutoMigrate = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	envString("DB_HOST", &c.Database.Host)
+	envString("DB_USER", &c.Database.User)
+	envString("DB_PASSWORD", &c.Database.Password)
+	envString("DB_NAME", &c.Database.Name)
+	envString("DB_SSLMODE", &c.Database.SSLMode)
+	envString("JWT_SECRET", &c.Auth.JWTSecret)
+	envString("OFD_URL", &c.OFD.URL)
+	errs = append(errs,
+		envInt("SERVER_PORT", &c.Server.Port),
+		envDuration("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout),
+		envDuration("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout),
+		envDuration("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout),
+		envDuration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout),
+		envInt("DB_PORT", &c.Database.Port),
+		envInt("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns),
+		envInt("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns),
+		envDuration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime),
+		envBool("DB_AUTO_MIGRATE", &c.Database.AutoMigrate),
+		envDuration("ACCESS_TOKEN_TTL", &c.Auth.AccessTokenTTL),
+		envDuration("REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL),
+		envDuration("TERMINAL_OFFLINE_WINDOW", &c.Terminals.OfflineWindow),
+		envDuration("TERMINAL_SWEEP_INTERVAL", &c.Terminals.SweepInterval),
+		envBool("OFD_ENABLED", &c.OFD.Enabled),
+		envInt("OFD_WORKERS", &c.OFD.Workers),
+		envInt("OFD_BATCH_SIZE", &c.OFD.BatchSize),
+		envDuration("OFD_POLL_INTERVAL", &c.OFD.PollInterval),
+		envDuration("OFD_REQUEST_TIMEOUT", &c.OFD.RequestTimeout),
+		envInt("OFD_MAX_ATTEMPTS", &c.OFD.MaxAttempts),
+		envDuration("OFD_BASE_BACKOFF", &c.OFD.BaseBackoff),
+		envDuration("OFD_MAX_BACKOFF", &c.OFD.MaxBackoff),
+	)
+	if v, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		c.CORS.AllowedOrigins = splitList(v)
+	}
+	return errors.Join(errs...)
+}
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки разом
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port %d is out of range 1-65535", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	check(c.Database.Host != "", "database.host is required")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port %d is out of range 1-65535", c.Database.Port)
+	check(c.Database.User != "", "database.user is required")
+	check(c.Database.Name != "", "database.name is required")
+	check(sslModes[c.Database.SSLMode], "database.sslmode %q is not a valid PostgreSQL SSL mode", c.Database.SSLMode)
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret (JWT_SECRET) is required")
+	check(c.Auth.JWTSecret != "your_secret_key", "auth.jwt_secret must not be the placeholder value")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+
+	check(len(c.CORS.AllowedOrigins) > 0, "cors.allowed_origins must not be empty")
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "",
+			"cors.allowed_origins entry %q must be \"*\" or a scheme://host[:port] origin", origin)
+	}
+
+	check(c.Terminals.OfflineWindow > 0, "terminals.offline_window must be positive")
+	check(c.Terminals.SweepInterval > 0, "terminals.sweep_interval must be positive")
+
+	if c.OFD.Enabled {
+		u, err := url.Parse(c.OFD.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "ofd.url (OFD_URL) must be an http(s) URL when ofd.enabled is set")
+		check(c.OFD.Workers > 0, "ofd.workers must be positive")
+		check(c.OFD.BatchSize > 0, "ofd.batch_size must be positive")
+		check(c.OFD.PollInterval > 0, "ofd.poll_interval must be positive")
+		check(c.OFD.RequestTimeout > 0, "ofd.request_timeout must be positive")
+		check(c.OFD.MaxAttempts > 0, "ofd.max_attempts must be positive")
+		check(c.OFD.BaseBackoff > 0 && c.OFD.BaseBackoff <= c.OFD.MaxBackoff, "ofd.base_backoff must be positive and not exceed ofd.max_backoff")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted возвращает YAML представление конфигурации со скрытыми секретами для журнала
+func (c *Config) Redacted() string {
+	redacted := *c
+	redacted.Database.Password = mask(c.Database.Password)
+	redacted.Auth.JWTSecret = mask(c.Auth.JWTSecret)
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return fmt.Sprintf("<unprintable config: %v>", err)
+	}
+	return string(out)
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+func envString(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+func envInt(key string, dst *int) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not an integer", key, v)
+	}
+	*dst = n
+	return nil
+}
+
+func envBool(key string, dst *bool) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not a boolean", key, v)
+	}
+	*dst = b
+	return nil
+}
+
+func envDuration(key string, dst *time.Duration) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not a duration", key, v)
+	}
+	*dst = d
+	return nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,244 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/handlers"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository/memory"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+// ИНН с верной контрольной цифрой
+const (
+	innAdmin  = "302563852"
+	innDealer = "201000011"
+	innOwner  = "301000028"
+	innOther  = "202000038"
+	innSpare  = "307000049"
+)
+
+const testPassword = "secret-password"
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	logger.InfoLogger.SetOutput(io.Discard)
+	logger.ErrorLogger.SetOutput(io.Discard)
+	log.SetOutput(io.Discard)
+	utils.SetJWTSecret("test-secret")
+	os.Exit(m.Run())
+}
+
+// testEnv — API с маршрутами как в cmd/server поверх хранилища в памяти.
+// Пользователи admin, dealer, owner, other (владелец) и viewer (только чтение)
+// заводятся заранее и уже вошли в систему. Через store тест может менять данные
+// в обход API, например сохранить заведомо неверный ИНН.
+type testEnv struct {
+	router http.Handler
+	store  *memory.Store
+	users  map[string]*models.User
+	tokens map[string]string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	store := memory.NewStore()
+	authService := services.NewAuthService(memory.NewUserRepository(store), memory.NewSessionRepository(store), time.Hour, 24*time.Hour)
+	unitOfWork := memory.NewUnitOfWork(store)
+	userService := services.NewUserService(memory.NewUserRepository(store), authService, unitOfWork)
+	fiscalService := services.NewFiscalService(memory.NewFiscalRepository(store))
+	terminalService := services.NewTerminalService(memory.NewTerminalRepository(store), fiscalService, unitOfWork)
+	receiptService := services.NewReceiptService(memory.NewReceiptRepository(store), fiscalService)
+	ofdService := services.NewOFDService(memory.NewOutboxRepository(store))
+	auditService := services.NewAuditService(memory.NewAuditRepository(store))
+	importService := services.NewImportService(memory.NewImportRepository(store))
+	taxIDService := services.NewTaxIDService(memory.NewTaxIDRepository(store))
+	companyService := services.NewCompanyService(memory.NewCompanyRepository(store), terminalService, fiscalService)
+
+	authenticate := middleware.AuthMiddleware(authService)
+	r := chi.NewRouter()
+	r.Use(middleware.RequestInfo)
+	r.Route("/api", func(r chi.Router) {
+		r.Mount("/auth", handlers.NewAuthHandler(authService).AuthRoutes(authenticate))
+		r.Group(func(r chi.Router) {
+			r.Use(authenticate)
+			r.Mount("/users", handlers.NewUserHandler(userService).Routes())
+			r.Mount("/fiscal", handlers.NewFiscalHandler(fiscalService).Routes())
+			r.Mount("/terminal", handlers.NewTerminalHandler(terminalService).Routes())
+			r.Mount("/receipts", handlers.NewReceiptHandler(receiptService).Routes())
+			r.Mount("/ofd", handlers.NewOFDHandler(ofdService).Routes())
+			r.Mount("/audit", handlers.NewAuditHandler(auditService).Routes())
+			r.Mount("/imports", handlers.NewImportHandler(importService).Routes())
+			r.Mount("/tax-ids", handlers.NewTaxIDHandler(taxIDService).Routes())
+			r.Mount("/companies", handlers.NewCompanyHandler(companyService).Routes())
+		})
+	})
+
+	env := &testEnv{router: r, store: store, users: map[string]*models.User{}, tokens: map[string]string{}}
+	seed := []struct {
+		username string
+		inn      string
+		role     models.Role
+	}{
+		{"admin", innAdmin, models.RoleAdmin},
+		{"dealer", innDealer, models.RoleDealer},
+		{"owner", innOwner, models.RoleOwner},
+		{"other", innOther, models.RoleOwner},
+		{"viewer", innOther, models.RoleReadOnly},
+	}
+	for _, u := range seed {
+		user := &models.User{INN: u.inn, Username: u.username, Password: testPassword, IsActive: true, Role: u.role}
+		if err := userService.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("seeding user %s: %v", u.username, err)
+		}
+		env.users[u.username] = user
+		env.tokens[u.username] = env.login(t, u.username, testPassword).AccessToken
+	}
+	return env
+}
+
+// login входит под username и возвращает выданные токены
+func (e *testEnv) login(t *testing.T, username, password string) models.UserLoginResponse {
+	t.Helper()
+	rec := e.do(http.MethodPost, "/api/auth/login", "", map[string]string{"username": username, "password": password}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login %s: status %d: %s", username, rec.Code, rec.Body)
+	}
+	return decode[models.UserLoginResponse](t, rec)
+}
+
+// userPath возвращает путь ресурса с ID пользователя username
+func (e *testEnv) userPath(format, username string) string {
+	return fmt.Sprintf(format, e.users[username].ID)
+}
+
+// do выполняет запрос с токеном доступа token. Строковое тело передаётся как есть,
+// остальные значения кодируются в JSON.
+func (e *testEnv) do(method, path, token string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			panic(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// apiCase — один запрос сценария и ожидаемый ответ
+type apiCase struct {
+	name    string
+	as      string // пользователь, от имени которого идёт запрос; пусто — без токена
+	method  string
+	path    string
+	body    interface{}
+	ifMatch int // версия для If-Match; 0 — без заголовка
+	status  int
+	check   func(t *testing.T, rec *httptest.ResponseRecorder)
+}
+
+// run выполняет запросы по порядку: каждый следующий видит изменения предыдущих
+func (e *testEnv) run(t *testing.T, cases []apiCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.ifMatch != 0 {
+				header.Set("If-Match", strconv.Quote(strconv.Itoa(tc.ifMatch)))
+			}
+			rec := e.do(tc.method, tc.path, e.tokens[tc.as], tc.body, header)
+			if rec.Code != tc.status {
+				t.Fatalf("%s %s: status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.status, rec.Body)
+			}
+			if tc.check != nil {
+				tc.check(t, rec)
+			}
+		})
+	}
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %T from %s: %v", v, rec.Body, err)
+	}
+	return v
+}
+
+// expectError проверяет код ошибки и поле, к которому она относится
+func expectError(code apperrors.Code, field string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		resp := decode[utils.ErrorResponse](t, rec)
+		if resp.Code != code || resp.Field != field {
+			t.Errorf("error code %q field %q, want %q field %q (%s)", resp.Code, resp.Field, code, field, resp.Error)
+		}
+	}
+}
+
+// expectETag проверяет, что ответ несёт версию записи version
+func expectETag(version int) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if got, want := rec.Header().Get("ETag"), strconv.Quote(strconv.Itoa(version)); got != want {
+			t.Errorf("ETag %s, want %s", got, want)
+		}
+	}
+}
+
+// expectTotal проверяет число записей страницы и общее число записей списка
+func expectTotal[T any](items, total int) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		page := decode[struct {
+			Items []T `json:"items"`
+			Total int `json:"total"`
+		}](t, rec)
+		if len(page.Items) != items || page.Total != total {
+			t.Errorf("got %d items of %d, want %d of %d", len(page.Items), page.Total, items, total)
+		}
+	}
+}
+
+// all объединяет проверки ответа
+func all(checks ...func(t *testing.T, rec *httptest.ResponseRecorder)) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		for _, check := range checks {
+			check(t, rec)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// @Summary Get audit log
+// @Description Keyset-paginated log of create, update and delete operations on users, terminals, fiscal modules and companies. Each record holds only the changed fields with their old and new values; passwords are masked.
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, created_at)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param entity_type query string false "Entity type" Enums(user, terminal, fiscal_module, company)
+// @Param entity_id query int false "Entity ID"
+// @Param actor_id query int false "ID of the user who made the change"
+// @Param from query string false "Changed at or after (RFC 3339)"
+// @Param to query string false "Changed before (RFC 3339)"
+// @Success 200 {object} models.AuditRecordList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /audit [get]
+func (h *AuditHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid audit log parameters: %v", err)
+		return
+	}
+
+	records, err := h.service.ListRecords(r.Context(), filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve audit log")
+		logger.ErrorLogger.Printf("Error in GetAuditLog handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, records)
+}
+
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		EntityType: models.AuditEntity(r.URL.Query().Get("entity_type")),
+	}
+	if filter.EntityType != "" && !filter.EntityType.Valid() {
+		return filter, fmt.Errorf("invalid entity_type %q", filter.EntityType)
+	}
+
+	var err error
+	if filter.ListParams, err = parseListParams(r); err != nil {
+		return filter, err
+	}
+	if filter.EntityID, err = queryInt(r, "entity_id"); err != nil {
+		return filter, err
+	}
+	if filter.ActorID, err = queryInt(r, "actor_id"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = queryTime(r, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(r, "to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func (h *AuditHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequirePermission(models.PermAuditRead))
+	r.Get("/", h.GetAuditLog)
+
+	return r
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkOybek/internal/models"
+)
+
+func TestAuditRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.users["owner"].ID
+	env.run(t, []apiCase{
+		// Создание пользователей и их компаний при заполнении окружения
+		{name: "list seeded", as: "admin", method: http.MethodGet, path: "/api/audit/", status: http.StatusOK, check: expectTotal[models.AuditRecord](9, 9)},
+		{name: "list companies", as: "admin", method: http.MethodGet, path: "/api/audit/?entity_type=company", status: http.StatusOK, check: expectTotal[models.AuditRecord](4, 4)},
+
+		{name: "change password", as: "admin", method: http.MethodPatch, path: env.userPath("/api/users/%d", "owner"), body: map[string]string{"password": "n3w-secret"}, ifMatch: 1, status: http.StatusOK},
+		{name: "create module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		{
+			name: "list by user", as: "admin", method: http.MethodGet, path: env.userPath("/api/audit/?entity_type=user&entity_id=%d&sort=id&order=desc", "owner"), status: http.StatusOK,
+			check: all(expectTotal[models.AuditRecord](2, 2), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				update := decode[models.AuditRecordList](t, rec).Items[0]
+				password, ok := update.Changes["password"]
+				if update.Action != models.AuditUpdate || !ok || password.Old != "******" || password.New != "******" {
+					t.Errorf("unexpected record %+v", update)
+				}
+				if update.ActorID == nil || *update.ActorID != env.users["admin"].ID {
+					t.Errorf("actor %v, want admin", update.ActorID)
+				}
+			}),
+		},
+		{name: "list by actor", as: "admin", method: http.MethodGet, path: env.userPath("/api/audit/?actor_id=%d", "admin"), status: http.StatusOK, check: expectTotal[models.AuditRecord](2, 2)},
+		{name: "list fiscal modules", as: "admin", method: http.MethodGet, path: "/api/audit/?entity_type=fiscal_module", status: http.StatusOK, check: expectTotal[models.AuditRecord](1, 1)},
+		{name: "list changed after", as: "admin", method: http.MethodGet, path: "/api/audit/?from=2100-01-01T00:00:00Z", status: http.StatusOK, check: expectTotal[models.AuditRecord](0, 0)},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/audit/?limit=3&sort=created_at&order=desc", status: http.StatusOK, check: expectTotal[models.AuditRecord](3, 11)},
+		{name: "list invalid entity type", as: "admin", method: http.MethodGet, path: "/api/audit/?entity_type=receipt", status: http.StatusBadRequest},
+		{name: "list invalid entity ID", as: "admin", method: http.MethodGet, path: "/api/audit/?entity_id=x", status: http.StatusBadRequest},
+		{name: "list invalid time", as: "admin", method: http.MethodGet, path: "/api/audit/?to=yesterday", status: http.StatusBadRequest},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/audit/?sort=action", status: http.StatusBadRequest},
+		{name: "forbidden for dealer", as: "dealer", method: http.MethodGet, path: "/api/audit/", status: http.StatusForbidden},
+		{name: "forbidden for owner", as: "owner", method: http.MethodGet, path: "/api/audit/", status: http.StatusForbidden},
+		{name: "unauthenticated", method: http.MethodGet, path: "/api/audit/", status: http.StatusUnauthorized},
+	})
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
 	"github.com/idkOybek/internal/models"
 	"github.com/idkOybek/internal/services"
 	"github.com/idkOybek/internal/utils"
@@ -20,75 +20,157 @@ func NewAuthHandler(service *services.AuthService) *AuthHandler {
 }
 
 // @Summary Register a new user
+// @Description Registers an owner. is_admin and role are not accepted and are rejected as unknown fields.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body models.UserRegistrationRequest true "User registration request"
-// @Success 201 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 201 {object} models.UserResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var userReq models.UserRegistrationRequest
-	if err := json.NewDecoder(r.Body).Decode(&userReq); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding user registration request: %v", err)
+	if !decodeRequest(w, r, &userReq) {
 		return
 	}
 
-	user := models.User{
+	user := &models.User{
 		INN:      userReq.INN,
 		Username: userReq.Username,
 		Password: userReq.Password,
 		IsActive: userReq.IsActive,
-		IsAdmin:  userReq.IsAdmin,
 	}
 
 	if err := h.service.RegisterUser(r.Context(), user); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to register user")
+		utils.RespondWithAppError(w, err, "Failed to register user")
 		logger.ErrorLogger.Printf("Error registering user: %v", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, user)
+	utils.RespondWithJSON(w, http.StatusCreated, models.NewUserResponse(user))
 }
 
 // @Summary Authenticate a user
+// @Description Opens a new session and returns a short-lived access token with a rotating refresh token
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body models.UserLoginRequest true "User login request"
 // @Success 200 {object} models.UserLoginResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var creds models.UserLoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding login request: %v", err)
+	if !decodeRequest(w, r, &creds) {
 		return
 	}
 
-	user, token, err := h.service.AuthenticateUser(r.Context(), creds.Username, creds.Password)
+	client := models.Session{UserAgent: r.UserAgent(), IP: r.RemoteAddr}
+	user, tokens, err := h.service.AuthenticateUser(r.Context(), creds.Username, creds.Password, client)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		utils.RespondWithAppError(w, err, "Failed to authenticate user")
 		logger.ErrorLogger.Printf("Error authenticating user: %v", err)
 		return
 	}
 
 	response := models.UserLoginResponse{
-		User:  *user,
-		Token: token,
+		User:      models.NewUserResponse(user),
+		TokenPair: *tokens,
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
-func (h *AuthHandler) AuthRoutes() chi.Router {
+// @Summary Refresh access token
+// @Description Exchanges a refresh token for a new token pair; the presented refresh token stops working
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to refresh token")
+		logger.ErrorLogger.Printf("Error refreshing token: %v", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, tokens)
+}
+
+// @Summary Log out
+// @Description Revokes the session of the presented access token
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUserFromContext(r.Context())
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	if err := h.service.Logout(r.Context(), sessionID, user.ID); err != nil {
+		utils.RespondWithAppError(w, err, "Failed to log out")
+		logger.ErrorLogger.Printf("Error logging out session %d: %v", sessionID, err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// @Summary Log out everywhere
+// @Description Revokes every session of the current user
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUserFromContext(r.Context())
+
+	revoked, err := h.service.LogoutEverywhere(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to log out")
+		logger.ErrorLogger.Printf("Error revoking sessions of user %d: %v", user.ID, err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]int64{"revoked_sessions": revoked})
+}
+
+// AuthRoutes возвращает маршруты аутентификации; authenticate защищает выход из сессий
+func (h *AuthHandler) AuthRoutes(authenticate func(http.Handler) http.Handler) chi.Router {
 	r := chi.NewRouter()
 	r.Post("/register", h.Register)
 	r.Post("/login", h.Login)
+	r.Post("/refresh", h.Refresh)
+	r.Group(func(r chi.Router) {
+		r.Use(authenticate)
+		r.Post("/logout", h.Logout)
+		r.Post("/logout-all", h.LogoutEverywhere)
+	})
 	return r
 }
@@ -0,0 +1,156 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+func TestAuthRegisterAndLogin(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, []apiCase{
+		{
+			name: "register creates an owner", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": innSpare, "username": "newcomer", "password": "pw", "is_active": true},
+			status: http.StatusCreated,
+			check: all(expectNoPassword, func(t *testing.T, rec *httptest.ResponseRecorder) {
+				user := decode[models.UserResponse](t, rec)
+				if user.Role != models.RoleOwner || user.IsAdmin {
+					t.Errorf("registered with role %q admin %v, want owner", user.Role, user.IsAdmin)
+				}
+			}),
+		},
+		{
+			name: "register rejects requested admin flag", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": innSpare, "username": "sneaky", "password": "pw", "is_admin": true},
+			status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, ""),
+		},
+		{
+			name: "register rejects requested role", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": innSpare, "username": "sneaky", "password": "pw", "role": "admin"},
+			status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, ""),
+		},
+		{
+			name: "register duplicate username", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": innSpare, "username": "newcomer", "password": "pw"},
+			status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "username"),
+		},
+		{
+			name: "register invalid INN checksum", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": "302563851", "username": "bad-inn", "password": "pw"},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "inn"),
+		},
+		{
+			name: "register missing fields", method: http.MethodPost, path: "/api/auth/register",
+			body:   map[string]interface{}{"inn": innSpare},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "username"),
+		},
+		{
+			name: "login registered user", method: http.MethodPost, path: "/api/auth/login",
+			body:   map[string]string{"username": "newcomer", "password": "pw"},
+			status: http.StatusOK,
+			check: all(expectNoPassword, func(t *testing.T, rec *httptest.ResponseRecorder) {
+				resp := decode[models.UserLoginResponse](t, rec)
+				if resp.AccessToken == "" || resp.RefreshToken == "" || resp.ExpiresAt.IsZero() {
+					t.Errorf("incomplete token pair: %+v", resp.TokenPair)
+				}
+			}),
+		},
+		{
+			name: "login wrong password", method: http.MethodPost, path: "/api/auth/login",
+			body:   map[string]string{"username": "newcomer", "password": "wrong"},
+			status: http.StatusUnauthorized, check: expectError(apperrors.CodeUnauthorized, ""),
+		},
+		{
+			name: "login unknown user", method: http.MethodPost, path: "/api/auth/login",
+			body:   map[string]string{"username": "nobody", "password": "pw"},
+			status: http.StatusUnauthorized, check: expectError(apperrors.CodeUnauthorized, ""),
+		},
+		{
+			name: "login unknown field", method: http.MethodPost, path: "/api/auth/login",
+			body:   map[string]string{"username": "newcomer", "password": "pw", "remember": "yes"},
+			status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, ""),
+		},
+		{
+			name: "login malformed JSON", method: http.MethodPost, path: "/api/auth/login",
+			body:   `{"username":`,
+			status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, ""),
+		},
+		{
+			name: "deactivate user", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]bool{"is_active": false}, ifMatch: 1, status: http.StatusOK,
+		},
+		{
+			name: "login deactivated user", method: http.MethodPost, path: "/api/auth/login",
+			body:   map[string]string{"username": "newcomer", "password": "pw"},
+			status: http.StatusForbidden, check: expectError(apperrors.CodeForbidden, ""),
+		},
+	})
+}
+
+func TestAuthTokens(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.login(t, "owner", testPassword)
+
+	// Обмен refresh токена выдаёт новую пару, а старый токен перестаёт действовать
+	rec := env.do(http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d: %s", rec.Code, rec.Body)
+	}
+	second := decode[models.TokenPair](t, rec)
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	env.tokens["rotated"] = second.AccessToken
+	env.tokens["first"] = first.AccessToken
+	env.tokens["owner-other-session"] = env.tokens["owner"]
+	env.run(t, []apiCase{
+		{name: "no token", method: http.MethodGet, path: "/api/users/3", status: http.StatusUnauthorized},
+		{name: "rotated access token", as: "rotated", method: http.MethodGet, path: "/api/users/3", status: http.StatusOK},
+		{
+			name: "reused refresh token", method: http.MethodPost, path: "/api/auth/refresh",
+			body:   map[string]string{"refresh_token": first.RefreshToken},
+			status: http.StatusUnauthorized, check: expectError(apperrors.CodeUnauthorized, ""),
+		},
+		// Повторное предъявление старого токена отзывает всю сессию
+		{name: "session revoked after reuse", as: "rotated", method: http.MethodGet, path: "/api/users/3", status: http.StatusUnauthorized},
+		{
+			name: "refresh of revoked session", method: http.MethodPost, path: "/api/auth/refresh",
+			body:   map[string]string{"refresh_token": second.RefreshToken},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "refresh without token", method: http.MethodPost, path: "/api/auth/refresh",
+			body:   map[string]string{},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "refresh_token"),
+		},
+		{name: "other session still valid", as: "owner-other-session", method: http.MethodGet, path: "/api/users/3", status: http.StatusOK},
+	})
+}
+
+func TestAuthLogout(t *testing.T) {
+	env := newTestEnv(t)
+	env.tokens["second"] = env.login(t, "owner", testPassword).AccessToken
+	env.tokens["third"] = env.login(t, "owner", testPassword).AccessToken
+
+	env.run(t, []apiCase{
+		{name: "logout requires token", method: http.MethodPost, path: "/api/auth/logout", status: http.StatusUnauthorized},
+		{name: "logout", as: "owner", method: http.MethodPost, path: "/api/auth/logout", status: http.StatusOK},
+		{name: "logged out token rejected", as: "owner", method: http.MethodGet, path: "/api/users/3", status: http.StatusUnauthorized},
+		{name: "other session unaffected", as: "second", method: http.MethodGet, path: "/api/users/3", status: http.StatusOK},
+		{
+			name: "logout everywhere", as: "second", method: http.MethodPost, path: "/api/auth/logout-all", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if revoked := decode[map[string]int64](t, rec)["revoked_sessions"]; revoked != 2 {
+					t.Errorf("revoked %d sessions, want 2", revoked)
+				}
+			},
+		},
+		{name: "all sessions rejected", as: "third", method: http.MethodGet, path: "/api/users/3", status: http.StatusUnauthorized},
+		{name: "other users unaffected", as: "dealer", method: http.MethodGet, path: "/api/users/2", status: http.StatusOK},
+	})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/utils"
+)
+
+type balanceOperation func(r *http.Request, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error)
+
+// @Summary Get terminal free record balance
+// @Description Returns the current balance together with the full movement ledger
+// @Tags terminal
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {object} models.TerminalBalanceResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/balance [get]
+func (h *TerminalHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		logger.ErrorLogger.Printf("Invalid terminal ID: %v", err)
+		return
+	}
+
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return
+	}
+
+	balance, err := h.service.GetBalance(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve balance")
+		logger.ErrorLogger.Printf("Error in GetBalance handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, balance)
+}
+
+// @Summary Top up terminal free record balance
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.BalanceChangeRequest true "Number of records to add"
+// @Success 200 {object} models.BalanceMovement
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/balance/top-up [post]
+func (h *TerminalHandler) TopUpBalance(w http.ResponseWriter, r *http.Request) {
+	h.changeBalance(w, r, func(r *http.Request, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+		return h.service.TopUp(r.Context(), terminalID, amount, actorID, reason)
+	})
+}
+
+// @Summary Consume terminal free records
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.BalanceChangeRequest true "Number of records to consume"
+// @Success 200 {object} models.BalanceMovement
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/balance/consume [post]
+func (h *TerminalHandler) ConsumeBalance(w http.ResponseWriter, r *http.Request) {
+	h.changeBalance(w, r, func(r *http.Request, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+		return h.service.Consume(r.Context(), terminalID, amount, actorID, reason)
+	})
+}
+
+// @Summary Correct terminal free record balance
+// @Description Amount is a signed delta; the resulting balance may not be negative
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.BalanceChangeRequest true "Signed correction"
+// @Success 200 {object} models.BalanceMovement
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/balance/adjust [post]
+func (h *TerminalHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
+	h.changeBalance(w, r, func(r *http.Request, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+		return h.service.Adjust(r.Context(), terminalID, amount, actorID, reason)
+	})
+}
+
+func (h *TerminalHandler) changeBalance(w http.ResponseWriter, r *http.Request, apply balanceOperation) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		logger.ErrorLogger.Printf("Invalid terminal ID: %v", err)
+		return
+	}
+
+	var req models.BalanceChangeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return
+	}
+
+	movement, err := apply(r, id, req.Amount, actorID(r), req.Reason)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to change balance")
+		logger.ErrorLogger.Printf("Error changing balance of terminal %d: %v", id, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, movement)
+}
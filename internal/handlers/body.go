@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/utils"
+	"github.com/idkOybek/internal/validate"
+)
+
+// decodeJSON читает тело запроса в dst. Неизвестные поля и данные после объекта
+// отклоняются, чтобы опечатка в имени поля не проходила незамеченной.
+// При ошибке ответ уже отправлен.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errors.New("unexpected data after JSON object")
+		}
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload: "+strings.TrimPrefix(err.Error(), "json: "))
+		logger.ErrorLogger.Printf("Error decoding %T: %v", dst, err)
+		return false
+	}
+	return true
+}
+
+// validateRequest проверяет dst по правилам тегов validate и при нарушениях отвечает
+// 422 со списком ошибок по полям
+func validateRequest(w http.ResponseWriter, dst interface{}) bool {
+	if err := validate.Struct(dst); err != nil {
+		utils.RespondWithAppError(w, err, validate.Message)
+		logger.ErrorLogger.Printf("Invalid %T: %v", dst, err)
+		return false
+	}
+	return true
+}
+
+// decodeRequest читает тело запроса в dst и проверяет его. При ошибке ответ уже отправлен.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSON(w, r, dst) && validateRequest(w, dst)
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+type CompanyHandler struct {
+	service *services.CompanyService
+}
+
+func NewCompanyHandler(service *services.CompanyService) *CompanyHandler {
+	return &CompanyHandler{service: service}
+}
+
+// @Summary Get all companies
+// @Description Keyset-paginated list; non-admin users only see their own company and the companies of their terminals
+// @Tags company
+// @Security BearerAuth
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, inn, legal_name)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param inn query string false "Exact INN"
+// @Param legal_name query string false "Legal name substring"
+// @Param vat_payer query bool false "VAT payer flag"
+// @Success 200 {object} models.CompanyList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies [get]
+func (h *CompanyHandler) GetAllCompanies(w http.ResponseWriter, r *http.Request) {
+	filter := models.CompanyFilter{
+		INN:       r.URL.Query().Get("inn"),
+		LegalName: r.URL.Query().Get("legal_name"),
+		UserID:    ownerScope(r),
+	}
+	var err error
+	if filter.ListParams, err = parseListParams(r); err == nil {
+		filter.VATPayer, err = queryBool(r, "vat_payer")
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid company list parameters: %v", err)
+		return
+	}
+
+	companies, err := h.service.ListCompanies(r.Context(), filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve companies")
+		logger.ErrorLogger.Printf("Error in GetAllCompanies handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, companies)
+}
+
+// @Summary Get company by ID
+// @Tags company
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Company ID"
+// @Success 200 {object} models.Company
+// @Header 200 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies/{id} [get]
+func (h *CompanyHandler) GetCompanyByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := companyID(w, r)
+	if !ok {
+		return
+	}
+	company, ok := h.authorizeCompany(w, r, id)
+	if !ok {
+		return
+	}
+	setETag(w, company.Version)
+	utils.RespondWithJSON(w, http.StatusOK, company)
+}
+
+// @Summary Create a new company
+// @Tags company
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param company body models.Company true "New company data"
+// @Success 201 {object} models.Company
+// @Header 201 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies [post]
+func (h *CompanyHandler) CreateCompany(w http.ResponseWriter, r *http.Request) {
+	var company models.Company
+	if !decodeRequest(w, r, &company) {
+		return
+	}
+
+	if err := h.service.CreateCompany(r.Context(), &company); err != nil {
+		utils.RespondWithAppError(w, err, "Failed to create company")
+		logger.ErrorLogger.Printf("Error in CreateCompany handler: %v", err)
+		return
+	}
+	setETag(w, company.Version)
+	utils.RespondWithJSON(w, http.StatusCreated, company)
+}
+
+// @Summary Update company
+// @Description Partial update: only the fields present in the body are changed. A new INN is carried over to the company's terminals and users. Returns the stored company. Non-admin users may only change a company whose terminals and users all belong to them.
+// @Tags company
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Company ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param company body models.CompanyUpdateRequest true "Fields to change"
+// @Success 200 {object} models.Company
+// @Header 200 {string} ETag "Version of the stored record"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies/{id} [patch]
+// @Router /companies/{id} [put]
+func (h *CompanyHandler) UpdateCompany(w http.ResponseWriter, r *http.Request) {
+	id, ok := companyID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var patch models.CompanyUpdateRequest
+	if !decodeRequest(w, r, &patch) {
+		return
+	}
+
+	if _, ok := h.authorizeCompanyChange(w, r, id); !ok {
+		return
+	}
+
+	company, err := h.service.UpdateCompany(r.Context(), id, version, &patch)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to update company")
+		logger.ErrorLogger.Printf("Error in UpdateCompany handler: %v", err)
+		return
+	}
+	setETag(w, company.Version)
+	utils.RespondWithJSON(w, http.StatusOK, company)
+}
+
+// @Summary Delete company
+// @Description A company that still has terminals or users cannot be deleted. Non-admin users may only delete a company whose terminals and users all belong to them.
+// @Tags company
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Company ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies/{id} [delete]
+func (h *CompanyHandler) DeleteCompany(w http.ResponseWriter, r *http.Request) {
+	id, ok := companyID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.authorizeCompanyChange(w, r, id); !ok {
+		return
+	}
+
+	if err := h.service.DeleteCompany(r.Context(), id, version); err != nil {
+		utils.RespondWithAppError(w, err, "Failed to delete company")
+		logger.ErrorLogger.Printf("Error in DeleteCompany handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, "Company deleted")
+}
+
+// @Summary Get company terminals
+// @Description Keyset-paginated list of the company's terminals; non-admin users only see their own terminals
+// @Tags company
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Company ID"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, inn, company_name, cash_register_number, free_record_balance, last_request_date)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param status query string false "Status" Enums(registered, active, suspended, blocked, decommissioned)
+// @Param user_id query int false "Owner user ID"
+// @Param is_online query bool false "Online flag"
+// @Param last_request_from query string false "Last request not before (RFC 3339)"
+// @Param last_request_to query string false "Last request before (RFC 3339)"
+// @Success 200 {object} models.TerminalList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies/{id}/terminals [get]
+func (h *CompanyHandler) GetCompanyTerminals(w http.ResponseWriter, r *http.Request) {
+	id, ok := companyID(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseTerminalFilter(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid company terminal list parameters: %v", err)
+		return
+	}
+	if _, ok := h.authorizeCompany(w, r, id); !ok {
+		return
+	}
+	if userID := ownerScope(r); userID != nil {
+		filter.UserID = userID
+	}
+
+	terminals, err := h.service.ListTerminals(r.Context(), id, filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve company terminals")
+		logger.ErrorLogger.Printf("Error in GetCompanyTerminals handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, terminals)
+}
+
+// @Summary Get company fiscal modules
+// @Description Keyset-paginated list of the fiscal modules bound to the company's terminals; non-admin users only see their own fiscal modules
+// @Tags company
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Company ID"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, factory_number, fiscal_number)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param user_id query int false "Owner user ID"
+// @Param factory_number query string false "Factory number substring"
+// @Param fiscal_number query string false "Fiscal number substring"
+// @Success 200 {object} models.FiscalModuleList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /companies/{id}/fiscal-modules [get]
+func (h *CompanyHandler) GetCompanyFiscalModules(w http.ResponseWriter, r *http.Request) {
+	id, ok := companyID(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseFiscalModuleFilter(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid company fiscal module list parameters: %v", err)
+		return
+	}
+	if _, ok := h.authorizeCompany(w, r, id); !ok {
+		return
+	}
+	if userID := ownerScope(r); userID != nil {
+		filter.UserID = userID
+	}
+
+	modules, err := h.service.ListFiscalModules(r.Context(), id, filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve company fiscal modules")
+		logger.ErrorLogger.Printf("Error in GetCompanyFiscalModules handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, modules)
+}
+
+func companyID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid company ID")
+		logger.ErrorLogger.Printf("Invalid company ID: %v", err)
+		return 0, false
+	}
+	return id, true
+}
+
+// authorizeCompany загружает компанию и проверяет, что текущий пользователь вправе
+// её читать: администратор — любую, остальные — только связанную с ними.
+// При отказе ответ уже отправлен.
+func (h *CompanyHandler) authorizeCompany(w http.ResponseWriter, r *http.Request, id int) (*models.Company, bool) {
+	return h.checkCompany(w, r, id, h.service.IsRelated)
+}
+
+// authorizeCompanyChange проверяет право менять компанию. Смена ИНН переносится на все
+// торговые точки и пользователей компании, поэтому не администратор меняет только
+// компанию, у которой нет других владельцев.
+func (h *CompanyHandler) authorizeCompanyChange(w http.ResponseWriter, r *http.Request, id int) (*models.Company, bool) {
+	return h.checkCompany(w, r, id, h.service.IsSoleOwner)
+}
+
+func (h *CompanyHandler) checkCompany(w http.ResponseWriter, r *http.Request, id int,
+	allowed func(ctx context.Context, company *models.Company, userID int) (bool, error)) (*models.Company, bool) {
+	company, err := h.service.GetCompanyByID(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve company")
+		logger.ErrorLogger.Printf("Error loading company %d: %v", id, err)
+		return nil, false
+	}
+	userID, scoped := middleware.OwnerScope(r.Context())
+	if !scoped {
+		return company, true
+	}
+	ok, err := allowed(r.Context(), company, userID)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve company")
+		logger.ErrorLogger.Printf("Error checking access to company %d: %v", id, err)
+		return nil, false
+	}
+	if !ok {
+		middleware.RespondForbidden(w)
+		return nil, false
+	}
+	return company, true
+}
+
+func (h *CompanyHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.With(middleware.RequirePermission(models.PermCompaniesRead)).Get("/", h.GetAllCompanies)
+	r.With(middleware.RequirePermission(models.PermCompaniesWrite)).Post("/", h.CreateCompany)
+	r.With(middleware.RequirePermission(models.PermCompaniesRead)).Get("/{id}", h.GetCompanyByID)
+	r.With(middleware.RequirePermission(models.PermCompaniesWrite)).Patch("/{id}", h.UpdateCompany)
+	r.With(middleware.RequirePermission(models.PermCompaniesWrite)).Put("/{id}", h.UpdateCompany)
+	r.With(middleware.RequirePermission(models.PermCompaniesWrite)).Delete("/{id}", h.DeleteCompany)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/{id}/terminals", h.GetCompanyTerminals)
+	r.With(middleware.RequirePermission(models.PermFiscalRead)).Get("/{id}/fiscal-modules", h.GetCompanyFiscalModules)
+
+	return r
+}
@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// Свободные ИНН с верной контрольной цифрой
+const (
+	innMoved = "308000052"
+	innEmpty = "300000070"
+)
+
+// expectCompany проверяет ИНН и название компании и её версию в ETag
+func expectCompany(inn, legalName string, version int) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return all(expectETag(version), func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if company := decode[models.Company](t, rec); company.INN != inn || company.LegalName != legalName || company.Version != version {
+			t.Errorf("unexpected company %+v", company)
+		}
+	})
+}
+
+func TestCompanyRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.users["owner"].ID
+	spare := map[string]interface{}{"inn": innSpare, "legal_name": "Spare LLC", "legal_address": "Tashkent", "email": "info@spare.uz"}
+	env.run(t, []apiCase{
+		// Компании пользователей заводятся при их регистрации
+		{name: "list all", as: "admin", method: http.MethodGet, path: "/api/companies/", status: http.StatusOK, check: expectTotal[models.Company](4, 4)},
+		{name: "list scoped to owner", as: "owner", method: http.MethodGet, path: "/api/companies/", status: http.StatusOK, check: expectTotal[models.Company](1, 1)},
+
+		{name: "create", as: "admin", method: http.MethodPost, path: "/api/companies/", body: spare, status: http.StatusCreated, check: expectCompany(innSpare, "Spare LLC", 1)},
+		{name: "create duplicate INN", as: "admin", method: http.MethodPost, path: "/api/companies/", body: spare, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "inn")},
+		{
+			name: "create with invalid INN", as: "admin", method: http.MethodPost, path: "/api/companies/",
+			body: map[string]string{"inn": "302563851", "legal_name": "Bad"}, status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "inn"),
+		},
+		{
+			name: "create without name", as: "admin", method: http.MethodPost, path: "/api/companies/",
+			body: map[string]string{"inn": innEmpty}, status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "legal_name"),
+		},
+		{name: "create forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/companies/", body: spare, status: http.StatusForbidden},
+		{name: "get unrelated", as: "owner", method: http.MethodGet, path: "/api/companies/5", status: http.StatusForbidden},
+
+		{name: "create module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "create terminal", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "get related through terminal", as: "owner", method: http.MethodGet, path: "/api/companies/5", status: http.StatusOK, check: expectCompany(innSpare, "Spare LLC", 1)},
+		{name: "list related", as: "owner", method: http.MethodGet, path: "/api/companies/", status: http.StatusOK, check: expectTotal[models.Company](2, 2)},
+		{name: "list by name", as: "admin", method: http.MethodGet, path: "/api/companies/?legal_name=spare", status: http.StatusOK, check: expectTotal[models.Company](1, 1)},
+		{name: "list by INN", as: "admin", method: http.MethodGet, path: "/api/companies/?inn=" + innOwner, status: http.StatusOK, check: expectTotal[models.Company](1, 1)},
+		{name: "list VAT payers", as: "admin", method: http.MethodGet, path: "/api/companies/?vat_payer=true", status: http.StatusOK, check: expectTotal[models.Company](0, 0)},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/companies/?limit=2&sort=inn&order=desc", status: http.StatusOK, check: expectTotal[models.Company](2, 5)},
+		{name: "list invalid VAT flag", as: "admin", method: http.MethodGet, path: "/api/companies/?vat_payer=maybe", status: http.StatusBadRequest},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/companies/?sort=phone", status: http.StatusBadRequest},
+		{name: "terminals", as: "owner", method: http.MethodGet, path: "/api/companies/5/terminals", status: http.StatusOK, check: expectTotal[models.Terminal](1, 1)},
+		{name: "fiscal modules", as: "owner", method: http.MethodGet, path: "/api/companies/5/fiscal-modules", status: http.StatusOK, check: expectTotal[models.FiscalModule](1, 1)},
+		{name: "terminals of unrelated company", as: "other", method: http.MethodGet, path: "/api/companies/5/terminals", status: http.StatusForbidden},
+		{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/companies/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+		{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/companies/x", status: http.StatusBadRequest},
+
+		{name: "update without If-Match", as: "admin", method: http.MethodPatch, path: "/api/companies/5", body: map[string]bool{"vat_payer": true}, status: http.StatusPreconditionRequired},
+		{name: "update forbidden for owner", as: "owner", method: http.MethodPatch, path: "/api/companies/5", body: map[string]bool{"vat_payer": true}, ifMatch: 1, status: http.StatusForbidden},
+		{name: "dealer cannot update unrelated company", as: "dealer", method: http.MethodPatch, path: "/api/companies/5", body: map[string]bool{"vat_payer": true}, ifMatch: 1, status: http.StatusForbidden},
+		{
+			name: "update", as: "admin", method: http.MethodPatch, path: "/api/companies/5",
+			body: map[string]interface{}{"legal_name": "Spare Group", "vat_payer": true}, ifMatch: 1, status: http.StatusOK,
+			check: expectCompany(innSpare, "Spare Group", 2),
+		},
+		{name: "update stale version", as: "admin", method: http.MethodPut, path: "/api/companies/5", body: map[string]string{"phone": "+998"}, ifMatch: 1, status: http.StatusPreconditionFailed},
+		{
+			name: "update to taken INN", as: "admin", method: http.MethodPatch, path: "/api/companies/5",
+			body: map[string]string{"inn": innOwner}, ifMatch: 2, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "inn"),
+		},
+		{
+			name: "update INN", as: "admin", method: http.MethodPatch, path: "/api/companies/5",
+			body: map[string]string{"inn": innMoved}, ifMatch: 2, status: http.StatusOK, check: expectCompany(innMoved, "Spare Group", 3),
+		},
+		{
+			name: "INN moves to terminals", as: "owner", method: http.MethodGet, path: "/api/terminal/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.INN != innMoved || terminal.CompanyName != "Spare Group" {
+					t.Errorf("unexpected terminal %+v", terminal)
+				}
+			},
+		},
+		{name: "list VAT payers after update", as: "admin", method: http.MethodGet, path: "/api/companies/?vat_payer=true", status: http.StatusOK, check: expectTotal[models.Company](1, 1)},
+
+		{name: "delete with terminals", as: "admin", method: http.MethodDelete, path: "/api/companies/5", ifMatch: 3, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "")},
+		{name: "delete with users", as: "admin", method: http.MethodDelete, path: "/api/companies/3", ifMatch: 1, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "")},
+		{name: "create empty", as: "admin", method: http.MethodPost, path: "/api/companies/", body: map[string]string{"inn": innEmpty, "legal_name": "Empty LLC"}, status: http.StatusCreated},
+		{name: "delete without If-Match", as: "admin", method: http.MethodDelete, path: "/api/companies/6", status: http.StatusPreconditionRequired},
+		{name: "delete stale version", as: "admin", method: http.MethodDelete, path: "/api/companies/6", ifMatch: 2, status: http.StatusPreconditionFailed},
+		{name: "delete forbidden for owner", as: "owner", method: http.MethodDelete, path: "/api/companies/6", ifMatch: 1, status: http.StatusForbidden},
+		{name: "delete", as: "admin", method: http.MethodDelete, path: "/api/companies/6", ifMatch: 1, status: http.StatusOK},
+		{name: "get deleted", as: "admin", method: http.MethodGet, path: "/api/companies/6", status: http.StatusNotFound},
+		{name: "delete missing", as: "admin", method: http.MethodDelete, path: "/api/companies/6", ifMatch: 1, status: http.StatusNotFound},
+	})
+}
+
+func TestCompanySharedByOwners(t *testing.T) {
+	env := newTestEnv(t)
+	dealer, owner := env.users["dealer"].ID, env.users["owner"].ID
+	env.run(t, []apiCase{
+		// У компании Spare LLC торговые точки дилера и владельца owner
+		{name: "create dealer module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", dealer), status: http.StatusCreated},
+		{name: "create dealer terminal", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-1", "FN-1", dealer), status: http.StatusCreated},
+		{name: "create owner module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-2", "FN-2", owner), status: http.StatusCreated},
+		{name: "create owner terminal", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-2", "FN-2", owner), status: http.StatusCreated},
+
+		{name: "dealer reads shared company", as: "dealer", method: http.MethodGet, path: "/api/companies/5", status: http.StatusOK, check: expectCompany(innSpare, "Spare LLC", 1)},
+		{
+			name: "dealer cannot change INN of shared company", as: "dealer", method: http.MethodPatch, path: "/api/companies/5",
+			body: map[string]string{"inn": innMoved}, ifMatch: 1, status: http.StatusForbidden,
+		},
+		{
+			name: "dealer cannot rename shared company", as: "dealer", method: http.MethodPut, path: "/api/companies/5",
+			body: map[string]string{"legal_name": "Dealer LLC"}, ifMatch: 1, status: http.StatusForbidden,
+		},
+		{name: "dealer cannot delete shared company", as: "dealer", method: http.MethodDelete, path: "/api/companies/5", ifMatch: 1, status: http.StatusForbidden},
+		{
+			name: "owner terminal keeps INN", as: "owner", method: http.MethodGet, path: "/api/terminal/2", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.INN != innSpare || terminal.CompanyName != "Spare LLC" {
+					t.Errorf("unexpected terminal %+v", terminal)
+				}
+			},
+		},
+
+		// Компанией, у которой нет других владельцев, дилер распоряжается сам
+		{
+			name: "dealer changes own company", as: "dealer", method: http.MethodPatch, path: "/api/companies/2",
+			body: map[string]string{"legal_name": "Dealer LLC"}, ifMatch: 1, status: http.StatusOK, check: expectCompany(innDealer, "Dealer LLC", 2),
+		},
+		{
+			name: "admin changes shared company", as: "admin", method: http.MethodPatch, path: "/api/companies/5",
+			body: map[string]string{"legal_name": "Spare Group"}, ifMatch: 1, status: http.StatusOK, check: expectCompany(innSpare, "Spare Group", 2),
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/utils"
+)
+
+var (
+	// ErrIfMatchRequired возвращается на изменяющий запрос без заголовка If-Match
+	ErrIfMatchRequired = apperrors.New(apperrors.CodePreconditionRequired, "If-Match header with the current ETag is required")
+	// ErrInvalidIfMatch возвращается, если If-Match не содержит ETag, выданный сервером
+	ErrInvalidIfMatch = apperrors.New(apperrors.CodeBadRequest, "If-Match must contain a single ETag returned by the server")
+)
+
+// setETag отдаёт версию записи в заголовке ETag
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion читает из If-Match версию, которую клиент собирается изменить.
+// При отсутствии или неверном формате заголовка ответ уже отправлен.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		utils.RespondWithAppError(w, ErrIfMatchRequired, ErrIfMatchRequired.Message)
+		return 0, false
+	}
+
+	tag, err := strconv.Unquote(strings.TrimPrefix(header, "W/"))
+	if err != nil {
+		utils.RespondWithAppError(w, ErrInvalidIfMatch, ErrInvalidIfMatch.Message)
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		utils.RespondWithAppError(w, ErrInvalidIfMatch, ErrInvalidIfMatch.Message)
+		return 0, false
+	}
+	return version, true
+}
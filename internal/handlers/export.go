@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/tabular"
+	"github.com/idkOybek/internal/utils"
+)
+
+// parseExportParams читает формат выгрузки (по умолчанию csv) и список столбцов через запятую
+func parseExportParams(r *http.Request) (tabular.Format, []string, error) {
+	q := r.URL.Query()
+	format := tabular.Format(q.Get("format"))
+	if format == "" {
+		format = tabular.FormatCSV
+	}
+	if !format.Writable() {
+		return "", nil, fmt.Errorf("invalid format %q, expected csv, xlsx or pdf", format)
+	}
+
+	var columns []string
+	for _, c := range strings.Split(q.Get("columns"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			columns = append(columns, c)
+		}
+	}
+	return format, columns, nil
+}
+
+// exportResponse откладывает заголовки ответа до первой записи файла, чтобы ошибку,
+// возникшую до начала выгрузки, можно было вернуть обычным JSON-ответом
+type exportResponse struct {
+	w        http.ResponseWriter
+	format   tabular.Format
+	fileName string
+	started  bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.format.ContentType())
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.fileName))
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
+
+// serveExport отдаёт результат export файлом name-YYYYMMDD.<format>. Если выгрузка
+// оборвалась после начала ответа, соединение разрывается, чтобы клиент не принял
+// неполный файл за целый. Большая выгрузка может идти дольше таймаута записи сервера,
+// поэтому для её ответа он снимается.
+func serveExport(w http.ResponseWriter, name string, format tabular.Format, export func(out io.Writer) error) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.ErrorLogger.Printf("Error lifting write deadline for %s export: %v", name, err)
+	}
+	resp := &exportResponse{
+		w:        w,
+		format:   format,
+		fileName: fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102"), format),
+	}
+	err := export(resp)
+	if err == nil {
+		return
+	}
+	if !resp.started {
+		utils.RespondWithAppError(w, err, "Export failed")
+		logger.ErrorLogger.Printf("Error exporting %s: %v", name, err)
+		return
+	}
+	logger.ErrorLogger.Printf("Export of %s interrupted: %v", name, err)
+	panic(http.ErrAbortHandler)
+}
@@ -1,14 +1,16 @@
 package handlers
 
 import (
-	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/middleware"
 	"github.com/idkOybek/internal/models"
 	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/tabular"
 	"github.com/idkOybek/internal/utils"
 )
 
@@ -22,33 +24,139 @@ func NewFiscalHandler(service *services.FiscalService) *FiscalHandler {
 
 func (h *FiscalHandler) Routes() chi.Router {
 	r := chi.NewRouter()
-	r.Get("/", h.GetAllFiscalModules)
-	r.Get("/{id}", h.GetFiscalModuleByID)
-	r.Post("/", h.CreateFiscalModule)
-	r.Put("/{id}", h.UpdateFiscalModule)
-	r.Delete("/{id}", h.DeleteFiscalModule)
+	r.With(middleware.RequirePermission(models.PermFiscalRead)).Get("/", h.GetAllFiscalModules)
+	r.With(middleware.RequirePermission(models.PermFiscalRead)).Get("/export", h.ExportFiscalModules)
+	r.With(middleware.RequirePermission(models.PermFiscalRead)).Get("/{id}", h.GetFiscalModuleByID)
+	r.With(middleware.RequirePermission(models.PermFiscalRead)).Get("/{id}/bindings", h.GetFiscalModuleBindings)
+	r.With(middleware.RequirePermission(models.PermFiscalWrite)).Post("/", h.CreateFiscalModule)
+	r.With(middleware.RequirePermission(models.PermFiscalWrite)).Patch("/{id}", h.UpdateFiscalModule)
+	r.With(middleware.RequirePermission(models.PermFiscalWrite)).Put("/{id}", h.UpdateFiscalModule)
+	r.With(middleware.RequirePermission(models.PermFiscalWrite)).Delete("/{id}", h.DeleteFiscalModule)
 	return r
 }
 
-// GetAllFiscalModules обрабатывает запрос на получение всех фискальных модулей
+// authorizeModule загружает фискальный модуль и проверяет, что текущий пользователь
+// вправе с ним работать. При отказе ответ уже отправлен.
+func (h *FiscalHandler) authorizeModule(w http.ResponseWriter, r *http.Request, id int) (*models.FiscalModule, bool) {
+	module, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		log.Printf("Error retrieving fiscal module by ID %d: %v", id, err)
+		utils.RespondWithAppError(w, err, "Could not retrieve fiscal module")
+		return nil, false
+	}
+	if !middleware.CanAccessOwned(r.Context(), module.UserID) {
+		log.Printf("Access to fiscal module %d denied", id)
+		middleware.RespondForbidden(w)
+		return nil, false
+	}
+	return module, true
+}
+
+// assignOwner закрепляет модуль за текущим пользователем, если он не администратор
+func (h *FiscalHandler) assignOwner(w http.ResponseWriter, r *http.Request, userID *int) bool {
+	ownerID, scoped := middleware.OwnerScope(r.Context())
+	if !scoped {
+		return true
+	}
+	if *userID != 0 && *userID != ownerID {
+		log.Printf("Assigning fiscal module to user %d denied", *userID)
+		middleware.RespondForbidden(w)
+		return false
+	}
+	*userID = ownerID
+	return true
+}
+
+// GetAllFiscalModules обрабатывает запрос на получение списка фискальных модулей
 // @Summary Get all fiscal modules
-// @Description Get all fiscal modules
+// @Description Keyset-paginated list; non-admin users only see their own fiscal modules
 // @Tags fiscal
 // @Produce json
-// @Success 200 {array} models.FiscalModuleResponse
-// @Failure 500 {object} map[string]string
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, factory_number, fiscal_number)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param user_id query int false "Owner user ID"
+// @Param factory_number query string false "Factory number substring"
+// @Param fiscal_number query string false "Fiscal number substring"
+// @Success 200 {object} models.FiscalModuleList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /fiscal [get]
 // @Security BearerAuth
 func (h *FiscalHandler) GetAllFiscalModules(w http.ResponseWriter, r *http.Request) {
-	log.Println("Fetching all fiscal modules")
-	fiscalModules, err := h.service.GetAll(r.Context())
+	log.Println("Fetching fiscal modules")
+	filter, err := parseFiscalModuleFilter(r)
+	if err != nil {
+		log.Printf("Invalid fiscal module list parameters: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		filter.UserID = &userID
+	}
+
+	fiscalModules, err := h.service.List(r.Context(), filter)
 	if err != nil {
 		log.Printf("Error retrieving fiscal modules: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not retrieve fiscal modules")
+		utils.RespondWithAppError(w, err, "Could not retrieve fiscal modules")
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, fiscalModules)
-	log.Println("Successfully fetched all fiscal modules")
+	log.Println("Successfully fetched fiscal modules")
+}
+
+func parseFiscalModuleFilter(r *http.Request) (models.FiscalModuleFilter, error) {
+	filter := models.FiscalModuleFilter{
+		FactoryNumber: r.URL.Query().Get("factory_number"),
+		FiscalNumber:  r.URL.Query().Get("fiscal_number"),
+	}
+	var err error
+	if filter.ListParams, err = parseListParams(r); err == nil {
+		filter.UserID, err = queryInt(r, "user_id")
+	}
+	return filter, err
+}
+
+// ExportFiscalModules обрабатывает запрос на выгрузку фискальных модулей в файл
+// @Summary Export fiscal modules
+// @Description Streams all fiscal modules matching the list filters as CSV, XLSX or a printable PDF report, in the requested sort order; limit and cursor are ignored. Non-admin users only export their own fiscal modules.
+// @Tags fiscal
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param format query string false "File format (default csv); pdf is limited to 5000 rows, larger exports return 400" Enums(csv, xlsx, pdf)
+// @Param columns query string false "Comma-separated columns in output order (default all): id, factory_number, fiscal_number, user_id"
+// @Param sort query string false "Sort field" Enums(id, factory_number, fiscal_number)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param user_id query int false "Owner user ID"
+// @Param factory_number query string false "Factory number substring"
+// @Param fiscal_number query string false "Fiscal number substring"
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /fiscal/export [get]
+// @Security BearerAuth
+func (h *FiscalHandler) ExportFiscalModules(w http.ResponseWriter, r *http.Request) {
+	log.Println("Exporting fiscal modules")
+	filter, err := parseFiscalModuleFilter(r)
+	var format tabular.Format
+	var columns []string
+	if err == nil {
+		format, columns, err = parseExportParams(r)
+	}
+	if err != nil {
+		log.Printf("Invalid fiscal module export parameters: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		filter.UserID = &userID
+	}
+
+	serveExport(w, "fiscal-modules", format, func(out io.Writer) error {
+		return h.service.Export(r.Context(), filter, format, columns, out)
+	})
 }
 
 // GetFiscalModuleByID обрабатывает запрос на получение фискального модуля по ID
@@ -58,8 +166,11 @@ func (h *FiscalHandler) GetAllFiscalModules(w http.ResponseWriter, r *http.Reque
 // @Produce json
 // @Param id path int true "Fiscal module ID"
 // @Success 200 {object} models.FiscalModuleResponse
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
+// @Header 200 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /fiscal/{id} [get]
 // @Security BearerAuth
 func (h *FiscalHandler) GetFiscalModuleByID(w http.ResponseWriter, r *http.Request) {
@@ -71,35 +182,81 @@ func (h *FiscalHandler) GetFiscalModuleByID(w http.ResponseWriter, r *http.Reque
 	}
 
 	log.Printf("Fetching fiscal module by ID: %d", id)
-	module, err := h.service.GetByID(r.Context(), id)
+	module, ok := h.authorizeModule(w, r, id)
+	if !ok {
+		return
+	}
+
+	module.Terminal, err = h.service.GetCurrentTerminal(r.Context(), id)
 	if err != nil {
-		log.Printf("Error retrieving fiscal module by ID %d: %v", id, err)
-		utils.RespondWithError(w, http.StatusNotFound, "Fiscal module not found")
+		log.Printf("Error retrieving current terminal of fiscal module %d: %v", id, err)
+		utils.RespondWithAppError(w, err, "Could not retrieve fiscal module")
 		return
 	}
 
+	setETag(w, module.Version)
 	utils.RespondWithJSON(w, http.StatusOK, module)
 	log.Printf("Successfully fetched fiscal module by ID: %d", id)
 }
 
+// GetFiscalModuleBindings обрабатывает запрос на получение истории привязок модуля к кассам
+// @Summary Get fiscal module binding history
+// @Description Lists which terminals the fiscal module served and when, newest first
+// @Tags fiscal
+// @Produce json
+// @Param id path int true "Fiscal module ID"
+// @Success 200 {array} models.FiscalModuleBinding
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /fiscal/{id}/bindings [get]
+// @Security BearerAuth
+func (h *FiscalHandler) GetFiscalModuleBindings(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("Invalid fiscal module ID: %v", err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid fiscal module ID")
+		return
+	}
+
+	if _, ok := h.authorizeModule(w, r, id); !ok {
+		return
+	}
+
+	bindings, err := h.service.GetBindings(r.Context(), id)
+	if err != nil {
+		log.Printf("Error retrieving bindings of fiscal module %d: %v", id, err)
+		utils.RespondWithAppError(w, err, "Could not retrieve binding history")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, bindings)
+}
+
 // CreateFiscalModule обрабатывает запрос на создание нового фискального модуля
 // @Summary Create a new fiscal module
-// @Description Create a new fiscal module
+// @Description Create a new fiscal module. Returns the stored module.
 // @Tags fiscal
 // @Accept json
 // @Produce json
 // @Param module body models.FiscalModuleCreateRequest true "New fiscal module"
-// @Success 201 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 201 {object} models.FiscalModule
+// @Header 201 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /fiscal [post]
 // @Security BearerAuth
 func (h *FiscalHandler) CreateFiscalModule(w http.ResponseWriter, r *http.Request) {
 	var moduleReq models.FiscalModuleCreateRequest
-	err := json.NewDecoder(r.Body).Decode(&moduleReq)
-	if err != nil {
-		log.Printf("Invalid request payload: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodeJSON(w, r, &moduleReq) {
+		return
+	}
+
+	// Владелец подставляется до проверки, чтобы не требовать user_id от не-администраторов
+	if !h.assignOwner(w, r, &moduleReq.UserID) || !validateRequest(w, &moduleReq) {
 		return
 	}
 
@@ -110,28 +267,38 @@ func (h *FiscalHandler) CreateFiscalModule(w http.ResponseWriter, r *http.Reques
 	}
 
 	log.Println("Creating new fiscal module")
-	err = h.service.Create(r.Context(), module)
+	err := h.service.Create(r.Context(), &module)
 	if err != nil {
 		log.Printf("Error creating fiscal module: %v", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not create fiscal module")
+		utils.RespondWithAppError(w, err, "Could not create fiscal module")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, map[string]string{"message": "Fiscal module created"})
+	setETag(w, module.Version)
+	utils.RespondWithJSON(w, http.StatusCreated, module)
 	log.Println("Successfully created new fiscal module")
 }
 
-// UpdateFiscalModule обрабатывает запрос на обновление фискального модуля
+// UpdateFiscalModule обрабатывает запрос на частичное обновление фискального модуля
 // @Summary Update fiscal module
-// @Description Update fiscal module
+// @Description Partial update: only the fields present in the body are changed. Returns the stored module.
 // @Tags fiscal
 // @Accept json
 // @Produce json
 // @Param id path int true "Fiscal module ID"
-// @Param module body models.FiscalModuleUpdateRequest true "Fiscal module data"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param module body models.FiscalModuleUpdateRequest true "Fields to change"
+// @Success 200 {object} models.FiscalModule
+// @Header 200 {string} ETag "Version of the stored record"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /fiscal/{id} [patch]
 // @Router /fiscal/{id} [put]
 // @Security BearerAuth
 func (h *FiscalHandler) UpdateFiscalModule(w http.ResponseWriter, r *http.Request) {
@@ -142,30 +309,33 @@ func (h *FiscalHandler) UpdateFiscalModule(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var moduleReq models.FiscalModuleUpdateRequest
-	err = json.NewDecoder(r.Body).Decode(&moduleReq)
-	if err != nil {
-		log.Printf("Invalid request payload: %v", err)
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
 		return
 	}
 
-	module := models.FiscalModule{
-		ID:            id,
-		FactoryNumber: moduleReq.FactoryNumber,
-		FiscalNumber:  moduleReq.FiscalNumber,
-		UserID:        moduleReq.UserID,
+	var patch models.FiscalModuleUpdateRequest
+	if !decodeRequest(w, r, &patch) {
+		return
+	}
+
+	if _, ok := h.authorizeModule(w, r, id); !ok {
+		return
+	}
+	if patch.UserID != nil && !h.assignOwner(w, r, patch.UserID) {
+		return
 	}
 
 	log.Printf("Updating fiscal module with ID: %d", id)
-	err = h.service.Update(r.Context(), module)
+	module, err := h.service.Update(r.Context(), id, version, &patch)
 	if err != nil {
 		log.Printf("Error updating fiscal module with ID %d: %v", id, err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not update fiscal module")
+		utils.RespondWithAppError(w, err, "Could not update fiscal module")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Fiscal module updated"})
+	setETag(w, module.Version)
+	utils.RespondWithJSON(w, http.StatusOK, module)
 	log.Printf("Successfully updated fiscal module with ID: %d", id)
 }
 
@@ -175,9 +345,14 @@ func (h *FiscalHandler) UpdateFiscalModule(w http.ResponseWriter, r *http.Reques
 // @Tags fiscal
 // @Produce json
 // @Param id path int true "Fiscal module ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /fiscal/{id} [delete]
 // @Security BearerAuth
 func (h *FiscalHandler) DeleteFiscalModule(w http.ResponseWriter, r *http.Request) {
@@ -188,11 +363,19 @@ func (h *FiscalHandler) DeleteFiscalModule(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.authorizeModule(w, r, id); !ok {
+		return
+	}
+
 	log.Printf("Deleting fiscal module with ID: %d", id)
-	err = h.service.Delete(r.Context(), id)
+	err = h.service.Delete(r.Context(), id, version)
 	if err != nil {
 		log.Printf("Error deleting fiscal module with ID %d: %v", id, err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not delete fiscal module")
+		utils.RespondWithAppError(w, err, "Could not delete fiscal module")
 		return
 	}
 
@@ -0,0 +1,238 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/tabular"
+)
+
+// newModule — тело запроса на создание фискального модуля
+func newModule(factory, fiscal string, userID int) map[string]interface{} {
+	body := map[string]interface{}{"factory_number": factory, "fiscal_number": fiscal}
+	if userID != 0 {
+		body["user_id"] = userID
+	}
+	return body
+}
+
+func TestFiscalRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	owner, other := env.users["owner"].ID, env.users["other"].ID
+	env.run(t, []apiCase{
+		{
+			name: "create for owner", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("F-1", "FN-1", owner), status: http.StatusCreated,
+			check: all(expectETag(1), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				created := decode[models.FiscalModule](t, rec)
+				if created.ID != 1 || created.FactoryNumber != "F-1" || created.FiscalNumber != "FN-1" || created.UserID != owner || created.Version != 1 {
+					t.Errorf("unexpected module %+v", created)
+				}
+			}),
+		},
+		{name: "create for other", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-2", "FN-2", other), status: http.StatusCreated},
+		{name: "dealer creates own module", as: "dealer", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-3", "FN-3", 0), status: http.StatusCreated},
+		{
+			name: "dealer cannot assign module to another user", as: "dealer", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("F-4", "FN-4", owner), status: http.StatusForbidden,
+		},
+		{
+			name: "create duplicate factory number", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("F-1", "FN-9", owner), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "factory_number"),
+		},
+		{
+			name: "create duplicate fiscal number", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("F-9", "FN-1", owner), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "fiscal_number"),
+		},
+		{
+			name: "create for unknown user", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("F-9", "FN-9", 999), status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeInvalidReference, "user_id"),
+		},
+		{
+			name: "create without numbers", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body: newModule("", "FN-9", owner), status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "factory_number"),
+		},
+		{name: "create forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-9", "FN-9", 0), status: http.StatusForbidden},
+
+		{name: "list all", as: "admin", method: http.MethodGet, path: "/api/fiscal/", status: http.StatusOK, check: expectTotal[models.FiscalModule](3, 3)},
+		{name: "list scoped to owner", as: "owner", method: http.MethodGet, path: "/api/fiscal/", status: http.StatusOK, check: expectTotal[models.FiscalModule](1, 1)},
+		{name: "list filtered by number", as: "admin", method: http.MethodGet, path: "/api/fiscal/?factory_number=f-2", status: http.StatusOK, check: expectTotal[models.FiscalModule](1, 1)},
+		{name: "list filtered by user", as: "admin", method: http.MethodGet, path: env.userPath("/api/fiscal/?user_id=%d", "other"), status: http.StatusOK, check: expectTotal[models.FiscalModule](1, 1)},
+		{name: "list invalid user_id", as: "admin", method: http.MethodGet, path: "/api/fiscal/?user_id=x", status: http.StatusBadRequest},
+		{
+			name: "list keyset pages", as: "admin", method: http.MethodGet, path: "/api/fiscal/?limit=2&sort=fiscal_number&order=desc", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				first := decode[models.FiscalModuleList](t, rec)
+				if len(first.Items) != 2 || first.Items[0].FiscalNumber != "FN-3" || first.NextCursor == "" {
+					t.Fatalf("unexpected first page %+v", first)
+				}
+				next := env.do(http.MethodGet, "/api/fiscal/?limit=2&sort=fiscal_number&order=desc&cursor="+first.NextCursor, env.tokens["admin"], nil, nil)
+				second := decode[models.FiscalModuleList](t, next)
+				if len(second.Items) != 1 || second.Items[0].FiscalNumber != "FN-1" || second.NextCursor != "" {
+					t.Errorf("unexpected second page %+v", second)
+				}
+			},
+		},
+
+		{
+			name: "export", as: "owner", method: http.MethodGet, path: "/api/fiscal/export?columns=factory_number,user_id", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+					t.Errorf("Content-Type %q", ct)
+				}
+				// Выгрузка CSV начинается с BOM, чтобы Excel распознал UTF-8
+				lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(rec.Body.String(), "\ufeff")), "\n")
+				if len(lines) != 2 || strings.TrimSpace(lines[0]) != "Factory number,Owner ID" || !strings.HasPrefix(lines[1], "F-1,") {
+					t.Errorf("unexpected export %q", rec.Body)
+				}
+			},
+		},
+		{name: "export unknown format", as: "admin", method: http.MethodGet, path: "/api/fiscal/export?format=doc", status: http.StatusBadRequest},
+		{name: "export unknown column", as: "admin", method: http.MethodGet, path: "/api/fiscal/export?columns=secret", status: http.StatusBadRequest},
+
+		{
+			name: "get", as: "owner", method: http.MethodGet, path: "/api/fiscal/1", status: http.StatusOK,
+			check: all(expectETag(1), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if module := decode[models.FiscalModule](t, rec); module.FactoryNumber != "F-1" || module.Terminal != nil {
+					t.Errorf("unexpected module %+v", module)
+				}
+			}),
+		},
+		{name: "get foreign module", as: "owner", method: http.MethodGet, path: "/api/fiscal/2", status: http.StatusForbidden},
+		{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/fiscal/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+		{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/fiscal/one", status: http.StatusBadRequest},
+		{name: "bindings of unbound module", as: "owner", method: http.MethodGet, path: "/api/fiscal/1/bindings", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if bindings := decode[[]models.FiscalModuleBinding](t, rec); len(bindings) != 0 {
+					t.Errorf("got %d bindings", len(bindings))
+				}
+			},
+		},
+		{name: "bindings of foreign module", as: "owner", method: http.MethodGet, path: "/api/fiscal/2/bindings", status: http.StatusForbidden},
+
+		{name: "update without If-Match", as: "admin", method: http.MethodPatch, path: "/api/fiscal/1", body: map[string]string{"fiscal_number": "FN-10"}, status: http.StatusPreconditionRequired},
+		{
+			name: "update", as: "admin", method: http.MethodPatch, path: "/api/fiscal/1",
+			body: map[string]string{"fiscal_number": "FN-10"}, ifMatch: 1, status: http.StatusOK,
+			check: all(expectETag(2), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if module := decode[models.FiscalModule](t, rec); module.FiscalNumber != "FN-10" || module.FactoryNumber != "F-1" {
+					t.Errorf("unexpected module %+v", module)
+				}
+			}),
+		},
+		{name: "update stale version", as: "admin", method: http.MethodPut, path: "/api/fiscal/1", body: map[string]string{"fiscal_number": "FN-11"}, ifMatch: 1, status: http.StatusPreconditionFailed},
+		{
+			name: "update duplicate number", as: "admin", method: http.MethodPut, path: "/api/fiscal/1",
+			body: map[string]string{"factory_number": "F-2"}, ifMatch: 2, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "factory_number"),
+		},
+		{
+			name: "dealer cannot update foreign module", as: "dealer", method: http.MethodPatch, path: "/api/fiscal/1",
+			body: map[string]string{"fiscal_number": "FN-12"}, ifMatch: 2, status: http.StatusForbidden,
+		},
+		{
+			name: "dealer cannot hand module to another user", as: "dealer", method: http.MethodPatch, path: "/api/fiscal/3",
+			body: map[string]int{"user_id": owner}, ifMatch: 1, status: http.StatusForbidden,
+		},
+		{name: "update missing", as: "admin", method: http.MethodPatch, path: "/api/fiscal/999", body: map[string]string{"fiscal_number": "FN-13"}, ifMatch: 1, status: http.StatusNotFound},
+
+		{name: "delete stale version", as: "admin", method: http.MethodDelete, path: "/api/fiscal/2", ifMatch: 2, status: http.StatusPreconditionFailed},
+		{name: "delete forbidden for owner", as: "other", method: http.MethodDelete, path: "/api/fiscal/2", ifMatch: 1, status: http.StatusForbidden},
+		{name: "delete", as: "admin", method: http.MethodDelete, path: "/api/fiscal/2", ifMatch: 1, status: http.StatusOK},
+		{name: "get deleted", as: "admin", method: http.MethodGet, path: "/api/fiscal/2", status: http.StatusNotFound},
+	})
+}
+
+func TestFiscalBoundModule(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, []apiCase{
+		{name: "create module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", env.users["owner"].ID), status: http.StatusCreated},
+		{name: "create terminal with module", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-1", "FN-1", env.users["owner"].ID), status: http.StatusCreated},
+		{
+			name: "module shows its terminal", as: "owner", method: http.MethodGet, path: "/api/fiscal/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				module := decode[models.FiscalModule](t, rec)
+				if module.Terminal == nil || module.Terminal.ID != 1 || module.Terminal.CashRegisterNumber != "CR-1" || module.Terminal.CompanyName != "Spare LLC" {
+					t.Errorf("unexpected terminal %+v", module.Terminal)
+				}
+			},
+		},
+		{
+			name: "binding history", as: "owner", method: http.MethodGet, path: "/api/fiscal/1/bindings", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				bindings := decode[[]models.FiscalModuleBinding](t, rec)
+				if len(bindings) != 1 || bindings[0].TerminalID != 1 || bindings[0].UnboundAt != nil {
+					t.Errorf("unexpected bindings %+v", bindings)
+				}
+			},
+		},
+		{
+			name: "bound module cannot be deleted", as: "admin", method: http.MethodDelete, path: "/api/fiscal/1",
+			ifMatch: 1, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, ""),
+		},
+		{name: "unbind module", as: "admin", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"module_number": ""}, ifMatch: 1, status: http.StatusOK},
+		{
+			name: "binding closed", as: "owner", method: http.MethodGet, path: "/api/fiscal/1/bindings", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if bindings := decode[[]models.FiscalModuleBinding](t, rec); len(bindings) != 1 || bindings[0].UnboundAt == nil {
+					t.Errorf("unexpected bindings %+v", bindings)
+				}
+			},
+		},
+		{name: "unbound module can be deleted", as: "admin", method: http.MethodDelete, path: "/api/fiscal/1", ifMatch: 1, status: http.StatusOK},
+	})
+}
+
+func TestFiscalModuleNumberCollision(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.users["owner"].ID
+	env.run(t, []apiCase{
+		{name: "create module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		// Фискальный номер второго модуля совпадает с заводским номером первого
+		{name: "create colliding module", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-20", "F-1", owner), status: http.StatusCreated},
+		{
+			name: "terminal binds module with matching fiscal number", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-1", "F-1", owner), status: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.FiscalModuleID == nil || *terminal.FiscalModuleID != 2 {
+					t.Errorf("bound module %v, want 2", terminal.FiscalModuleID)
+				}
+			},
+		},
+		{
+			name: "check in by the same number", as: "owner", method: http.MethodPost, path: "/api/terminal/check-in",
+			body: map[string]string{"cash_register_number": "CR-1", "module_number": "F-1"}, status: http.StatusOK,
+		},
+		{name: "first module stays unbound", as: "admin", method: http.MethodDelete, path: "/api/fiscal/1", ifMatch: 1, status: http.StatusOK},
+	})
+}
+
+func TestFiscalPDFExportLimit(t *testing.T) {
+	limit := tabular.MaxPDFRows
+	tabular.MaxPDFRows = 1
+	defer func() { tabular.MaxPDFRows = limit }()
+
+	env := newTestEnv(t)
+	owner, other := env.users["owner"].ID, env.users["other"].ID
+	env.run(t, []apiCase{
+		{name: "create module 1", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "create module 2", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-2", "FN-2", other), status: http.StatusCreated},
+
+		{
+			name: "within limit", as: "owner", method: http.MethodGet, path: "/api/fiscal/export?format=pdf", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if ct := rec.Header().Get("Content-Type"); ct != "application/pdf" || !strings.HasPrefix(rec.Body.String(), "%PDF") {
+					t.Errorf("unexpected export %s, %q", ct, rec.Body.String()[:min(rec.Body.Len(), 16)])
+				}
+			},
+		},
+		{
+			name: "over limit", as: "admin", method: http.MethodGet, path: "/api/fiscal/export?format=pdf", status: http.StatusBadRequest,
+			check: expectError(apperrors.CodeBadRequest, "format"),
+		},
+		{name: "over limit as csv", as: "admin", method: http.MethodGet, path: "/api/fiscal/export", status: http.StatusOK},
+	})
+}
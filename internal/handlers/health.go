@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/idkOybek/internal/health"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/utils"
+)
+
+// HealthHandler отвечает на пробы балансировщика и оркестратора. Пробы живут вне /api,
+// не требуют аутентификации и не попадают в журнал запросов.
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Healthz сообщает, что процесс запущен и обрабатывает запросы
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Readyz выполняет проверки готовности и отвечает 503, если хотя бы одна не прошла
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Run(r.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+		for _, result := range report.Checks {
+			if !result.OK {
+				logger.ErrorLogger.Printf("Readiness check %s failed: %s", result.Name, result.Error)
+			}
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, status, report)
+}
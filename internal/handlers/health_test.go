@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/handlers"
+	"github.com/idkOybek/internal/health"
+)
+
+func TestHealth(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	var migrationErr error
+	checker.Add("migrations", func(ctx context.Context) error { return migrationErr })
+	checker.Add("sweeper", health.NewHeartbeat(time.Hour).Check)
+	h := handlers.NewHealthHandler(checker)
+
+	probe := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	if rec := probe(h.Healthz); rec.Code != http.StatusOK {
+		t.Errorf("healthz status %d", rec.Code)
+	}
+
+	rec := probe(h.Readyz)
+	if report := decode[health.Report](t, rec); rec.Code != http.StatusOK || !report.Ready || len(report.Checks) != 3 {
+		t.Errorf("readyz status %d report %+v", rec.Code, report)
+	}
+
+	migrationErr = errors.New("database is at version 3, expected 4")
+	rec = probe(h.Readyz)
+	report := decode[health.Report](t, rec)
+	if rec.Code != http.StatusServiceUnavailable || report.Ready {
+		t.Fatalf("readyz status %d report %+v with outdated schema", rec.Code, report)
+	}
+	for _, result := range report.Checks {
+		if result.OK != (result.Name != "migrations") {
+			t.Errorf("check %+v", result)
+		}
+	}
+
+	// Обработчик, переставший отмечаться, делает сервер неготовым
+	stale := health.NewChecker(time.Second)
+	stale.Add("dispatcher", health.NewHeartbeat(-time.Second).Check)
+	if rec := probe(handlers.NewHealthHandler(stale).Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz status %d with a stalled worker", rec.Code)
+	}
+}
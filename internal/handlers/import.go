@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+// maxImportFileSize ограничивает размер загружаемого файла импорта
+const maxImportFileSize = 32 << 20
+
+type ImportHandler struct {
+	service *services.ImportService
+}
+
+func NewImportHandler(service *services.ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+// @Summary Start bulk import
+// @Description Uploads a CSV or XLSX file whose header row names the fields of TerminalCreateRequest (kind=terminals) or FiscalModuleCreateRequest (kind=fiscal_modules). The file is checked row by row in the background; poll the returned job for progress and per-row errors. With dry_run nothing is written. Otherwise all rows are created in one transaction, and only if no row has errors.
+// @Tags import
+// @Security BearerAuth
+// @Accept mpfd
+// @Produce json
+// @Param kind query string true "What to import" Enums(terminals, fiscal_modules)
+// @Param dry_run query bool false "Only validate the file"
+// @Param file formData file true "CSV or XLSX file"
+// @Success 202 {object} models.ImportJob
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /imports [post]
+func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := queryBool(r, "dry_run")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid import parameters: %v", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Expected a multipart form with a file field no larger than 32 MB")
+		logger.ErrorLogger.Printf("Error reading import file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	kind := models.ImportKind(r.URL.Query().Get("kind"))
+	job, err := h.service.Start(r.Context(), kind, header.Filename, dryRun != nil && *dryRun, file)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not start import")
+		logger.ErrorLogger.Printf("Error in StartImport handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusAccepted, job)
+}
+
+// @Summary Get import job
+// @Description Progress and per-row errors of an import job
+// @Tags import
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Import job ID"
+// @Success 200 {object} models.ImportJob
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /imports/{id} [get]
+func (h *ImportHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid import job ID")
+		logger.ErrorLogger.Printf("Invalid import job ID: %v", err)
+		return
+	}
+
+	job, err := h.service.GetJob(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve import job")
+		logger.ErrorLogger.Printf("Error in GetImport handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, job)
+}
+
+func (h *ImportHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequirePermission(models.PermImport))
+	r.Post("/", h.StartImport)
+	r.Get("/{id}", h.GetImport)
+
+	return r
+}
@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// startImport загружает файл name с содержимым content от имени пользователя as
+func (e *testEnv) startImport(t *testing.T, as, query, name, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("creating form file: %v", err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", form.FormDataContentType())
+	return e.do(http.MethodPost, "/api/imports/?"+query, e.tokens[as], body.String(), header)
+}
+
+// awaitImport запускает импорт и ждёт, пока фоновое задание завершится
+func (e *testEnv) awaitImport(t *testing.T, query, name, content string) models.ImportJob {
+	t.Helper()
+	rec := e.startImport(t, "admin", query, name, content)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("starting import: status %d: %s", rec.Code, rec.Body)
+	}
+	path := fmt.Sprintf("/api/imports/%d", decode[models.ImportJob](t, rec).ID)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rec := e.do(http.MethodGet, path, e.tokens["admin"], nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		if job := decode[models.ImportJob](t, rec); job.Status == models.ImportCompleted || job.Status == models.ImportFailed {
+			return job
+		}
+	}
+	t.Fatalf("import job %s did not finish", path)
+	return models.ImportJob{}
+}
+
+func TestImportRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	modules := fmt.Sprintf("factory_number,fiscal_number,user_id\nF-1,FN-1,%d\nF-2,FN-2,%d\n", env.users["owner"].ID, env.users["other"].ID)
+
+	t.Run("dry run", func(t *testing.T) {
+		job := env.awaitImport(t, "kind=fiscal_modules&dry_run=true", "modules.csv", modules)
+		if job.Status != models.ImportCompleted || !job.DryRun || job.TotalRows != 2 || job.ValidatedRows != 2 || job.ImportedRows != 0 {
+			t.Errorf("unexpected job %+v", job)
+		}
+		env.run(t, []apiCase{
+			{name: "nothing created", as: "admin", method: http.MethodGet, path: "/api/fiscal/", status: http.StatusOK, check: expectTotal[models.FiscalModule](0, 0)},
+		})
+	})
+
+	t.Run("import", func(t *testing.T) {
+		job := env.awaitImport(t, "kind=fiscal_modules", "modules.csv", modules)
+		if job.Status != models.ImportCompleted || job.ImportedRows != 2 || job.ErrorCount != 0 || job.CreatedBy == nil || *job.CreatedBy != env.users["admin"].ID {
+			t.Errorf("unexpected job %+v", job)
+		}
+		env.run(t, []apiCase{
+			{name: "modules created", as: "admin", method: http.MethodGet, path: "/api/fiscal/", status: http.StatusOK, check: expectTotal[models.FiscalModule](2, 2)},
+		})
+	})
+
+	t.Run("rows with errors", func(t *testing.T) {
+		job := env.awaitImport(t, "kind=fiscal_modules", "modules.csv", "factory_number,fiscal_number,user_id\nF-1,FN-3,1\nF-4,FN-4,999\nF-5,FN-5,1\n")
+		if job.Status != models.ImportFailed || job.ImportedRows != 0 || job.ErrorCount != 2 || len(job.Errors) != 2 ||
+			job.Errors[0].Row != 2 || job.Errors[1].Row != 3 {
+			t.Errorf("unexpected job %+v", job)
+		}
+		env.run(t, []apiCase{
+			{name: "nothing created", as: "admin", method: http.MethodGet, path: "/api/fiscal/", status: http.StatusOK, check: expectTotal[models.FiscalModule](2, 2)},
+		})
+	})
+
+	t.Run("terminals", func(t *testing.T) {
+		terminals := fmt.Sprintf("inn,company_name,address,cash_register_number,module_number,assembly_number,user_id,free_record_balance\n"+
+			"%s,Spare LLC,Tashkent,CR-1,FN-1,A-1,%d,5\n", innSpare, env.users["owner"].ID)
+		job := env.awaitImport(t, "kind=terminals", "terminals.csv", terminals)
+		if job.Status != models.ImportCompleted || job.ImportedRows != 1 {
+			t.Errorf("unexpected job %+v", job)
+		}
+		env.run(t, []apiCase{
+			{
+				name: "terminal created", as: "owner", method: http.MethodGet, path: "/api/terminal/1", status: http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if terminal := decode[models.Terminal](t, rec); terminal.ModuleNumber != "FN-1" || terminal.FreeRecordBalance != 5 {
+						t.Errorf("unexpected terminal %+v", terminal)
+					}
+				},
+			},
+		})
+
+		job = env.awaitImport(t, "kind=terminals", "terminals.csv", terminals)
+		if job.Status != models.ImportFailed || job.ErrorCount == 0 {
+			t.Errorf("repeated import: unexpected job %+v", job)
+		}
+	})
+
+	t.Run("rejected requests", func(t *testing.T) {
+		for _, tc := range []struct {
+			name, as, query, file, content string
+			status                         int
+			check                          func(t *testing.T, rec *httptest.ResponseRecorder)
+		}{
+			{"unknown kind", "admin", "kind=receipts", "modules.csv", modules, http.StatusBadRequest, expectError(apperrors.CodeBadRequest, "kind")},
+			{"unknown format", "admin", "kind=fiscal_modules", "modules.txt", modules, http.StatusBadRequest, expectError(apperrors.CodeBadRequest, "file")},
+			{"missing column", "admin", "kind=fiscal_modules", "modules.csv", "factory_number,fiscal_number\nF-9,FN-9\n", http.StatusUnprocessableEntity, expectError(apperrors.CodeValidation, "file")},
+			{"invalid dry run flag", "admin", "kind=fiscal_modules&dry_run=maybe", "modules.csv", modules, http.StatusBadRequest, nil},
+			{"forbidden for dealer", "dealer", "kind=fiscal_modules", "modules.csv", modules, http.StatusForbidden, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				rec := env.startImport(t, tc.as, tc.query, tc.file, tc.content)
+				if rec.Code != tc.status {
+					t.Fatalf("status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+				}
+				if tc.check != nil {
+					tc.check(t, rec)
+				}
+			})
+		}
+		env.run(t, []apiCase{
+			{name: "without file", as: "admin", method: http.MethodPost, path: "/api/imports/?kind=fiscal_modules", body: modules, status: http.StatusBadRequest},
+			{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/imports/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+			{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/imports/x", status: http.StatusBadRequest},
+			{name: "get forbidden for owner", as: "owner", method: http.MethodGet, path: "/api/imports/1", status: http.StatusForbidden},
+		})
+	})
+}
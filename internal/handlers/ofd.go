@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+type OFDHandler struct {
+	service *services.OFDService
+}
+
+func NewOFDHandler(service *services.OFDService) *OFDHandler {
+	return &OFDHandler{service: service}
+}
+
+// @Summary Get OFD outbox
+// @Description Keyset-paginated delivery queue to the fiscal data operator; use status=dead to inspect dead letters
+// @Tags ofd
+// @Security BearerAuth
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, next_attempt_at, attempts)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param status query string false "Delivery status" Enums(pending, acknowledged, dead)
+// @Param kind query string false "Document kind" Enums(receipt, z_report)
+// @Success 200 {object} models.OFDDeliveryList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /ofd/outbox [get]
+func (h *OFDHandler) GetOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := models.OFDDeliveryFilter{
+		Status: models.OFDDeliveryStatus(q.Get("status")),
+		Kind:   models.OFDDocumentKind(q.Get("kind")),
+	}
+	var err error
+	filter.ListParams, err = parseListParams(r)
+	if err == nil && filter.Status != "" && !filter.Status.Valid() {
+		err = fmt.Errorf("invalid status %q", filter.Status)
+	}
+	if err == nil && filter.Kind != "" && filter.Kind != models.OFDReceipt && filter.Kind != models.OFDZReport {
+		err = fmt.Errorf("invalid kind %q", filter.Kind)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid OFD outbox list parameters: %v", err)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve OFD outbox")
+		logger.ErrorLogger.Printf("Error in GetOutbox handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// @Summary Requeue dead-lettered OFD document
+// @Description Resets the attempt counter of a dead-lettered document and schedules it for immediate delivery
+// @Tags ofd
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Outbox entry ID"
+// @Success 200 {object} models.OFDDelivery
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /ofd/outbox/{id}/requeue [post]
+func (h *OFDHandler) RequeueDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid outbox entry ID")
+		logger.ErrorLogger.Printf("Invalid outbox entry ID: %v", err)
+		return
+	}
+
+	delivery, err := h.service.Requeue(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to requeue document")
+		logger.ErrorLogger.Printf("Error in RequeueDelivery handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, delivery)
+}
+
+func (h *OFDHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequirePermission(models.PermOFDManage))
+	r.Get("/outbox", h.GetOutbox)
+	r.Post("/outbox/{id}/requeue", h.RequeueDelivery)
+
+	return r
+}
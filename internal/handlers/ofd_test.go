@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository/memory"
+)
+
+func TestOFDRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, setupReceiptTerminals(env))
+	env.run(t, []apiCase{
+		{name: "submit 1", as: "owner", method: http.MethodPost, path: "/api/receipts/", body: newReceipt(1, "FN-1", 1, models.ReceiptSale), status: http.StatusCreated},
+		{name: "submit 2", as: "owner", method: http.MethodPost, path: "/api/receipts/", body: newReceipt(1, "FN-1", 2, models.ReceiptSale), status: http.StatusCreated},
+		{name: "close shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/close", status: http.StatusOK},
+	})
+
+	// Доставку документов в ОФД выполняет диспетчер; здесь её итог записывается напрямую
+	outbox := memory.NewOutboxRepository(env.store)
+	if err := outbox.Acknowledge(context.Background(), 1, "ACK-1"); err != nil {
+		t.Fatalf("acknowledging: %v", err)
+	}
+	if err := outbox.DeadLetter(context.Background(), 2, "rejected"); err != nil {
+		t.Fatalf("dead-lettering: %v", err)
+	}
+
+	env.run(t, []apiCase{
+		{name: "list", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox", status: http.StatusOK, check: expectTotal[models.OFDDelivery](3, 3)},
+		{name: "list Z-reports", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?kind=z_report", status: http.StatusOK, check: expectTotal[models.OFDDelivery](1, 1)},
+		{name: "list pending", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?status=pending", status: http.StatusOK, check: expectTotal[models.OFDDelivery](1, 1)},
+		{
+			name: "list dead", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?status=dead", status: http.StatusOK,
+			check: all(expectTotal[models.OFDDelivery](1, 1), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				dead := decode[models.OFDDeliveryList](t, rec).Items[0]
+				if dead.ID != 2 || dead.Attempts != 1 || dead.LastError == nil || *dead.LastError != "rejected" {
+					t.Errorf("unexpected dead letter %+v", dead)
+				}
+			}),
+		},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?limit=2&sort=attempts&order=desc", status: http.StatusOK, check: expectTotal[models.OFDDelivery](2, 3)},
+		{name: "list invalid status", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?status=lost", status: http.StatusBadRequest},
+		{name: "list invalid kind", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?kind=invoice", status: http.StatusBadRequest},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?sort=kind", status: http.StatusBadRequest},
+		{name: "list forbidden for dealer", as: "dealer", method: http.MethodGet, path: "/api/ofd/outbox", status: http.StatusForbidden},
+		{
+			name: "receipt shows acknowledgement", as: "owner", method: http.MethodGet, path: "/api/receipts/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				delivery := decode[models.Receipt](t, rec).OFD
+				if delivery == nil || delivery.Status != models.OFDAcknowledged || delivery.AckID == nil || *delivery.AckID != "ACK-1" {
+					t.Errorf("unexpected delivery %+v", delivery)
+				}
+			},
+		},
+
+		{name: "requeue forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/ofd/outbox/2/requeue", status: http.StatusForbidden},
+		{name: "requeue pending", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/3/requeue", status: http.StatusNotFound},
+		{name: "requeue acknowledged", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/1/requeue", status: http.StatusNotFound},
+		{
+			name: "requeue", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/2/requeue", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if delivery := decode[models.OFDDelivery](t, rec); delivery.Status != models.OFDPending || delivery.Attempts != 0 {
+					t.Errorf("unexpected delivery %+v", delivery)
+				}
+			},
+		},
+		{name: "requeue twice", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/2/requeue", status: http.StatusNotFound},
+		{name: "requeue missing", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/999/requeue", status: http.StatusNotFound},
+		{name: "requeue invalid ID", as: "admin", method: http.MethodPost, path: "/api/ofd/outbox/x/requeue", status: http.StatusBadRequest},
+		{name: "list pending after requeue", as: "admin", method: http.MethodGet, path: "/api/ofd/outbox?status=pending", status: http.StatusOK, check: expectTotal[models.OFDDelivery](2, 2)},
+	})
+}
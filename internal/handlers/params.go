@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+// parseListParams читает общие параметры постраничной выборки: limit, cursor, sort, order
+func parseListParams(r *http.Request) (models.ListParams, error) {
+	q := r.URL.Query()
+	params := models.ListParams{
+		Cursor: q.Get("cursor"),
+		Sort:   q.Get("sort"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return params, fmt.Errorf("invalid limit %q", v)
+		}
+		params.Limit = limit
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		params.Desc = true
+	default:
+		return params, fmt.Errorf("invalid order %q, expected asc or desc", q.Get("order"))
+	}
+
+	return params, nil
+}
+
+// queryInt читает необязательный целочисленный параметр запроса
+func queryInt(r *http.Request, name string) (*int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return &n, nil
+}
+
+// queryBool читает необязательный логический параметр запроса
+func queryBool(r *http.Request, name string) (*bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return &b, nil
+}
+
+// queryTime читает необязательный параметр запроса в формате RFC 3339
+func queryTime(r *http.Request, name string) (*time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q, expected RFC 3339", name, v)
+	}
+	return &t, nil
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/tabular"
+	"github.com/idkOybek/internal/utils"
+)
+
+type ReceiptHandler struct {
+	service *services.ReceiptService
+}
+
+func NewReceiptHandler(service *services.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{service: service}
+}
+
+// @Summary Submit fiscal receipt
+// @Description Stores a sale or refund receipt signed by the terminal's fiscal module and consumes one free record. The terminal must have a shift open for less than 24 hours. Receipt numbers must strictly increase per fiscal module. Amounts are in tiyin.
+// @Tags receipt
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param receipt body models.ReceiptCreateRequest true "Receipt"
+// @Success 201 {object} models.Receipt
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /receipts [post]
+func (h *ReceiptHandler) SubmitReceipt(w http.ResponseWriter, r *http.Request) {
+	var req models.ReceiptCreateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	receipt, err := h.service.SubmitReceipt(r.Context(), &req, ownerScope(r))
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to store receipt")
+		logger.ErrorLogger.Printf("Error in SubmitReceipt handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, receipt)
+}
+
+// @Summary Get receipts
+// @Description Keyset-paginated list of receipts without items; non-admin users only see receipts of their own terminals
+// @Tags receipt
+// @Security BearerAuth
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, issued_at, receipt_number, total)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param terminal_id query int false "Terminal ID"
+// @Param fiscal_module_id query int false "Fiscal module ID"
+// @Param inn query string false "Exact INN"
+// @Param type query string false "Receipt type" Enums(sale, refund)
+// @Param issued_from query string false "Issued at or after (RFC 3339)"
+// @Param issued_to query string false "Issued before (RFC 3339)"
+// @Success 200 {object} models.ReceiptList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /receipts [get]
+func (h *ReceiptHandler) GetAllReceipts(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReceiptFilter(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid receipt list parameters: %v", err)
+		return
+	}
+	filter.UserID = ownerScope(r)
+
+	receipts, err := h.service.ListReceipts(r.Context(), filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve receipts")
+		logger.ErrorLogger.Printf("Error in GetAllReceipts handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, receipts)
+}
+
+// @Summary Export receipts
+// @Description Streams receipt headers matching the list filters as CSV, XLSX or a printable PDF report, in the requested sort order; limit and cursor are ignored. Amounts are in tiyin. Non-admin users only export receipts of their own terminals.
+// @Tags receipt
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param format query string false "File format (default csv); pdf is limited to 5000 rows, larger exports return 400" Enums(csv, xlsx, pdf)
+// @Param columns query string false "Comma-separated columns in output order (default all): id, terminal_id, shift_id, fiscal_module_id, module_number, receipt_number, type, inn, total, vat_total, fiscal_sign, issued_at"
+// @Param sort query string false "Sort field" Enums(id, issued_at, receipt_number, total)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param terminal_id query int false "Terminal ID"
+// @Param fiscal_module_id query int false "Fiscal module ID"
+// @Param inn query string false "Exact INN"
+// @Param type query string false "Receipt type" Enums(sale, refund)
+// @Param issued_from query string false "Issued at or after (RFC 3339)"
+// @Param issued_to query string false "Issued before (RFC 3339)"
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /receipts/export [get]
+func (h *ReceiptHandler) ExportReceipts(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReceiptFilter(r)
+	var format tabular.Format
+	var columns []string
+	if err == nil {
+		format, columns, err = parseExportParams(r)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid receipt export parameters: %v", err)
+		return
+	}
+	filter.UserID = ownerScope(r)
+
+	serveExport(w, "receipts", format, func(out io.Writer) error {
+		return h.service.ExportReceipts(r.Context(), filter, format, columns, out)
+	})
+}
+
+func parseReceiptFilter(r *http.Request) (models.ReceiptFilter, error) {
+	q := r.URL.Query()
+	filter := models.ReceiptFilter{
+		INN:  q.Get("inn"),
+		Type: models.ReceiptType(q.Get("type")),
+	}
+	if filter.Type != "" && !filter.Type.Valid() {
+		return filter, fmt.Errorf("invalid type %q", filter.Type)
+	}
+
+	var err error
+	if filter.ListParams, err = parseListParams(r); err != nil {
+		return filter, err
+	}
+	if filter.TerminalID, err = queryInt(r, "terminal_id"); err != nil {
+		return filter, err
+	}
+	if filter.FiscalModuleID, err = queryInt(r, "fiscal_module_id"); err != nil {
+		return filter, err
+	}
+	if filter.IssuedFrom, err = queryTime(r, "issued_from"); err != nil {
+		return filter, err
+	}
+	if filter.IssuedTo, err = queryTime(r, "issued_to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// @Summary Get receipt by ID
+// @Tags receipt
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Receipt ID"
+// @Success 200 {object} models.Receipt
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /receipts/{id} [get]
+func (h *ReceiptHandler) GetReceiptByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid receipt ID")
+		logger.ErrorLogger.Printf("Invalid receipt ID: %v", err)
+		return
+	}
+
+	receipt, err := h.service.GetReceiptByID(r.Context(), id, ownerScope(r))
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve receipt")
+		logger.ErrorLogger.Printf("Error in GetReceiptByID handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, receipt)
+}
+
+// ownerScope возвращает ID пользователя, которым ограничен запрос, или nil для администратора
+func ownerScope(r *http.Request) *int {
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		return &userID
+	}
+	return nil
+}
+
+func (h *ReceiptHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/", h.GetAllReceipts)
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/export", h.ExportReceipts)
+	r.With(middleware.RequirePermission(models.PermReceiptsWrite)).Post("/", h.SubmitReceipt)
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/{id}", h.GetReceiptByID)
+
+	return r
+}
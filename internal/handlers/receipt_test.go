@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// newReceipt — тело чека с одной позицией на 100 сумов с НДС 12%, оплаченной наличными
+func newReceipt(terminalID int, moduleNumber string, number int64, kind models.ReceiptType) map[string]interface{} {
+	return map[string]interface{}{
+		"terminal_id":    terminalID,
+		"module_number":  moduleNumber,
+		"receipt_number": number,
+		"type":           kind,
+		"items":          []models.ReceiptItem{{Name: "Bread", Quantity: 1, Price: 10000, VATRate: 12, VATAmount: 1071, Total: 10000}},
+		"payments":       []models.ReceiptPayment{{Type: models.PaymentCash, Amount: 10000}},
+		"fiscal_sign":    "SIGN",
+		"issued_at":      time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+// setupReceiptTerminals заводит активные кассы 1 (владелец owner, модуль FN-1)
+// и 2 (владелец other, модуль FN-2) и открывает смену на кассе 1
+func setupReceiptTerminals(env *testEnv) []apiCase {
+	owner, other := env.users["owner"].ID, env.users["other"].ID
+	return []apiCase{
+		{name: "create module 1", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "create module 2", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-2", "FN-2", other), status: http.StatusCreated},
+		{name: "create terminal 1", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "create terminal 2", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-2", "FN-2", other), status: http.StatusCreated},
+		{name: "activate terminal 1", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("installed"), status: http.StatusOK},
+		{name: "activate terminal 2", as: "admin", method: http.MethodPost, path: "/api/terminal/2/activate", body: reason("installed"), status: http.StatusOK},
+		{
+			name: "submit without shift", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-1", 1, models.ReceiptSale), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, ""),
+		},
+		{name: "open shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusCreated},
+	}
+}
+
+func TestReceiptRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, setupReceiptTerminals(env))
+
+	mismatched := newReceipt(1, "FN-1", 5, models.ReceiptSale)
+	mismatched["payments"] = []models.ReceiptPayment{{Type: models.PaymentCard, Amount: 1}}
+	env.run(t, []apiCase{
+		{
+			name: "submit", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "F-1", 1, models.ReceiptSale), status: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				receipt := decode[models.Receipt](t, rec)
+				if receipt.ID != 1 || receipt.INN != innSpare || receipt.ShiftID == nil || *receipt.ShiftID != 1 ||
+					receipt.FiscalModuleID != 1 || receipt.Total != 10000 || receipt.VATTotal != 1071 {
+					t.Errorf("unexpected receipt %+v", receipt)
+				}
+			},
+		},
+		{
+			name: "submit repeated number", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-1", 1, models.ReceiptSale), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "receipt_number"),
+		},
+		{
+			name: "submit with module of another terminal", as: "admin", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-2", 2, models.ReceiptSale), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "module_number"),
+		},
+		{
+			name: "submit with unknown module", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-9", 2, models.ReceiptSale), status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeInvalidReference, "module_number"),
+		},
+		{
+			name: "submit with mismatched payments", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: mismatched, status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "payments"),
+		},
+		{
+			name: "submit for foreign terminal", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(2, "FN-2", 1, models.ReceiptSale), status: http.StatusNotFound,
+		},
+		{
+			name: "submit on terminal without shift", as: "other", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(2, "FN-2", 1, models.ReceiptSale), status: http.StatusConflict,
+		},
+		{
+			name: "submit forbidden for viewer", as: "viewer", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-1", 2, models.ReceiptSale), status: http.StatusForbidden,
+		},
+		{name: "submit refund", as: "owner", method: http.MethodPost, path: "/api/receipts/", body: newReceipt(1, "FN-1", 2, models.ReceiptRefund), status: http.StatusCreated},
+
+		{name: "list all", as: "admin", method: http.MethodGet, path: "/api/receipts/", status: http.StatusOK, check: expectTotal[models.Receipt](2, 2)},
+		{name: "list scoped to owner", as: "owner", method: http.MethodGet, path: "/api/receipts/", status: http.StatusOK, check: expectTotal[models.Receipt](2, 2)},
+		{name: "list scoped to other owner", as: "other", method: http.MethodGet, path: "/api/receipts/", status: http.StatusOK, check: expectTotal[models.Receipt](0, 0)},
+		{name: "list by type", as: "admin", method: http.MethodGet, path: "/api/receipts/?type=refund", status: http.StatusOK, check: expectTotal[models.Receipt](1, 1)},
+		{name: "list by terminal", as: "admin", method: http.MethodGet, path: "/api/receipts/?terminal_id=2", status: http.StatusOK, check: expectTotal[models.Receipt](0, 0)},
+		{name: "list issued before", as: "admin", method: http.MethodGet, path: "/api/receipts/?issued_to=2024-05-01T10:00:00Z", status: http.StatusOK, check: expectTotal[models.Receipt](0, 0)},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/receipts/?limit=1&sort=receipt_number&order=desc", status: http.StatusOK, check: expectTotal[models.Receipt](1, 2)},
+		{name: "list invalid type", as: "admin", method: http.MethodGet, path: "/api/receipts/?type=gift", status: http.StatusBadRequest},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/receipts/?sort=fiscal_sign", status: http.StatusBadRequest},
+		{
+			name: "export", as: "owner", method: http.MethodGet, path: "/api/receipts/export?columns=receipt_number,type&sort=receipt_number", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if body := strings.TrimSpace(rec.Body.String()); !strings.HasSuffix(body, "\n1,sale\n2,refund") {
+					t.Errorf("unexpected export %q", body)
+				}
+			},
+		},
+
+		{
+			name: "get", as: "owner", method: http.MethodGet, path: "/api/receipts/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				receipt := decode[models.Receipt](t, rec)
+				if len(receipt.Items) != 1 || len(receipt.Payments) != 1 || receipt.OFD == nil || receipt.OFD.Status != models.OFDPending {
+					t.Errorf("unexpected receipt %+v", receipt)
+				}
+			},
+		},
+		{name: "get foreign", as: "other", method: http.MethodGet, path: "/api/receipts/1", status: http.StatusNotFound},
+		{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/receipts/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+		{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/receipts/x", status: http.StatusBadRequest},
+
+		{
+			name: "x-report counts receipts", as: "owner", method: http.MethodGet, path: "/api/terminal/1/shift/x-report", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				report := decode[models.ShiftReport](t, rec)
+				if report.SaleCount != 1 || report.RefundCount != 1 || report.SalesTotal != 10000 || report.NetTotal != 0 ||
+					len(report.ByPaymentType) != 1 || len(report.ByVATRate) != 1 || report.ByVATRate[0].RefundsVAT != 1071 {
+					t.Errorf("unexpected report %+v", report)
+				}
+			},
+		},
+		{
+			name: "receipts consume balance", as: "owner", method: http.MethodGet, path: "/api/terminal/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.FreeRecordBalance != 8 {
+					t.Errorf("balance %d, want 8", terminal.FreeRecordBalance)
+				}
+			},
+		},
+		{
+			name: "decommission with open shift", as: "admin", method: http.MethodPost, path: "/api/terminal/1/decommission",
+			body: reason("closed"), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, ""),
+		},
+		{name: "close shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/close", status: http.StatusOK},
+		{name: "decommission after close", as: "admin", method: http.MethodPost, path: "/api/terminal/1/decommission", body: reason("closed"), status: http.StatusOK},
+		{
+			name: "submit after close", as: "owner", method: http.MethodPost, path: "/api/receipts/",
+			body: newReceipt(1, "FN-1", 3, models.ReceiptSale), status: http.StatusConflict,
+		},
+	})
+}
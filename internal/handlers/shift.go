@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/utils"
+)
+
+// @Summary Open shift
+// @Description Opens a cash register shift on an active terminal with a bound fiscal module. Receipts are accepted only while a shift is open and for at most 24 hours.
+// @Tags shift
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 201 {object} models.Shift
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/shift/open [post]
+func (h *TerminalHandler) OpenShift(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftTerminal(w, r)
+	if !ok {
+		return
+	}
+
+	shift, err := h.service.OpenShift(r.Context(), id, actorID(r))
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to open shift")
+		logger.ErrorLogger.Printf("Error in OpenShift handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, shift)
+}
+
+// @Summary Get open shift
+// @Tags shift
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {object} models.Shift
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/shift [get]
+func (h *TerminalHandler) GetOpenShift(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftTerminal(w, r)
+	if !ok {
+		return
+	}
+
+	shift, err := h.service.GetOpenShift(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve shift")
+		logger.ErrorLogger.Printf("Error in GetOpenShift handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, shift)
+}
+
+// @Summary X-report
+// @Description Interim totals of the open shift by payment type and VAT rate; the shift stays open
+// @Tags shift
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {object} models.ShiftReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/shift/x-report [get]
+func (h *TerminalHandler) XReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftTerminal(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.service.XReport(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not build X-report")
+		logger.ErrorLogger.Printf("Error in XReport handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// @Summary Close shift (Z-report)
+// @Description Closes the open shift and stores a Z-report numbered sequentially per fiscal module
+// @Tags shift
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {object} models.ZReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/shift/close [post]
+func (h *TerminalHandler) CloseShift(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftTerminal(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.service.CloseShift(r.Context(), id, actorID(r))
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to close shift")
+		logger.ErrorLogger.Printf("Error in CloseShift handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// @Summary Get Z-reports
+// @Tags shift
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {array} models.ZReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/z-reports [get]
+func (h *TerminalHandler) GetZReports(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftTerminal(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := h.service.GetZReports(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve Z-reports")
+		logger.ErrorLogger.Printf("Error in GetZReports handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, reports)
+}
+
+// shiftTerminal читает ID торговой точки из пути и проверяет доступ к ней
+func (h *TerminalHandler) shiftTerminal(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		logger.ErrorLogger.Printf("Invalid terminal ID: %v", err)
+		return 0, false
+	}
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return 0, false
+	}
+	return id, true
+}
+
+// actorID возвращает ID текущего пользователя для журналов
+func actorID(r *http.Request) *int {
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+		return &user.ID
+	}
+	return nil
+}
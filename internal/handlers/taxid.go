@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/utils"
+)
+
+type TaxIDHandler struct {
+	service *services.TaxIDService
+}
+
+func NewTaxIDHandler(service *services.TaxIDService) *TaxIDHandler {
+	return &TaxIDHandler{service: service}
+}
+
+// @Summary Report invalid stored INNs
+// @Description Checks the INN of every stored company, user and terminal against the 9-digit INN and 14-digit PINFL rules, including check digits, and lists the values that fail with the reason
+// @Tags tax-ids
+// @Security BearerAuth
+// @Produce json
+// @Param entity_type query string false "Only check objects of this type" Enums(company, user, terminal)
+// @Success 200 {object} models.InvalidTaxIDReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /tax-ids/invalid [get]
+func (h *TaxIDHandler) GetInvalidTaxIDs(w http.ResponseWriter, r *http.Request) {
+	entity := models.TaxIDEntity(r.URL.Query().Get("entity_type"))
+	if entity != "" && !entity.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid entity_type, expected company, user or terminal")
+		logger.ErrorLogger.Printf("Invalid tax ID report entity_type %q", entity)
+		return
+	}
+
+	report, err := h.service.InvalidTaxIDs(r.Context(), entity)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not check stored tax IDs")
+		logger.ErrorLogger.Printf("Error in GetInvalidTaxIDs handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+func (h *TaxIDHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequirePermission(models.PermTaxIDReport))
+	r.Get("/invalid", h.GetInvalidTaxIDs)
+
+	return r
+}
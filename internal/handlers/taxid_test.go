@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository/memory"
+	"github.com/idkOybek/internal/taxid"
+)
+
+// expectInvalidTaxIDs проверяет число проверенных значений и найденные ошибки
+func expectInvalidTaxIDs(checked int, want ...models.InvalidTaxID) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		report := decode[models.InvalidTaxIDReport](t, rec)
+		if report.Checked != checked || len(report.Items) != len(want) {
+			t.Fatalf("unexpected report %+v", report)
+		}
+		for i := range want {
+			if report.Items[i] != want[i] {
+				t.Errorf("item %d: got %+v, want %+v", i, report.Items[i], want[i])
+			}
+		}
+	}
+}
+
+func TestTaxIDRoutes(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Значения, сохранённые до появления проверки ИНН, записываются в хранилище напрямую
+	ctx := context.Background()
+	companies := memory.NewCompanyRepository(env.store)
+	for _, inn := range []string{"302563851", "31507880123457"} {
+		if err := companies.Create(ctx, &models.Company{INN: inn, LegalName: "Legacy " + inn}, models.AuditMeta{}); err != nil {
+			t.Fatalf("seeding company %s: %v", inn, err)
+		}
+	}
+	legacy := &models.User{INN: "12345", Username: "legacy", Password: "hash", IsActive: true, Role: models.RoleOwner}
+	if err := memory.NewUserRepository(env.store).Create(ctx, legacy, models.AuditMeta{}); err != nil {
+		t.Fatalf("seeding user: %v", err)
+	}
+
+	badCompany := models.InvalidTaxID{TaxIDRecord: models.TaxIDRecord{EntityType: models.TaxIDCompany, EntityID: 5, INN: "302563851"}, Reason: taxid.ErrINNChecksum.Error()}
+	shortCompany := models.InvalidTaxID{TaxIDRecord: models.TaxIDRecord{EntityType: models.TaxIDCompany, EntityID: 7, INN: "12345"}, Reason: taxid.ErrUnknownTaxIDLen.Error()}
+	shortUser := models.InvalidTaxID{TaxIDRecord: models.TaxIDRecord{EntityType: models.TaxIDUser, EntityID: legacy.ID, INN: "12345"}, Reason: taxid.ErrUnknownTaxIDLen.Error()}
+	env.run(t, []apiCase{
+		{name: "report", as: "admin", method: http.MethodGet, path: "/api/tax-ids/invalid", status: http.StatusOK, check: expectInvalidTaxIDs(13, badCompany, shortCompany, shortUser)},
+		{name: "report companies", as: "admin", method: http.MethodGet, path: "/api/tax-ids/invalid?entity_type=company", status: http.StatusOK, check: expectInvalidTaxIDs(7, badCompany, shortCompany)},
+		{name: "report users", as: "admin", method: http.MethodGet, path: "/api/tax-ids/invalid?entity_type=user", status: http.StatusOK, check: expectInvalidTaxIDs(6, shortUser)},
+		{name: "report terminals", as: "admin", method: http.MethodGet, path: "/api/tax-ids/invalid?entity_type=terminal", status: http.StatusOK, check: expectInvalidTaxIDs(0)},
+		{name: "invalid entity type", as: "admin", method: http.MethodGet, path: "/api/tax-ids/invalid?entity_type=receipt", status: http.StatusBadRequest},
+		{name: "forbidden for dealer", as: "dealer", method: http.MethodGet, path: "/api/tax-ids/invalid", status: http.StatusForbidden},
+		{name: "forbidden for owner", as: "owner", method: http.MethodGet, path: "/api/tax-ids/invalid", status: http.StatusForbidden},
+	})
+}
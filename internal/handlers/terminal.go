@@ -1,14 +1,17 @@
 package handlers
 
 import (
-	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
 	"github.com/idkOybek/internal/models"
 	"github.com/idkOybek/internal/services"
+	"github.com/idkOybek/internal/tabular"
 	"github.com/idkOybek/internal/utils"
 )
 
@@ -21,31 +24,130 @@ func NewTerminalHandler(service *services.TerminalService) *TerminalHandler {
 }
 
 // @Summary Get all terminals
+// @Description Keyset-paginated list; non-admin users only see their own terminals
 // @Tags terminal
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {array} models.Terminal
-// @Failure 500 {object} map[string]string
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, inn, company_name, cash_register_number, free_record_balance, last_request_date)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param inn query string false "Exact INN"
+// @Param status query string false "Status" Enums(registered, active, suspended, blocked, decommissioned)
+// @Param user_id query int false "Owner user ID"
+// @Param company_name query string false "Company name substring"
+// @Param is_online query bool false "Online flag"
+// @Param last_request_from query string false "Last request not before (RFC 3339)"
+// @Param last_request_to query string false "Last request before (RFC 3339)"
+// @Success 200 {object} models.TerminalList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /terminal [get]
 func (h *TerminalHandler) GetAllTerminals(w http.ResponseWriter, r *http.Request) {
-	terminals, err := h.service.GetAllTerminals(r.Context())
+	filter, err := parseTerminalFilter(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not retrieve terminals")
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid terminal list parameters: %v", err)
+		return
+	}
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		filter.UserID = &userID
+	}
+
+	terminals, err := h.service.ListTerminals(r.Context(), filter)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve terminals")
 		logger.ErrorLogger.Printf("Error in GetAllTerminals handler: %v", err)
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, terminals)
 }
 
+// @Summary Export terminals
+// @Description Streams all terminals matching the list filters as CSV, XLSX or a printable PDF report, in the requested sort order; limit and cursor are ignored. Non-admin users only export their own terminals.
+// @Tags terminal
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param format query string false "File format (default csv); pdf is limited to 5000 rows, larger exports return 400" Enums(csv, xlsx, pdf)
+// @Param columns query string false "Comma-separated columns in output order (default all): id, inn, company_name, address, cash_register_number, module_number, assembly_number, status, is_online, last_request_date, database_update_date, user_id, free_record_balance, fiscal_module_id"
+// @Param sort query string false "Sort field" Enums(id, inn, company_name, cash_register_number, free_record_balance, last_request_date)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param inn query string false "Exact INN"
+// @Param status query string false "Status" Enums(registered, active, suspended, blocked, decommissioned)
+// @Param user_id query int false "Owner user ID"
+// @Param company_name query string false "Company name substring"
+// @Param is_online query bool false "Online flag"
+// @Param last_request_from query string false "Last request not before (RFC 3339)"
+// @Param last_request_to query string false "Last request before (RFC 3339)"
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/export [get]
+func (h *TerminalHandler) ExportTerminals(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTerminalFilter(r)
+	var format tabular.Format
+	var columns []string
+	if err == nil {
+		format, columns, err = parseExportParams(r)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid terminal export parameters: %v", err)
+		return
+	}
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		filter.UserID = &userID
+	}
+
+	serveExport(w, "terminals", format, func(out io.Writer) error {
+		return h.service.ExportTerminals(r.Context(), filter, format, columns, out)
+	})
+}
+
+func parseTerminalFilter(r *http.Request) (models.TerminalFilter, error) {
+	q := r.URL.Query()
+	filter := models.TerminalFilter{
+		INN:         q.Get("inn"),
+		Status:      models.TerminalStatus(q.Get("status")),
+		CompanyName: q.Get("company_name"),
+	}
+
+	if filter.Status != "" && !filter.Status.Valid() {
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	var err error
+	if filter.ListParams, err = parseListParams(r); err != nil {
+		return filter, err
+	}
+	if filter.UserID, err = queryInt(r, "user_id"); err != nil {
+		return filter, err
+	}
+	if filter.IsOnline, err = queryBool(r, "is_online"); err != nil {
+		return filter, err
+	}
+	if filter.LastRequestFrom, err = queryTime(r, "last_request_from"); err != nil {
+		return filter, err
+	}
+	if filter.LastRequestTo, err = queryTime(r, "last_request_to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
 // @Summary Get terminal by ID
 // @Tags terminal
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "Terminal ID"
 // @Success 200 {object} models.Terminal
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /terminal/{id} [get]
 func (h *TerminalHandler) GetTerminalByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -56,51 +158,76 @@ func (h *TerminalHandler) GetTerminalByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	terminal, err := h.service.GetTerminalByID(r.Context(), id)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Terminal not found")
-		logger.ErrorLogger.Printf("Error in GetTerminalByID handler: %v", err)
+	terminal, ok := h.authorizeTerminal(w, r, id)
+	if !ok {
 		return
 	}
+
+	if err := h.service.AttachFiscalModule(r.Context(), terminal); err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve fiscal module")
+		logger.ErrorLogger.Printf("Error attaching fiscal module to terminal %d: %v", id, err)
+		return
+	}
+	setETag(w, terminal.Version)
 	utils.RespondWithJSON(w, http.StatusOK, terminal)
 }
 
 // @Summary Create a new terminal
+// @Description Creates the company with the terminal's INN named company_name if it does not exist yet. If it exists, company_name must equal its legal name, otherwise 409 is returned.
 // @Tags terminal
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Param terminal body models.Terminal true "New terminal data"
+// @Param terminal body models.TerminalCreateRequest true "New terminal data"
 // @Success 201 {object} models.Terminal
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 201 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /terminal [post]
 func (h *TerminalHandler) CreateTerminal(w http.ResponseWriter, r *http.Request) {
 	var terminal models.TerminalCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&terminal); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding terminal creation request: %v", err)
+	if !decodeJSON(w, r, &terminal) {
 		return
 	}
 
-	if err := h.service.CreateTerminal(r.Context(), &terminal); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create terminal")
+	// Владелец подставляется до проверки, чтобы не требовать user_id от не-администраторов
+	if !h.assignOwner(w, r, &terminal.UserID) || !validateRequest(w, &terminal) {
+		return
+	}
+
+	created, err := h.service.CreateTerminal(r.Context(), &terminal)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to create terminal")
 		logger.ErrorLogger.Printf("Error in CreateTerminal handler: %v", err)
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusCreated, terminal)
+	setETag(w, created.Version)
+	utils.RespondWithJSON(w, http.StatusCreated, created)
 }
 
 // @Summary Update terminal
+// @Description Partial update: only the fields present in the body are changed. An empty module_number unbinds the fiscal module. Balance and status have their own endpoints. Returns the stored terminal.
 // @Tags terminal
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Terminal ID"
-// @Param terminal body models.Terminal true "Updated terminal data"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param terminal body models.TerminalUpdateRequest true "Fields to change"
 // @Success 200 {object} models.Terminal
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200 {string} ETag "Version of the stored record"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id} [patch]
 // @Router /terminal/{id} [put]
 func (h *TerminalHandler) UpdateTerminal(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -111,20 +238,35 @@ func (h *TerminalHandler) UpdateTerminal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var terminal models.Terminal
-	if err := json.NewDecoder(r.Body).Decode(&terminal); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding terminal update request: %v", err)
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var patch models.TerminalUpdateRequest
+	if !decodeRequest(w, r, &patch) {
 		return
 	}
 
-	terminal.ID = id
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return
+	}
+	if patch.UserID != nil && !h.assignOwner(w, r, patch.UserID) {
+		return
+	}
 
-	if err := h.service.UpdateTerminal(r.Context(), &terminal); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update terminal")
+	terminal, err := h.service.UpdateTerminal(r.Context(), id, version, &patch)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to update terminal")
 		logger.ErrorLogger.Printf("Error in UpdateTerminal handler: %v", err)
 		return
 	}
+	if err := h.service.AttachFiscalModule(r.Context(), terminal); err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve fiscal module")
+		logger.ErrorLogger.Printf("Error attaching fiscal module to terminal %d: %v", id, err)
+		return
+	}
+	setETag(w, terminal.Version)
 	utils.RespondWithJSON(w, http.StatusOK, terminal)
 }
 
@@ -133,9 +275,14 @@ func (h *TerminalHandler) UpdateTerminal(w http.ResponseWriter, r *http.Request)
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "Terminal ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /terminal/{id} [delete]
 func (h *TerminalHandler) DeleteTerminal(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -146,22 +293,111 @@ func (h *TerminalHandler) DeleteTerminal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.service.DeleteTerminal(r.Context(), id); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete terminal")
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return
+	}
+
+	if err := h.service.DeleteTerminal(r.Context(), id, version); err != nil {
+		utils.RespondWithAppError(w, err, "Failed to delete terminal")
 		logger.ErrorLogger.Printf("Error in DeleteTerminal handler: %v", err)
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, "Terminal deleted")
 }
 
+// @Summary Terminal check-in
+// @Description Stamps last_request_date, marks the terminal online and reports whether its local database must be resynced
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param checkin body models.TerminalCheckInRequest true "Check-in data"
+// @Success 200 {object} models.TerminalCheckInResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/check-in [post]
+func (h *TerminalHandler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	var req models.TerminalCheckInRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	var ownerID *int
+	if userID, scoped := middleware.OwnerScope(r.Context()); scoped {
+		ownerID = &userID
+	}
+
+	response, err := h.service.CheckIn(r.Context(), &req, ownerID)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to check in terminal")
+		logger.ErrorLogger.Printf("Error in CheckIn handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// authorizeTerminal загружает торговую точку и проверяет, что текущий пользователь
+// вправе с ней работать. При отказе ответ уже отправлен.
+func (h *TerminalHandler) authorizeTerminal(w http.ResponseWriter, r *http.Request, id int) (*models.Terminal, bool) {
+	terminal, err := h.service.GetTerminalByID(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve terminal")
+		logger.ErrorLogger.Printf("Error loading terminal %d: %v", id, err)
+		return nil, false
+	}
+	if !middleware.CanAccessOwned(r.Context(), terminal.UserID) {
+		middleware.RespondForbidden(w)
+		return nil, false
+	}
+	return terminal, true
+}
+
+// assignOwner закрепляет торговую точку за текущим пользователем, если он не администратор.
+// Назначить точку другому пользователю может только администратор.
+func (h *TerminalHandler) assignOwner(w http.ResponseWriter, r *http.Request, userID *int) bool {
+	ownerID, scoped := middleware.OwnerScope(r.Context())
+	if !scoped {
+		return true
+	}
+	if *userID != 0 && *userID != ownerID {
+		middleware.RespondForbidden(w)
+		return false
+	}
+	*userID = ownerID
+	return true
+}
+
 func (h *TerminalHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", h.GetAllTerminals)
-	r.Post("/", h.CreateTerminal)
-	r.Get("/{id}", h.GetTerminalByID)
-	r.Put("/{id}", h.UpdateTerminal)
-	r.Delete("/{id}", h.DeleteTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/", h.GetAllTerminals)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/export", h.ExportTerminals)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Post("/", h.CreateTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsCheckIn)).Post("/check-in", h.CheckIn)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/{id}", h.GetTerminalByID)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Patch("/{id}", h.UpdateTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Put("/{id}", h.UpdateTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Delete("/{id}", h.DeleteTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Post("/{id}/activate", h.ActivateTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Post("/{id}/suspend", h.SuspendTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsBlock)).Post("/{id}/block", h.BlockTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsWrite)).Post("/{id}/decommission", h.DecommissionTerminal)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/{id}/status-history", h.GetStatusHistory)
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/{id}/shift", h.GetOpenShift)
+	r.With(middleware.RequirePermission(models.PermReceiptsWrite)).Post("/{id}/shift/open", h.OpenShift)
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/{id}/shift/x-report", h.XReport)
+	r.With(middleware.RequirePermission(models.PermReceiptsWrite)).Post("/{id}/shift/close", h.CloseShift)
+	r.With(middleware.RequirePermission(models.PermReceiptsRead)).Get("/{id}/z-reports", h.GetZReports)
+	r.With(middleware.RequirePermission(models.PermTerminalsRead)).Get("/{id}/balance", h.GetBalance)
+	r.With(middleware.RequirePermission(models.PermBalanceManage)).Post("/{id}/balance/top-up", h.TopUpBalance)
+	r.With(middleware.RequirePermission(models.PermBalanceConsume)).Post("/{id}/balance/consume", h.ConsumeBalance)
+	r.With(middleware.RequirePermission(models.PermBalanceManage)).Post("/{id}/balance/adjust", h.AdjustBalance)
 
 	return r
 }
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/utils"
+)
+
+// @Summary Activate terminal
+// @Description Moves a registered, suspended or blocked terminal to active. Unblocking requires the terminals:block permission.
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.TerminalStatusChangeRequest true "Reason for the transition"
+// @Success 200 {object} models.Terminal
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/activate [post]
+func (h *TerminalHandler) ActivateTerminal(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.TerminalActive)
+}
+
+// @Summary Suspend terminal
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.TerminalStatusChangeRequest true "Reason for the transition"
+// @Success 200 {object} models.Terminal
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/suspend [post]
+func (h *TerminalHandler) SuspendTerminal(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.TerminalSuspended)
+}
+
+// @Summary Block terminal
+// @Description A blocked terminal cannot consume free records
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.TerminalStatusChangeRequest true "Reason for the transition"
+// @Success 200 {object} models.Terminal
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/block [post]
+func (h *TerminalHandler) BlockTerminal(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.TerminalBlocked)
+}
+
+// @Summary Decommission terminal
+// @Description Final state: the terminal goes offline and its fiscal module is released. A terminal with an open shift is rejected with 409 until the shift is closed with a Z-report.
+// @Tags terminal
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Param change body models.TerminalStatusChangeRequest true "Reason for the transition"
+// @Success 200 {object} models.Terminal
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/decommission [post]
+func (h *TerminalHandler) DecommissionTerminal(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.TerminalDecommissioned)
+}
+
+// @Summary Get terminal status history
+// @Tags terminal
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Terminal ID"
+// @Success 200 {array} models.TerminalStatusChange
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /terminal/{id}/status-history [get]
+func (h *TerminalHandler) GetStatusHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		logger.ErrorLogger.Printf("Invalid terminal ID: %v", err)
+		return
+	}
+
+	if _, ok := h.authorizeTerminal(w, r, id); !ok {
+		return
+	}
+
+	history, err := h.service.GetStatusHistory(r.Context(), id)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Could not retrieve status history")
+		logger.ErrorLogger.Printf("Error in GetStatusHistory handler: %v", err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, history)
+}
+
+func (h *TerminalHandler) changeStatus(w http.ResponseWriter, r *http.Request, to models.TerminalStatus) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		logger.ErrorLogger.Printf("Invalid terminal ID: %v", err)
+		return
+	}
+
+	var req models.TerminalStatusChangeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	terminal, ok := h.authorizeTerminal(w, r, id)
+	if !ok {
+		return
+	}
+
+	// Снять блокировку может только тот, кто вправе блокировать
+	if terminal.Status == models.TerminalBlocked && !middleware.HasPermission(r.Context(), models.PermTerminalsBlock) {
+		middleware.RespondForbidden(w)
+		return
+	}
+
+	updated, err := h.service.ChangeStatus(r.Context(), id, to, actorID(r), req.Reason)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to change terminal status")
+		logger.ErrorLogger.Printf("Error changing status of terminal %d: %v", id, err)
+		return
+	}
+	setETag(w, updated.Version)
+	utils.RespondWithJSON(w, http.StatusOK, updated)
+}
@@ -0,0 +1,311 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// newTerminal — тело запроса на создание торговой точки компании «Spare LLC»
+func newTerminal(cashRegister, moduleNumber string, userID int) map[string]interface{} {
+	return map[string]interface{}{
+		"inn":                  innSpare,
+		"company_name":         "Spare LLC",
+		"address":              "Tashkent, Amir Temur 1",
+		"cash_register_number": cashRegister,
+		"module_number":        moduleNumber,
+		"assembly_number":      "A-" + cashRegister,
+		"user_id":              userID,
+		"free_record_balance":  10,
+	}
+}
+
+// expectTerminal проверяет статус торговой точки и её версию в ETag
+func expectTerminal(status models.TerminalStatus, version int) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return all(expectETag(version), func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if terminal := decode[models.Terminal](t, rec); terminal.Status != status || terminal.Version != version {
+			t.Errorf("status %q version %d, want %q version %d", terminal.Status, terminal.Version, status, version)
+		}
+	})
+}
+
+// expectBalanceAfter проверяет остаток после движения баланса
+func expectBalanceAfter(balance int) func(t *testing.T, rec *httptest.ResponseRecorder) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if movement := decode[models.BalanceMovement](t, rec); movement.BalanceAfter != balance {
+			t.Errorf("balance after %d, want %d", movement.BalanceAfter, balance)
+		}
+	}
+}
+
+func reason(text string) map[string]string {
+	return map[string]string{"reason": text}
+}
+
+func TestTerminalRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	owner, other := env.users["owner"].ID, env.users["other"].ID
+	env.run(t, []apiCase{
+		{name: "create module 1", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-1", "FN-1", owner), status: http.StatusCreated},
+		{name: "create module 2", as: "admin", method: http.MethodPost, path: "/api/fiscal/", body: newModule("F-2", "FN-2", other), status: http.StatusCreated},
+
+		{
+			name: "create", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-1", "FN-1", owner), status: http.StatusCreated,
+			check: all(expectETag(1), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				created := decode[models.Terminal](t, rec)
+				if created.ID != 1 || created.CashRegisterNumber != "CR-1" || created.UserID != owner || created.Status != models.TerminalRegistered {
+					t.Errorf("unexpected terminal %+v", created)
+				}
+			}),
+		},
+		{
+			name: "create with unknown module", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-9", "FN-9", owner), status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeInvalidReference, "module_number"),
+		},
+		{
+			name: "create with bound module", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-9", "F-1", owner), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "module_number"),
+		},
+		{
+			name: "create duplicate cash register", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-1", "FN-2", other), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "cash_register_number"),
+		},
+		{
+			name: "create for unknown user", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-9", "FN-2", 999), status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeInvalidReference, "user_id"),
+		},
+		{
+			name: "create with invalid INN", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: map[string]interface{}{
+				"inn": "302563851", "company_name": "Bad", "address": "x", "cash_register_number": "CR-9",
+				"module_number": "FN-2", "assembly_number": "A-9", "user_id": other,
+			},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "inn"),
+		},
+		{
+			name: "create with negative balance", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: map[string]interface{}{
+				"inn": innSpare, "company_name": "Spare LLC", "address": "x", "cash_register_number": "CR-9",
+				"module_number": "FN-2", "assembly_number": "A-9", "user_id": other, "free_record_balance": -1,
+			},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "free_record_balance"),
+		},
+		{name: "create forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-9", "FN-2", 0), status: http.StatusForbidden},
+		{
+			name: "dealer cannot create terminal for another user", as: "dealer", method: http.MethodPost, path: "/api/terminal/",
+			body: newTerminal("CR-9", "FN-2", other), status: http.StatusForbidden,
+		},
+		{
+			// Существующую компанию создание кассы не переименовывает, поэтому другое название отклоняется
+			name: "create with another company name", as: "admin", method: http.MethodPost, path: "/api/terminal/",
+			body: map[string]interface{}{
+				"inn": innSpare, "company_name": "Renamed LLC", "address": "x", "cash_register_number": "CR-9",
+				"module_number": "FN-2", "assembly_number": "A-9", "user_id": other,
+			},
+			status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "company_name"),
+		},
+		{name: "create second", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-2", "F-2", other), status: http.StatusCreated},
+
+		{name: "list all", as: "admin", method: http.MethodGet, path: "/api/terminal/", status: http.StatusOK, check: expectTotal[models.Terminal](2, 2)},
+		{name: "list scoped to owner", as: "owner", method: http.MethodGet, path: "/api/terminal/", status: http.StatusOK, check: expectTotal[models.Terminal](1, 1)},
+		{name: "list by status", as: "admin", method: http.MethodGet, path: "/api/terminal/?status=active", status: http.StatusOK, check: expectTotal[models.Terminal](0, 0)},
+		{name: "list by company", as: "admin", method: http.MethodGet, path: "/api/terminal/?company_name=spare&sort=company_name", status: http.StatusOK, check: expectTotal[models.Terminal](2, 2)},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/terminal/?limit=1&sort=cash_register_number&order=desc", status: http.StatusOK, check: expectTotal[models.Terminal](1, 2)},
+		{name: "list invalid status", as: "admin", method: http.MethodGet, path: "/api/terminal/?status=lost", status: http.StatusBadRequest},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/terminal/?sort=address", status: http.StatusBadRequest},
+		{name: "list forbidden without permission", as: "", method: http.MethodGet, path: "/api/terminal/", status: http.StatusUnauthorized},
+		{
+			name: "export", as: "owner", method: http.MethodGet, path: "/api/terminal/export?columns=cash_register_number", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if body := strings.TrimSpace(rec.Body.String()); !strings.HasSuffix(body, "\nCR-1") || strings.Contains(body, "CR-2") {
+					t.Errorf("unexpected export %q", body)
+				}
+			},
+		},
+
+		{
+			name: "check in", as: "owner", method: http.MethodPost, path: "/api/terminal/check-in",
+			body: map[string]string{"cash_register_number": "CR-1", "module_number": "FN-1"}, status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if resp := decode[models.TerminalCheckInResponse](t, rec); resp.TerminalID != 1 || !resp.IsOnline || resp.MustResync {
+					t.Errorf("unexpected check-in response %+v", resp)
+				}
+			},
+		},
+		{
+			name: "check in foreign terminal", as: "owner", method: http.MethodPost, path: "/api/terminal/check-in",
+			body: map[string]string{"cash_register_number": "CR-2", "module_number": "F-2"}, status: http.StatusNotFound,
+		},
+		{
+			name: "check in without module", as: "owner", method: http.MethodPost, path: "/api/terminal/check-in",
+			body: map[string]string{"cash_register_number": "CR-1"}, status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "module_number"),
+		},
+		{name: "list online", as: "admin", method: http.MethodGet, path: "/api/terminal/?is_online=true", status: http.StatusOK, check: expectTotal[models.Terminal](1, 1)},
+
+		{
+			name: "get", as: "owner", method: http.MethodGet, path: "/api/terminal/1", status: http.StatusOK,
+			check: all(expectTerminal(models.TerminalRegistered, 1), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				terminal := decode[models.Terminal](t, rec)
+				if terminal.CompanyName != "Spare LLC" || terminal.FiscalModule == nil || terminal.FiscalModule.FactoryNumber != "F-1" {
+					t.Errorf("unexpected terminal %+v", terminal)
+				}
+			}),
+		},
+		{name: "get foreign", as: "owner", method: http.MethodGet, path: "/api/terminal/2", status: http.StatusForbidden},
+		{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/terminal/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+		{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/terminal/x", status: http.StatusBadRequest},
+
+		{name: "update without If-Match", as: "dealer", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"address": "Samarkand"}, status: http.StatusPreconditionRequired},
+		{name: "dealer cannot update foreign terminal", as: "dealer", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"address": "Samarkand"}, ifMatch: 1, status: http.StatusForbidden},
+		{name: "update forbidden for owner", as: "owner", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"address": "Samarkand"}, ifMatch: 1, status: http.StatusForbidden},
+		{
+			name: "update", as: "admin", method: http.MethodPatch, path: "/api/terminal/1",
+			body: map[string]string{"address": "Samarkand"}, ifMatch: 1, status: http.StatusOK,
+			check: all(expectTerminal(models.TerminalRegistered, 2), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.Address != "Samarkand" || terminal.CashRegisterNumber != "CR-1" {
+					t.Errorf("unexpected terminal %+v", terminal)
+				}
+			}),
+		},
+		{name: "update stale version", as: "admin", method: http.MethodPut, path: "/api/terminal/1", body: map[string]string{"address": "Bukhara"}, ifMatch: 1, status: http.StatusPreconditionFailed},
+		{
+			name: "update to bound module", as: "admin", method: http.MethodPatch, path: "/api/terminal/1",
+			body: map[string]string{"module_number": "FN-2"}, ifMatch: 2, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "module_number"),
+		},
+		{
+			name: "update duplicate cash register", as: "admin", method: http.MethodPatch, path: "/api/terminal/1",
+			body: map[string]string{"cash_register_number": "CR-2"}, ifMatch: 2, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "cash_register_number"),
+		},
+		{
+			name: "update balance field rejected", as: "admin", method: http.MethodPatch, path: "/api/terminal/1",
+			body: map[string]int{"free_record_balance": 100}, ifMatch: 2, status: http.StatusBadRequest,
+		},
+
+		{name: "activate without reason", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason(" "), status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, "reason")},
+		{name: "activate forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("installed"), status: http.StatusForbidden},
+		{name: "activate", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("installed"), status: http.StatusOK, check: expectTerminal(models.TerminalActive, 3)},
+		{name: "activate twice", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("again"), status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "")},
+		{name: "suspend", as: "admin", method: http.MethodPost, path: "/api/terminal/1/suspend", body: reason("seasonal"), status: http.StatusOK, check: expectTerminal(models.TerminalSuspended, 4)},
+		{name: "block forbidden for dealer", as: "dealer", method: http.MethodPost, path: "/api/terminal/1/block", body: reason("debt"), status: http.StatusForbidden},
+		{name: "block", as: "admin", method: http.MethodPost, path: "/api/terminal/1/block", body: reason("debt"), status: http.StatusOK, check: expectTerminal(models.TerminalBlocked, 5)},
+		{name: "consume while blocked", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 1}, status: http.StatusConflict},
+		{name: "unblock", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("paid"), status: http.StatusOK, check: expectTerminal(models.TerminalActive, 6)},
+		{
+			name: "status history", as: "owner", method: http.MethodGet, path: "/api/terminal/1/status-history", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				history := decode[[]models.TerminalStatusChange](t, rec)
+				if len(history) != 4 {
+					t.Fatalf("got %d status changes, want 4", len(history))
+				}
+				for _, change := range history {
+					if change.ActorID == nil || *change.ActorID != env.users["admin"].ID || change.Reason == "" {
+						t.Errorf("unexpected status change %+v", change)
+					}
+				}
+			},
+		},
+		{name: "status history of foreign terminal", as: "owner", method: http.MethodGet, path: "/api/terminal/2/status-history", status: http.StatusForbidden},
+
+		{name: "no open shift", as: "owner", method: http.MethodGet, path: "/api/terminal/1/shift", status: http.StatusConflict},
+		{name: "x-report without shift", as: "owner", method: http.MethodGet, path: "/api/terminal/1/shift/x-report", status: http.StatusConflict},
+		{name: "open shift on registered terminal", as: "other", method: http.MethodPost, path: "/api/terminal/2/shift/open", status: http.StatusConflict},
+		{name: "open shift on foreign terminal", as: "other", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusForbidden},
+		{name: "open shift forbidden for viewer", as: "viewer", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusForbidden},
+		{
+			name: "open shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if shift := decode[models.Shift](t, rec); shift.ID != 1 || shift.FiscalModuleID != 1 || shift.ClosedAt != nil {
+					t.Errorf("unexpected shift %+v", shift)
+				}
+			},
+		},
+		{name: "open second shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusConflict},
+		{name: "get open shift", as: "owner", method: http.MethodGet, path: "/api/terminal/1/shift", status: http.StatusOK},
+		{
+			name: "x-report", as: "owner", method: http.MethodGet, path: "/api/terminal/1/shift/x-report", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if report := decode[models.ShiftReport](t, rec); report.ShiftID != 1 || report.ClosedAt != nil {
+					t.Errorf("unexpected X-report %+v", report)
+				}
+			},
+		},
+		{
+			name: "close shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/close", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if report := decode[models.ZReport](t, rec); report.ReportNumber != 1 || report.Report.ClosedAt == nil {
+					t.Errorf("unexpected Z-report %+v", report)
+				}
+			},
+		},
+		{name: "close closed shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/close", status: http.StatusConflict},
+		{name: "reopen shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/open", status: http.StatusCreated},
+		{name: "close reopened shift", as: "owner", method: http.MethodPost, path: "/api/terminal/1/shift/close", status: http.StatusOK},
+		{
+			name: "z-reports", as: "owner", method: http.MethodGet, path: "/api/terminal/1/z-reports", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				reports := decode[[]models.ZReport](t, rec)
+				if len(reports) != 2 || reports[0].ReportNumber != 1 || reports[1].ReportNumber != 2 {
+					t.Errorf("unexpected Z-reports %+v", reports)
+				}
+			},
+		},
+
+		{name: "consume", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 3, "reason": "receipts"}, status: http.StatusOK, check: expectBalanceAfter(7)},
+		{name: "consume more than balance", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 100}, status: http.StatusConflict},
+		{name: "consume nothing", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 0}, status: http.StatusBadRequest},
+		{name: "consume on foreign terminal", as: "other", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 1}, status: http.StatusForbidden},
+		{name: "top up forbidden for owner", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/top-up", body: map[string]interface{}{"amount": 5}, status: http.StatusForbidden},
+		{name: "top up", as: "admin", method: http.MethodPost, path: "/api/terminal/1/balance/top-up", body: map[string]interface{}{"amount": 5, "reason": "payment"}, status: http.StatusOK, check: expectBalanceAfter(12)},
+		{name: "top up negative", as: "admin", method: http.MethodPost, path: "/api/terminal/1/balance/top-up", body: map[string]interface{}{"amount": -5}, status: http.StatusBadRequest},
+		{name: "adjust down", as: "admin", method: http.MethodPost, path: "/api/terminal/1/balance/adjust", body: map[string]interface{}{"amount": -2, "reason": "correction"}, status: http.StatusOK, check: expectBalanceAfter(10)},
+		{name: "adjust below zero", as: "admin", method: http.MethodPost, path: "/api/terminal/1/balance/adjust", body: map[string]interface{}{"amount": -11}, status: http.StatusConflict},
+		{name: "balance of missing terminal", as: "admin", method: http.MethodPost, path: "/api/terminal/999/balance/top-up", body: map[string]interface{}{"amount": 1}, status: http.StatusNotFound},
+		{
+			name: "balance", as: "owner", method: http.MethodGet, path: "/api/terminal/1/balance", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				balance := decode[models.TerminalBalanceResponse](t, rec)
+				if balance.Balance != 10 || balance.LedgerTotal != 10 || len(balance.History) != 4 {
+					t.Errorf("unexpected balance %+v", balance)
+				}
+			},
+		},
+		// Каждое движение баланса меняет представление кассы и увеличивает её версию
+		{name: "update stale after balance movements", as: "admin", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"address": "Nukus"}, ifMatch: 6, status: http.StatusPreconditionFailed},
+		{name: "get after balance movements", as: "admin", method: http.MethodGet, path: "/api/terminal/1", status: http.StatusOK, check: expectETag(9)},
+
+		{name: "delete terminal with shifts", as: "admin", method: http.MethodDelete, path: "/api/terminal/1", ifMatch: 9, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "")},
+		{
+			name: "decommission", as: "admin", method: http.MethodPost, path: "/api/terminal/1/decommission", body: reason("closed"), status: http.StatusOK,
+			check: all(expectTerminal(models.TerminalDecommissioned, 10), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if terminal := decode[models.Terminal](t, rec); terminal.FiscalModuleID != nil || terminal.IsOnline {
+					t.Errorf("decommissioned terminal keeps its module or stays online: %+v", terminal)
+				}
+			}),
+		},
+		{name: "update decommissioned", as: "admin", method: http.MethodPatch, path: "/api/terminal/1", body: map[string]string{"address": "Nukus"}, ifMatch: 10, status: http.StatusConflict},
+		{name: "activate decommissioned", as: "admin", method: http.MethodPost, path: "/api/terminal/1/activate", body: reason("back"), status: http.StatusConflict},
+		{name: "consume on decommissioned", as: "owner", method: http.MethodPost, path: "/api/terminal/1/balance/consume", body: map[string]interface{}{"amount": 1}, status: http.StatusConflict},
+		{name: "freed module can be bound again", as: "admin", method: http.MethodPost, path: "/api/terminal/", body: newTerminal("CR-3", "F-1", owner), status: http.StatusCreated},
+
+		{name: "delete without If-Match", as: "admin", method: http.MethodDelete, path: "/api/terminal/2", status: http.StatusPreconditionRequired},
+		{name: "delete stale version", as: "admin", method: http.MethodDelete, path: "/api/terminal/2", ifMatch: 2, status: http.StatusPreconditionFailed},
+		{name: "delete forbidden for owner", as: "other", method: http.MethodDelete, path: "/api/terminal/2", ifMatch: 1, status: http.StatusForbidden},
+		{
+			name: "delete", as: "admin", method: http.MethodDelete, path: "/api/terminal/2", ifMatch: 1, status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if msg := decode[string](t, rec); msg != "Terminal deleted" {
+					t.Errorf("message %q", msg)
+				}
+			},
+		},
+		{name: "get deleted", as: "admin", method: http.MethodGet, path: "/api/terminal/2", status: http.StatusNotFound},
+		{name: "module of deleted terminal is free", as: "admin", method: http.MethodDelete, path: "/api/fiscal/2", ifMatch: 1, status: http.StatusOK},
+	})
+}
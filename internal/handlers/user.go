@@ -1,12 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
 	"github.com/idkOybek/internal/models"
 	"github.com/idkOybek/internal/services"
 	"github.com/idkOybek/internal/utils"
@@ -21,16 +21,42 @@ func NewUserHandler(service *services.UserService) *UserHandler {
 }
 
 // @Summary Get all users
+// @Description Keyset-paginated list of users
 // @Tags user
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {array} models.User
-// @Failure 500 {object} map[string]string
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param sort query string false "Sort field" Enums(id, inn, username)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param inn query string false "Exact INN"
+// @Param username query string false "Username substring"
+// @Param role query string false "Role"
+// @Param is_active query bool false "Active flag"
+// @Success 200 {object} models.UserList
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /users [get]
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.service.GetAllUsers(r.Context())
+	filter := models.UserFilter{
+		INN:      r.URL.Query().Get("inn"),
+		Username: r.URL.Query().Get("username"),
+		Role:     models.Role(r.URL.Query().Get("role")),
+	}
+	var err error
+	if filter.ListParams, err = parseListParams(r); err == nil {
+		filter.IsActive, err = queryBool(r, "is_active")
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid user list parameters: %v", err)
+		return
+	}
+
+	users, err := h.service.ListUsers(r.Context(), filter)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		utils.RespondWithAppError(w, err, "Failed to retrieve users")
 		logger.ErrorLogger.Printf("Error retrieving users: %v", err)
 		return
 	}
@@ -42,10 +68,12 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "Record version for If-Match"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -56,13 +84,20 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Не администраторы могут просматривать только собственную учётную запись
+	if !middleware.CanAccessOwned(r.Context(), id) {
+		middleware.RespondForbidden(w)
+		return
+	}
+
 	user, err := h.service.GetUserByID(r.Context(), id)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "User not found")
-		logger.ErrorLogger.Printf("User not found: %v", err)
+		utils.RespondWithAppError(w, err, "Failed to retrieve user")
+		logger.ErrorLogger.Printf("Error retrieving user %d: %v", id, err)
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, user)
+	setETag(w, user.Version)
+	utils.RespondWithJSON(w, http.StatusOK, models.NewUserResponse(user))
 }
 
 // @Summary Create a new user
@@ -70,16 +105,17 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Param user body models.UserRegistrationRequest true "New user data"
-// @Success 201 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Param user body models.UserCreateRequest true "New user data"
+// @Success 201 {object} models.UserResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /users [post]
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var userRequest models.UserRegistrationRequest
-	if err := json.NewDecoder(r.Body).Decode(&userRequest); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding user creation request: %v", err)
+	var userRequest models.UserCreateRequest
+	if !decodeRequest(w, r, &userRequest) {
 		return
 	}
 
@@ -89,26 +125,37 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Password: userRequest.Password,
 		IsActive: userRequest.IsActive,
 		IsAdmin:  userRequest.IsAdmin,
+		Role:     userRequest.Role,
 	}
 
 	if err := h.service.CreateUser(r.Context(), user); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		utils.RespondWithAppError(w, err, "Failed to create user")
 		logger.ErrorLogger.Printf("Error creating user: %v", err)
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusCreated, user)
+	utils.RespondWithJSON(w, http.StatusCreated, models.NewUserResponse(user))
 }
 
 // @Summary Update user
+// @Description Partial update: only the fields present in the body are changed. A new password is stored hashed. Returns the stored user.
 // @Tags user
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param user body models.UserUpdateRequest true "Updated user data"
-// @Success 200 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param user body models.UserUpdateRequest true "Fields to change"
+// @Success 200 {object} models.UserResponse
+// @Header 200 {string} ETag "Version of the stored record"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /users/{id} [patch]
 // @Router /users/{id} [put]
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -119,28 +166,24 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userRequest models.UserUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&userRequest); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		logger.ErrorLogger.Printf("Error decoding user update request: %v", err)
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
 		return
 	}
 
-	user := &models.User{
-		ID:       id,
-		INN:      userRequest.INN,
-		Username: userRequest.Username,
-		Password: userRequest.Password,
-		IsActive: userRequest.IsActive,
-		IsAdmin:  userRequest.IsAdmin,
+	var patch models.UserUpdateRequest
+	if !decodeRequest(w, r, &patch) {
+		return
 	}
 
-	if err := h.service.UpdateUser(r.Context(), user); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
+	user, err := h.service.UpdateUser(r.Context(), id, version, &patch)
+	if err != nil {
+		utils.RespondWithAppError(w, err, "Failed to update user")
 		logger.ErrorLogger.Printf("Error updating user: %v", err)
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, user)
+	setETag(w, user.Version)
+	utils.RespondWithJSON(w, http.StatusOK, models.NewUserResponse(user))
 }
 
 // @Summary Delete user
@@ -148,9 +191,16 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "User ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param reassign_to query int false "User ID to hand the deleted user's terminals and fiscal modules over to"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
 // @Router /users/{id} [delete]
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
@@ -161,8 +211,20 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.DeleteUser(r.Context(), id); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete user")
+	reassignTo, err := queryInt(r, "reassign_to")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		logger.ErrorLogger.Printf("Invalid user deletion parameters: %v", err)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteUser(r.Context(), id, version, reassignTo); err != nil {
+		utils.RespondWithAppError(w, err, "Failed to delete user")
 		logger.ErrorLogger.Printf("Error deleting user: %v", err)
 		return
 	}
@@ -172,11 +234,14 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", h.GetAllUsers)
-	r.Post("/", h.CreateUser)
+	r.With(middleware.RequirePermission(models.PermUsersManage)).Get("/", h.GetAllUsers)
+	r.With(middleware.RequirePermission(models.PermUsersManage)).Post("/", h.CreateUser)
+	// Собственную учётную запись читает любой вошедший пользователь, поэтому отдельного
+	// права на чтение нет: GetUserByID сам ограничивает не-администраторов своей записью
 	r.Get("/{id}", h.GetUserByID)
-	r.Put("/{id}", h.UpdateUser)
-	r.Delete("/{id}", h.DeleteUser)
+	r.With(middleware.RequirePermission(models.PermUsersManage)).Patch("/{id}", h.UpdateUser)
+	r.With(middleware.RequirePermission(models.PermUsersManage)).Put("/{id}", h.UpdateUser)
+	r.With(middleware.RequirePermission(models.PermUsersManage)).Delete("/{id}", h.DeleteUser)
 
 	return r
 }
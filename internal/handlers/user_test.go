@@ -0,0 +1,173 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// expectNoPassword проверяет, что хеш пароля не попал в ответ
+func expectNoPassword(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	if strings.Contains(rec.Body.String(), `"password"`) {
+		t.Errorf("response contains the password hash: %s", rec.Body)
+	}
+}
+
+func TestUserRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, []apiCase{
+		{name: "list", as: "admin", method: http.MethodGet, path: "/api/users/", status: http.StatusOK, check: all(expectTotal[models.UserResponse](5, 5), expectNoPassword)},
+		{name: "list page", as: "admin", method: http.MethodGet, path: "/api/users/?limit=2&sort=username", status: http.StatusOK, check: expectTotal[models.UserResponse](2, 5)},
+		{name: "list filtered by role", as: "admin", method: http.MethodGet, path: "/api/users/?role=owner", status: http.StatusOK, check: expectTotal[models.UserResponse](2, 2)},
+		{name: "list invalid sort", as: "admin", method: http.MethodGet, path: "/api/users/?sort=password", status: http.StatusBadRequest},
+		{name: "list invalid cursor", as: "admin", method: http.MethodGet, path: "/api/users/?cursor=garbage", status: http.StatusBadRequest},
+		{name: "list forbidden for dealer", as: "dealer", method: http.MethodGet, path: "/api/users/", status: http.StatusForbidden, check: expectError(apperrors.CodeForbidden, "")},
+
+		{
+			name: "create", as: "admin", method: http.MethodPost, path: "/api/users/",
+			body:   map[string]interface{}{"inn": innSpare, "username": "tech", "password": "pw", "is_active": true, "role": "technician"},
+			status: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				user := decode[map[string]interface{}](t, rec)
+				if _, leaked := user["password"]; leaked {
+					t.Error("response contains the password hash")
+				}
+				if user["id"] != float64(6) || user["role"] != "technician" || user["version"] != float64(1) {
+					t.Errorf("unexpected user %v", user)
+				}
+			},
+		},
+		{
+			name: "create duplicate username", as: "admin", method: http.MethodPost, path: "/api/users/",
+			body:   map[string]interface{}{"inn": innSpare, "username": "tech", "password": "pw"},
+			status: http.StatusConflict, check: expectError(apperrors.CodeConflict, "username"),
+		},
+		{
+			name: "create unknown role", as: "admin", method: http.MethodPost, path: "/api/users/",
+			body:   map[string]interface{}{"inn": innSpare, "username": "root", "password": "pw", "role": "root"},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "role"),
+		},
+		{
+			name: "create invalid INN", as: "admin", method: http.MethodPost, path: "/api/users/",
+			body:   map[string]interface{}{"inn": "12345", "username": "short-inn", "password": "pw"},
+			status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeValidation, "inn"),
+		},
+		{
+			name: "create forbidden for dealer", as: "dealer", method: http.MethodPost, path: "/api/users/",
+			body:   map[string]interface{}{"inn": innSpare, "username": "dealer-made", "password": "pw"},
+			status: http.StatusForbidden,
+		},
+
+		{name: "get", as: "admin", method: http.MethodGet, path: "/api/users/6", status: http.StatusOK, check: all(expectETag(1), expectNoPassword)},
+		{name: "get own account", as: "owner", method: http.MethodGet, path: env.userPath("/api/users/%d", "owner"), status: http.StatusOK},
+		{name: "get own account as viewer", as: "viewer", method: http.MethodGet, path: env.userPath("/api/users/%d", "viewer"), status: http.StatusOK},
+		{name: "get foreign account", as: "owner", method: http.MethodGet, path: env.userPath("/api/users/%d", "other"), status: http.StatusForbidden},
+		{name: "get missing", as: "admin", method: http.MethodGet, path: "/api/users/999", status: http.StatusNotFound, check: expectError(apperrors.CodeNotFound, "")},
+		{name: "get invalid ID", as: "admin", method: http.MethodGet, path: "/api/users/abc", status: http.StatusBadRequest},
+
+		{
+			name: "patch without If-Match", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"username": "technician"}, status: http.StatusPreconditionRequired,
+			check: expectError(apperrors.CodePreconditionRequired, ""),
+		},
+		{
+			name: "patch", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"username": "technician"}, ifMatch: 1, status: http.StatusOK,
+			check: all(expectETag(2), func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if user := decode[models.UserResponse](t, rec); user.Username != "technician" || user.Role != models.RoleTechnician {
+					t.Errorf("patch changed more than the username: %+v", user)
+				}
+			}),
+		},
+		{
+			name: "patch stale version", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"username": "stale"}, ifMatch: 1, status: http.StatusPreconditionFailed,
+			check: expectError(apperrors.CodePreconditionFailed, ""),
+		},
+		{
+			name: "put promotes to admin", as: "admin", method: http.MethodPut, path: "/api/users/6",
+			body: map[string]bool{"is_admin": true}, ifMatch: 2, status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if user := decode[models.UserResponse](t, rec); user.Role != models.RoleAdmin || !user.IsAdmin {
+					t.Errorf("role %q admin %v, want admin", user.Role, user.IsAdmin)
+				}
+			},
+		},
+		{
+			name: "patch duplicate username", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"username": "owner"}, ifMatch: 3, status: http.StatusConflict,
+			check: expectError(apperrors.CodeConflict, "username"),
+		},
+		{
+			name: "patch empty username", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"username": ""}, ifMatch: 3, status: http.StatusUnprocessableEntity,
+			check: expectError(apperrors.CodeValidation, "username"),
+		},
+		{
+			name: "patch unknown field", as: "admin", method: http.MethodPatch, path: "/api/users/6",
+			body: map[string]string{"nickname": "x"}, ifMatch: 3, status: http.StatusBadRequest,
+		},
+		{
+			name: "patch missing", as: "admin", method: http.MethodPatch, path: "/api/users/999",
+			body: map[string]string{"username": "ghost"}, ifMatch: 1, status: http.StatusNotFound,
+		},
+		{
+			name: "patch forbidden for owner", as: "owner", method: http.MethodPatch, path: env.userPath("/api/users/%d", "owner"),
+			body: map[string]string{"role": "admin"}, ifMatch: 1, status: http.StatusForbidden,
+		},
+
+		{name: "delete without If-Match", as: "admin", method: http.MethodDelete, path: "/api/users/6", status: http.StatusPreconditionRequired},
+		{name: "delete stale version", as: "admin", method: http.MethodDelete, path: "/api/users/6", ifMatch: 1, status: http.StatusPreconditionFailed},
+		{name: "delete forbidden for dealer", as: "dealer", method: http.MethodDelete, path: "/api/users/6", ifMatch: 3, status: http.StatusForbidden},
+		{name: "delete", as: "admin", method: http.MethodDelete, path: "/api/users/6", ifMatch: 3, status: http.StatusOK},
+		{name: "delete again", as: "admin", method: http.MethodDelete, path: "/api/users/6", ifMatch: 3, status: http.StatusNotFound},
+		{name: "get deleted", as: "admin", method: http.MethodGet, path: "/api/users/6", status: http.StatusNotFound},
+	})
+}
+
+func TestUserDeleteReferenced(t *testing.T) {
+	env := newTestEnv(t)
+	env.run(t, []apiCase{
+		{
+			name: "create module of owner", as: "admin", method: http.MethodPost, path: "/api/fiscal/",
+			body:   map[string]interface{}{"factory_number": "F-1", "fiscal_number": "FN-1", "user_id": env.users["owner"].ID},
+			status: http.StatusCreated,
+		},
+		{
+			name: "owner of a module cannot be deleted", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d", "owner"),
+			ifMatch: 1, status: http.StatusConflict, check: expectError(apperrors.CodeConflict, ""),
+		},
+		{
+			name: "reassign to the deleted user", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d?reassign_to=%[1]d", "owner"),
+			ifMatch: 1, status: http.StatusBadRequest, check: expectError(apperrors.CodeBadRequest, "reassign_to"),
+		},
+		{
+			name: "reassign to missing user", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d?reassign_to=999", "owner"),
+			ifMatch: 1, status: http.StatusUnprocessableEntity, check: expectError(apperrors.CodeInvalidReference, "reassign_to"),
+		},
+		{name: "reassign to invalid ID", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d?reassign_to=abc", "owner"), ifMatch: 1, status: http.StatusBadRequest},
+		{
+			name: "delete owner reassigning the module", as: "admin", method: http.MethodDelete,
+			path:    fmt.Sprintf("/api/users/%d?reassign_to=%d", env.users["owner"].ID, env.users["other"].ID),
+			ifMatch: 1, status: http.StatusOK,
+		},
+		{
+			name: "module belongs to the new owner", as: "admin", method: http.MethodGet, path: "/api/fiscal/1", status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if module := decode[models.FiscalModule](t, rec); module.UserID != env.users["other"].ID {
+					t.Errorf("module of user %d, want %d", module.UserID, env.users["other"].ID)
+				}
+			},
+		},
+		{name: "new owner of the module cannot be deleted", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d", "other"), ifMatch: 1, status: http.StatusConflict},
+		// Удалённый пользователь теряет доступ даже с действующим токеном
+		{name: "delete user without modules", as: "admin", method: http.MethodDelete, path: env.userPath("/api/users/%d", "viewer"), ifMatch: 1, status: http.StatusOK},
+		{name: "token of deleted user", as: "viewer", method: http.MethodGet, path: env.userPath("/api/users/%d", "viewer"), status: http.StatusUnauthorized},
+	})
+}
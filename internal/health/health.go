@@ -0,0 +1,104 @@
+// Package health собирает проверки готовности сервера и следит за фоновыми обработчиками.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check проверяет одну зависимость сервера; nil означает, что она готова
+type Check func(ctx context.Context) error
+
+// Result — итог одной проверки
+type Result struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report — итог всех проверок готовности
+type Report struct {
+	Ready  bool     `json:"ready"`
+	Checks []Result `json:"checks"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker выполняет зарегистрированные проверки параллельно, каждую не дольше timeout
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add регистрирует проверку. Проверки добавляются при запуске, до обработки запросов.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run выполняет все проверки; сервер готов, если прошли все
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			results[i] = Result{Name: nc.name, OK: true}
+			if err := nc.check(ctx); err != nil {
+				results[i] = Result{Name: nc.name, Error: err.Error()}
+			}
+		}(i, nc)
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, Checks: results}
+	for _, result := range results {
+		report.Ready = report.Ready && result.OK
+	}
+	return report
+}
+
+// Heartbeat отмечает, что фоновый обработчик жив. Обработчик считается зависшим,
+// если не отмечался дольше maxAge. Методы nil Heartbeat ничего не делают.
+type Heartbeat struct {
+	maxAge time.Duration
+	last   atomic.Int64
+}
+
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{maxAge: maxAge}
+	h.Beat()
+	return h
+}
+
+// Beat отмечает успешный проход цикла обработчика
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Check — проверка готовности: ошибка, если обработчик давно не отмечался
+func (h *Heartbeat) Check(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+	if age := time.Since(time.Unix(0, h.last.Load())); age > h.maxAge {
+		return fmt.Errorf("no heartbeat for %s", age.Round(time.Second))
+	}
+	return nil
+}
@@ -12,42 +12,61 @@ import (
 
 type contextKey string
 
-const userContextKey contextKey = "user"
-
-// AuthMiddleware проверяет наличие и валидность JWT токена
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header required")
-			logger.ErrorLogger.Println("Authorization header missing")
-			return
-		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header format must be Bearer {token}")
-			logger.ErrorLogger.Println("Invalid Authorization header format")
-			return
-		}
-
-		token := parts[1]
-		claims, err := utils.ParseJWT(token)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid token")
-			logger.ErrorLogger.Printf("Invalid token: %v", err)
-			return
-		}
-
-		user := &models.User{
-			ID:       claims.ID,
-			Username: claims.Username,
-			IsAdmin:  claims.IsAdmin,
-		}
-
-		ctx := context.WithValue(r.Context(), userContextKey, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+)
+
+// SessionValidator проверяет, что сессия токена не отозвана, и возвращает актуального пользователя
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, sessionID, userID int) (*models.User, error)
+}
+
+// AuthMiddleware проверяет наличие и валидность JWT токена, а также то,
+// что его сессия не отозвана и пользователь не деактивирован
+func AuthMiddleware(validator SessionValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header required")
+				logger.ErrorLogger.Println("Authorization header missing")
+				return
+			}
+
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header format must be Bearer {token}")
+				logger.ErrorLogger.Println("Invalid Authorization header format")
+				return
+			}
+
+			token := parts[1]
+			claims, err := utils.ParseJWT(token)
+			if err != nil {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+				logger.ErrorLogger.Printf("Invalid token: %v", err)
+				return
+			}
+
+			// Токены без сессии выпущены до появления отзыва сессий и больше не принимаются
+			if claims.SessionID == 0 {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Session expired, please log in again")
+				return
+			}
+
+			user, err := validator.ValidateSession(r.Context(), claims.SessionID, claims.ID)
+			if err != nil {
+				utils.RespondWithAppError(w, err, "Could not validate session")
+				logger.ErrorLogger.Printf("Session %d of user %d rejected: %v", claims.SessionID, claims.ID, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userContextKey, user)
+			ctx = context.WithValue(ctx, sessionContextKey, claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
 // GetUserFromContext извлекает пользователя из контекста запроса
@@ -55,3 +74,9 @@ func GetUserFromContext(ctx context.Context) (*models.User, bool) {
 	user, ok := ctx.Value(userContextKey).(*models.User)
 	return user, ok
 }
+
+// GetSessionIDFromContext извлекает ID сессии, которой подписан токен запроса
+func GetSessionIDFromContext(ctx context.Context) (int, bool) {
+	sessionID, ok := ctx.Value(sessionContextKey).(int)
+	return sessionID, ok
+}
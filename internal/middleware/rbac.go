@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/utils"
+)
+
+// RequirePermission пропускает запрос только если роль пользователя содержит право p.
+// Должен стоять после AuthMiddleware.
+func RequirePermission(p models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+			if !user.Role.Has(p) {
+				RespondForbidden(w)
+				logger.ErrorLogger.Printf("User %d (%s) denied %s on %s %s", user.ID, user.Role, p, r.Method, r.URL.Path)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RespondForbidden отправляет единый ответ об отказе в доступе
+func RespondForbidden(w http.ResponseWriter) {
+	utils.RespondWithError(w, http.StatusForbidden, "Access denied")
+}
+
+// HasPermission сообщает, есть ли у текущего пользователя право p
+func HasPermission(ctx context.Context, p models.Permission) bool {
+	user, ok := GetUserFromContext(ctx)
+	return ok && user.Role.Has(p)
+}
+
+// IsAdmin сообщает, является ли текущий пользователь администратором
+func IsAdmin(ctx context.Context) bool {
+	user, ok := GetUserFromContext(ctx)
+	return ok && user.Role == models.RoleAdmin
+}
+
+// CanAccessOwned сообщает, может ли текущий пользователь работать с объектом,
+// принадлежащим ownerID. Администраторы видят все объекты, остальные — только свои.
+func CanAccessOwned(ctx context.Context, ownerID int) bool {
+	user, ok := GetUserFromContext(ctx)
+	if !ok {
+		return false
+	}
+	return user.Role == models.RoleAdmin || user.ID == ownerID
+}
+
+// OwnerScope возвращает ID пользователя, которым нужно ограничить выборку,
+// и false для администраторов, которым ограничение не нужно
+func OwnerScope(ctx context.Context) (int, bool) {
+	user, ok := GetUserFromContext(ctx)
+	if !ok {
+		return 0, true
+	}
+	if user.Role == models.RoleAdmin {
+		return 0, false
+	}
+	return user.ID, true
+}
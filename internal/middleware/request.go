@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const requestInfoContextKey contextKey = "request_info"
+
+type requestInfo struct {
+	id string
+	ip string
+}
+
+// RequestInfo сохраняет в контексте ID запроса и адрес клиента для журнала аудита
+// и возвращает ID запроса в заголовке X-Request-Id. Должен стоять после chi RequestID.
+func RequestInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := requestInfo{id: chiMiddleware.GetReqID(r.Context()), ip: r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			info.ip = host
+		}
+		if info.id != "" {
+			w.Header().Set(chiMiddleware.RequestIDHeader, info.id)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestInfoContextKey, info)))
+	})
+}
+
+// GetRequestInfo возвращает ID запроса и адрес клиента, сохранённые RequestInfo
+func GetRequestInfo(ctx context.Context) (requestID, ip string) {
+	info, _ := ctx.Value(requestInfoContextKey).(requestInfo)
+	return info.id, info.ip
+}
@@ -0,0 +1,341 @@
+// Package migrate применяет встроенные SQL миграции и ведёт учёт версии схемы
+// в таблице schema_migrations.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/idkOybek/internal/logger"
+)
+
+// lockKey — ключ advisory lock, под которым выполняются миграции,
+// чтобы несколько экземпляров сервера не применяли их одновременно
+const lockKey int64 = 7_311_020_240_009
+
+var fileName = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.(up|down)\.sql$`)
+
+var (
+	// ErrDirty возвращается, если предыдущая миграция была применена не полностью
+	ErrDirty = errors.New("database is in a dirty migration state")
+	// ErrUnknownVersion возвращается для версии, которой нет среди встроенных миграций
+	ErrUnknownVersion = errors.New("unknown migration version")
+	// ErrOutOfDate возвращается, если версия схемы не совпадает с последней встроенной миграцией
+	ErrOutOfDate = errors.New("database schema is not at the latest migration")
+)
+
+// Migration — пара скриптов одной версии схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status описывает текущее состояние схемы
+type Status struct {
+	Version    int
+	Dirty      bool
+	Migrations []Migration
+}
+
+// Runner применяет миграции из файловой системы к базе данных
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewRunner читает миграции из fsys и проверяет, что версии уникальны и у каждой есть up скрипт
+func NewRunner(db *sql.DB, fsys fs.FS) (*Runner, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	r := &Runner{db: db}
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		r.migrations = append(r.migrations, *mig)
+	}
+	sort.Slice(r.migrations, func(i, j int) bool { return r.migrations[i].Version < r.migrations[j].Version })
+	return r, nil
+}
+
+// Latest возвращает номер последней встроенной миграции
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Up применяет все ещё не применённые миграции
+func (r *Runner) Up(ctx context.Context) error {
+	return r.To(ctx, r.Latest())
+}
+
+// Down откатывает последнюю применённую миграцию
+func (r *Runner) Down(ctx context.Context) error {
+	return r.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := r.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			logger.InfoLogger.Printf("Migrate: nothing to roll back")
+			return nil
+		}
+		return r.migrate(ctx, conn, current, r.previous(current))
+	})
+}
+
+// To приводит схему к версии target, применяя или откатывая миграции по одной
+func (r *Runner) To(ctx context.Context, target int) error {
+	if target != 0 && r.index(target) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+	return r.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := r.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current == target {
+			logger.InfoLogger.Printf("Migrate: schema is up to date at version %d", current)
+			return nil
+		}
+		return r.migrate(ctx, conn, current, target)
+	})
+}
+
+// Force записывает версию без выполнения скриптов и снимает признак dirty.
+// Используется после ручного исправления схемы.
+func (r *Runner) Force(ctx context.Context, version int) error {
+	if version != 0 && r.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return r.withLock(ctx, func(conn *sql.Conn) error {
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+// Status возвращает текущую версию схемы и список встроенных миграций
+func (r *Runner) Status(ctx context.Context) (*Status, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{Version: version, Dirty: dirty, Migrations: r.migrations}, nil
+}
+
+// Verify проверяет, что схема приведена к последней встроенной миграции полностью.
+// В отличие от Status только читает: отсутствие schema_migrations означает версию 0.
+func (r *Runner) Verify(ctx context.Context) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	version, dirty := 0, false
+	if exists {
+		if version, dirty, err = readVersion(ctx, conn); err != nil {
+			return err
+		}
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+	if version != r.Latest() {
+		return fmt.Errorf("%w: database is at version %d, expected %d", ErrOutOfDate, version, r.Latest())
+	}
+	return nil
+}
+
+func (r *Runner) migrate(ctx context.Context, conn *sql.Conn, current, target int) error {
+	if current != 0 && r.index(current) < 0 {
+		return fmt.Errorf("%w: database is at version %d", ErrUnknownVersion, current)
+	}
+
+	if target > current {
+		for _, mig := range r.migrations {
+			if mig.Version <= current || mig.Version > target {
+				continue
+			}
+			logger.InfoLogger.Printf("Migrate: applying %d_%s", mig.Version, mig.Name)
+			if err := apply(ctx, conn, mig.Version, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := r.index(current); i >= 0 && r.migrations[i].Version > target; i-- {
+		mig := r.migrations[i]
+		if mig.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+		}
+		logger.InfoLogger.Printf("Migrate: rolling back %d_%s", mig.Version, mig.Name)
+		if err := apply(ctx, conn, mig.Version, mig.Down, r.previous(mig.Version)); err != nil {
+			return fmt.Errorf("rolling back migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply помечает версию как dirty, выполняет скрипт в транзакции и в той же
+// транзакции записывает итоговую версию. Если процесс прервётся между шагами,
+// признак dirty останется и следующий запуск откажется продолжать.
+func apply(ctx context.Context, conn *sql.Conn, version int, script string, result int) error {
+	if err := setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := setVersion(ctx, tx, result, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (r *Runner) cleanVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d: fix the schema manually and run \"migrate force N\"", ErrDirty, version)
+	}
+	return version, nil
+}
+
+func (r *Runner) index(version int) int {
+	for i, mig := range r.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Runner) previous(version int) int {
+	i := r.index(version)
+	if i <= 0 {
+		return 0
+	}
+	return r.migrations[i-1].Version
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty BOOLEAN NOT NULL,
+			applied_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+func readVersion(ctx context.Context, conn *sql.Conn) (int, bool, error) {
+	var version int
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// setVersion хранит в schema_migrations ровно одну строку с текущей версией
+func setVersion(ctx context.Context, ex execer, version int, dirty bool) error {
+	if _, err := ex.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	_, err := ex.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+	return err
+}
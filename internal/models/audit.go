@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// AuditEntity определяет вид объекта, изменение которого попадает в журнал аудита
+type AuditEntity string
+
+const (
+	AuditUser         AuditEntity = "user"
+	AuditTerminal     AuditEntity = "terminal"
+	AuditFiscalModule AuditEntity = "fiscal_module"
+	AuditCompany      AuditEntity = "company"
+)
+
+// Valid сообщает, ведётся ли аудит объектов этого вида
+func (e AuditEntity) Valid() bool {
+	return e == AuditUser || e == AuditTerminal || e == AuditFiscalModule || e == AuditCompany
+}
+
+// AuditAction — вид изменения объекта
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+)
+
+// AuditMeta описывает, кто и откуда выполнил изменение
+type AuditMeta struct {
+	ActorID   *int
+	RequestID string
+	IP        string
+}
+
+// AuditChange — значения поля до и после изменения
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditRecord представляет запись журнала аудита. Changes содержит только изменившиеся поля.
+type AuditRecord struct {
+	ID         int                    `json:"id"`
+	EntityType AuditEntity            `json:"entity_type"`
+	EntityID   int                    `json:"entity_id"`
+	Action     AuditAction            `json:"action"`
+	ActorID    *int                   `json:"actor_id"`
+	Changes    map[string]AuditChange `json:"changes"`
+	RequestID  string                 `json:"request_id"`
+	IP         string                 `json:"ip"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// BalanceMovementKind описывает тип движения по балансу бесплатных записей
+type BalanceMovementKind string
+
+const (
+	BalanceMovementTopUp       BalanceMovementKind = "top_up"
+	BalanceMovementConsumption BalanceMovementKind = "consumption"
+	BalanceMovementCorrection  BalanceMovementKind = "correction"
+)
+
+// BalanceMovement представляет запись журнала движений баланса торговой точки
+type BalanceMovement struct {
+	ID           int                 `json:"id"`
+	TerminalID   int                 `json:"terminal_id"`
+	Kind         BalanceMovementKind `json:"kind"`
+	Amount       int                 `json:"amount"`
+	BalanceAfter int                 `json:"balance_after"`
+	ActorID      *int                `json:"actor_id"`
+	Reason       string              `json:"reason"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// BalanceChangeRequest представляет данные для пополнения, списания или корректировки баланса
+type BalanceChangeRequest struct {
+	Amount int    `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// TerminalBalanceResponse представляет текущий баланс торговой точки и историю его движений
+type TerminalBalanceResponse struct {
+	TerminalID  int               `json:"terminal_id"`
+	Balance     int               `json:"balance"`
+	LedgerTotal int               `json:"ledger_total"`
+	History     []BalanceMovement `json:"history"`
+}
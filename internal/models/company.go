@@ -0,0 +1,27 @@
+package models
+
+// Company представляет компанию-налогоплательщика. Торговые точки и пользователи
+// ссылаются на неё по ИНН.
+type Company struct {
+	ID            int    `json:"id"`
+	INN           string `json:"inn" validate:"required,taxid"`
+	LegalName     string `json:"legal_name" validate:"required,max=255"`
+	LegalAddress  string `json:"legal_address"`
+	VATPayer      bool   `json:"vat_payer"`
+	ContactPerson string `json:"contact_person" validate:"max=255"`
+	Phone         string `json:"phone" validate:"max=64"`
+	Email         string `json:"email" validate:"max=255,email"`
+	Version       int    `json:"version"`
+}
+
+// CompanyUpdateRequest представляет частичное обновление компании: изменяются только
+// переданные поля. Новый ИНН переносится на её торговые точки и пользователей.
+type CompanyUpdateRequest struct {
+	INN           *string `json:"inn,omitempty" validate:"required,taxid"`
+	LegalName     *string `json:"legal_name,omitempty" validate:"required,max=255"`
+	LegalAddress  *string `json:"legal_address,omitempty"`
+	VATPayer      *bool   `json:"vat_payer,omitempty"`
+	ContactPerson *string `json:"contact_person,omitempty" validate:"max=255"`
+	Phone         *string `json:"phone,omitempty" validate:"max=64"`
+	Email         *string `json:"email,omitempty" validate:"max=255,email"`
+}
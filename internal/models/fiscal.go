@@ -1,25 +1,47 @@
 package models
 
+import "time"
+
 // FiscalModule представляет фискальный модуль системы
 type FiscalModule struct {
-	ID            int    `json:"id"`
-	FactoryNumber string `json:"factory_number"`
-	FiscalNumber  string `json:"fiscal_number"`
-	UserID        int    `json:"user_id"`
+	ID            int                   `json:"id"`
+	FactoryNumber string                `json:"factory_number"`
+	FiscalNumber  string                `json:"fiscal_number"`
+	UserID        int                   `json:"user_id"`
+	Terminal      *FiscalModuleTerminal `json:"terminal,omitempty"`
+	Version       int                   `json:"version"`
+}
+
+// FiscalModuleTerminal представляет кассу, которую сейчас обслуживает фискальный модуль
+type FiscalModuleTerminal struct {
+	ID                 int       `json:"id"`
+	CashRegisterNumber string    `json:"cash_register_number"`
+	CompanyName        string    `json:"company_name"`
+	BoundAt            time.Time `json:"bound_at"`
+}
+
+// FiscalModuleBinding представляет запись истории привязки модуля к кассе
+type FiscalModuleBinding struct {
+	ID             int        `json:"id"`
+	TerminalID     int        `json:"terminal_id"`
+	FiscalModuleID int        `json:"fiscal_module_id"`
+	BoundAt        time.Time  `json:"bound_at"`
+	UnboundAt      *time.Time `json:"unbound_at"`
 }
 
 // FiscalModuleCreateRequest представляет данные для создания фискального модуля
 type FiscalModuleCreateRequest struct {
-	FactoryNumber string `json:"factory_number"`
-	FiscalNumber  string `json:"fiscal_number"`
-	UserID        int    `json:"user_id"`
+	FactoryNumber string `json:"factory_number" validate:"required,max=255"`
+	FiscalNumber  string `json:"fiscal_number" validate:"required,max=255"`
+	UserID        int    `json:"user_id" validate:"min=1"`
 }
 
-// FiscalModuleUpdateRequest представляет данные для обновления фискального модуля
+// FiscalModuleUpdateRequest представляет частичное обновление фискального модуля:
+// изменяются только переданные поля
 type FiscalModuleUpdateRequest struct {
-	FactoryNumber string `json:"factory_number,omitempty"`
-	FiscalNumber  string `json:"fiscal_number,omitempty"`
-	UserID        int    `json:"user_id,omitempty"`
+	FactoryNumber *string `json:"factory_number,omitempty" validate:"required,max=255"`
+	FiscalNumber  *string `json:"fiscal_number,omitempty" validate:"required,max=255"`
+	UserID        *int    `json:"user_id,omitempty" validate:"min=1"`
 }
 
 // FiscalModuleResponse представляет данные фискального модуля для ответа
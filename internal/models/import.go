@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// ImportKind определяет, какие объекты создаёт импорт
+type ImportKind string
+
+const (
+	ImportTerminals     ImportKind = "terminals"
+	ImportFiscalModules ImportKind = "fiscal_modules"
+)
+
+// Valid сообщает, поддерживается ли импорт объектов этого вида
+func (k ImportKind) Valid() bool {
+	return k == ImportTerminals || k == ImportFiscalModules
+}
+
+// ImportStatus — состояние задания импорта
+type ImportStatus string
+
+const (
+	ImportPending    ImportStatus = "pending"
+	ImportValidating ImportStatus = "validating"
+	ImportImporting  ImportStatus = "importing"
+	// ImportCompleted — проверка (в режиме dry run) или импорт завершены
+	ImportCompleted ImportStatus = "completed"
+	// ImportFailed — в файле есть ошибки или запись не удалась; ничего не создано
+	ImportFailed ImportStatus = "failed"
+)
+
+// ImportRowError описывает ошибку в строке файла. Row — номер строки в файле
+// (заголовок — строка 1), 0 — ошибка относится к файлу целиком.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportJob представляет задание импорта и его ход
+type ImportJob struct {
+	ID            int              `json:"id"`
+	Kind          ImportKind       `json:"kind"`
+	FileName      string           `json:"file_name"`
+	Format        string           `json:"format"`
+	DryRun        bool             `json:"dry_run"`
+	Status        ImportStatus     `json:"status"`
+	TotalRows     int              `json:"total_rows"`
+	ValidatedRows int              `json:"validated_rows"`
+	ImportedRows  int              `json:"imported_rows"`
+	ErrorCount    int              `json:"error_count"`
+	Errors        []ImportRowError `json:"errors"`
+	CreatedBy     *int             `json:"created_by"`
+	CreatedAt     time.Time        `json:"created_at"`
+	StartedAt     *time.Time       `json:"started_at"`
+	FinishedAt    *time.Time       `json:"finished_at"`
+}
+
+// ImportTerminalRow — проверенная строка импорта торговых точек с найденным фискальным модулем
+type ImportTerminalRow struct {
+	Row            int
+	Terminal       TerminalCreateRequest
+	FiscalModuleID int
+}
+
+// ImportFiscalModuleRow — проверенная строка импорта фискальных модулей
+type ImportFiscalModuleRow struct {
+	Row    int
+	Module FiscalModule
+}
+
+// ImportModuleRef — фискальный модуль, найденный по номеру при проверке импорта
+type ImportModuleRef struct {
+	ID    int
+	Bound bool
+}
@@ -0,0 +1,130 @@
+package models
+
+import "time"
+
+// ListParams — общие параметры постраничной выборки с сортировкой
+type ListParams struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Desc   bool
+}
+
+// TerminalFilter описывает фильтры списка торговых точек
+type TerminalFilter struct {
+	ListParams
+	INN             string
+	Status          TerminalStatus
+	UserID          *int
+	CompanyName     string
+	IsOnline        *bool
+	LastRequestFrom *time.Time
+	LastRequestTo   *time.Time
+}
+
+// FiscalModuleFilter описывает фильтры списка фискальных модулей
+type FiscalModuleFilter struct {
+	ListParams
+	UserID        *int
+	CompanyINN    string
+	FactoryNumber string
+	FiscalNumber  string
+}
+
+// CompanyFilter описывает фильтры списка компаний. UserID ограничивает выборку
+// компанией пользователя и компаниями его торговых точек.
+type CompanyFilter struct {
+	ListParams
+	INN       string
+	LegalName string
+	VATPayer  *bool
+	UserID    *int
+}
+
+// UserFilter описывает фильтры списка пользователей
+type UserFilter struct {
+	ListParams
+	INN      string
+	Username string
+	Role     Role
+	IsActive *bool
+}
+
+// ReceiptFilter описывает фильтры списка чеков. UserID ограничивает выборку
+// чеками торговых точек владельца.
+type ReceiptFilter struct {
+	ListParams
+	TerminalID     *int
+	FiscalModuleID *int
+	UserID         *int
+	INN            string
+	Type           ReceiptType
+	IssuedFrom     *time.Time
+	IssuedTo       *time.Time
+}
+
+// OFDDeliveryFilter описывает фильтры списка очереди отправки в ОФД
+type OFDDeliveryFilter struct {
+	ListParams
+	Status OFDDeliveryStatus
+	Kind   OFDDocumentKind
+}
+
+// AuditFilter описывает фильтры журнала аудита
+type AuditFilter struct {
+	ListParams
+	EntityType AuditEntity
+	EntityID   *int
+	ActorID    *int
+	From       *time.Time
+	To         *time.Time
+}
+
+// TerminalList представляет страницу списка торговых точек
+type TerminalList struct {
+	Items      []Terminal `json:"items"`
+	Total      int        `json:"total"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// FiscalModuleList представляет страницу списка фискальных модулей
+type FiscalModuleList struct {
+	Items      []FiscalModule `json:"items"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// CompanyList представляет страницу списка компаний
+type CompanyList struct {
+	Items      []Company `json:"items"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// UserList представляет страницу списка пользователей
+type UserList struct {
+	Items      []UserResponse `json:"items"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ReceiptList представляет страницу списка чеков
+type ReceiptList struct {
+	Items      []Receipt `json:"items"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// OFDDeliveryList представляет страницу очереди отправки в ОФД
+type OFDDeliveryList struct {
+	Items      []OFDDelivery `json:"items"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// AuditRecordList представляет страницу журнала аудита
+type AuditRecordList struct {
+	Items      []AuditRecord `json:"items"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
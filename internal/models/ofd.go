@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OFDDocumentKind определяет вид документа, отправляемого оператору фискальных данных
+type OFDDocumentKind string
+
+const (
+	OFDReceipt OFDDocumentKind = "receipt"
+	OFDZReport OFDDocumentKind = "z_report"
+)
+
+// OFDDeliveryStatus — состояние доставки документа в ОФД
+type OFDDeliveryStatus string
+
+const (
+	OFDPending      OFDDeliveryStatus = "pending"
+	OFDAcknowledged OFDDeliveryStatus = "acknowledged"
+	OFDDead         OFDDeliveryStatus = "dead"
+)
+
+// Valid сообщает, известно ли состояние доставки системе
+func (s OFDDeliveryStatus) Valid() bool {
+	return s == OFDPending || s == OFDAcknowledged || s == OFDDead
+}
+
+// OFDDelivery представляет запись очереди отправки в ОФД и её квитанцию
+type OFDDelivery struct {
+	ID             int               `json:"id"`
+	Kind           OFDDocumentKind   `json:"kind"`
+	ReceiptID      *int              `json:"receipt_id,omitempty"`
+	ZReportID      *int              `json:"z_report_id,omitempty"`
+	Status         OFDDeliveryStatus `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastError      *string           `json:"last_error"`
+	AckID          *string           `json:"ack_id"`
+	AcknowledgedAt *time.Time        `json:"acknowledged_at"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// OFDDocument — документ, взятый из очереди для отправки
+type OFDDocument struct {
+	ID       int             `json:"id"`
+	Kind     OFDDocumentKind `json:"kind"`
+	Payload  json.RawMessage `json:"document"`
+	Attempts int             `json:"-"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// ReceiptType определяет вид фискального чека
+type ReceiptType string
+
+const (
+	ReceiptSale   ReceiptType = "sale"
+	ReceiptRefund ReceiptType = "refund"
+)
+
+// Valid сообщает, известен ли вид чека системе
+func (t ReceiptType) Valid() bool {
+	return t == ReceiptSale || t == ReceiptRefund
+}
+
+// PaymentType определяет способ оплаты по чеку
+type PaymentType string
+
+const (
+	PaymentCash PaymentType = "cash"
+	PaymentCard PaymentType = "card"
+)
+
+// Valid сообщает, известен ли способ оплаты системе
+func (t PaymentType) Valid() bool {
+	return t == PaymentCash || t == PaymentCard
+}
+
+// Receipt представляет фискальный чек, подписанный фискальным модулем кассы.
+// Денежные суммы хранятся в тийинах.
+type Receipt struct {
+	ID             int              `json:"id"`
+	TerminalID     int              `json:"terminal_id"`
+	ShiftID        *int             `json:"shift_id"`
+	FiscalModuleID int              `json:"fiscal_module_id"`
+	ModuleNumber   string           `json:"module_number"`
+	ReceiptNumber  int64            `json:"receipt_number"`
+	Type           ReceiptType      `json:"type"`
+	INN            string           `json:"inn"`
+	Total          int64            `json:"total"`
+	VATTotal       int64            `json:"vat_total"`
+	FiscalSign     string           `json:"fiscal_sign"`
+	IssuedAt       time.Time        `json:"issued_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	Items          []ReceiptItem    `json:"items,omitempty"`
+	Payments       []ReceiptPayment `json:"payments,omitempty"`
+	OFD            *OFDDelivery     `json:"ofd,omitempty"`
+}
+
+// ReceiptItem представляет позицию чека
+type ReceiptItem struct {
+	Name      string  `json:"name" validate:"required"`
+	Quantity  float64 `json:"quantity" validate:"gt=0"`
+	Price     int64   `json:"price" validate:"min=0"`
+	VATRate   int     `json:"vat_rate" validate:"min=0,max=100"`
+	VATAmount int64   `json:"vat_amount" validate:"min=0"`
+	Total     int64   `json:"total" validate:"min=0"`
+}
+
+// ReceiptPayment представляет оплату по чеку одним способом
+type ReceiptPayment struct {
+	Type   PaymentType `json:"type" validate:"required,enum"`
+	Amount int64       `json:"amount" validate:"gt=0"`
+}
+
+// ReceiptCreateRequest представляет чек, переданный кассой
+type ReceiptCreateRequest struct {
+	TerminalID    int              `json:"terminal_id" validate:"min=1"`
+	ModuleNumber  string           `json:"module_number" validate:"required"`
+	ReceiptNumber int64            `json:"receipt_number" validate:"min=1"`
+	Type          ReceiptType      `json:"type" validate:"required,enum"`
+	Items         []ReceiptItem    `json:"items" validate:"required"`
+	Payments      []ReceiptPayment `json:"payments" validate:"required"`
+	FiscalSign    string           `json:"fiscal_sign" validate:"required"`
+	IssuedAt      time.Time        `json:"issued_at" validate:"required"`
+}
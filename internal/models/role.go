@@ -0,0 +1,94 @@
+package models
+
+// Role определяет набор прав пользователя
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleDealer     Role = "dealer"
+	RoleTechnician Role = "technician"
+	RoleOwner      Role = "owner"
+	RoleReadOnly   Role = "read_only"
+)
+
+// Permission представляет право на выполнение группы операций
+type Permission string
+
+const (
+	PermUsersManage      Permission = "users:manage"
+	PermTerminalsRead    Permission = "terminals:read"
+	PermTerminalsWrite   Permission = "terminals:write"
+	PermTerminalsCheckIn Permission = "terminals:check_in"
+	PermTerminalsBlock   Permission = "terminals:block"
+	PermBalanceConsume   Permission = "balance:consume"
+	PermBalanceManage    Permission = "balance:manage"
+	PermFiscalRead       Permission = "fiscal:read"
+	PermFiscalWrite      Permission = "fiscal:write"
+	PermReceiptsRead     Permission = "receipts:read"
+	PermReceiptsWrite    Permission = "receipts:write"
+	PermOFDManage        Permission = "ofd:manage"
+	PermAuditRead        Permission = "audit:read"
+	PermImport           Permission = "imports:manage"
+	PermTaxIDReport      Permission = "tax_ids:report"
+	PermCompaniesRead    Permission = "companies:read"
+	PermCompaniesWrite   Permission = "companies:write"
+)
+
+// rolePermissions описывает права каждой роли. Администратор имеет все права
+// и, в отличие от остальных ролей, видит чужие торговые точки и фискальные модули.
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermUsersManage,
+		PermTerminalsRead, PermTerminalsWrite, PermTerminalsCheckIn, PermTerminalsBlock,
+		PermBalanceConsume, PermBalanceManage,
+		PermFiscalRead, PermFiscalWrite,
+		PermReceiptsRead, PermReceiptsWrite,
+		PermOFDManage,
+		PermAuditRead,
+		PermImport,
+		PermTaxIDReport,
+		PermCompaniesRead, PermCompaniesWrite,
+	},
+	RoleDealer: {
+		PermTerminalsRead, PermTerminalsWrite, PermTerminalsCheckIn,
+		PermBalanceConsume, PermBalanceManage,
+		PermFiscalRead, PermFiscalWrite,
+		PermReceiptsRead, PermReceiptsWrite,
+		PermCompaniesRead, PermCompaniesWrite,
+	},
+	RoleTechnician: {
+		PermTerminalsRead, PermTerminalsCheckIn,
+		PermFiscalRead,
+		PermReceiptsRead,
+		PermCompaniesRead,
+	},
+	RoleOwner: {
+		PermTerminalsRead, PermTerminalsCheckIn,
+		PermBalanceConsume,
+		PermFiscalRead,
+		PermReceiptsRead, PermReceiptsWrite,
+		PermCompaniesRead,
+	},
+	RoleReadOnly: {
+		PermTerminalsRead,
+		PermFiscalRead,
+		PermReceiptsRead,
+		PermCompaniesRead,
+	},
+}
+
+// Valid сообщает, известна ли роль системе
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Has сообщает, входит ли право в роль
+func (r Role) Has(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// MaxShiftDuration — максимальная продолжительность смены; после неё чеки не принимаются до закрытия смены
+const MaxShiftDuration = 24 * time.Hour
+
+// Shift представляет кассовую смену торговой точки
+type Shift struct {
+	ID             int        `json:"id"`
+	TerminalID     int        `json:"terminal_id"`
+	FiscalModuleID int        `json:"fiscal_module_id"`
+	OpenedAt       time.Time  `json:"opened_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+	OpenedBy       *int       `json:"opened_by"`
+	ClosedBy       *int       `json:"closed_by"`
+}
+
+// ShiftReport содержит итоги смены по чекам. Для X-отчёта это промежуточные итоги
+// открытой смены, для Z-отчёта — итоги закрытой смены. Суммы в тийинах.
+type ShiftReport struct {
+	ShiftID        int             `json:"shift_id"`
+	TerminalID     int             `json:"terminal_id"`
+	FiscalModuleID int             `json:"fiscal_module_id"`
+	OpenedAt       time.Time       `json:"opened_at"`
+	ClosedAt       *time.Time      `json:"closed_at"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+	SaleCount      int             `json:"sale_count"`
+	RefundCount    int             `json:"refund_count"`
+	SalesTotal     int64           `json:"sales_total"`
+	RefundsTotal   int64           `json:"refunds_total"`
+	NetTotal       int64           `json:"net_total"`
+	SalesVAT       int64           `json:"sales_vat"`
+	RefundsVAT     int64           `json:"refunds_vat"`
+	ByPaymentType  []PaymentTotals `json:"by_payment_type"`
+	ByVATRate      []VATRateTotals `json:"by_vat_rate"`
+}
+
+// PaymentTotals содержит итоги смены по одному способу оплаты
+type PaymentTotals struct {
+	Type    PaymentType `json:"type"`
+	Sales   int64       `json:"sales"`
+	Refunds int64       `json:"refunds"`
+}
+
+// VATRateTotals содержит итоги смены по одной ставке НДС
+type VATRateTotals struct {
+	Rate       int   `json:"rate"`
+	Sales      int64 `json:"sales"`
+	SalesVAT   int64 `json:"sales_vat"`
+	Refunds    int64 `json:"refunds"`
+	RefundsVAT int64 `json:"refunds_vat"`
+}
+
+// ZReport представляет сохранённый отчёт о закрытии смены.
+// Номер отчёта последовательный в пределах фискального модуля.
+type ZReport struct {
+	ID           int         `json:"id"`
+	ReportNumber int         `json:"report_number"`
+	Report       ShiftReport `json:"report"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// TaxIDEntity — вид объекта, у которого хранится ИНН или ПИНФЛ
+type TaxIDEntity string
+
+const (
+	TaxIDUser     TaxIDEntity = "user"
+	TaxIDTerminal TaxIDEntity = "terminal"
+	TaxIDCompany  TaxIDEntity = "company"
+)
+
+// Valid сообщает, хранится ли у объектов этого вида ИНН
+func (e TaxIDEntity) Valid() bool {
+	return e == TaxIDUser || e == TaxIDTerminal || e == TaxIDCompany
+}
+
+// TaxIDRecord — ИНН или ПИНФЛ, сохранённый у пользователя, торговой точки или компании
+type TaxIDRecord struct {
+	EntityType TaxIDEntity `json:"entity_type"`
+	EntityID   int         `json:"entity_id"`
+	INN        string      `json:"inn"`
+}
+
+// InvalidTaxID — сохранённое значение, не прошедшее проверку, с причиной
+type InvalidTaxID struct {
+	TaxIDRecord
+	Reason string `json:"reason"`
+}
+
+// InvalidTaxIDReport — результат проверки сохранённых ИНН и ПИНФЛ
+type InvalidTaxIDReport struct {
+	Checked int            `json:"checked"`
+	Items   []InvalidTaxID `json:"items"`
+}
@@ -2,62 +2,85 @@ package models
 
 import "time"
 
-// Terminal представляет торговую точку системы
+// Terminal представляет торговую точку системы. CompanyName — название компании
+// с ИНН точки; изменяется через /api/companies.
 type Terminal struct {
-	ID                 int       `json:"id"`
-	INN                string    `json:"inn"`
-	CompanyName        string    `json:"company_name"`
-	Address            string    `json:"address"`
-	CashRegisterNumber string    `json:"cash_register_number"`
-	ModuleNumber       string    `json:"module_number"`
-	AssemblyNumber     string    `json:"assembly_number"`
-	LastRequestDate    time.Time `json:"last_request_date"`
-	DatabaseUpdateDate time.Time `json:"database_update_date"`
-	Status             string    `json:"status"`
-	UserID             int       `json:"user_id"`
-	FreeRecordBalance  int       `json:"free_record_balance"`
+	ID                 int            `json:"id"`
+	INN                string         `json:"inn"`
+	CompanyName        string         `json:"company_name"`
+	Address            string         `json:"address"`
+	CashRegisterNumber string         `json:"cash_register_number"`
+	ModuleNumber       string         `json:"module_number"`
+	AssemblyNumber     string         `json:"assembly_number"`
+	LastRequestDate    *time.Time     `json:"last_request_date"`
+	DatabaseUpdateDate *time.Time     `json:"database_update_date"`
+	Status             TerminalStatus `json:"status"`
+	StatusChangedAt    *time.Time     `json:"status_changed_at"`
+	IsOnline           bool           `json:"is_online"`
+	UserID             int            `json:"user_id"`
+	FreeRecordBalance  int            `json:"free_record_balance"`
+	FiscalModuleID     *int           `json:"fiscal_module_id"`
+	FiscalModule       *FiscalModule  `json:"fiscal_module,omitempty"`
+	Version            int            `json:"version"`
 }
 
-// TerminalCreateRequest представляет данные для создания торговой точки
+// TerminalCreateRequest представляет данные для создания торговой точки. Если компании
+// с таким ИНН ещё нет, она создаётся с названием company_name; иначе company_name должно
+// совпадать с названием компании.
 type TerminalCreateRequest struct {
-	INN                string `json:"inn"`
-	CompanyName        string `json:"company_name"`
-	Address            string `json:"address"`
-	CashRegisterNumber string `json:"cash_register_number"`
-	ModuleNumber       string `json:"module_number"`
-	AssemblyNumber     string `json:"assembly_number"`
-	Status             string `json:"status"`
-	UserID             int    `json:"user_id"`
-	FreeRecordBalance  int    `json:"free_record_balance"`
+	INN                string `json:"inn" validate:"required,taxid"`
+	CompanyName        string `json:"company_name" validate:"required,max=255"`
+	Address            string `json:"address" validate:"required"`
+	CashRegisterNumber string `json:"cash_register_number" validate:"required,max=255"`
+	ModuleNumber       string `json:"module_number" validate:"required,max=255"`
+	AssemblyNumber     string `json:"assembly_number" validate:"required,max=255"`
+	UserID             int    `json:"user_id" validate:"min=1"`
+	FreeRecordBalance  int    `json:"free_record_balance" validate:"min=0"`
 }
 
-// TerminalUpdateRequest представляет данные для обновления торговой точки
+// TerminalUpdateRequest представляет частичное обновление торговой точки: изменяются
+// только переданные поля. Пустой module_number отвязывает фискальный модуль.
+// Баланс и статус меняются только через отдельные операции.
 type TerminalUpdateRequest struct {
-	INN                string    `json:"inn,omitempty"`
-	CompanyName        string    `json:"company_name,omitempty"`
-	Address            string    `json:"address,omitempty"`
-	CashRegisterNumber string    `json:"cash_register_number,omitempty"`
-	ModuleNumber       string    `json:"module_number,omitempty"`
-	AssemblyNumber     string    `json:"assembly_number,omitempty"`
-	LastRequestDate    time.Time `json:"last_request_date,omitempty"`
-	DatabaseUpdateDate time.Time `json:"database_update_date,omitempty"`
-	Status             string    `json:"status,omitempty"`
-	UserID             int       `json:"user_id"`
-	FreeRecordBalance  int       `json:"free_record_balance"`
+	INN                *string    `json:"inn,omitempty" validate:"required,taxid"`
+	Address            *string    `json:"address,omitempty" validate:"required"`
+	CashRegisterNumber *string    `json:"cash_register_number,omitempty" validate:"required,max=255"`
+	ModuleNumber       *string    `json:"module_number,omitempty" validate:"max=255"`
+	AssemblyNumber     *string    `json:"assembly_number,omitempty" validate:"required,max=255"`
+	LastRequestDate    *time.Time `json:"last_request_date,omitempty"`
+	DatabaseUpdateDate *time.Time `json:"database_update_date,omitempty"`
+	UserID             *int       `json:"user_id,omitempty" validate:"min=1"`
 }
 
 // TerminalResponse представляет данные торговой точки для ответа
 type TerminalResponse struct {
-	ID                 int       `json:"id"`
-	INN                string    `json:"inn"`
-	CompanyName        string    `json:"company_name"`
-	Address            string    `json:"address"`
-	CashRegisterNumber string    `json:"cash_register_number"`
-	ModuleNumber       string    `json:"module_number"`
-	AssemblyNumber     string    `json:"assembly_number"`
-	LastRequestDate    time.Time `json:"last_request_date"`
-	DatabaseUpdateDate time.Time `json:"database_update_date"`
-	Status             string    `json:"status"`
-	UserID             int       `json:"user_id"`
-	FreeRecordBalance  int       `json:"free_record_balance"`
+	ID                 int            `json:"id"`
+	INN                string         `json:"inn"`
+	CompanyName        string         `json:"company_name"`
+	Address            string         `json:"address"`
+	CashRegisterNumber string         `json:"cash_register_number"`
+	ModuleNumber       string         `json:"module_number"`
+	AssemblyNumber     string         `json:"assembly_number"`
+	LastRequestDate    *time.Time     `json:"last_request_date"`
+	DatabaseUpdateDate *time.Time     `json:"database_update_date"`
+	Status             TerminalStatus `json:"status"`
+	IsOnline           bool           `json:"is_online"`
+	UserID             int            `json:"user_id"`
+	FreeRecordBalance  int            `json:"free_record_balance"`
+}
+
+// TerminalCheckInRequest представляет данные периодического опроса от кассы
+type TerminalCheckInRequest struct {
+	CashRegisterNumber string     `json:"cash_register_number" validate:"required"`
+	ModuleNumber       string     `json:"module_number" validate:"required"`
+	DatabaseUpdateDate *time.Time `json:"database_update_date"`
+}
+
+// TerminalCheckInResponse представляет ответ кассе на опрос
+type TerminalCheckInResponse struct {
+	TerminalID         int        `json:"terminal_id"`
+	IsOnline           bool       `json:"is_online"`
+	MustResync         bool       `json:"must_resync"`
+	LastRequestDate    time.Time  `json:"last_request_date"`
+	DatabaseUpdateDate *time.Time `json:"database_update_date"`
 }
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// TerminalStatus — этап жизненного цикла торговой точки
+type TerminalStatus string
+
+const (
+	TerminalRegistered     TerminalStatus = "registered"
+	TerminalActive         TerminalStatus = "active"
+	TerminalSuspended      TerminalStatus = "suspended"
+	TerminalBlocked        TerminalStatus = "blocked"
+	TerminalDecommissioned TerminalStatus = "decommissioned"
+)
+
+// terminalTransitions перечисляет допустимые переходы из каждого статуса.
+// Выведенная из эксплуатации точка в другие статусы не переходит.
+var terminalTransitions = map[TerminalStatus][]TerminalStatus{
+	TerminalRegistered: {TerminalActive, TerminalDecommissioned},
+	TerminalActive:     {TerminalSuspended, TerminalBlocked, TerminalDecommissioned},
+	TerminalSuspended:  {TerminalActive, TerminalBlocked, TerminalDecommissioned},
+	TerminalBlocked:    {TerminalActive, TerminalDecommissioned},
+}
+
+// Valid сообщает, известен ли статус системе
+func (s TerminalStatus) Valid() bool {
+	switch s {
+	case TerminalRegistered, TerminalActive, TerminalSuspended, TerminalBlocked, TerminalDecommissioned:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo сообщает, разрешён ли переход из s в next
+func (s TerminalStatus) CanTransitionTo(next TerminalStatus) bool {
+	for _, allowed := range terminalTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CanConsume сообщает, может ли точка в этом статусе списывать бесплатные записи
+func (s TerminalStatus) CanConsume() bool {
+	return s != TerminalBlocked && s != TerminalDecommissioned
+}
+
+// TerminalStatusChange представляет запись истории смены статуса торговой точки
+type TerminalStatusChange struct {
+	ID         int            `json:"id"`
+	TerminalID int            `json:"terminal_id"`
+	FromStatus TerminalStatus `json:"from_status"`
+	ToStatus   TerminalStatus `json:"to_status"`
+	Reason     string         `json:"reason"`
+	ActorID    *int           `json:"actor_id"`
+	ChangedAt  time.Time      `json:"changed_at"`
+}
+
+// TerminalStatusChangeRequest представляет данные для перевода торговой точки в другой статус
+type TerminalStatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
@@ -8,36 +8,50 @@ type User struct {
 	Password string `json:"password"`
 	IsActive bool   `json:"is_active"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     Role   `json:"role"`
+	Version  int    `json:"version"`
 }
 
-// UserRegistrationRequest представляет данные для регистрации пользователя
+// UserRegistrationRequest представляет данные для самостоятельной регистрации. Роль
+// не передаётся: новый пользователь всегда становится владельцем.
 type UserRegistrationRequest struct {
-	INN      string `json:"inn"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	INN      string `json:"inn" validate:"required,taxid"`
+	Username string `json:"username" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+	IsActive bool   `json:"is_active"`
+}
+
+// UserCreateRequest представляет данные для создания пользователя администратором
+type UserCreateRequest struct {
+	INN      string `json:"inn" validate:"required,taxid"`
+	Username string `json:"username" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
 	IsActive bool   `json:"is_active"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     Role   `json:"role" validate:"enum"`
 }
 
 // UserLoginRequest представляет данные для входа пользователя
 type UserLoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 // UserLoginResponse представляет ответ на успешный вход пользователя
 type UserLoginResponse struct {
-	User  User   `json:"user"`
-	Token string `json:"token"`
+	User UserResponse `json:"user"`
+	TokenPair
 }
 
-// UserUpdateRequest представляет данные для обновления пользователя
+// UserUpdateRequest представляет частичное обновление пользователя: изменяются только
+// переданные поля. Пароль сохраняется только в виде хеша.
 type UserUpdateRequest struct {
-	INN      string `json:"inn"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	IsActive bool   `json:"is_active"`
-	IsAdmin  bool   `json:"is_admin"`
+	INN      *string `json:"inn,omitempty" validate:"required,taxid"`
+	Username *string `json:"username,omitempty" validate:"required,max=255"`
+	Password *string `json:"password,omitempty" validate:"required,max=72"`
+	IsActive *bool   `json:"is_active,omitempty"`
+	IsAdmin  *bool   `json:"is_admin,omitempty"`
+	Role     *Role   `json:"role,omitempty" validate:"enum"`
 }
 
 // UserResponse представляет данные пользователя для ответа
@@ -47,4 +61,28 @@ type UserResponse struct {
 	Username string `json:"username"`
 	IsActive bool   `json:"is_active"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     Role   `json:"role"`
+	Version  int    `json:"version"`
+}
+
+// NewUserResponse убирает из данных пользователя хеш пароля
+func NewUserResponse(user *User) UserResponse {
+	return UserResponse{
+		ID:       user.ID,
+		INN:      user.INN,
+		Username: user.Username,
+		IsActive: user.IsActive,
+		IsAdmin:  user.IsAdmin,
+		Role:     user.Role,
+		Version:  user.Version,
+	}
+}
+
+// NewUserResponses убирает хеши паролей из списка пользователей
+func NewUserResponses(users []User) []UserResponse {
+	responses := make([]UserResponse, len(users))
+	for i := range users {
+		responses[i] = NewUserResponse(&users[i])
+	}
+	return responses
 }
@@ -0,0 +1,207 @@
+// Package ofd доставляет чеки и Z-отчёты оператору фискальных данных (ОФД)
+// из очереди ofd_outbox с повторными попытками и экспоненциальной задержкой.
+package ofd
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/idkOybek/internal/health"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+)
+
+// Ack — квитанция ОФД о приёме документа
+type Ack struct {
+	ID         string    `json:"ack_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// OFDClient отправляет документ оператору фискальных данных. Отправка должна быть
+// идемпотентной по doc.ID: при повторе ОФД возвращает прежнюю квитанцию.
+type OFDClient interface {
+	Send(ctx context.Context, doc models.OFDDocument) (*Ack, error)
+}
+
+// PermanentError означает, что ОФД отверг документ и повторная отправка не поможет
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return "permanent: " + e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// IsPermanent сообщает, является ли ошибка отправки окончательной
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Outbox — очередь документов, ожидающих отправки
+type Outbox interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OFDDocument, error)
+	Acknowledge(ctx context.Context, id int, ackID string) error
+	Reschedule(ctx context.Context, id int, retryAt time.Time, reason string) error
+	DeadLetter(ctx context.Context, id int, reason string) error
+}
+
+// Config задаёт параметры пула отправки
+type Config struct {
+	Workers        int
+	BatchSize      int
+	PollInterval   time.Duration
+	RequestTimeout time.Duration
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Dispatcher забирает документы из очереди и отправляет их пулом из Config.Workers обработчиков
+type Dispatcher struct {
+	outbox Outbox
+	client OFDClient
+	cfg    Config
+}
+
+func NewDispatcher(outbox Outbox, client OFDClient, cfg Config) *Dispatcher {
+	return &Dispatcher{outbox: outbox, client: client, cfg: cfg}
+}
+
+// lease — время, на которое документ скрывается от других обработчиков. Документ
+// забирается только для свободного обработчика, поэтому аренда с запасом покрывает одну
+// отправку, и документ не уходит дважды параллельно.
+func (d *Dispatcher) lease() time.Duration {
+	return 2*d.cfg.RequestTimeout + d.cfg.PollInterval
+}
+
+// Run обрабатывает очередь до отмены ctx. Забирается не больше документов, чем свободных
+// обработчиков (и не больше BatchSize): каждый документ начинает отправляться сразу и не
+// ждёт своей очереди, пока истекает его аренда. Пока очередь отдаёт столько документов,
+// сколько запрошено, следующая пачка забирается без паузы; иначе следующая проверка через
+// PollInterval. Успешные обращения к очереди и завершённые отправки отмечаются в heartbeat.
+func (d *Dispatcher) Run(ctx context.Context, heartbeat *health.Heartbeat) {
+	logger.InfoLogger.Printf("OFD dispatcher started with %d worker(s)", d.cfg.Workers)
+	jobs := make(chan models.OFDDocument)
+	idle := make(chan struct{}, d.cfg.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		idle <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for doc := range jobs {
+				d.deliver(ctx, doc)
+				heartbeat.Beat()
+				idle <- struct{}{}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+		logger.InfoLogger.Printf("OFD dispatcher stopped")
+	}()
+
+	for {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return
+		}
+		free := 1
+	collect:
+		for free < d.cfg.BatchSize {
+			select {
+			case <-idle:
+				free++
+			default:
+				break collect
+			}
+		}
+
+		docs, err := d.outbox.Claim(ctx, free, d.lease())
+		if err != nil && ctx.Err() == nil {
+			logger.ErrorLogger.Printf("Error claiming OFD outbox documents: %v", err)
+		}
+		if err == nil {
+			heartbeat.Beat()
+		}
+		for _, doc := range docs {
+			select {
+			case jobs <- doc:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for i := len(docs); i < free; i++ {
+			idle <- struct{}{}
+		}
+		if err == nil && len(docs) == free {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.cfg.PollInterval):
+		}
+	}
+}
+
+// deliver отправляет один документ и записывает результат в очередь
+func (d *Dispatcher) deliver(ctx context.Context, doc models.OFDDocument) {
+	sendCtx, cancel := context.WithTimeout(ctx, d.cfg.RequestTimeout)
+	ack, err := d.client.Send(sendCtx, doc)
+	cancel()
+
+	// Квитанция записывается даже после отмены ctx, чтобы не терять её при остановке
+	recordCtx, cancelRecord := context.WithTimeout(context.Background(), d.cfg.RequestTimeout)
+	defer cancelRecord()
+
+	attempt := doc.Attempts + 1
+	switch {
+	case err == nil:
+		if err := d.outbox.Acknowledge(recordCtx, doc.ID, ack.ID); err != nil {
+			logger.ErrorLogger.Printf("Error recording OFD ack %s for %s %d: %v", ack.ID, doc.Kind, doc.ID, err)
+			return
+		}
+		logger.InfoLogger.Printf("OFD acknowledged %s outbox %d as %s", doc.Kind, doc.ID, ack.ID)
+	case ctx.Err() != nil:
+		// Отправку прервала остановка, а не ОФД: попытка не засчитывается, документ
+		// вернётся в работу после истечения аренды
+		logger.InfoLogger.Printf("OFD delivery of %s outbox %d interrupted by shutdown: %v", doc.Kind, doc.ID, err)
+	case IsPermanent(err) || attempt >= d.cfg.MaxAttempts:
+		if err := d.outbox.DeadLetter(recordCtx, doc.ID, err.Error()); err != nil {
+			logger.ErrorLogger.Printf("Error dead-lettering OFD outbox %d: %v", doc.ID, err)
+			return
+		}
+		logger.ErrorLogger.Printf("OFD delivery of %s outbox %d dead-lettered after %d attempt(s): %v", doc.Kind, doc.ID, attempt, err)
+	default:
+		retryAt := time.Now().Add(Backoff(attempt, d.cfg.BaseBackoff, d.cfg.MaxBackoff))
+		if err := d.outbox.Reschedule(recordCtx, doc.ID, retryAt, err.Error()); err != nil {
+			logger.ErrorLogger.Printf("Error rescheduling OFD outbox %d: %v", doc.ID, err)
+			return
+		}
+		logger.ErrorLogger.Printf("OFD delivery of %s outbox %d failed (attempt %d), retry at %s: %v", doc.Kind, doc.ID, attempt, retryAt.Format(time.RFC3339), err)
+	}
+}
+
+// Backoff возвращает задержку перед попыткой attempt+1: base·2^(attempt-1), не больше max,
+// со случайным разбросом в пределах второй половины интервала
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,278 @@
+package ofd_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/ofd"
+	"github.com/idkOybek/internal/ofd/fake"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	logger.InfoLogger.SetOutput(io.Discard)
+	logger.ErrorLogger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// entry — документ тестовой очереди и всё, что диспетчер о нём записал
+type entry struct {
+	doc         models.OFDDocument
+	status      models.OFDDeliveryStatus
+	ackID       string
+	reasons     []string
+	delays      []time.Duration
+	retryAt     time.Time
+	leasedUntil time.Time
+}
+
+// queue — очередь в памяти с той же арендой, что у ofd_outbox
+type queue struct {
+	mu      sync.Mutex
+	entries []*entry
+	limits  []int
+}
+
+func newQueue(count int) *queue {
+	q := &queue{}
+	for i := 1; i <= count; i++ {
+		doc := models.OFDDocument{ID: i, Kind: models.OFDReceipt, Payload: json.RawMessage(fmt.Sprintf(`{"receipt_number":%d}`, i))}
+		q.entries = append(q.entries, &entry{doc: doc, status: models.OFDPending})
+	}
+	return q
+}
+
+func (q *queue) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OFDDocument, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limits = append(q.limits, limit)
+	now := time.Now()
+	var docs []models.OFDDocument
+	for _, e := range q.entries {
+		if len(docs) < limit && e.status == models.OFDPending && !e.retryAt.After(now) && !e.leasedUntil.After(now) {
+			e.leasedUntil = now.Add(lease)
+			docs = append(docs, e.doc)
+		}
+	}
+	return docs, nil
+}
+
+func (q *queue) Acknowledge(ctx context.Context, id int, ackID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := q.entries[id-1]
+	e.status, e.ackID = models.OFDAcknowledged, ackID
+	return nil
+}
+
+func (q *queue) Reschedule(ctx context.Context, id int, retryAt time.Time, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := q.entries[id-1]
+	e.doc.Attempts++
+	e.reasons = append(e.reasons, reason)
+	e.delays = append(e.delays, time.Until(retryAt))
+	e.retryAt, e.leasedUntil = retryAt, time.Time{}
+	return nil
+}
+
+func (q *queue) DeadLetter(ctx context.Context, id int, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := q.entries[id-1]
+	e.doc.Attempts++
+	e.reasons = append(e.reasons, reason)
+	e.status = models.OFDDead
+	return nil
+}
+
+// snapshot возвращает копии записей очереди
+func (q *queue) snapshot() []entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := make([]entry, len(q.entries))
+	for i, e := range q.entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// settled сообщает, что ни один документ больше не ждёт отправки
+func (q *queue) settled() bool {
+	for _, e := range q.snapshot() {
+		if e.status == models.OFDPending {
+			return false
+		}
+	}
+	return true
+}
+
+var testConfig = ofd.Config{
+	Workers:        2,
+	BatchSize:      50,
+	PollInterval:   5 * time.Millisecond,
+	RequestTimeout: time.Second,
+	MaxAttempts:    3,
+	BaseBackoff:    20 * time.Millisecond,
+	MaxBackoff:     40 * time.Millisecond,
+}
+
+// dispatch запускает диспетчер с ОФД handler, ждёт until и останавливает его
+func dispatch(t *testing.T, q *queue, handler http.Handler, cfg ofd.Config, until func() bool) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ofd.NewDispatcher(q, ofd.NewHTTPClient(server.URL), cfg).Run(ctx, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !until() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if !until() {
+		t.Fatalf("dispatcher did not finish: %+v", q.snapshot())
+	}
+}
+
+// failing отвечает статусом status на первые failures запросов каждого документа,
+// остальные передаёт фейковому ОФД
+func failing(server http.Handler, status, failures int) http.Handler {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		mu.Lock()
+		seen[key]++
+		fail := seen[key] <= failures
+		mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		server.ServeHTTP(w, r)
+	})
+}
+
+func TestDispatcherAcknowledges(t *testing.T) {
+	q := newQueue(10)
+	server := fake.NewServer(0)
+	dispatch(t, q, server, testConfig, q.settled)
+
+	received := server.Received()
+	if len(received) != 10 {
+		t.Fatalf("OFD received %d documents, want 10", len(received))
+	}
+	acks := map[string]string{}
+	for _, doc := range received {
+		acks[doc.IdempotencyKey] = doc.Ack.ID
+	}
+	for _, e := range q.snapshot() {
+		if e.status != models.OFDAcknowledged || e.doc.Attempts != 0 || e.ackID != acks[fmt.Sprint(e.doc.ID)] {
+			t.Errorf("document %d: status %s, attempts %d, ack %q", e.doc.ID, e.status, e.doc.Attempts, e.ackID)
+		}
+	}
+	// Документы забираются только для свободных обработчиков, чтобы аренда не истекала в ожидании
+	for _, limit := range q.limits {
+		if limit > testConfig.Workers {
+			t.Errorf("claimed %d documents for %d workers", limit, testConfig.Workers)
+		}
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	q := newQueue(1)
+	server := fake.NewServer(0)
+	cfg := testConfig
+	cfg.MaxAttempts = 5
+	dispatch(t, q, failing(server, http.StatusServiceUnavailable, 2), cfg, q.settled)
+
+	e := q.snapshot()[0]
+	if e.status != models.OFDAcknowledged || e.doc.Attempts != 2 || len(e.reasons) != 2 || len(server.Received()) != 1 {
+		t.Fatalf("unexpected delivery %+v", e)
+	}
+	// Задержка удваивается с каждой попыткой и лежит во второй половине интервала
+	for i, want := range []time.Duration{cfg.BaseBackoff, 2 * cfg.BaseBackoff} {
+		if delay := e.delays[i]; delay > want || delay < want/2-5*time.Millisecond {
+			t.Errorf("retry %d after %s, want between %s and %s", i+1, delay, want/2, want)
+		}
+	}
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	t.Run("after max attempts", func(t *testing.T) {
+		q := newQueue(1)
+		dispatch(t, q, failing(fake.NewServer(0), http.StatusServiceUnavailable, 100), testConfig, q.settled)
+		if e := q.snapshot()[0]; e.status != models.OFDDead || e.doc.Attempts != testConfig.MaxAttempts || len(e.delays) != testConfig.MaxAttempts-1 {
+			t.Errorf("unexpected delivery %+v", e)
+		}
+	})
+
+	t.Run("on permanent rejection", func(t *testing.T) {
+		q := newQueue(1)
+		dispatch(t, q, failing(fake.NewServer(0), http.StatusUnprocessableEntity, 100), testConfig, q.settled)
+		if e := q.snapshot()[0]; e.status != models.OFDDead || e.doc.Attempts != 1 || len(e.delays) != 0 {
+			t.Errorf("unexpected delivery %+v", e)
+		}
+	})
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	q := newQueue(1)
+	started := make(chan struct{})
+	var once sync.Once
+	// ОФД не отвечает, пока клиент не прервёт запрос
+	hanging := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Обрыв соединения сервер замечает только после чтения тела запроса
+		io.Copy(io.Discard, r.Body)
+		once.Do(func() { close(started) })
+		<-r.Context().Done()
+	})
+	dispatch(t, q, hanging, testConfig, func() bool {
+		select {
+		case <-started:
+			return true
+		default:
+			return false
+		}
+	})
+
+	if e := q.snapshot()[0]; e.status != models.OFDPending || e.doc.Attempts != 0 || len(e.reasons) != 0 {
+		t.Errorf("interrupted delivery was recorded: %+v", e)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{4, 400 * time.Millisecond, 800 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 100; i++ {
+			if delay := ofd.Backoff(tc.attempt, 100*time.Millisecond, time.Second); delay < tc.min || delay > tc.max {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", tc.attempt, delay, tc.min, tc.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package fake — локальная замена ОФД для разработки и проверки доставки без сети
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/idkOybek/internal/ofd"
+)
+
+// Document — документ, принятый фейковым ОФД
+type Document struct {
+	IdempotencyKey string          `json:"idempotency_key"`
+	Kind           string          `json:"kind"`
+	Body           json.RawMessage `json:"document"`
+	Ack            ofd.Ack         `json:"ack"`
+}
+
+// Server принимает документы по ofd.DocumentsPath и выдаёт квитанции. Повтор с тем же
+// Idempotency-Key возвращает прежнюю квитанцию. С вероятностью FailureRate отвечает 503,
+// чтобы проверить повторные попытки; документы без поля document отклоняются с 422.
+type Server struct {
+	FailureRate float64
+
+	mu       sync.Mutex
+	byKey    map[string]*Document
+	received []*Document
+	rnd      *rand.Rand
+}
+
+func NewServer(failureRate float64) *Server {
+	return &Server{
+		FailureRate: failureRate,
+		byKey:       map[string]*Document{},
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ofd.DocumentsPath {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.accept(w, r)
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.received)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) accept(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Idempotency-Key header is required"})
+		return
+	}
+
+	var doc Document
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || len(doc.Body) == 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "document is required"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.byKey[key]; ok {
+		writeJSON(w, http.StatusOK, existing.Ack)
+		return
+	}
+	if s.rnd.Float64() < s.FailureRate {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "temporarily unavailable"})
+		return
+	}
+
+	doc.IdempotencyKey = key
+	doc.Ack = ofd.Ack{ID: fmt.Sprintf("OFD-%06d", len(s.received)+1), ReceivedAt: time.Now().UTC()}
+	s.byKey[key] = &doc
+	s.received = append(s.received, &doc)
+	writeJSON(w, http.StatusCreated, doc.Ack)
+}
+
+// Received возвращает копию списка принятых документов
+func (s *Server) Received() []Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := make([]Document, len(s.received))
+	for i, doc := range s.received {
+		docs[i] = *doc
+	}
+	return docs
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,68 @@
+package ofd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/internal/models"
+)
+
+// DocumentsPath — путь приёма документов на стороне ОФД
+const DocumentsPath = "/api/v1/documents"
+
+// HTTPClient отправляет документы в ОФД по HTTP. Ответы 4xx, кроме 408 и 429,
+// считаются окончательным отказом; прочие ошибки повторяются.
+type HTTPClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewHTTPClient(baseURL string) *HTTPClient {
+	return &HTTPClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{},
+	}
+}
+
+// Send реализует OFDClient
+func (c *HTTPClient) Send(ctx context.Context, doc models.OFDDocument) (*Ack, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, &PermanentError{Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+DocumentsPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, &PermanentError{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.Itoa(doc.ID))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		var ack Ack
+		if err := json.Unmarshal(respBody, &ack); err != nil || ack.ID == "" {
+			return nil, fmt.Errorf("invalid OFD acknowledgement: %s", respBody)
+		}
+		return &ack, nil
+	}
+
+	err = fmt.Errorf("OFD responded %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, &PermanentError{Err: err}
+	}
+	return nil, err
+}
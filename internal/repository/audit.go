@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type AuditRepository struct {
+	db conn
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: pool{db}}
+}
+
+// redactedAuditFields — поля, значения которых не попадают в журнал; фиксируется только факт изменения
+var redactedAuditFields = map[string]bool{"password": true}
+
+const redactedAuditValue = "******"
+
+// AuditDiff сравнивает JSON-представления объекта до и после изменения и возвращает
+// изменившиеся поля. before или after равен nil при создании и удалении.
+func AuditDiff(before, after interface{}) (map[string]models.AuditChange, error) {
+	oldFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.AuditChange{}
+	for name, value := range oldFields {
+		if next, ok := newFields[name]; !ok || !reflect.DeepEqual(value, next) {
+			changes[name] = models.AuditChange{Old: value, New: newFields[name]}
+		}
+	}
+	for name, value := range newFields {
+		if _, ok := oldFields[name]; !ok && value != nil {
+			changes[name] = models.AuditChange{New: value}
+		}
+	}
+	for name, change := range changes {
+		if redactedAuditFields[name] {
+			if change.Old != nil {
+				change.Old = redactedAuditValue
+			}
+			if change.New != nil {
+				change.New = redactedAuditValue
+			}
+			changes[name] = change
+		}
+	}
+	return changes, nil
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if rv := reflect.ValueOf(v); v == nil || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return fields, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(raw, &fields)
+}
+
+// writeAudit записывает изменение объекта в журнал аудита в рамках транзакции, выполнившей изменение
+func writeAudit(ctx context.Context, tx executor, meta models.AuditMeta, entity models.AuditEntity, entityID int, action models.AuditAction, before, after interface{}) error {
+	changes, err := AuditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO audit_log (entity_type, entity_id, action, actor_id, changes, request_id, ip) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err = tx.ExecContext(ctx, query, entity, entityID, action, meta.ActorID, payload, meta.RequestID, meta.IP)
+	return err
+}
+
+var auditPage = pageSpec{
+	table:   "audit_log",
+	columns: "id, entity_type, entity_id, action, actor_id, changes, request_id, ip, created_at",
+	sorts: map[string]sortColumn{
+		"id":         {expr: "id", cast: "int"},
+		"created_at": {expr: "created_at", cast: "timestamp"},
+	},
+}
+
+// List возвращает страницу журнала аудита
+func (r *AuditRepository) List(ctx context.Context, filter models.AuditFilter) (*models.AuditRecordList, error) {
+	where := &whereBuilder{}
+	if filter.EntityType != "" {
+		where.add("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		where.add("entity_id = ?", *filter.EntityID)
+	}
+	if filter.ActorID != nil {
+		where.add("actor_id = ?", *filter.ActorID)
+	}
+	if filter.From != nil {
+		where.add("created_at >= ?::timestamptz", *filter.From)
+	}
+	if filter.To != nil {
+		where.add("created_at < ?::timestamptz", *filter.To)
+	}
+
+	items, total, next, err := fetchPage(ctx, r.db, auditPage, where, filter.ListParams,
+		func(rows *sql.Rows, record *models.AuditRecord, sortKey *string) error {
+			var changes []byte
+			err := rows.Scan(&record.ID, &record.EntityType, &record.EntityID, &record.Action, &record.ActorID, &changes, &record.RequestID, &record.IP, &record.CreatedAt, sortKey)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(changes, &record.Changes)
+		},
+		func(record *models.AuditRecord) int { return record.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditRecordList{Items: items, Total: total, NextCursor: next}, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// ErrInsufficientBalance возвращается, если движение увело бы баланс в минус
+var ErrInsufficientBalance = apperrors.New(apperrors.CodeConflict, "Insufficient free record balance")
+
+// ErrConsumptionNotAllowed возвращается при списании записей точкой, статус которой это запрещает
+var ErrConsumptionNotAllowed = apperrors.New(apperrors.CodeConflict, "Terminal status does not allow consuming free records")
+
+// ApplyBalanceMovement атомарно изменяет баланс торговой точки на movement.Amount
+// и записывает движение в журнал
+func (r *TerminalRepository) ApplyBalanceMovement(ctx context.Context, movement *models.BalanceMovement) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := applyBalanceMovement(ctx, tx, movement); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyBalanceMovement изменяет баланс в рамках транзакции tx. Строка торговой точки
+// блокируется до конца транзакции, поэтому проверка статуса при списании не расходится
+// с параллельной сменой статуса. Баланс входит в представление кассы, поэтому движение
+// увеличивает её версию.
+func applyBalanceMovement(ctx context.Context, tx executor, movement *models.BalanceMovement) error {
+	var balance int
+	var status models.TerminalStatus
+	err := tx.QueryRowContext(ctx, "SELECT free_record_balance, status FROM terminals WHERE id=$1 FOR UPDATE", movement.TerminalID).Scan(&balance, &status)
+	if err != nil {
+		return err
+	}
+	if movement.Kind == models.BalanceMovementConsumption && !status.CanConsume() {
+		return ErrConsumptionNotAllowed
+	}
+
+	balance += movement.Amount
+	if balance < 0 {
+		return ErrInsufficientBalance
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE terminals SET free_record_balance=$1, version=version+1, updated_at=now() WHERE id=$2", balance, movement.TerminalID)
+	if err != nil {
+		return err
+	}
+
+	movement.BalanceAfter = balance
+	return insertBalanceMovement(ctx, tx, movement)
+}
+
+// GetBalanceHistory возвращает журнал движений баланса торговой точки в порядке записи
+func (r *TerminalRepository) GetBalanceHistory(ctx context.Context, terminalID int) ([]models.BalanceMovement, error) {
+	query := "SELECT id, terminal_id, kind, amount, balance_after, actor_id, reason, created_at FROM terminal_balance_movements WHERE terminal_id=$1 ORDER BY id"
+	rows, err := r.db.QueryContext(ctx, query, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.BalanceMovement{}
+	for rows.Next() {
+		var movement models.BalanceMovement
+		var actorID sql.NullInt64
+		err := rows.Scan(&movement.ID, &movement.TerminalID, &movement.Kind, &movement.Amount, &movement.BalanceAfter, &actorID, &movement.Reason, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			movement.ActorID = &id
+		}
+		movements = append(movements, movement)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+func insertBalanceMovement(ctx context.Context, tx executor, movement *models.BalanceMovement) error {
+	query := "INSERT INTO terminal_balance_movements (terminal_id, kind, amount, balance_after, actor_id, reason) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+	return tx.QueryRowContext(ctx, query, movement.TerminalID, movement.Kind, movement.Amount, movement.BalanceAfter, movement.ActorID, movement.Reason).Scan(&movement.ID, &movement.CreatedAt)
+}
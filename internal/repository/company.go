@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+// ErrCompanyNameMismatch возвращается, когда для уже существующей компании передано
+// другое название: оно не переименовывает компанию и не должно теряться молча
+var ErrCompanyNameMismatch = &apperrors.Error{Code: apperrors.CodeConflict, Message: "A company with this INN already exists under another legal name", Field: "company_name"}
+
+type CompanyRepository struct {
+	db conn
+}
+
+func NewCompanyRepository(db *sql.DB) *CompanyRepository {
+	return &CompanyRepository{db: pool{db}}
+}
+
+const companyColumns = "id, inn, legal_name, legal_address, vat_payer, contact_person, phone, email, version"
+
+var companyPage = pageSpec{
+	table:   "companies",
+	columns: companyColumns,
+	sorts: map[string]sortColumn{
+		"id":         {expr: "id", cast: "int"},
+		"inn":        {expr: "inn", cast: "text"},
+		"legal_name": {expr: "legal_name", cast: "text"},
+	},
+}
+
+func scanCompanyInto(row interface{ Scan(...interface{}) error }, company *models.Company, extra ...interface{}) error {
+	dest := []interface{}{&company.ID, &company.INN, &company.LegalName, &company.LegalAddress, &company.VATPayer, &company.ContactPerson, &company.Phone, &company.Email, &company.Version}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func scanCompany(row interface{ Scan(...interface{}) error }) (*models.Company, error) {
+	var company models.Company
+	if err := scanCompanyInto(row, &company); err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+// List возвращает страницу компаний, удовлетворяющих фильтру
+func (r *CompanyRepository) List(ctx context.Context, filter models.CompanyFilter) (*models.CompanyList, error) {
+	where := &whereBuilder{}
+	if filter.INN != "" {
+		where.add("inn = ?", filter.INN)
+	}
+	if filter.LegalName != "" {
+		where.add("legal_name ILIKE ?", containsPattern(filter.LegalName))
+	}
+	if filter.VATPayer != nil {
+		where.add("vat_payer = ?", *filter.VATPayer)
+	}
+	if filter.UserID != nil {
+		where.add("inn IN (SELECT inn FROM users WHERE id = ? UNION SELECT inn FROM terminals WHERE user_id = ?)", *filter.UserID, *filter.UserID)
+	}
+
+	items, total, next, err := fetchPage(ctx, r.db, companyPage, where, filter.ListParams,
+		func(rows *sql.Rows, company *models.Company, sortKey *string) error {
+			return scanCompanyInto(rows, company, sortKey)
+		},
+		func(company *models.Company) int { return company.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &models.CompanyList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+func (r *CompanyRepository) GetByID(ctx context.Context, id int) (*models.Company, error) {
+	query := "SELECT " + companyColumns + " FROM companies WHERE id=$1"
+	return scanCompany(r.db.QueryRowContext(ctx, query, id))
+}
+
+// IsRelated сообщает, относится ли пользователь userID к компании с ИНН inn:
+// сам зарегистрирован с этим ИНН или владеет её торговой точкой
+func (r *CompanyRepository) IsRelated(ctx context.Context, inn string, userID int) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM users WHERE id=$2 AND inn=$1) OR EXISTS (SELECT 1 FROM terminals WHERE user_id=$2 AND inn=$1)"
+	var related bool
+	err := r.db.QueryRowContext(ctx, query, inn, userID).Scan(&related)
+	return related, err
+}
+
+// IsSoleOwner сообщает, относится ли пользователь userID к компании с ИНН inn и
+// принадлежат ли ему все её торговые точки и пользователи
+func (r *CompanyRepository) IsSoleOwner(ctx context.Context, inn string, userID int) (bool, error) {
+	query := "SELECT (EXISTS (SELECT 1 FROM users WHERE id=$2 AND inn=$1) OR EXISTS (SELECT 1 FROM terminals WHERE user_id=$2 AND inn=$1))" +
+		" AND NOT EXISTS (SELECT 1 FROM users WHERE inn=$1 AND id<>$2)" +
+		" AND NOT EXISTS (SELECT 1 FROM terminals WHERE inn=$1 AND user_id IS DISTINCT FROM $2)"
+	var sole bool
+	err := r.db.QueryRowContext(ctx, query, inn, userID).Scan(&sole)
+	return sole, err
+}
+
+// Create добавляет компанию и записывает создание в журнал аудита
+func (r *CompanyRepository) Create(ctx context.Context, company *models.Company, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO companies (inn, legal_name, legal_address, vat_payer, contact_person, phone, email) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version"
+	err = tx.QueryRowContext(ctx, query, company.INN, company.LegalName, company.LegalAddress, company.VATPayer, company.ContactPerson, company.Phone, company.Email).Scan(&company.ID, &company.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditCompany, company.ID, models.AuditCreate, nil, company); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update перезаписывает компанию, если её версия всё ещё равна company.Version,
+// и увеличивает версию. Смена ИНН каскадно переносится на торговые точки и пользователей.
+func (r *CompanyRepository) Update(ctx context.Context, company *models.Company, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanCompany(tx.QueryRowContext(ctx, "SELECT "+companyColumns+" FROM companies WHERE id=$1 FOR UPDATE", company.ID))
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, company.Version); err != nil {
+		return err
+	}
+
+	query := "UPDATE companies SET inn=$1, legal_name=$2, legal_address=$3, vat_payer=$4, contact_person=$5, phone=$6, email=$7, version=version+1, updated_at=now() WHERE id=$8 RETURNING version"
+	err = tx.QueryRowContext(ctx, query, company.INN, company.LegalName, company.LegalAddress, company.VATPayer, company.ContactPerson, company.Phone, company.Email, company.ID).Scan(&company.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditCompany, company.ID, models.AuditUpdate, before, company); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete удаляет компанию версии version. Компанию, на которую ссылаются торговые точки
+// или пользователи, удалить нельзя.
+func (r *CompanyRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanCompany(tx.QueryRowContext(ctx, "SELECT "+companyColumns+" FROM companies WHERE id=$1 FOR UPDATE", id))
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM companies WHERE id=$1", id); err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditCompany, id, models.AuditDelete, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureCompany создаёт в транзакции tx компанию с ИНН inn и названием legalName,
+// если её ещё нет, и записывает создание в журнал аудита. Если компания уже есть,
+// непустое legalName должно совпадать с её названием, иначе возвращается ErrCompanyNameMismatch.
+func ensureCompany(ctx context.Context, tx executor, inn, legalName string, meta models.AuditMeta) error {
+	company := models.Company{INN: inn, LegalName: legalName}
+	query := "INSERT INTO companies (inn, legal_name) VALUES ($1, $2) ON CONFLICT (inn) DO NOTHING RETURNING id, version"
+	err := tx.QueryRowContext(ctx, query, inn, legalName).Scan(&company.ID, &company.Version)
+	if err == sql.ErrNoRows {
+		if legalName == "" {
+			return nil
+		}
+		var stored string
+		if err := tx.QueryRowContext(ctx, "SELECT legal_name FROM companies WHERE inn=$1", inn).Scan(&stored); err != nil {
+			return err
+		}
+		if stored != legalName {
+			return ErrCompanyNameMismatch
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, meta, models.AuditCompany, company.ID, models.AuditCreate, nil, &company)
+}
@@ -0,0 +1,230 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+func TestCompanyRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewCompanyRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+	terminal := createTerminal(t, db, "CR-1", nil, other.ID)
+
+	companyByINN := func(inn string) *models.Company {
+		t.Helper()
+		list, err := repo.List(ctx, models.CompanyFilter{INN: inn})
+		mustNot(t, err)
+		if len(list.Items) != 1 {
+			t.Fatalf("%d companies with INN %s", len(list.Items), inn)
+		}
+		return &list.Items[0]
+	}
+	spare := companyByINN(innSpare)
+	company := &models.Company{INN: innAdmin, LegalName: "Acme", LegalAddress: "Tashkent", VATPayer: true, Email: "office@acme.uz"}
+
+	t.Run("create", func(t *testing.T) {
+		mustNot(t, repo.Create(ctx, company, meta))
+		if company.ID == 0 || company.Version != 1 {
+			t.Errorf("created company %+v", company)
+		}
+		duplicate := &models.Company{INN: innAdmin, LegalName: "Acme again"}
+		expectError(t, repo.Create(ctx, duplicate, meta), apperrors.CodeConflict, "inn")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := repo.GetByID(ctx, company.ID)
+		mustNot(t, err)
+		if *got != *company {
+			t.Errorf("got %+v, want %+v", got, company)
+		}
+		_, err = repo.GetByID(ctx, 999)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("related", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			inn    string
+			userID int
+			want   bool
+		}{
+			{"own INN", innOwner, owner.ID, true},
+			{"terminal owner", innSpare, other.ID, true},
+			{"unrelated", innSpare, owner.ID, false},
+			{"missing user", innOwner, 999, false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				related, err := repo.IsRelated(ctx, tc.inn, tc.userID)
+				mustNot(t, err)
+				if related != tc.want {
+					t.Errorf("related %v, want %v", related, tc.want)
+				}
+			})
+		}
+	})
+
+	t.Run("sole owner", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			inn    string
+			userID int
+			want   bool
+		}{
+			{"own INN", innOwner, owner.ID, true},
+			{"only terminal owner", innSpare, other.ID, true},
+			{"unrelated", innSpare, owner.ID, false},
+			{"missing user", innOwner, 999, false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				sole, err := repo.IsSoleOwner(ctx, tc.inn, tc.userID)
+				mustNot(t, err)
+				if sole != tc.want {
+					t.Errorf("sole owner %v, want %v", sole, tc.want)
+				}
+			})
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		payer := true
+		ownerCompany, otherCompany := companyByINN(innOwner), companyByINN(innOther)
+		cases := []struct {
+			name   string
+			filter models.CompanyFilter
+			want   []int
+		}{
+			{"all", models.CompanyFilter{}, []int{ownerCompany.ID, otherCompany.ID, spare.ID, company.ID}},
+			{"by name", models.CompanyFilter{LegalName: "LLC"}, []int{spare.ID}},
+			{"VAT payers", models.CompanyFilter{VATPayer: &payer}, []int{company.ID}},
+			{"by user", models.CompanyFilter{UserID: &other.ID}, []int{otherCompany.ID, spare.ID}},
+			{"by name descending", models.CompanyFilter{ListParams: models.ListParams{Sort: "legal_name", Desc: true}}, []int{spare.ID, company.ID, otherCompany.ID, ownerCompany.ID}},
+			{"by INN", models.CompanyFilter{ListParams: models.ListParams{Sort: "inn"}}, []int{otherCompany.ID, ownerCompany.ID, company.ID, spare.ID}},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				params := tc.filter.ListParams
+				params.Limit = 1
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.Company, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := repo.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(company models.Company) int { return company.ID })
+				expectIDs(t, ids, tc.want...)
+			})
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		// Новый ИНН компании переносится на её торговые точки
+		expectError(t, repo.Update(ctx, &models.Company{ID: spare.ID, INN: innAdmin, Version: spare.Version}, meta), apperrors.CodeConflict, "inn")
+		spare.INN = innDealer
+		spare.LegalName = "Spare Group"
+		mustNot(t, repo.Update(ctx, spare, meta))
+		if spare.Version != 2 {
+			t.Errorf("version %d after update, want 2", spare.Version)
+		}
+		moved, err := repository.NewTerminalRepository(db).GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if moved.INN != spare.INN || moved.CompanyName != "Spare Group" {
+			t.Errorf("terminal after company update %+v", moved)
+		}
+
+		stale := *spare
+		stale.Version = 1
+		expectError(t, repo.Update(ctx, &stale, meta), apperrors.CodePreconditionFailed, "")
+		missing := *spare
+		missing.ID = 999
+		expectError(t, repo.Update(ctx, &missing, meta), apperrors.CodeNotFound, "")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		expectError(t, repo.Delete(ctx, spare.ID, spare.Version, meta), apperrors.CodeConflict, "")
+		ownerCompany := companyByINN(innOwner)
+		expectError(t, repo.Delete(ctx, ownerCompany.ID, ownerCompany.Version, meta), apperrors.CodeConflict, "")
+
+		expectError(t, repo.Delete(ctx, company.ID, company.Version+1, meta), apperrors.CodePreconditionFailed, "")
+		mustNot(t, repo.Delete(ctx, company.ID, company.Version, meta))
+		expectError(t, repo.Delete(ctx, company.ID, company.Version, meta), apperrors.CodeNotFound, "")
+	})
+}
+
+func TestAuditRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewAuditRepository(db)
+	companies := repository.NewCompanyRepository(db)
+	admin := createUser(t, db, "admin", innAdmin)
+
+	acting := models.AuditMeta{ActorID: &admin.ID, RequestID: "request-1", IP: "10.0.0.1"}
+	company := &models.Company{INN: innOwner, LegalName: "Acme"}
+	mustNot(t, companies.Create(ctx, company, acting))
+	company.LegalName = "Acme Group"
+	mustNot(t, companies.Update(ctx, company, meta))
+	mustNot(t, companies.Delete(ctx, company.ID, company.Version, acting))
+
+	all, err := repo.List(ctx, models.AuditFilter{EntityType: models.AuditCompany, EntityID: &company.ID})
+	mustNot(t, err)
+	if len(all.Items) != 3 {
+		t.Fatalf("%d audit records, want 3", len(all.Items))
+	}
+	created, updated, deleted := all.Items[0], all.Items[1], all.Items[2]
+	if created.Action != models.AuditCreate || updated.Action != models.AuditUpdate || deleted.Action != models.AuditDelete {
+		t.Errorf("audit actions %s, %s, %s", created.Action, updated.Action, deleted.Action)
+	}
+	if created.RequestID != "request-1" || created.IP != "10.0.0.1" || *created.ActorID != admin.ID || updated.ActorID != nil {
+		t.Errorf("audit meta %+v and %+v", created, updated)
+	}
+	if change, ok := updated.Changes["legal_name"]; !ok || change.Old != "Acme" || change.New != "Acme Group" || len(updated.Changes) != 2 {
+		t.Errorf("update changes %+v", updated.Changes)
+	}
+
+	// Границы периода в другом поясе сравниваются как моменты времени
+	west := time.FixedZone("UTC-5", -5*60*60)
+	from, to := updated.CreatedAt.In(west), deleted.CreatedAt.In(west)
+	within := func(from, to *time.Time) []int {
+		var ids []int
+		for _, record := range all.Items {
+			if (from == nil || !record.CreatedAt.Before(*from)) && (to == nil || record.CreatedAt.Before(*to)) {
+				ids = append(ids, record.ID)
+			}
+		}
+		return ids
+	}
+	cases := []struct {
+		name   string
+		filter models.AuditFilter
+		want   []int
+	}{
+		{"by actor", models.AuditFilter{ActorID: &admin.ID, EntityType: models.AuditCompany}, []int{created.ID, deleted.ID}},
+		{"since update", models.AuditFilter{EntityType: models.AuditCompany, EntityID: &company.ID, From: &from}, within(&from, nil)},
+		{"before deletion", models.AuditFilter{EntityType: models.AuditCompany, EntityID: &company.ID, To: &to}, within(nil, &to)},
+		{"newest first", models.AuditFilter{EntityType: models.AuditCompany, EntityID: &company.ID, ListParams: models.ListParams{Sort: "created_at", Desc: true}}, []int{deleted.ID, updated.ID, created.ID}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := tc.filter.ListParams
+			params.Limit = 1
+			ids := pageIDs(t, params, func(params models.ListParams) ([]models.AuditRecord, string, error) {
+				filter := tc.filter
+				filter.ListParams = params
+				list, err := repo.List(ctx, filter)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.NextCursor, nil
+			}, func(record models.AuditRecord) int { return record.ID })
+			expectIDs(t, ids, tc.want...)
+		})
+	}
+}
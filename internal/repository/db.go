@@ -1,32 +1,87 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"os"
+	"strings"
 
+	"github.com/idkOybek/internal/config"
 	_ "github.com/lib/pq"
 )
 
-func NewPostgresDB() (*sql.DB, error) {
+// SessionTimeZone — часовой пояс сессий базы. Столбцы TIMESTAMP WITHOUT TIME ZONE хранят
+// время UTC: now() пишется в этом поясе, а параметры time.Time приводятся к timestamptz,
+// чтобы смещение клиента не отбрасывалось.
+const SessionTimeZone = "UTC"
+
+// NewPostgresDB открывает пул соединений с параметрами из конфигурации и проверяет доступность базы
+func NewPostgresDB(cfg config.DatabaseConfig) (*sql.DB, error) {
 	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s timezone=%s",
+		quoteConnValue(cfg.Host),
+		cfg.Port,
+		quoteConnValue(cfg.User),
+		quoteConnValue(cfg.Password),
+		quoteConnValue(cfg.Name),
+		cfg.SSLMode,
+		SessionTimeZone,
 	)
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// quoteConnValue экранирует значение для строки подключения key=value
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// requireAffected возвращает sql.ErrNoRows, если запрос не затронул ни одной строки
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// selectIDs возвращает идентификаторы, выбранные запросом query
+func selectIDs(ctx context.Context, q queryer, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
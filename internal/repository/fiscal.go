@@ -9,48 +9,78 @@ import (
 )
 
 type FiscalRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewFiscalRepository(db *sql.DB) *FiscalRepository {
-	return &FiscalRepository{db: db}
+	return &FiscalRepository{db: pool{db}}
 }
 
-func (r *FiscalRepository) GetAll(ctx context.Context) ([]models.FiscalModule, error) {
-	log.Println("Repository: Fetching all fiscal modules")
-	query := "SELECT id, factory_number, fiscal_number, user_id FROM fiscal_modules"
-	rows, err := r.db.QueryContext(ctx, query)
+const fiscalModuleColumns = "id, factory_number, fiscal_number, user_id, version"
+
+var fiscalModulePage = pageSpec{
+	table:   "fiscal_modules",
+	columns: fiscalModuleColumns,
+	sorts: map[string]sortColumn{
+		"id":             {expr: "id", cast: "int"},
+		"factory_number": {expr: "factory_number", cast: "text"},
+		"fiscal_number":  {expr: "fiscal_number", cast: "text"},
+	},
+}
+
+// fiscalModuleWhere строит условия выборки фискальных модулей по фильтру
+func fiscalModuleWhere(filter models.FiscalModuleFilter) *whereBuilder {
+	where := &whereBuilder{}
+	if filter.UserID != nil {
+		where.add("user_id = ?", *filter.UserID)
+	}
+	if filter.CompanyINN != "" {
+		where.add("id IN (SELECT fiscal_module_id FROM terminals WHERE inn = ?)", filter.CompanyINN)
+	}
+	if filter.FactoryNumber != "" {
+		where.add("factory_number ILIKE ?", containsPattern(filter.FactoryNumber))
+	}
+	if filter.FiscalNumber != "" {
+		where.add("fiscal_number ILIKE ?", containsPattern(filter.FiscalNumber))
+	}
+	return where
+}
+
+func (r *FiscalRepository) List(ctx context.Context, filter models.FiscalModuleFilter) (*models.FiscalModuleList, error) {
+	log.Println("Repository: Fetching fiscal modules page")
+	items, total, next, err := fetchPage(ctx, r.db, fiscalModulePage, fiscalModuleWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, module *models.FiscalModule, sortKey *string) error {
+			return rows.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID, &module.Version, sortKey)
+		},
+		func(module *models.FiscalModule) int { return module.ID })
 	if err != nil {
-		log.Printf("Repository: Error querying all fiscal modules: %v", err)
+		log.Printf("Repository: Error fetching fiscal modules page: %v", err)
 		return nil, err
 	}
-	defer rows.Close()
+	log.Printf("Repository: Successfully fetched %d of %d fiscal modules", len(items), total)
+	return &models.FiscalModuleList{Items: items, Total: total, NextCursor: next}, nil
+}
 
-	var modules []models.FiscalModule
-	for rows.Next() {
-		var module models.FiscalModule
-		err := rows.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID)
-		if err != nil {
-			log.Printf("Repository: Error scanning fiscal module row: %v", err)
-			return nil, err
-		}
-		modules = append(modules, module)
-	}
-	if err = rows.Err(); err != nil {
-		log.Printf("Repository: Error iterating fiscal module rows: %v", err)
-		return nil, err
+// Export передаёт fn все фискальные модули под фильтром в порядке его сортировки
+func (r *FiscalRepository) Export(ctx context.Context, filter models.FiscalModuleFilter, fn func(module *models.FiscalModule) error) error {
+	log.Println("Repository: Exporting fiscal modules")
+	err := streamAll(ctx, r.db, fiscalModulePage, fiscalModuleWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, module *models.FiscalModule) error {
+			return rows.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID, &module.Version)
+		}, fn)
+	if err != nil {
+		log.Printf("Repository: Error exporting fiscal modules: %v", err)
 	}
-	log.Println("Repository: Successfully fetched all fiscal modules")
-	return modules, nil
+	return err
 }
 
 func (r *FiscalRepository) GetByID(ctx context.Context, id int) (*models.FiscalModule, error) {
 	log.Printf("Repository: Fetching fiscal module by ID: %d", id)
-	query := "SELECT id, factory_number, fiscal_number, user_id FROM fiscal_modules WHERE id=$1"
+	query := "SELECT " + fiscalModuleColumns + " FROM fiscal_modules WHERE id=$1"
 	row := r.db.QueryRowContext(ctx, query, id)
 
 	var module models.FiscalModule
-	err := row.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID)
+	err := row.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID, &module.Version)
 	if err != nil {
 		log.Printf("Repository: Error scanning fiscal module by ID %d: %v", id, err)
 		return nil, err
@@ -60,38 +90,216 @@ func (r *FiscalRepository) GetByID(ctx context.Context, id int) (*models.FiscalM
 	return &module, nil
 }
 
-func (r *FiscalRepository) Create(ctx context.Context, module *models.FiscalModule) error {
+// lockFiscalModule читает фискальный модуль в транзакции и блокирует его строку до конца транзакции
+func lockFiscalModule(ctx context.Context, tx executor, id int) (*models.FiscalModule, error) {
+	var module models.FiscalModule
+	err := tx.QueryRowContext(ctx, "SELECT "+fiscalModuleColumns+" FROM fiscal_modules WHERE id=$1 FOR UPDATE", id).Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID, &module.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &module, nil
+}
+
+func (r *FiscalRepository) Create(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error {
 	log.Println("Repository: Creating new fiscal module")
-	query := "INSERT INTO fiscal_modules (factory_number, fiscal_number, user_id) VALUES ($1, $2, $3) RETURNING id"
-	err := r.db.QueryRowContext(ctx, query, module.FactoryNumber, module.FiscalNumber, module.UserID).Scan(&module.ID)
+	tx, err := r.db.begin(ctx)
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertFiscalModule(ctx, tx, module, meta); err != nil {
 		log.Printf("Repository: Error creating fiscal module: %v", err)
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	log.Println("Repository: Successfully created new fiscal module")
 	return nil
 }
 
-func (r *FiscalRepository) Update(ctx context.Context, module *models.FiscalModule) error {
+// insertFiscalModule добавляет модуль и запись о его создании в журнал аудита в рамках транзакции tx
+func insertFiscalModule(ctx context.Context, tx executor, module *models.FiscalModule, meta models.AuditMeta) error {
+	query := "INSERT INTO fiscal_modules (factory_number, fiscal_number, user_id) VALUES ($1, $2, $3) RETURNING id, version"
+	err := tx.QueryRowContext(ctx, query, module.FactoryNumber, module.FiscalNumber, module.UserID).Scan(&module.ID, &module.Version)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, meta, models.AuditFiscalModule, module.ID, models.AuditCreate, nil, module)
+}
+
+// Update перезаписывает модуль, если его версия всё ещё равна module.Version, и увеличивает версию
+func (r *FiscalRepository) Update(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error {
 	log.Printf("Repository: Updating fiscal module with ID: %d", module.ID)
-	query := "UPDATE fiscal_modules SET factory_number=$1, fiscal_number=$2, user_id=$3 WHERE id=$4"
-	_, err := r.db.ExecContext(ctx, query, module.FactoryNumber, module.FiscalNumber, module.UserID, module.ID)
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockFiscalModule(ctx, tx, module.ID)
+	if err != nil {
+		log.Printf("Repository: Error locking fiscal module with ID %d: %v", module.ID, err)
+		return err
+	}
+	if err := checkVersion(before.Version, module.Version); err != nil {
+		log.Printf("Repository: Fiscal module %d is at version %d, expected %d", module.ID, before.Version, module.Version)
+		return err
+	}
+
+	query := "UPDATE fiscal_modules SET factory_number=$1, fiscal_number=$2, user_id=$3, version=version+1, updated_at=now() WHERE id=$4 RETURNING version"
+	err = tx.QueryRowContext(ctx, query, module.FactoryNumber, module.FiscalNumber, module.UserID, module.ID).Scan(&module.Version)
 	if err != nil {
 		log.Printf("Repository: Error updating fiscal module with ID %d: %v", module.ID, err)
 		return err
 	}
+	if err := writeAudit(ctx, tx, meta, models.AuditFiscalModule, module.ID, models.AuditUpdate, before, module); err != nil {
+		log.Printf("Repository: Error auditing update of fiscal module %d: %v", module.ID, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	log.Printf("Repository: Successfully updated fiscal module with ID: %d", module.ID)
 	return nil
 }
 
-func (r *FiscalRepository) Delete(ctx context.Context, id int) error {
+// Delete удаляет модуль версии version
+func (r *FiscalRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
 	log.Printf("Repository: Deleting fiscal module with ID: %d", id)
-	query := "DELETE FROM fiscal_modules WHERE id=$1"
-	_, err := r.db.ExecContext(ctx, query, id)
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockFiscalModule(ctx, tx, id)
 	if err != nil {
+		log.Printf("Repository: Error locking fiscal module with ID %d: %v", id, err)
+		return err
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		log.Printf("Repository: Fiscal module %d is at version %d, expected %d", id, before.Version, version)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM fiscal_modules WHERE id=$1", id); err != nil {
 		log.Printf("Repository: Error deleting fiscal module with ID %d: %v", id, err)
 		return err
 	}
+	if err := writeAudit(ctx, tx, meta, models.AuditFiscalModule, id, models.AuditDelete, before, nil); err != nil {
+		log.Printf("Repository: Error auditing deletion of fiscal module %d: %v", id, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	log.Printf("Repository: Successfully deleted fiscal module with ID: %d", id)
 	return nil
 }
+
+// GetByNumber находит фискальный модуль по заводскому или фискальному номеру. Если номер
+// совпадает с фискальным номером одного модуля и заводским другого, берётся первый,
+// как при привязке касс в миграции 0008.
+func (r *FiscalRepository) GetByNumber(ctx context.Context, number string) (*models.FiscalModule, error) {
+	log.Printf("Repository: Fetching fiscal module by number: %s", number)
+	query := "SELECT " + fiscalModuleColumns + " FROM fiscal_modules WHERE factory_number=$1 OR fiscal_number=$1 ORDER BY (fiscal_number=$1) DESC, id LIMIT 1"
+	row := r.db.QueryRowContext(ctx, query, number)
+
+	var module models.FiscalModule
+	err := row.Scan(&module.ID, &module.FactoryNumber, &module.FiscalNumber, &module.UserID, &module.Version)
+	if err != nil {
+		log.Printf("Repository: Error scanning fiscal module by number %s: %v", number, err)
+		return nil, err
+	}
+
+	log.Printf("Repository: Successfully fetched fiscal module by number: %s", number)
+	return &module, nil
+}
+
+// Reassign передаёт все модули пользователя fromUserID пользователю toUserID и возвращает их число
+func (r *FiscalRepository) Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error) {
+	log.Printf("Repository: Reassigning fiscal modules of user %d to user %d", fromUserID, toUserID)
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := selectIDs(ctx, tx, "SELECT id FROM fiscal_modules WHERE user_id=$1 ORDER BY id FOR UPDATE", fromUserID)
+	if err != nil {
+		log.Printf("Repository: Error locking fiscal modules of user %d: %v", fromUserID, err)
+		return 0, err
+	}
+	for _, id := range ids {
+		before, err := lockFiscalModule(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		after := *before
+		err = tx.QueryRowContext(ctx, "UPDATE fiscal_modules SET user_id=$1, version=version+1, updated_at=now() WHERE id=$2 RETURNING user_id, version", toUserID, id).Scan(&after.UserID, &after.Version)
+		if err != nil {
+			log.Printf("Repository: Error reassigning fiscal module %d: %v", id, err)
+			return 0, err
+		}
+		if err := writeAudit(ctx, tx, meta, models.AuditFiscalModule, id, models.AuditUpdate, before, &after); err != nil {
+			log.Printf("Repository: Error auditing update of fiscal module %d: %v", id, err)
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("Repository: Successfully reassigned %d fiscal module(s)", len(ids))
+	return len(ids), nil
+}
+
+// GetCurrentTerminal возвращает кассу, к которой сейчас привязан модуль, или nil
+func (r *FiscalRepository) GetCurrentTerminal(ctx context.Context, moduleID int) (*models.FiscalModuleTerminal, error) {
+	log.Printf("Repository: Fetching current terminal of fiscal module ID: %d", moduleID)
+	query := `SELECT t.id, t.cash_register_number, c.legal_name, b.bound_at
+		FROM fiscal_module_bindings b
+		JOIN terminals t ON t.id = b.terminal_id
+		JOIN companies c ON c.inn = t.inn
+		WHERE b.fiscal_module_id=$1 AND b.unbound_at IS NULL`
+	row := r.db.QueryRowContext(ctx, query, moduleID)
+
+	var terminal models.FiscalModuleTerminal
+	err := row.Scan(&terminal.ID, &terminal.CashRegisterNumber, &terminal.CompanyName, &terminal.BoundAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Repository: Error fetching current terminal of fiscal module ID %d: %v", moduleID, err)
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+// GetBindings возвращает историю привязок модуля к кассам, начиная с последней
+func (r *FiscalRepository) GetBindings(ctx context.Context, moduleID int) ([]models.FiscalModuleBinding, error) {
+	log.Printf("Repository: Fetching binding history of fiscal module ID: %d", moduleID)
+	query := "SELECT id, terminal_id, fiscal_module_id, bound_at, unbound_at FROM fiscal_module_bindings WHERE fiscal_module_id=$1 ORDER BY bound_at DESC, id DESC"
+	rows, err := r.db.QueryContext(ctx, query, moduleID)
+	if err != nil {
+		log.Printf("Repository: Error querying binding history: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []models.FiscalModuleBinding{}
+	for rows.Next() {
+		var binding models.FiscalModuleBinding
+		if err := rows.Scan(&binding.ID, &binding.TerminalID, &binding.FiscalModuleID, &binding.BoundAt, &binding.UnboundAt); err != nil {
+			log.Printf("Repository: Error scanning binding row: %v", err)
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Repository: Error iterating binding rows: %v", err)
+		return nil, err
+	}
+	return bindings, nil
+}
@@ -0,0 +1,363 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+func TestFiscalRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewFiscalRepository(db)
+	terminals := repository.NewTerminalRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+
+	first := createModule(t, db, "F-1", "FN-1", owner.ID)
+	second := createModule(t, db, "F-2", "FN-2", other.ID)
+	// Заводской номер третьего модуля совпадает с фискальным номером второго
+	third := createModule(t, db, "FN-2", "FN-3", owner.ID)
+	if first.ID == 0 || first.Version != 1 {
+		t.Fatalf("created module %+v, want an ID and version 1", first)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			module models.FiscalModule
+			code   apperrors.Code
+			field  string
+		}{
+			{"duplicate factory number", models.FiscalModule{FactoryNumber: "F-1", FiscalNumber: "FN-9", UserID: owner.ID}, apperrors.CodeConflict, "factory_number"},
+			{"duplicate fiscal number", models.FiscalModule{FactoryNumber: "F-9", FiscalNumber: "FN-1", UserID: owner.ID}, apperrors.CodeConflict, "fiscal_number"},
+			{"unknown user", models.FiscalModule{FactoryNumber: "F-9", FiscalNumber: "FN-9", UserID: 999}, apperrors.CodeInvalidReference, "user_id"},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				expectError(t, repo.Create(ctx, &tc.module, meta), tc.code, tc.field)
+			})
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		// Фискальный номер модуля, заведённого позже, совпадает с заводским номером второго
+		late := createModule(t, db, "F-20", "F-2", owner.ID)
+		defer func() { mustNot(t, repo.Delete(ctx, late.ID, late.Version, meta)) }()
+
+		cases := []struct {
+			name string
+			get  func() (*models.FiscalModule, error)
+			want *models.FiscalModule
+		}{
+			{"by ID", func() (*models.FiscalModule, error) { return repo.GetByID(ctx, second.ID) }, second},
+			{"by factory number", func() (*models.FiscalModule, error) { return repo.GetByNumber(ctx, "F-1") }, first},
+			{"by fiscal number", func() (*models.FiscalModule, error) { return repo.GetByNumber(ctx, "FN-3") }, third},
+			// Совпадение с фискальным номером важнее совпадения с заводским
+			{"by ambiguous number", func() (*models.FiscalModule, error) { return repo.GetByNumber(ctx, "FN-2") }, second},
+			{"by number that is an earlier factory number", func() (*models.FiscalModule, error) { return repo.GetByNumber(ctx, "F-2") }, late},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				got, err := tc.get()
+				mustNot(t, err)
+				if *got != *tc.want {
+					t.Errorf("got %+v, want %+v", got, tc.want)
+				}
+			})
+		}
+
+		_, err := repo.GetByID(ctx, 999)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		_, err = repo.GetByNumber(ctx, "missing")
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		changed := *third
+		changed.FactoryNumber = "F-3"
+		changed.UserID = other.ID
+		mustNot(t, repo.Update(ctx, &changed, meta))
+		if changed.Version != 2 {
+			t.Errorf("version %d after update, want 2", changed.Version)
+		}
+		stored, err := repo.GetByID(ctx, third.ID)
+		mustNot(t, err)
+		if *stored != changed {
+			t.Errorf("stored %+v, want %+v", stored, changed)
+		}
+
+		stale := changed
+		stale.Version = 1
+		expectError(t, repo.Update(ctx, &stale, meta), apperrors.CodePreconditionFailed, "")
+		duplicate := changed
+		duplicate.FiscalNumber = "FN-1"
+		expectError(t, repo.Update(ctx, &duplicate, meta), apperrors.CodeConflict, "fiscal_number")
+		unknownUser := changed
+		unknownUser.UserID = 999
+		expectError(t, repo.Update(ctx, &unknownUser, meta), apperrors.CodeInvalidReference, "user_id")
+		missing := changed
+		missing.ID = 999
+		expectError(t, repo.Update(ctx, &missing, meta), apperrors.CodeNotFound, "")
+		*third = changed
+	})
+
+	t.Run("bindings", func(t *testing.T) {
+		current, err := repo.GetCurrentTerminal(ctx, first.ID)
+		mustNot(t, err)
+		if current != nil {
+			t.Fatalf("unbound module reports terminal %+v", current)
+		}
+
+		terminal := createTerminal(t, db, "CR-1", &first.ID, owner.ID)
+		current, err = repo.GetCurrentTerminal(ctx, first.ID)
+		mustNot(t, err)
+		if current == nil || current.ID != terminal.ID || current.CashRegisterNumber != "CR-1" || current.CompanyName != "Spare LLC" || current.BoundAt.IsZero() {
+			t.Fatalf("current terminal %+v", current)
+		}
+
+		// Перенос точки на другой модуль закрывает прежнюю привязку
+		terminal.FiscalModuleID = &second.ID
+		mustNot(t, terminals.Update(ctx, terminal, meta))
+		current, err = repo.GetCurrentTerminal(ctx, first.ID)
+		mustNot(t, err)
+		if current != nil {
+			t.Fatalf("module still reports terminal %+v after rebinding", current)
+		}
+
+		next := createTerminal(t, db, "CR-2", &first.ID, other.ID)
+		bindings, err := repo.GetBindings(ctx, first.ID)
+		mustNot(t, err)
+		if len(bindings) != 2 {
+			t.Fatalf("got %d bindings, want 2", len(bindings))
+		}
+		if bindings[0].TerminalID != next.ID || bindings[0].UnboundAt != nil {
+			t.Errorf("latest binding %+v, want an open binding of terminal %d", bindings[0], next.ID)
+		}
+		if bindings[1].TerminalID != terminal.ID || bindings[1].UnboundAt == nil || bindings[1].UnboundAt.Before(bindings[1].BoundAt) {
+			t.Errorf("earlier binding %+v, want a closed binding of terminal %d", bindings[1], terminal.ID)
+		}
+
+		bindings, err = repo.GetBindings(ctx, 999)
+		mustNot(t, err)
+		if bindings == nil || len(bindings) != 0 {
+			t.Errorf("bindings of a missing module: %#v", bindings)
+		}
+
+		// Модуль, к которому привязана касса, удалить нельзя
+		expectError(t, repo.Delete(ctx, first.ID, first.Version, meta), apperrors.CodeConflict, "")
+		changeStatus(t, db, next.ID, models.TerminalRegistered, models.TerminalDecommissioned)
+		expectError(t, repo.Delete(ctx, first.ID, first.Version+1, meta), apperrors.CodePreconditionFailed, "")
+		mustNot(t, repo.Delete(ctx, first.ID, first.Version, meta))
+		expectError(t, repo.Delete(ctx, first.ID, first.Version, meta), apperrors.CodeNotFound, "")
+
+		// История привязок удаляется вместе с модулем
+		bindings, err = repo.GetBindings(ctx, first.ID)
+		mustNot(t, err)
+		if len(bindings) != 0 {
+			t.Errorf("bindings left after deleting the module: %+v", bindings)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			filter models.FiscalModuleFilter
+			want   []int
+		}{
+			{"all", models.FiscalModuleFilter{}, []int{second.ID, third.ID}},
+			{"by user", models.FiscalModuleFilter{UserID: &other.ID}, []int{second.ID, third.ID}},
+			{"by factory number", models.FiscalModuleFilter{FactoryNumber: "f-3"}, []int{third.ID}},
+			{"by fiscal number", models.FiscalModuleFilter{FiscalNumber: "FN"}, []int{second.ID, third.ID}},
+			// CR-1 работает на втором модуле
+			{"by company", models.FiscalModuleFilter{CompanyINN: innSpare}, []int{second.ID}},
+			{"by fiscal number descending", models.FiscalModuleFilter{ListParams: models.ListParams{Sort: "fiscal_number", Desc: true}}, []int{third.ID, second.ID}},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				params := tc.filter.ListParams
+				params.Limit = 1
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.FiscalModule, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := repo.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(module models.FiscalModule) int { return module.ID })
+				expectIDs(t, ids, tc.want...)
+
+				var exported []int
+				mustNot(t, repo.Export(ctx, tc.filter, func(module *models.FiscalModule) error {
+					exported = append(exported, module.ID)
+					return nil
+				}))
+				expectIDs(t, exported, tc.want...)
+			})
+		}
+
+		// Курсор другой сортировки не принимается
+		list, err := repo.List(ctx, models.FiscalModuleFilter{ListParams: models.ListParams{Limit: 1}})
+		mustNot(t, err)
+		_, err = repo.List(ctx, models.FiscalModuleFilter{ListParams: models.ListParams{Cursor: list.NextCursor, Sort: "fiscal_number"}})
+		expectError(t, err, apperrors.CodeBadRequest, "")
+
+		stop := errors.New("stop")
+		if err := repo.Export(ctx, models.FiscalModuleFilter{}, func(*models.FiscalModule) error { return stop }); !errors.Is(err, stop) {
+			t.Errorf("export returned %v, want the callback error", err)
+		}
+	})
+}
+
+func TestImportRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewImportRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	bound := createModule(t, db, "F-1", "FN-1", owner.ID)
+	free := createModule(t, db, "F-2", "FN-2", owner.ID)
+	createTerminal(t, db, "CR-1", &bound.ID, owner.ID)
+
+	t.Run("job lifecycle", func(t *testing.T) {
+		job := &models.ImportJob{Kind: models.ImportTerminals, FileName: "terminals.csv", Format: "csv", TotalRows: 3, CreatedBy: &owner.ID}
+		mustNot(t, repo.Create(ctx, job))
+		if job.ID == 0 || job.Status != models.ImportPending || job.Errors == nil || job.StartedAt != nil || job.FinishedAt != nil || job.CreatedAt.IsZero() {
+			t.Fatalf("created job %+v", job)
+		}
+
+		mustNot(t, repo.SetStatus(ctx, job.ID, models.ImportValidating))
+		validating, err := repo.GetByID(ctx, job.ID)
+		mustNot(t, err)
+		if validating.Status != models.ImportValidating || validating.StartedAt == nil {
+			t.Fatalf("job after start %+v", validating)
+		}
+		mustNot(t, repo.SetStatus(ctx, job.ID, models.ImportImporting))
+		mustNot(t, repo.UpdateProgress(ctx, job.ID, 3, 2))
+		importing, err := repo.GetByID(ctx, job.ID)
+		mustNot(t, err)
+		if !importing.StartedAt.Equal(*validating.StartedAt) || importing.ValidatedRows != 3 || importing.ImportedRows != 2 {
+			t.Errorf("job while importing %+v", importing)
+		}
+
+		// Сохраняется не больше 1000 ошибок, но счётчик учитывает все
+		job.Status = models.ImportFailed
+		job.ValidatedRows = 3
+		for row := 2; row <= 1002; row++ {
+			job.Errors = append(job.Errors, models.ImportRowError{Row: row, Field: "inn", Message: "invalid"})
+		}
+		mustNot(t, repo.Finish(ctx, job))
+		finished, err := repo.GetByID(ctx, job.ID)
+		mustNot(t, err)
+		if finished.Status != models.ImportFailed || finished.ErrorCount != 1001 || len(finished.Errors) != 1000 || finished.FinishedAt == nil {
+			t.Errorf("finished job: status %s, %d errors of %d, finished at %v", finished.Status, len(finished.Errors), finished.ErrorCount, finished.FinishedAt)
+		}
+		if finished.Errors[0] != job.Errors[0] {
+			t.Errorf("first stored error %+v, want %+v", finished.Errors[0], job.Errors[0])
+		}
+
+		_, err = repo.GetByID(ctx, 999)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("finish without start", func(t *testing.T) {
+		job := &models.ImportJob{Kind: models.ImportFiscalModules, FileName: "modules.xlsx", Format: "xlsx", DryRun: true}
+		mustNot(t, repo.Create(ctx, job))
+		job.Status = models.ImportCompleted
+		mustNot(t, repo.Finish(ctx, job))
+		finished, err := repo.GetByID(ctx, job.ID)
+		mustNot(t, err)
+		if finished.StartedAt == nil || finished.Errors == nil || len(finished.Errors) != 0 || finished.CreatedBy != nil {
+			t.Errorf("finished job %+v", finished)
+		}
+	})
+
+	t.Run("lookups", func(t *testing.T) {
+		users, err := repo.ExistingUserIDs(ctx, []int{owner.ID, 999})
+		mustNot(t, err)
+		if len(users) != 1 || !users[owner.ID] {
+			t.Errorf("existing users %v", users)
+		}
+
+		taken, err := repo.TakenValues(ctx, models.ImportTerminals, "cash_register_number", []string{"CR-1", "CR-2"})
+		mustNot(t, err)
+		if len(taken) != 1 || !taken["CR-1"] {
+			t.Errorf("taken cash register numbers %v", taken)
+		}
+		taken, err = repo.TakenValues(ctx, models.ImportFiscalModules, "fiscal_number", []string{"FN-2", "FN-3"})
+		mustNot(t, err)
+		if len(taken) != 1 || !taken["FN-2"] {
+			t.Errorf("taken fiscal numbers %v", taken)
+		}
+		if _, err := repo.TakenValues(ctx, models.ImportTerminals, "address", []string{"x"}); err == nil {
+			t.Error("lookup by a non-unique column succeeded")
+		}
+
+		// Фискальный номер этого модуля совпадает с заводским номером свободного
+		colliding := createModule(t, db, "F-20", "F-2", owner.ID)
+		modules, err := repo.FiscalModulesByNumber(ctx, []string{"F-1", "FN-2", "F-2", "F-9"})
+		mustNot(t, err)
+		want := map[string]models.ImportModuleRef{
+			"F-1": {ID: bound.ID, Bound: true}, "FN-1": {ID: bound.ID, Bound: true},
+			"F-2": {ID: colliding.ID}, "FN-2": {ID: free.ID}, "F-20": {ID: colliding.ID},
+		}
+		if len(modules) != len(want) {
+			t.Fatalf("modules %v, want %v", modules, want)
+		}
+		for number, ref := range want {
+			if modules[number] != ref {
+				t.Errorf("module %s: %+v, want %+v", number, modules[number], ref)
+			}
+		}
+	})
+
+	t.Run("apply fiscal modules", func(t *testing.T) {
+		rows := []models.ImportFiscalModuleRow{
+			{Row: 2, Module: models.FiscalModule{FactoryNumber: "F-10", FiscalNumber: "FN-10", UserID: owner.ID}},
+			{Row: 3, Module: models.FiscalModule{FactoryNumber: "F-1", FiscalNumber: "FN-11", UserID: owner.ID}},
+		}
+		err := repo.ApplyFiscalModules(ctx, rows, meta, func(int) { t.Error("progress reported for two rows") })
+		var failure *repository.ImportRowFailure
+		if !errors.As(err, &failure) || failure.Row != 3 {
+			t.Fatalf("got %v, want a failure of row 3", err)
+		}
+		expectError(t, err, apperrors.CodeConflict, "factory_number")
+		if _, err := repository.NewFiscalRepository(db).GetByNumber(ctx, "F-10"); err == nil {
+			t.Error("row 2 was created although the import failed")
+		}
+
+		rows[1].Module.FactoryNumber = "F-11"
+		mustNot(t, repo.ApplyFiscalModules(ctx, rows, meta, func(int) {}))
+		created, err := repository.NewFiscalRepository(db).GetByNumber(ctx, "FN-11")
+		mustNot(t, err)
+		if created.FactoryNumber != "F-11" || created.Version != 1 {
+			t.Errorf("imported module %+v", created)
+		}
+	})
+
+	t.Run("apply terminals", func(t *testing.T) {
+		second := terminalRequest("CR-3", owner.ID)
+		rows := []models.ImportTerminalRow{
+			{Row: 2, Terminal: *terminalRequest("CR-2", owner.ID), FiscalModuleID: free.ID},
+			{Row: 3, Terminal: *second, FiscalModuleID: bound.ID},
+		}
+		var failure *repository.ImportRowFailure
+		if err := repo.ApplyTerminals(ctx, rows, meta, func(int) {}); !errors.As(err, &failure) || failure.Row != 3 {
+			t.Fatalf("got %v, want a failure of row 3", err)
+		}
+		list, err := repository.NewTerminalRepository(db).List(ctx, models.TerminalFilter{})
+		mustNot(t, err)
+		if list.Total != 1 {
+			t.Fatalf("%d terminals after a failed import, want 1", list.Total)
+		}
+
+		rows = rows[:1]
+		mustNot(t, repo.ApplyTerminals(ctx, rows, meta, func(int) {}))
+		list, err = repository.NewTerminalRepository(db).List(ctx, models.TerminalFilter{})
+		mustNot(t, err)
+		if list.Total != 2 || list.Items[1].FiscalModuleID == nil || *list.Items[1].FiscalModuleID != free.ID || list.Items[1].FreeRecordBalance != 10 {
+			t.Errorf("terminals after import %+v", list.Items)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/lib/pq"
+)
+
+type ImportRepository struct {
+	db conn
+}
+
+func NewImportRepository(db *sql.DB) *ImportRepository {
+	return &ImportRepository{db: pool{db}}
+}
+
+// maxStoredImportErrors ограничивает число ошибок, сохраняемых в задании; error_count считает все
+const maxStoredImportErrors = 1000
+
+// importProgressStep — через сколько записанных строк обновляется ход задания
+const importProgressStep = 100
+
+// importUniqueColumns — уникальные столбцы, повторы которых проверяются до записи.
+// Вид импорта совпадает с именем таблицы создаваемых объектов.
+var importUniqueColumns = map[models.ImportKind][]string{
+	models.ImportTerminals:     {"cash_register_number", "module_number", "assembly_number"},
+	models.ImportFiscalModules: {"factory_number", "fiscal_number"},
+}
+
+// ImportUniqueColumns возвращает уникальные столбцы таблицы объектов вида kind
+func ImportUniqueColumns(kind models.ImportKind) []string {
+	return importUniqueColumns[kind]
+}
+
+// ImportRowFailure — ошибка записи строки Row; транзакция импорта при этом откатывается целиком
+type ImportRowFailure struct {
+	Row int
+	Err error
+}
+
+func (e *ImportRowFailure) Error() string { return fmt.Sprintf("row %d: %v", e.Row, e.Err) }
+func (e *ImportRowFailure) Unwrap() error { return e.Err }
+
+const importJobColumns = "id, kind, file_name, format, dry_run, status, total_rows, validated_rows, imported_rows, error_count, errors, created_by, created_at, started_at, finished_at"
+
+func scanImportJob(row interface{ Scan(...interface{}) error }) (*models.ImportJob, error) {
+	var job models.ImportJob
+	var errs []byte
+	err := row.Scan(&job.ID, &job.Kind, &job.FileName, &job.Format, &job.DryRun, &job.Status, &job.TotalRows, &job.ValidatedRows, &job.ImportedRows, &job.ErrorCount, &errs, &job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(errs, &job.Errors); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Create сохраняет новое задание в состоянии pending
+func (r *ImportRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	query := "INSERT INTO import_jobs (kind, file_name, format, dry_run, total_rows, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING " + importJobColumns
+	created, err := scanImportJob(r.db.QueryRowContext(ctx, query, job.Kind, job.FileName, job.Format, job.DryRun, job.TotalRows, job.CreatedBy))
+	if err != nil {
+		return err
+	}
+	*job = *created
+	return nil
+}
+
+func (r *ImportRepository) GetByID(ctx context.Context, id int) (*models.ImportJob, error) {
+	return scanImportJob(r.db.QueryRowContext(ctx, "SELECT "+importJobColumns+" FROM import_jobs WHERE id=$1", id))
+}
+
+// SetStatus переводит задание в состояние status; при первом выходе из pending фиксирует started_at
+func (r *ImportRepository) SetStatus(ctx context.Context, id int, status models.ImportStatus) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE import_jobs SET status=$1, started_at=COALESCE(started_at, now()) WHERE id=$2", status, id)
+	return err
+}
+
+// UpdateProgress записывает число проверенных и записанных строк
+func (r *ImportRepository) UpdateProgress(ctx context.Context, id, validated, imported int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE import_jobs SET validated_rows=$1, imported_rows=$2 WHERE id=$3", validated, imported, id)
+	return err
+}
+
+// Finish завершает задание с итоговым состоянием и ошибками по строкам
+func (r *ImportRepository) Finish(ctx context.Context, job *models.ImportJob) error {
+	stored := job.Errors
+	if len(stored) > maxStoredImportErrors {
+		stored = stored[:maxStoredImportErrors]
+	}
+	if stored == nil {
+		stored = []models.ImportRowError{}
+	}
+	errs, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE import_jobs SET status=$1, validated_rows=$2, imported_rows=$3, error_count=$4, errors=$5,
+		started_at=COALESCE(started_at, now()), finished_at=now()
+		WHERE id=$6 RETURNING finished_at`
+	return r.db.QueryRowContext(ctx, query, job.Status, job.ValidatedRows, job.ImportedRows, len(job.Errors), errs, job.ID).Scan(&job.FinishedAt)
+}
+
+// ExistingUserIDs возвращает те из ids, для которых есть пользователь
+func (r *ImportRepository) ExistingUserIDs(ctx context.Context, ids []int) (map[int]bool, error) {
+	values := make([]int64, len(ids))
+	for i, id := range ids {
+		values[i] = int64(id)
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT id FROM users WHERE id = ANY($1)", pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	return existing, rows.Err()
+}
+
+// TakenValues возвращает те из values, которые уже заняты в уникальном столбце column
+// таблицы объектов вида kind
+func (r *ImportRepository) TakenValues(ctx context.Context, kind models.ImportKind, column string, values []string) (map[string]bool, error) {
+	known := false
+	for _, c := range importUniqueColumns[kind] {
+		known = known || c == column
+	}
+	if !known {
+		return nil, fmt.Errorf("column %q is not a unique column of %s", column, kind)
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SELECT %[1]s FROM %[2]s WHERE %[1]s = ANY($1)", column, kind), pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		taken[value] = true
+	}
+	return taken, rows.Err()
+}
+
+// FiscalModulesByNumber находит модули по заводским или фискальным номерам так же, как
+// FiscalRepository.GetByNumber, и отмечает модули, уже привязанные к кассе
+func (r *ImportRepository) FiscalModulesByNumber(ctx context.Context, numbers []string) (map[string]models.ImportModuleRef, error) {
+	query := `SELECT m.id, m.factory_number, m.fiscal_number,
+			EXISTS (SELECT 1 FROM fiscal_module_bindings b WHERE b.fiscal_module_id = m.id AND b.unbound_at IS NULL)
+		FROM fiscal_modules m
+		WHERE m.factory_number = ANY($1) OR m.fiscal_number = ANY($1)
+`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(numbers))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modules := make(map[string]models.ImportModuleRef)
+	for rows.Next() {
+		var ref models.ImportModuleRef
+		var factoryNumber, fiscalNumber string
+		if err := rows.Scan(&ref.ID, &factoryNumber, &fiscalNumber, &ref.Bound); err != nil {
+			return nil, err
+		}
+		// Совпадение с фискальным номером важнее совпадения с заводским, как в GetByNumber
+		modules[fiscalNumber] = ref
+		if _, ok := modules[factoryNumber]; !ok {
+			modules[factoryNumber] = ref
+		}
+	}
+	return modules, rows.Err()
+}
+
+// ApplyTerminals создаёт все торговые точки в одной транзакции: при ошибке любой строки
+// не создаётся ни одна. progress вызывается по ходу записи с числом записанных строк.
+func (r *ImportRepository) ApplyTerminals(ctx context.Context, rows []models.ImportTerminalRow, meta models.AuditMeta, progress func(done int)) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range rows {
+		moduleID := rows[i].FiscalModuleID
+		if _, err := insertTerminal(ctx, tx, &rows[i].Terminal, &moduleID, meta); err != nil {
+			return &ImportRowFailure{Row: rows[i].Row, Err: err}
+		}
+		if (i+1)%importProgressStep == 0 {
+			progress(i + 1)
+		}
+	}
+	return tx.Commit()
+}
+
+// ApplyFiscalModules создаёт все фискальные модули в одной транзакции по правилам ApplyTerminals
+func (r *ImportRepository) ApplyFiscalModules(ctx context.Context, rows []models.ImportFiscalModuleRow, meta models.AuditMeta, progress func(done int)) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range rows {
+		if err := insertFiscalModule(ctx, tx, &rows[i].Module, meta); err != nil {
+			return &ImportRowFailure{Row: rows[i].Row, Err: err}
+		}
+		if (i+1)%importProgressStep == 0 {
+			progress(i + 1)
+		}
+	}
+	return tx.Commit()
+}
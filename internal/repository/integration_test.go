@@ -0,0 +1,188 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/migrate"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/migrations"
+	"github.com/lib/pq"
+)
+
+// databaseURLEnv — переменная окружения со строкой подключения к тестовой базе PostgreSQL
+// (URL postgres://... или key=value). Без неё тесты репозиториев пропускаются.
+const databaseURLEnv = "TEST_DATABASE_URL"
+
+// ИНН с верной контрольной цифрой
+const (
+	innAdmin  = "302563852"
+	innOwner  = "301000028"
+	innOther  = "202000038"
+	innSpare  = "307000049"
+	innDealer = "201000011"
+)
+
+var ctx = context.Background()
+
+var meta = models.AuditMeta{RequestID: "test-request", IP: "127.0.0.1"}
+
+var schemaSeq atomic.Int64
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	logger.InfoLogger.SetOutput(io.Discard)
+	logger.ErrorLogger.SetOutput(io.Discard)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestDB создаёт для теста отдельную схему, применяет к ней миграции из migrations/
+// и возвращает пул, соединения которого работают в этой схеме. Схема удаляется после теста.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(databaseURLEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", databaseURLEnv)
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		converted, err := pq.ParseURL(dsn)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", databaseURLEnv, err)
+		}
+		dsn = converted
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), schemaSeq.Add(1))
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+pq.QuoteIdentifier(schema)); err != nil {
+		t.Fatalf("creating schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.ExecContext(ctx, "DROP SCHEMA "+pq.QuoteIdentifier(schema)+" CASCADE"); err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	// Часовой пояс сессии задаётся так же, как в repository.NewPostgresDB
+	db, err := sql.Open("postgres", fmt.Sprintf("%s search_path=%s timezone=%s", dsn, schema, repository.SessionTimeZone))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := migrate.NewRunner(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if err := runner.Up(ctx); err != nil {
+		t.Fatalf("applying migrations to %s: %v", schema, err)
+	}
+	return db
+}
+
+// expectError проверяет, что err приводится к доменной ошибке с кодом code и полем field
+func expectError(t *testing.T, err error, code apperrors.Code, field string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("got no error, want %s", code)
+	}
+	if appErr := apperrors.Classify(err); appErr.Code != code || appErr.Field != field {
+		t.Fatalf("error %v classified as %q field %q, want %q field %q", err, appErr.Code, appErr.Field, code, field)
+	}
+}
+
+func mustNot(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func intPtr(v int) *int { return &v }
+
+// createUser заводит пользователя-владельца с ИНН inn
+func createUser(t *testing.T, db *sql.DB, username, inn string) *models.User {
+	t.Helper()
+	user := &models.User{INN: inn, Username: username, Password: "hash", IsActive: true, Role: models.RoleOwner}
+	mustNot(t, repository.NewUserRepository(db).Create(ctx, user, meta))
+	return user
+}
+
+// createModule заводит фискальный модуль пользователя userID
+func createModule(t *testing.T, db *sql.DB, factoryNumber, fiscalNumber string, userID int) *models.FiscalModule {
+	t.Helper()
+	module := &models.FiscalModule{FactoryNumber: factoryNumber, FiscalNumber: fiscalNumber, UserID: userID}
+	mustNot(t, repository.NewFiscalRepository(db).Create(ctx, module, meta))
+	return module
+}
+
+// terminalRequest описывает торговую точку компании Spare LLC с балансом 10
+func terminalRequest(cashRegister string, userID int) *models.TerminalCreateRequest {
+	return &models.TerminalCreateRequest{
+		INN:                innSpare,
+		CompanyName:        "Spare LLC",
+		Address:            "Tashkent",
+		CashRegisterNumber: cashRegister,
+		ModuleNumber:       "M-" + cashRegister,
+		AssemblyNumber:     "A-" + cashRegister,
+		UserID:             userID,
+		FreeRecordBalance:  10,
+	}
+}
+
+// createTerminal заводит торговую точку с фискальным модулем moduleID
+func createTerminal(t *testing.T, db *sql.DB, cashRegister string, moduleID *int, userID int) *models.Terminal {
+	t.Helper()
+	terminal, err := repository.NewTerminalRepository(db).Create(ctx, terminalRequest(cashRegister, userID), moduleID, meta)
+	mustNot(t, err)
+	return terminal
+}
+
+// changeStatus переводит торговую точку из статуса from в to
+func changeStatus(t *testing.T, db *sql.DB, terminalID int, from, to models.TerminalStatus) *models.TerminalStatusChange {
+	t.Helper()
+	change := &models.TerminalStatusChange{TerminalID: terminalID, FromStatus: from, ToStatus: to, Reason: string(to)}
+	mustNot(t, repository.NewTerminalRepository(db).ChangeStatus(ctx, change, meta))
+	return change
+}
+
+// pageIDs проходит все страницы размера limit и возвращает идентификаторы в порядке выдачи
+func pageIDs[T any](t *testing.T, params models.ListParams, fetch func(params models.ListParams) ([]T, string, error), id func(item T) int) []int {
+	t.Helper()
+	var ids []int
+	for {
+		items, next, err := fetch(params)
+		mustNot(t, err)
+		for _, item := range items {
+			ids = append(ids, id(item))
+		}
+		if next == "" {
+			return ids
+		}
+		params.Cursor = next
+	}
+}
+
+func expectIDs(t *testing.T, got []int, want ...int) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got IDs %v, want %v", got, want)
+	}
+}
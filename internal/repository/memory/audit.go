@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+type AuditRepository struct {
+	store *Store
+}
+
+func NewAuditRepository(store *Store) *AuditRepository {
+	return &AuditRepository{store: store}
+}
+
+var auditSorts = sortKeys[models.AuditRecord]{
+	"id":         func(r *models.AuditRecord) interface{} { return r.ID },
+	"created_at": func(r *models.AuditRecord) interface{} { return r.CreatedAt },
+}
+
+func auditRecordID(r *models.AuditRecord) int { return r.ID }
+
+// writeAudit записывает изменение объекта в журнал аудита по правилам repository.AuditDiff
+func (s *Store) writeAudit(meta models.AuditMeta, entity models.AuditEntity, entityID int, action models.AuditAction, before, after interface{}) error {
+	changes, err := repository.AuditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	s.audit = append(s.audit, &models.AuditRecord{
+		ID:         s.nextID("audit_log"),
+		EntityType: entity,
+		EntityID:   entityID,
+		Action:     action,
+		ActorID:    meta.ActorID,
+		Changes:    changes,
+		RequestID:  meta.RequestID,
+		IP:         meta.IP,
+		CreatedAt:  now(),
+	})
+	return nil
+}
+
+// List возвращает страницу журнала аудита
+func (r *AuditRepository) List(ctx context.Context, filter models.AuditFilter) (*models.AuditRecordList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []models.AuditRecord{}
+	for _, record := range s.audit {
+		switch {
+		case filter.EntityType != "" && record.EntityType != filter.EntityType,
+			filter.EntityID != nil && record.EntityID != *filter.EntityID,
+			filter.ActorID != nil && (record.ActorID == nil || *record.ActorID != *filter.ActorID),
+			filter.From != nil && record.CreatedAt.Before(*filter.From),
+			filter.To != nil && !record.CreatedAt.Before(*filter.To):
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	items, total, next, err := page(records, auditSorts, filter.ListParams, auditRecordID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditRecordList{Items: items, Total: total, NextCursor: next}, nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+// ApplyBalanceMovement атомарно изменяет баланс торговой точки на movement.Amount
+// и записывает движение в журнал
+func (r *TerminalRepository) ApplyBalanceMovement(ctx context.Context, movement *models.BalanceMovement) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.applyMovement(movement)
+}
+
+func (s *Store) applyMovement(movement *models.BalanceMovement) error {
+	terminal, ok := s.terminals[movement.TerminalID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if movement.Kind == models.BalanceMovementConsumption && !terminal.Status.CanConsume() {
+		return repository.ErrConsumptionNotAllowed
+	}
+
+	balance := terminal.FreeRecordBalance + movement.Amount
+	if balance < 0 {
+		return repository.ErrInsufficientBalance
+	}
+	terminal.FreeRecordBalance = balance
+	terminal.Version++
+
+	movement.BalanceAfter = balance
+	s.addMovement(movement)
+	return nil
+}
+
+// GetBalanceHistory возвращает журнал движений баланса торговой точки в порядке записи
+func (r *TerminalRepository) GetBalanceHistory(ctx context.Context, terminalID int) ([]models.BalanceMovement, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movements := []models.BalanceMovement{}
+	for _, movement := range s.movements {
+		if movement.TerminalID == terminalID {
+			movements = append(movements, *movement)
+		}
+	}
+	return movements, nil
+}
+
+func (s *Store) addMovement(movement *models.BalanceMovement) {
+	movement.ID = s.nextID("terminal_balance_movements")
+	movement.CreatedAt = now()
+	stored := *movement
+	s.movements = append(s.movements, &stored)
+}
@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type CompanyRepository struct {
+	store *Store
+}
+
+func NewCompanyRepository(store *Store) *CompanyRepository {
+	return &CompanyRepository{store: store}
+}
+
+var companySorts = sortKeys[models.Company]{
+	"id":         func(c *models.Company) interface{} { return c.ID },
+	"inn":        func(c *models.Company) interface{} { return c.INN },
+	"legal_name": func(c *models.Company) interface{} { return c.LegalName },
+}
+
+func companyID(c *models.Company) int { return c.ID }
+
+// List возвращает страницу компаний, удовлетворяющих фильтру
+func (r *CompanyRepository) List(ctx context.Context, filter models.CompanyFilter) (*models.CompanyList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companies := []models.Company{}
+	for _, company := range s.companies {
+		switch {
+		case filter.INN != "" && company.INN != filter.INN,
+			filter.LegalName != "" && !containsFold(company.LegalName, filter.LegalName),
+			filter.VATPayer != nil && company.VATPayer != *filter.VATPayer,
+			filter.UserID != nil && !s.isRelated(company.INN, *filter.UserID):
+			continue
+		}
+		companies = append(companies, *company)
+	}
+
+	items, total, next, err := page(companies, companySorts, filter.ListParams, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CompanyList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+func (r *CompanyRepository) GetByID(ctx context.Context, id int) (*models.Company, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, ok := s.companies[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *company
+	return &copied, nil
+}
+
+// IsRelated сообщает, относится ли пользователь userID к компании с ИНН inn:
+// сам зарегистрирован с этим ИНН или владеет её торговой точкой
+func (r *CompanyRepository) IsRelated(ctx context.Context, inn string, userID int) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isRelated(inn, userID), nil
+}
+
+func (s *Store) isRelated(inn string, userID int) bool {
+	if user, ok := s.users[userID]; ok && user.INN == inn {
+		return true
+	}
+	for _, terminal := range s.terminals {
+		if terminal.UserID == userID && terminal.INN == inn {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSoleOwner сообщает, относится ли пользователь userID к компании с ИНН inn и
+// принадлежат ли ему все её торговые точки и пользователи
+func (r *CompanyRepository) IsSoleOwner(ctx context.Context, inn string, userID int) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isRelated(inn, userID) {
+		return false, nil
+	}
+	for _, user := range s.users {
+		if user.INN == inn && user.ID != userID {
+			return false, nil
+		}
+	}
+	for _, terminal := range s.terminals {
+		if terminal.INN == inn && terminal.UserID != userID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Create добавляет компанию и записывает создание в журнал аудита
+func (r *CompanyRepository) Create(ctx context.Context, company *models.Company, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCompany(company); err != nil {
+		return err
+	}
+	company.ID = s.nextID("companies")
+	company.Version = 1
+	stored := *company
+	s.companies[company.ID] = &stored
+	return s.writeAudit(meta, models.AuditCompany, company.ID, models.AuditCreate, nil, company)
+}
+
+// Update перезаписывает компанию, если её версия всё ещё равна company.Version,
+// и увеличивает версию. Смена ИНН каскадно переносится на торговые точки и пользователей.
+func (r *CompanyRepository) Update(ctx context.Context, company *models.Company, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.companies[company.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, company.Version); err != nil {
+		return err
+	}
+	if err := s.checkCompany(company); err != nil {
+		return err
+	}
+
+	if company.INN != before.INN {
+		for _, terminal := range s.terminals {
+			if terminal.INN == before.INN {
+				terminal.INN = company.INN
+			}
+		}
+		for _, user := range s.users {
+			if user.INN == before.INN {
+				user.INN = company.INN
+			}
+		}
+	}
+	company.Version = before.Version + 1
+	stored := *company
+	s.companies[company.ID] = &stored
+	return s.writeAudit(meta, models.AuditCompany, company.ID, models.AuditUpdate, before, company)
+}
+
+// Delete удаляет компанию версии version. Компанию, на которую ссылаются торговые точки
+// или пользователи, удалить нельзя.
+func (r *CompanyRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.companies[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+	for _, terminal := range s.terminals {
+		if terminal.INN == before.INN {
+			return stillReferenced("terminals", "terminals_inn_fkey", id)
+		}
+	}
+	for _, user := range s.users {
+		if user.INN == before.INN {
+			return stillReferenced("users", "users_inn_fkey", id)
+		}
+	}
+
+	delete(s.companies, id)
+	return s.writeAudit(meta, models.AuditCompany, id, models.AuditDelete, before, nil)
+}
+
+// checkCompany проверяет уникальность ИНН компании
+func (s *Store) checkCompany(company *models.Company) error {
+	for _, other := range s.companies {
+		if other.ID != company.ID && other.INN == company.INN {
+			return uniqueViolation("companies", "companies_inn_key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type FiscalRepository struct {
+	store *Store
+}
+
+func NewFiscalRepository(store *Store) *FiscalRepository {
+	return &FiscalRepository{store: store}
+}
+
+var fiscalModuleSorts = sortKeys[models.FiscalModule]{
+	"id":             func(m *models.FiscalModule) interface{} { return m.ID },
+	"factory_number": func(m *models.FiscalModule) interface{} { return m.FactoryNumber },
+	"fiscal_number":  func(m *models.FiscalModule) interface{} { return m.FiscalNumber },
+}
+
+func fiscalModuleID(m *models.FiscalModule) int { return m.ID }
+
+// filterModules возвращает копии фискальных модулей, удовлетворяющих фильтру
+func (s *Store) filterModules(filter models.FiscalModuleFilter) []models.FiscalModule {
+	modules := []models.FiscalModule{}
+	for _, module := range s.modules {
+		switch {
+		case filter.UserID != nil && module.UserID != *filter.UserID,
+			filter.CompanyINN != "" && !s.moduleInCompany(module.ID, filter.CompanyINN),
+			filter.FactoryNumber != "" && !containsFold(module.FactoryNumber, filter.FactoryNumber),
+			filter.FiscalNumber != "" && !containsFold(module.FiscalNumber, filter.FiscalNumber):
+			continue
+		}
+		modules = append(modules, *module)
+	}
+	return modules
+}
+
+// moduleInCompany сообщает, привязан ли модуль к торговой точке с ИНН inn
+func (s *Store) moduleInCompany(moduleID int, inn string) bool {
+	for _, terminal := range s.terminals {
+		if terminal.INN == inn && terminal.FiscalModuleID != nil && *terminal.FiscalModuleID == moduleID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *FiscalRepository) List(ctx context.Context, filter models.FiscalModuleFilter) (*models.FiscalModuleList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, total, next, err := page(s.filterModules(filter), fiscalModuleSorts, filter.ListParams, fiscalModuleID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.FiscalModuleList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// Export передаёт fn все фискальные модули под фильтром в порядке его сортировки
+func (r *FiscalRepository) Export(ctx context.Context, filter models.FiscalModuleFilter, fn func(module *models.FiscalModule) error) error {
+	s := r.store
+	s.mu.Lock()
+	modules := s.filterModules(filter)
+	s.mu.Unlock()
+
+	if _, err := sortItems(modules, fiscalModuleSorts, filter.ListParams, fiscalModuleID); err != nil {
+		return err
+	}
+	for i := range modules {
+		if err := fn(&modules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *FiscalRepository) GetByID(ctx context.Context, id int) (*models.FiscalModule, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	module, ok := s.modules[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *module
+	return &copied, nil
+}
+
+// GetByNumber находит фискальный модуль по заводскому или фискальному номеру,
+// предпочитая совпадение с фискальным номером
+func (r *FiscalRepository) GetByNumber(ctx context.Context, number string) (*models.FiscalModule, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.moduleByNumber(number)
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	copied := *found
+	return &copied, nil
+}
+
+// moduleByNumber находит модуль так же, как FiscalRepository.GetByNumber в базе:
+// сначала по фискальному номеру, затем по заводскому
+func (s *Store) moduleByNumber(number string) *models.FiscalModule {
+	var byFactory *models.FiscalModule
+	for _, module := range s.modules {
+		if module.FiscalNumber == number {
+			return module
+		}
+		if module.FactoryNumber == number && (byFactory == nil || module.ID < byFactory.ID) {
+			byFactory = module
+		}
+	}
+	return byFactory
+}
+
+func (r *FiscalRepository) Create(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertModule(module, meta)
+}
+
+// insertModule выполняет Create под уже взятой блокировкой хранилища
+func (s *Store) insertModule(module *models.FiscalModule, meta models.AuditMeta) error {
+	if err := s.checkModule(module); err != nil {
+		return err
+	}
+	module.ID = s.nextID("fiscal_modules")
+	module.Version = 1
+	s.storeModule(module)
+	return s.writeAudit(meta, models.AuditFiscalModule, module.ID, models.AuditCreate, nil, module)
+}
+
+// Update перезаписывает модуль, если его версия всё ещё равна module.Version, и увеличивает версию
+func (r *FiscalRepository) Update(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.modules[module.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, module.Version); err != nil {
+		return err
+	}
+	if err := s.checkModule(module); err != nil {
+		return err
+	}
+	module.Version = before.Version + 1
+	s.storeModule(module)
+	return s.writeAudit(meta, models.AuditFiscalModule, module.ID, models.AuditUpdate, before, module)
+}
+
+// Reassign передаёт все модули пользователя fromUserID пользователю toUserID и возвращает их число
+func (r *FiscalRepository) Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, module := range s.modules {
+		if module.UserID != fromUserID {
+			continue
+		}
+		if _, ok := s.users[toUserID]; !ok {
+			return 0, missingReference("fiscal_modules", "fiscal_modules_user_id_fkey")
+		}
+		before := *module
+		module.UserID = toUserID
+		module.Version++
+		if err := s.writeAudit(meta, models.AuditFiscalModule, module.ID, models.AuditUpdate, &before, module); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Delete удаляет модуль версии version. Модуль, привязанный к торговой точке
+// или открывавший смены, удалить нельзя; история привязок удаляется вместе с ним.
+func (r *FiscalRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.modules[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+	for _, terminal := range s.terminals {
+		if terminal.FiscalModuleID != nil && *terminal.FiscalModuleID == id {
+			return stillReferenced("terminals", "terminals_fiscal_module_id_fkey", id)
+		}
+	}
+	for _, shift := range s.shifts {
+		if shift.FiscalModuleID == id {
+			return stillReferenced("shifts", "shifts_fiscal_module_id_fkey", id)
+		}
+	}
+
+	delete(s.modules, id)
+	delete(s.lastReceiptNumber, id)
+	delete(s.lastZReport, id)
+	bindings := s.bindings[:0]
+	for _, binding := range s.bindings {
+		if binding.FiscalModuleID != id {
+			bindings = append(bindings, binding)
+		}
+	}
+	s.bindings = bindings
+	return s.writeAudit(meta, models.AuditFiscalModule, id, models.AuditDelete, before, nil)
+}
+
+// GetCurrentTerminal возвращает кассу, к которой сейчас привязан модуль, или nil
+func (r *FiscalRepository) GetCurrentTerminal(ctx context.Context, moduleID int) (*models.FiscalModuleTerminal, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, binding := range s.bindings {
+		if binding.FiscalModuleID != moduleID || binding.UnboundAt != nil {
+			continue
+		}
+		terminal := s.terminals[binding.TerminalID]
+		return &models.FiscalModuleTerminal{
+			ID:                 terminal.ID,
+			CashRegisterNumber: terminal.CashRegisterNumber,
+			CompanyName:        s.companyName(terminal.INN),
+			BoundAt:            binding.BoundAt,
+		}, nil
+	}
+	return nil, nil
+}
+
+// GetBindings возвращает историю привязок модуля к кассам, начиная с последней
+func (r *FiscalRepository) GetBindings(ctx context.Context, moduleID int) ([]models.FiscalModuleBinding, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bindings := []models.FiscalModuleBinding{}
+	for _, binding := range s.bindings {
+		if binding.FiscalModuleID == moduleID {
+			bindings = append(bindings, *binding)
+		}
+	}
+	sort.SliceStable(bindings, func(i, j int) bool {
+		if !bindings[i].BoundAt.Equal(bindings[j].BoundAt) {
+			return bindings[i].BoundAt.After(bindings[j].BoundAt)
+		}
+		return bindings[i].ID > bindings[j].ID
+	})
+	return bindings, nil
+}
+
+// checkModule проверяет уникальные номера модуля и ссылку на владельца
+func (s *Store) checkModule(module *models.FiscalModule) error {
+	for _, other := range s.modules {
+		if other.ID == module.ID {
+			continue
+		}
+		if other.FactoryNumber == module.FactoryNumber {
+			return uniqueViolation("fiscal_modules", "fiscal_modules_factory_number_key")
+		}
+		if other.FiscalNumber == module.FiscalNumber {
+			return uniqueViolation("fiscal_modules", "fiscal_modules_fiscal_number_key")
+		}
+	}
+	if _, ok := s.users[module.UserID]; !ok {
+		return missingReference("fiscal_modules", "fiscal_modules_user_id_fkey")
+	}
+	return nil
+}
+
+func (s *Store) storeModule(module *models.FiscalModule) {
+	stored := *module
+	stored.Terminal = nil
+	s.modules[module.ID] = &stored
+}
@@ -0,0 +1,240 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+type ImportRepository struct {
+	store *Store
+}
+
+func NewImportRepository(store *Store) *ImportRepository {
+	return &ImportRepository{store: store}
+}
+
+// maxStoredImportErrors ограничивает число ошибок, сохраняемых в задании, как в базе
+const maxStoredImportErrors = 1000
+
+// importProgressStep — через сколько записанных строк сообщается ход задания
+const importProgressStep = 100
+
+// Значения уникальных столбцов импортируемых объектов по имени столбца
+var (
+	importTerminalColumns = map[string]func(t *models.Terminal) string{
+		"cash_register_number": func(t *models.Terminal) string { return t.CashRegisterNumber },
+		"module_number":        func(t *models.Terminal) string { return t.ModuleNumber },
+		"assembly_number":      func(t *models.Terminal) string { return t.AssemblyNumber },
+	}
+	importModuleColumns = map[string]func(m *models.FiscalModule) string{
+		"factory_number": func(m *models.FiscalModule) string { return m.FactoryNumber },
+		"fiscal_number":  func(m *models.FiscalModule) string { return m.FiscalNumber },
+	}
+)
+
+// Create сохраняет новое задание в состоянии pending
+func (r *ImportRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.ID = s.nextID("import_jobs")
+	job.Status = models.ImportPending
+	job.Errors = []models.ImportRowError{}
+	job.CreatedAt = now()
+	stored := *job
+	s.imports[job.ID] = &stored
+	return nil
+}
+
+func (r *ImportRepository) GetByID(ctx context.Context, id int) (*models.ImportJob, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.imports[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *job
+	copied.Errors = append([]models.ImportRowError{}, job.Errors...)
+	return &copied, nil
+}
+
+// SetStatus переводит задание в состояние status; при первом выходе из pending фиксирует started_at
+func (r *ImportRepository) SetStatus(ctx context.Context, id int, status models.ImportStatus) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.imports[id]; ok {
+		job.Status = status
+		if job.StartedAt == nil {
+			job.StartedAt = timePtr(now())
+		}
+	}
+	return nil
+}
+
+// UpdateProgress записывает число проверенных и записанных строк
+func (r *ImportRepository) UpdateProgress(ctx context.Context, id, validated, imported int) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.imports[id]; ok {
+		job.ValidatedRows = validated
+		job.ImportedRows = imported
+	}
+	return nil
+}
+
+// Finish завершает задание с итоговым состоянием и ошибками по строкам
+func (r *ImportRepository) Finish(ctx context.Context, job *models.ImportJob) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.imports[job.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	errs := job.Errors
+	if len(errs) > maxStoredImportErrors {
+		errs = errs[:maxStoredImportErrors]
+	}
+	stored.Status = job.Status
+	stored.ValidatedRows = job.ValidatedRows
+	stored.ImportedRows = job.ImportedRows
+	stored.ErrorCount = len(job.Errors)
+	stored.Errors = append([]models.ImportRowError{}, errs...)
+	if stored.StartedAt == nil {
+		stored.StartedAt = timePtr(now())
+	}
+	stored.FinishedAt = timePtr(now())
+	job.FinishedAt = stored.FinishedAt
+	return nil
+}
+
+// ExistingUserIDs возвращает те из ids, для которых есть пользователь
+func (r *ImportRepository) ExistingUserIDs(ctx context.Context, ids []int) (map[int]bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[int]bool)
+	for _, id := range ids {
+		if _, ok := s.users[id]; ok {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+// TakenValues возвращает те из values, которые уже заняты в уникальном столбце column
+// таблицы объектов вида kind
+func (r *ImportRepository) TakenValues(ctx context.Context, kind models.ImportKind, column string, values []string) (map[string]bool, error) {
+	known := false
+	for _, c := range repository.ImportUniqueColumns(kind) {
+		known = known || c == column
+	}
+	if !known {
+		return nil, fmt.Errorf("column %q is not a unique column of %s", column, kind)
+	}
+
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make(map[string]bool)
+	if kind == models.ImportTerminals {
+		for _, terminal := range s.terminals {
+			stored[importTerminalColumns[column](terminal)] = true
+		}
+	} else {
+		for _, module := range s.modules {
+			stored[importModuleColumns[column](module)] = true
+		}
+	}
+
+	taken := make(map[string]bool)
+	for _, value := range values {
+		if stored[value] {
+			taken[value] = true
+		}
+	}
+	return taken, nil
+}
+
+// FiscalModulesByNumber находит модули по заводским или фискальным номерам так же, как
+// FiscalRepository.GetByNumber, и отмечает модули, уже привязанные к кассе
+func (r *ImportRepository) FiscalModulesByNumber(ctx context.Context, numbers []string) (map[string]models.ImportModuleRef, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modules := make(map[string]models.ImportModuleRef)
+	for _, number := range numbers {
+		if found := s.moduleByNumber(number); found != nil {
+			modules[number] = models.ImportModuleRef{ID: found.ID, Bound: s.isBound(found.ID)}
+		}
+	}
+	return modules, nil
+}
+
+// isBound сообщает, есть ли у модуля действующая привязка к кассе
+func (s *Store) isBound(moduleID int) bool {
+	for _, binding := range s.bindings {
+		if binding.FiscalModuleID == moduleID && binding.UnboundAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyTerminals создаёт все торговые точки разом: при ошибке любой строки хранилище
+// возвращается к состоянию до импорта. Запись идёт под блокировкой хранилища, поэтому
+// progress вызывается после её завершения.
+func (r *ImportRepository) ApplyTerminals(ctx context.Context, rows []models.ImportTerminalRow, meta models.AuditMeta, progress func(done int)) error {
+	return r.store.apply(len(rows), progress, func(i int) error {
+		moduleID := rows[i].FiscalModuleID
+		if _, err := r.store.insertTerminal(&rows[i].Terminal, &moduleID, meta); err != nil {
+			return &repository.ImportRowFailure{Row: rows[i].Row, Err: err}
+		}
+		return nil
+	})
+}
+
+// ApplyFiscalModules создаёт все фискальные модули по правилам ApplyTerminals
+func (r *ImportRepository) ApplyFiscalModules(ctx context.Context, rows []models.ImportFiscalModuleRow, meta models.AuditMeta, progress func(done int)) error {
+	return r.store.apply(len(rows), progress, func(i int) error {
+		if err := r.store.insertModule(&rows[i].Module, meta); err != nil {
+			return &repository.ImportRowFailure{Row: rows[i].Row, Err: err}
+		}
+		return nil
+	})
+}
+
+// apply вызывает write для строк 0..count-1 под блокировкой хранилища и откатывает
+// все изменения, если какая-то строка не записана
+func (s *Store) apply(count int, progress func(done int), write func(i int) error) error {
+	s.mu.Lock()
+	snapshot := s.tables()
+	for i := 0; i < count; i++ {
+		if err := write(i); err != nil {
+			s.setTables(snapshot)
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+
+	for done := importProgressStep; done <= count; done += importProgressStep {
+		progress(done)
+	}
+	return nil
+}
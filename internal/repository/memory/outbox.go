@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type OutboxRepository struct {
+	store *Store
+}
+
+func NewOutboxRepository(store *Store) *OutboxRepository {
+	return &OutboxRepository{store: store}
+}
+
+// outboxEntry — строка таблицы ofd_outbox
+type outboxEntry struct {
+	models.OFDDelivery
+	payload json.RawMessage
+}
+
+var outboxSorts = sortKeys[models.OFDDelivery]{
+	"id":              func(d *models.OFDDelivery) interface{} { return d.ID },
+	"next_attempt_at": func(d *models.OFDDelivery) interface{} { return d.NextAttemptAt },
+	"attempts":        func(d *models.OFDDelivery) interface{} { return d.Attempts },
+}
+
+func deliveryID(d *models.OFDDelivery) int { return d.ID }
+
+// enqueueOFD ставит документ в очередь отправки в ОФД
+func (s *Store) enqueueOFD(kind models.OFDDocumentKind, documentID int, document interface{}) error {
+	payload, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	entry := &outboxEntry{
+		OFDDelivery: models.OFDDelivery{
+			ID:            s.nextID("ofd_outbox"),
+			Kind:          kind,
+			Status:        models.OFDPending,
+			NextAttemptAt: now(),
+			CreatedAt:     now(),
+		},
+		payload: payload,
+	}
+	if kind == models.OFDReceipt {
+		entry.ReceiptID = intPtr(documentID)
+	} else {
+		entry.ZReportID = intPtr(documentID)
+	}
+	s.outbox[entry.ID] = entry
+	return nil
+}
+
+// Claim забирает до limit документов, срок отправки которых наступил, и откладывает их
+// следующую попытку на lease
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OFDDocument, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []models.OFDDelivery{}
+	for _, entry := range s.outbox {
+		if entry.Status == models.OFDPending && !entry.NextAttemptAt.After(now()) {
+			due = append(due, entry.OFDDelivery)
+		}
+	}
+	if _, err := sortItems(due, outboxSorts, models.ListParams{Sort: "next_attempt_at"}, deliveryID); err != nil {
+		return nil, err
+	}
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	var documents []models.OFDDocument
+	for _, delivery := range due {
+		entry := s.outbox[delivery.ID]
+		entry.NextAttemptAt = now().Add(lease)
+		documents = append(documents, models.OFDDocument{ID: entry.ID, Kind: entry.Kind, Payload: entry.payload, Attempts: entry.Attempts})
+	}
+	return documents, nil
+}
+
+// pending возвращает документ id, ожидающий доставки
+func (s *Store) pending(id int) (*outboxEntry, error) {
+	entry, ok := s.outbox[id]
+	if !ok || entry.Status != models.OFDPending {
+		return nil, sql.ErrNoRows
+	}
+	return entry, nil
+}
+
+// Acknowledge отмечает документ доставленным и сохраняет номер квитанции ОФД
+func (r *OutboxRepository) Acknowledge(ctx context.Context, id int, ackID string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.pending(id)
+	if err != nil {
+		return err
+	}
+	entry.Status = models.OFDAcknowledged
+	entry.Attempts++
+	entry.AckID = &ackID
+	entry.AcknowledgedAt = timePtr(now())
+	entry.LastError = nil
+	return nil
+}
+
+// Reschedule записывает неудачную попытку и назначает следующую на retryAt
+func (r *OutboxRepository) Reschedule(ctx context.Context, id int, retryAt time.Time, reason string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.pending(id)
+	if err != nil {
+		return err
+	}
+	entry.Attempts++
+	entry.NextAttemptAt = retryAt.UTC()
+	entry.LastError = &reason
+	return nil
+}
+
+// DeadLetter прекращает попытки доставки документа
+func (r *OutboxRepository) DeadLetter(ctx context.Context, id int, reason string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.pending(id)
+	if err != nil {
+		return err
+	}
+	entry.Status = models.OFDDead
+	entry.Attempts++
+	entry.LastError = &reason
+	return nil
+}
+
+// Requeue возвращает недоставленный документ в очередь с обнулённым счётчиком попыток
+func (r *OutboxRepository) Requeue(ctx context.Context, id int) (*models.OFDDelivery, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.outbox[id]
+	if !ok || entry.Status != models.OFDDead {
+		return nil, sql.ErrNoRows
+	}
+	entry.Status = models.OFDPending
+	entry.Attempts = 0
+	entry.NextAttemptAt = now()
+	delivery := entry.OFDDelivery
+	return &delivery, nil
+}
+
+// List возвращает страницу очереди отправки в ОФД
+func (r *OutboxRepository) List(ctx context.Context, filter models.OFDDeliveryFilter) (*models.OFDDeliveryList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []models.OFDDelivery{}
+	for _, entry := range s.outbox {
+		if (filter.Status != "" && entry.Status != filter.Status) || (filter.Kind != "" && entry.Kind != filter.Kind) {
+			continue
+		}
+		deliveries = append(deliveries, entry.OFDDelivery)
+	}
+
+	items, total, next, err := page(deliveries, outboxSorts, filter.ListParams, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OFDDeliveryList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// deliveryForReceipt возвращает состояние доставки чека в ОФД или nil, если чек не ставился в очередь
+func (s *Store) deliveryForReceipt(receiptID int) *models.OFDDelivery {
+	for _, entry := range s.outbox {
+		if entry.ReceiptID != nil && *entry.ReceiptID == receiptID {
+			delivery := entry.OFDDelivery
+			return &delivery
+		}
+	}
+	return nil
+}
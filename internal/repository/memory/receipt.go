@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+type ReceiptRepository struct {
+	store *Store
+}
+
+func NewReceiptRepository(store *Store) *ReceiptRepository {
+	return &ReceiptRepository{store: store}
+}
+
+var receiptSorts = sortKeys[models.Receipt]{
+	"id":             func(r *models.Receipt) interface{} { return r.ID },
+	"issued_at":      func(r *models.Receipt) interface{} { return r.IssuedAt },
+	"receipt_number": func(r *models.Receipt) interface{} { return int(r.ReceiptNumber) },
+	"total":          func(r *models.Receipt) interface{} { return int(r.Total) },
+}
+
+func receiptID(r *models.Receipt) int { return r.ID }
+
+// Create сохраняет чек вместе с позициями и оплатами по тем же правилам, что
+// repository.ReceiptRepository: модуль привязан к точке, смена открыта не дольше
+// MaxShiftDuration, номер чека больше последнего принятого. Списывает одну бесплатную
+// запись с баланса точки и ставит чек в очередь отправки в ОФД.
+// Если ownerID задан, чек принимается только от точки этого владельца.
+func (r *ReceiptRepository) Create(ctx context.Context, receipt *models.Receipt, ownerID *int) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terminal, ok := s.terminals[receipt.TerminalID]
+	if !ok || (ownerID != nil && *ownerID != terminal.UserID) {
+		return sql.ErrNoRows
+	}
+	if terminal.FiscalModuleID == nil || *terminal.FiscalModuleID != receipt.FiscalModuleID {
+		return repository.ErrModuleNotBound
+	}
+
+	shift := s.openShift(receipt.TerminalID)
+	switch {
+	case shift == nil:
+		return repository.ErrNoOpenShift
+	case shift.OpenedAt.Before(now().Add(-models.MaxShiftDuration)):
+		return repository.ErrShiftExpired
+	case shift.FiscalModuleID != receipt.FiscalModuleID:
+		return repository.ErrShiftModuleChanged
+	}
+	if receipt.ReceiptNumber <= s.lastReceiptNumber[receipt.FiscalModuleID] {
+		return repository.ErrReceiptNumberOutOfOrder
+	}
+
+	consumption := &models.BalanceMovement{
+		TerminalID: receipt.TerminalID,
+		Kind:       models.BalanceMovementConsumption,
+		Amount:     -1,
+		Reason:     fmt.Sprintf("receipt %d of module %s", receipt.ReceiptNumber, receipt.ModuleNumber),
+	}
+	if err := s.applyMovement(consumption); err != nil {
+		return err
+	}
+
+	s.lastReceiptNumber[receipt.FiscalModuleID] = receipt.ReceiptNumber
+	receipt.INN = terminal.INN
+	receipt.ShiftID = intPtr(shift.ID)
+	receipt.ID = s.nextID("receipts")
+	receipt.CreatedAt = now()
+	stored := *receipt
+	stored.Items = append([]models.ReceiptItem(nil), receipt.Items...)
+	stored.Payments = append([]models.ReceiptPayment(nil), receipt.Payments...)
+	stored.OFD = nil
+	s.receipts[receipt.ID] = &stored
+	return s.enqueueOFD(models.OFDReceipt, receipt.ID, receipt)
+}
+
+// filterReceipts возвращает заголовки чеков, удовлетворяющих фильтру, без позиций и оплат
+func (s *Store) filterReceipts(filter models.ReceiptFilter) []models.Receipt {
+	receipts := []models.Receipt{}
+	for _, receipt := range s.receipts {
+		switch {
+		case filter.TerminalID != nil && receipt.TerminalID != *filter.TerminalID,
+			filter.FiscalModuleID != nil && receipt.FiscalModuleID != *filter.FiscalModuleID,
+			filter.UserID != nil && !s.ownsTerminal(*filter.UserID, receipt.TerminalID),
+			filter.INN != "" && receipt.INN != filter.INN,
+			filter.Type != "" && receipt.Type != filter.Type,
+			filter.IssuedFrom != nil && receipt.IssuedAt.Before(*filter.IssuedFrom),
+			filter.IssuedTo != nil && !receipt.IssuedAt.Before(*filter.IssuedTo):
+			continue
+		}
+		header := *receipt
+		header.Items = nil
+		header.Payments = nil
+		receipts = append(receipts, header)
+	}
+	return receipts
+}
+
+// ownsTerminal сообщает, принадлежит ли торговая точка terminalID пользователю userID
+func (s *Store) ownsTerminal(userID, terminalID int) bool {
+	terminal, ok := s.terminals[terminalID]
+	return ok && terminal.UserID == userID
+}
+
+// List возвращает страницу чеков без позиций и оплат
+func (r *ReceiptRepository) List(ctx context.Context, filter models.ReceiptFilter) (*models.ReceiptList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, total, next, err := page(s.filterReceipts(filter), receiptSorts, filter.ListParams, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ReceiptList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// Export передаёт fn заголовки всех чеков под фильтром в порядке его сортировки
+func (r *ReceiptRepository) Export(ctx context.Context, filter models.ReceiptFilter, fn func(receipt *models.Receipt) error) error {
+	s := r.store
+	s.mu.Lock()
+	receipts := s.filterReceipts(filter)
+	s.mu.Unlock()
+
+	if _, err := sortItems(receipts, receiptSorts, filter.ListParams, receiptID); err != nil {
+		return err
+	}
+	for i := range receipts {
+		if err := fn(&receipts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByID возвращает чек вместе с позициями, оплатами и состоянием доставки в ОФД.
+// Если ownerID задан, чеки чужих торговых точек считаются ненайденными.
+func (r *ReceiptRepository) GetByID(ctx context.Context, id int, ownerID *int) (*models.Receipt, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.receipts[id]
+	if !ok || (ownerID != nil && !s.ownsTerminal(*ownerID, stored.TerminalID)) {
+		return nil, sql.ErrNoRows
+	}
+	receipt := *stored
+	receipt.Items = append([]models.ReceiptItem(nil), stored.Items...)
+	receipt.Payments = append([]models.ReceiptPayment(nil), stored.Payments...)
+	receipt.OFD = s.deliveryForReceipt(id)
+	return &receipt, nil
+}
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type SessionRepository struct {
+	store *Store
+}
+
+func NewSessionRepository(store *Store) *SessionRepository {
+	return &SessionRepository{store: store}
+}
+
+// Create сохраняет новую сессию с хешем refresh токена
+func (r *SessionRepository) Create(ctx context.Context, sess *models.Session, tokenHash string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[sess.UserID]; !ok {
+		return missingReference("sessions", "sessions_user_id_fkey")
+	}
+	if err := s.checkTokenHash(tokenHash); err != nil {
+		return err
+	}
+
+	sess.ID = s.nextID("sessions")
+	sess.CreatedAt = now()
+	sess.LastUsedAt = sess.CreatedAt
+	s.sessions[sess.ID] = &session{Session: *sess, tokenHash: tokenHash}
+	return nil
+}
+
+// Rotate заменяет refresh токен действующей сессии и продлевает её до expiresAt.
+// Возвращает sql.ErrNoRows, если токен не принадлежит действующей сессии.
+func (r *SessionRepository) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.Session, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.tokenHash != oldHash || !sess.active() {
+			continue
+		}
+		if err := s.checkTokenHash(newHash); err != nil {
+			return nil, err
+		}
+		sess.previousHash = oldHash
+		sess.tokenHash = newHash
+		sess.LastUsedAt = now()
+		sess.ExpiresAt = expiresAt
+		rotated := sess.Session
+		return &rotated, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// RevokeByPreviousToken отзывает сессию, чей уже заменённый refresh токен предъявлен повторно
+func (r *SessionRepository) RevokeByPreviousToken(ctx context.Context, tokenHash string) (int64, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revokeWhere(func(sess *session) bool { return sess.previousHash == tokenHash }), nil
+}
+
+// Revoke отзывает сессию пользователя
+func (r *SessionRepository) Revoke(ctx context.Context, sessionID, userID int) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := s.revokeWhere(func(sess *session) bool { return sess.ID == sessionID && sess.UserID == userID })
+	if revoked == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAllForUser отзывает все действующие сессии пользователя
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID int) (int64, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revokeWhere(func(sess *session) bool { return sess.UserID == userID }), nil
+}
+
+// GetActiveUser возвращает владельца сессии, если сессия не отозвана и не истекла
+func (r *SessionRepository) GetActiveUser(ctx context.Context, sessionID, userID int) (*models.User, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok || sess.UserID != userID || !sess.active() {
+		return nil, sql.ErrNoRows
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &models.User{ID: user.ID, INN: user.INN, Username: user.Username, IsActive: user.IsActive, IsAdmin: user.IsAdmin, Role: user.Role}, nil
+}
+
+func (sess *session) active() bool {
+	return sess.RevokedAt == nil && sess.ExpiresAt.After(now())
+}
+
+// revokeWhere отзывает действующие сессии, подходящие под match, и возвращает их число
+func (s *Store) revokeWhere(match func(sess *session) bool) int64 {
+	var revoked int64
+	for _, sess := range s.sessions {
+		if sess.RevokedAt == nil && match(sess) {
+			sess.RevokedAt = timePtr(now())
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func (s *Store) checkTokenHash(hash string) error {
+	for _, sess := range s.sessions {
+		if sess.tokenHash == hash {
+			return uniqueViolation("sessions", "sessions_refresh_token_hash_key")
+		}
+	}
+	return nil
+}
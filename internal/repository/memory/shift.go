@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+// OpenShift открывает смену на активной торговой точке с привязанным фискальным модулем
+func (r *TerminalRepository) OpenShift(ctx context.Context, terminalID int, actorID *int) (*models.Shift, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terminal, ok := s.terminals[terminalID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if terminal.Status != models.TerminalActive || terminal.FiscalModuleID == nil {
+		return nil, repository.ErrShiftNotAllowed
+	}
+	if s.openShift(terminalID) != nil {
+		return nil, repository.ErrShiftAlreadyOpen
+	}
+
+	shift := &models.Shift{
+		ID:             s.nextID("shifts"),
+		TerminalID:     terminalID,
+		FiscalModuleID: *terminal.FiscalModuleID,
+		OpenedAt:       now(),
+		OpenedBy:       actorID,
+	}
+	s.shifts[shift.ID] = shift
+	opened := *shift
+	return &opened, nil
+}
+
+// GetOpenShift возвращает открытую смену торговой точки или repository.ErrNoOpenShift
+func (r *TerminalRepository) GetOpenShift(ctx context.Context, terminalID int) (*models.Shift, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shift := s.openShift(terminalID)
+	if shift == nil {
+		return nil, repository.ErrNoOpenShift
+	}
+	open := *shift
+	return &open, nil
+}
+
+// ShiftReport считает промежуточные итоги открытой смены (X-отчёт)
+func (r *TerminalRepository) ShiftReport(ctx context.Context, terminalID int) (*models.ShiftReport, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shift := s.openShift(terminalID)
+	if shift == nil {
+		return nil, repository.ErrNoOpenShift
+	}
+	return s.shiftTotals(shift), nil
+}
+
+// CloseShift закрывает открытую смену, сохраняет Z-отчёт со следующим номером фискального модуля
+// и ставит его в очередь отправки в ОФД
+func (r *TerminalRepository) CloseShift(ctx context.Context, terminalID int, actorID *int) (*models.ZReport, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shift := s.openShift(terminalID)
+	if shift == nil {
+		return nil, repository.ErrNoOpenShift
+	}
+	shift.ClosedAt = timePtr(now())
+	shift.ClosedBy = actorID
+
+	s.lastZReport[shift.FiscalModuleID]++
+	report := &zReport{
+		ZReport: models.ZReport{
+			ID:           s.nextID("z_reports"),
+			ReportNumber: s.lastZReport[shift.FiscalModuleID],
+			Report:       *s.shiftTotals(shift),
+			CreatedAt:    now(),
+		},
+		terminalID: terminalID,
+	}
+	s.zReports = append(s.zReports, report)
+	closed := report.ZReport
+	if err := s.enqueueOFD(models.OFDZReport, closed.ID, &closed); err != nil {
+		return nil, err
+	}
+	return &closed, nil
+}
+
+// GetZReports возвращает Z-отчёты торговой точки в порядке закрытия смен
+func (r *TerminalRepository) GetZReports(ctx context.Context, terminalID int) ([]models.ZReport, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := []models.ZReport{}
+	for _, report := range s.zReports {
+		if report.terminalID == terminalID {
+			reports = append(reports, report.ZReport)
+		}
+	}
+	return reports, nil
+}
+
+func (s *Store) openShift(terminalID int) *models.Shift {
+	for _, shift := range s.shifts {
+		if shift.TerminalID == terminalID && shift.ClosedAt == nil {
+			return shift
+		}
+	}
+	return nil
+}
+
+// shiftTotals собирает итоги смены по сохранённым чекам
+func (s *Store) shiftTotals(shift *models.Shift) *models.ShiftReport {
+	report := &models.ShiftReport{
+		ShiftID:        shift.ID,
+		TerminalID:     shift.TerminalID,
+		FiscalModuleID: shift.FiscalModuleID,
+		OpenedAt:       shift.OpenedAt,
+		ClosedAt:       shift.ClosedAt,
+		GeneratedAt:    now(),
+		ByPaymentType:  []models.PaymentTotals{},
+		ByVATRate:      []models.VATRateTotals{},
+	}
+
+	byPayment := map[models.PaymentType]*models.PaymentTotals{}
+	byRate := map[int]*models.VATRateTotals{}
+	for _, receipt := range s.receipts {
+		if receipt.ShiftID == nil || *receipt.ShiftID != shift.ID {
+			continue
+		}
+		refund := receipt.Type == models.ReceiptRefund
+		if refund {
+			report.RefundCount++
+			report.RefundsTotal += receipt.Total
+			report.RefundsVAT += receipt.VATTotal
+		} else {
+			report.SaleCount++
+			report.SalesTotal += receipt.Total
+			report.SalesVAT += receipt.VATTotal
+		}
+
+		for _, payment := range receipt.Payments {
+			totals, ok := byPayment[payment.Type]
+			if !ok {
+				totals = &models.PaymentTotals{Type: payment.Type}
+				byPayment[payment.Type] = totals
+			}
+			if refund {
+				totals.Refunds += payment.Amount
+			} else {
+				totals.Sales += payment.Amount
+			}
+		}
+		for _, item := range receipt.Items {
+			totals, ok := byRate[item.VATRate]
+			if !ok {
+				totals = &models.VATRateTotals{Rate: item.VATRate}
+				byRate[item.VATRate] = totals
+			}
+			if refund {
+				totals.Refunds += item.Total
+				totals.RefundsVAT += item.VATAmount
+			} else {
+				totals.Sales += item.Total
+				totals.SalesVAT += item.VATAmount
+			}
+		}
+	}
+	report.NetTotal = report.SalesTotal - report.RefundsTotal
+
+	for _, totals := range byPayment {
+		report.ByPaymentType = append(report.ByPaymentType, *totals)
+	}
+	sort.Slice(report.ByPaymentType, func(i, j int) bool { return report.ByPaymentType[i].Type < report.ByPaymentType[j].Type })
+	for _, totals := range byRate {
+		report.ByVATRate = append(report.ByVATRate, *totals)
+	}
+	sort.Slice(report.ByVATRate, func(i, j int) bool { return report.ByVATRate[i].Rate < report.ByVATRate[j].Rate })
+	return report
+}
@@ -0,0 +1,338 @@
+// Package memory — хранилище в памяти с теми же интерфейсами и ограничениями, что
+// и репозитории PostgreSQL. Нужно для тестов сервисов и обработчиков без базы данных.
+//
+// Нарушения уникальности и внешних ключей возвращаются как *pq.Error с кодом и именем
+// ограничения из схемы, поэтому apperrors.Classify переводит их в те же ответы API.
+// Журнал аудита, очередь ОФД и задания импорта ведутся по тем же правилам, что в базе.
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/ofd"
+	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/internal/services"
+	"github.com/lib/pq"
+)
+
+var (
+	_ services.UserRepository     = (*UserRepository)(nil)
+	_ services.SessionRepository  = (*SessionRepository)(nil)
+	_ services.FiscalRepository   = (*FiscalRepository)(nil)
+	_ services.TerminalRepository = (*TerminalRepository)(nil)
+	_ services.ReceiptRepository  = (*ReceiptRepository)(nil)
+	_ services.CompanyRepository  = (*CompanyRepository)(nil)
+	_ services.OutboxRepository   = (*OutboxRepository)(nil)
+	_ services.AuditRepository    = (*AuditRepository)(nil)
+	_ services.ImportRepository   = (*ImportRepository)(nil)
+	_ services.TaxIDRepository    = (*TaxIDRepository)(nil)
+	_ services.UnitOfWork         = (*UnitOfWork)(nil)
+	_ ofd.Outbox                  = (*OutboxRepository)(nil)
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// session — строка таблицы sessions
+type session struct {
+	models.Session
+	tokenHash    string
+	previousHash string
+}
+
+// Store содержит все таблицы. Репозитории одного Store видят общие данные,
+// как репозитории одной базы; все операции выполняются под одной блокировкой.
+type Store struct {
+	mu sync.Mutex
+
+	seq               map[string]int
+	users             map[int]*models.User
+	companies         map[int]*models.Company
+	sessions          map[int]*session
+	modules           map[int]*models.FiscalModule
+	lastReceiptNumber map[int]int64
+	lastZReport       map[int]int
+	terminals         map[int]*models.Terminal
+	bindings          []*models.FiscalModuleBinding
+	statusChanges     []*models.TerminalStatusChange
+	movements         []*models.BalanceMovement
+	shifts            map[int]*models.Shift
+	zReports          []*zReport
+	receipts          map[int]*models.Receipt
+	outbox            map[int]*outboxEntry
+	audit             []*models.AuditRecord
+	imports           map[int]*models.ImportJob
+}
+
+// zReport — строка таблицы z_reports
+type zReport struct {
+	models.ZReport
+	terminalID int
+}
+
+func NewStore() *Store {
+	return &Store{
+		seq:               map[string]int{},
+		users:             map[int]*models.User{},
+		companies:         map[int]*models.Company{},
+		sessions:          map[int]*session{},
+		modules:           map[int]*models.FiscalModule{},
+		lastReceiptNumber: map[int]int64{},
+		lastZReport:       map[int]int{},
+		terminals:         map[int]*models.Terminal{},
+		shifts:            map[int]*models.Shift{},
+		receipts:          map[int]*models.Receipt{},
+		outbox:            map[int]*outboxEntry{},
+		imports:           map[int]*models.ImportJob{},
+	}
+}
+
+// nextID выдаёт следующий идентификатор таблицы, как SERIAL
+func (s *Store) nextID(table string) int {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// companyByINN возвращает компанию с ИНН inn или nil
+func (s *Store) companyByINN(inn string) *models.Company {
+	for _, company := range s.companies {
+		if company.INN == inn {
+			return company
+		}
+	}
+	return nil
+}
+
+// companyName возвращает название компании с ИНН inn
+func (s *Store) companyName(inn string) string {
+	if company := s.companyByINN(inn); company != nil {
+		return company.LegalName
+	}
+	return ""
+}
+
+// ensureCompany создаёт компанию с ИНН inn и названием legalName, если её ещё нет,
+// и записывает создание в журнал аудита. Непустое legalName должно совпадать с названием
+// уже существующей компании.
+func (s *Store) ensureCompany(inn, legalName string, meta models.AuditMeta) error {
+	if existing := s.companyByINN(inn); existing != nil {
+		if legalName != "" && existing.LegalName != legalName {
+			return repository.ErrCompanyNameMismatch
+		}
+		return nil
+	}
+	company := &models.Company{ID: s.nextID("companies"), INN: inn, LegalName: legalName, Version: 1}
+	s.companies[company.ID] = company
+	return s.writeAudit(meta, models.AuditCompany, company.ID, models.AuditCreate, nil, company)
+}
+
+func checkVersion(current, expected int) error {
+	if current != expected {
+		return repository.ErrVersionMismatch
+	}
+	return nil
+}
+
+func uniqueViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// missingReference — ссылка строки table на несуществующую запись
+func missingReference(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		Detail:     "Key is not present in referenced table.",
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// stillReferenced — удаление записи id, на которую ссылаются строки table
+func stillReferenced(table, constraint string, id int) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    fmt.Sprintf("update or delete violates foreign key constraint %q on table %q", constraint, table),
+		Detail:     fmt.Sprintf("Key (id)=(%d) is still referenced from table %q.", id, table),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// sortKeys задаёт допустимые поля сортировки списка. Ключ — int, string или time.Time.
+type sortKeys[T any] map[string]func(item *T) interface{}
+
+// pageCursor — позиция последней записи страницы, как у курсоров repository
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// sortItems упорядочивает items по полю params.Sort и id, как ORDER BY в репозиториях
+func sortItems[T any](items []T, keys sortKeys[T], params models.ListParams, idOf func(item *T) int) (func(item *T) interface{}, error) {
+	sortName := params.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	key, ok := keys[sortName]
+	if !ok {
+		return nil, repository.ErrInvalidSort
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		c := compareKeys(key(&items[i]), key(&items[j]))
+		if c == 0 {
+			c = idOf(&items[i]) - idOf(&items[j])
+		}
+		if params.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return key, nil
+}
+
+// page возвращает страницу items под параметрами params, общее число записей и курсор следующей страницы
+func page[T any](items []T, keys sortKeys[T], params models.ListParams, idOf func(item *T) int) ([]T, int, string, error) {
+	key, err := sortItems(items, keys, params, idOf)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	sortName := params.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	total := len(items)
+	if params.Cursor != "" {
+		cursor, err := decodeCursor(params.Cursor)
+		if err != nil || cursor.Sort != sortName || cursor.Desc != params.Desc {
+			return nil, 0, "", repository.ErrInvalidCursor
+		}
+		var zero T
+		value, err := parseKey(key(&zero), cursor.Value)
+		if err != nil {
+			return nil, 0, "", repository.ErrInvalidCursor
+		}
+		start := len(items)
+		for i := range items {
+			c := compareKeys(key(&items[i]), value)
+			if c == 0 {
+				c = idOf(&items[i]) - cursor.ID
+			}
+			if (!params.Desc && c > 0) || (params.Desc && c < 0) {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+
+	if len(items) <= limit {
+		return items, total, "", nil
+	}
+	items = items[:limit]
+	last := &items[limit-1]
+	next := encodeCursor(pageCursor{Sort: sortName, Desc: params.Desc, Value: formatKey(key(last)), ID: idOf(last)})
+	return items, total, next, nil
+}
+
+func compareKeys(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("memory: unsupported sort key %T", a))
+}
+
+func formatKey(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	panic(fmt.Sprintf("memory: unsupported sort key %T", v))
+}
+
+// parseKey разбирает значение курсора в тип ключа sample
+func parseKey(sample interface{}, s string) (interface{}, error) {
+	switch sample.(type) {
+	case int:
+		return strconv.Atoi(s)
+	case string:
+		return s, nil
+	case time.Time:
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	panic(fmt.Sprintf("memory: unsupported sort key %T", sample))
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(raw, &c)
+	return c, err
+}
+
+// containsFold повторяет ILIKE '%substr%'
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func timePtr(v time.Time) *time.Time {
+	return &v
+}
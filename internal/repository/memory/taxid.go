@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type TaxIDRepository struct {
+	store *Store
+}
+
+func NewTaxIDRepository(store *Store) *TaxIDRepository {
+	return &TaxIDRepository{store: store}
+}
+
+// Stream передаёт fn ИНН всех объектов вида entity в порядке их ID
+func (r *TaxIDRepository) Stream(ctx context.Context, entity models.TaxIDEntity, fn func(record models.TaxIDRecord) error) error {
+	s := r.store
+	s.mu.Lock()
+	records := []models.TaxIDRecord{}
+	add := func(id int, inn string) {
+		records = append(records, models.TaxIDRecord{EntityType: entity, EntityID: id, INN: inn})
+	}
+	switch entity {
+	case models.TaxIDUser:
+		for _, user := range s.users {
+			add(user.ID, user.INN)
+		}
+	case models.TaxIDTerminal:
+		for _, terminal := range s.terminals {
+			add(terminal.ID, terminal.INN)
+		}
+	case models.TaxIDCompany:
+		for _, company := range s.companies {
+			add(company.ID, company.INN)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].EntityID < records[j].EntityID })
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
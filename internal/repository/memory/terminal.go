@@ -0,0 +1,408 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+type TerminalRepository struct {
+	store *Store
+}
+
+func NewTerminalRepository(store *Store) *TerminalRepository {
+	return &TerminalRepository{store: store}
+}
+
+var terminalSorts = sortKeys[models.Terminal]{
+	"id":                   func(t *models.Terminal) interface{} { return t.ID },
+	"inn":                  func(t *models.Terminal) interface{} { return t.INN },
+	"company_name":         func(t *models.Terminal) interface{} { return t.CompanyName },
+	"cash_register_number": func(t *models.Terminal) interface{} { return t.CashRegisterNumber },
+	"free_record_balance":  func(t *models.Terminal) interface{} { return t.FreeRecordBalance },
+	"last_request_date": func(t *models.Terminal) interface{} {
+		if t.LastRequestDate == nil {
+			return time.Time{}
+		}
+		return *t.LastRequestDate
+	},
+}
+
+func terminalID(t *models.Terminal) int { return t.ID }
+
+// terminal возвращает копию торговой точки с названием её компании
+func (s *Store) terminal(id int) (*models.Terminal, bool) {
+	stored, ok := s.terminals[id]
+	if !ok {
+		return nil, false
+	}
+	terminal := *stored
+	terminal.CompanyName = s.companyName(terminal.INN)
+	return &terminal, true
+}
+
+// filterTerminals возвращает копии торговых точек, удовлетворяющих фильтру
+func (s *Store) filterTerminals(filter models.TerminalFilter) []models.Terminal {
+	terminals := []models.Terminal{}
+	for id := range s.terminals {
+		terminal, _ := s.terminal(id)
+		switch {
+		case filter.INN != "" && terminal.INN != filter.INN,
+			filter.Status != "" && terminal.Status != filter.Status,
+			filter.UserID != nil && terminal.UserID != *filter.UserID,
+			filter.CompanyName != "" && !containsFold(terminal.CompanyName, filter.CompanyName),
+			filter.IsOnline != nil && terminal.IsOnline != *filter.IsOnline,
+			filter.LastRequestFrom != nil && (terminal.LastRequestDate == nil || terminal.LastRequestDate.Before(*filter.LastRequestFrom)),
+			filter.LastRequestTo != nil && (terminal.LastRequestDate == nil || !terminal.LastRequestDate.Before(*filter.LastRequestTo)):
+			continue
+		}
+		terminals = append(terminals, *terminal)
+	}
+	return terminals
+}
+
+// List возвращает страницу торговых точек, удовлетворяющих фильтру
+func (r *TerminalRepository) List(ctx context.Context, filter models.TerminalFilter) (*models.TerminalList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, total, next, err := page(s.filterTerminals(filter), terminalSorts, filter.ListParams, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TerminalList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// Export передаёт fn все торговые точки под фильтром в порядке его сортировки
+func (r *TerminalRepository) Export(ctx context.Context, filter models.TerminalFilter, fn func(terminal *models.Terminal) error) error {
+	s := r.store
+	s.mu.Lock()
+	terminals := s.filterTerminals(filter)
+	s.mu.Unlock()
+
+	if _, err := sortItems(terminals, terminalSorts, filter.ListParams, terminalID); err != nil {
+		return err
+	}
+	for i := range terminals {
+		if err := fn(&terminals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TerminalRepository) GetByID(ctx context.Context, id int) (*models.Terminal, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terminal, ok := s.terminal(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return terminal, nil
+}
+
+// Create добавляет торговую точку, привязывает к ней фискальный модуль fiscalModuleID
+// и отражает начальный баланс в журнале движений и создание в журнале аудита.
+// Компания с ИНН точки создаётся, если её ещё нет. Возвращает сохранённую точку.
+func (r *TerminalRepository) Create(ctx context.Context, req *models.TerminalCreateRequest, fiscalModuleID *int, meta models.AuditMeta) (*models.Terminal, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertTerminal(req, fiscalModuleID, meta)
+}
+
+// insertTerminal выполняет Create под уже взятой блокировкой хранилища
+func (s *Store) insertTerminal(req *models.TerminalCreateRequest, fiscalModuleID *int, meta models.AuditMeta) (*models.Terminal, error) {
+	changedAt := now()
+	terminal := &models.Terminal{
+		INN:                req.INN,
+		Address:            req.Address,
+		CashRegisterNumber: req.CashRegisterNumber,
+		ModuleNumber:       req.ModuleNumber,
+		AssemblyNumber:     req.AssemblyNumber,
+		Status:             models.TerminalRegistered,
+		StatusChangedAt:    &changedAt,
+		UserID:             req.UserID,
+		FreeRecordBalance:  req.FreeRecordBalance,
+		FiscalModuleID:     fiscalModuleID,
+		Version:            1,
+	}
+	if err := s.checkTerminal(terminal); err != nil {
+		return nil, err
+	}
+	if err := s.checkBinding(0, fiscalModuleID); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureCompany(req.INN, req.CompanyName, meta); err != nil {
+		return nil, err
+	}
+	terminal.ID = s.nextID("terminals")
+	s.storeTerminal(terminal)
+	if fiscalModuleID != nil {
+		s.bind(terminal.ID, *fiscalModuleID)
+	}
+	if req.FreeRecordBalance != 0 {
+		s.addMovement(&models.BalanceMovement{
+			TerminalID:   terminal.ID,
+			Kind:         models.BalanceMovementCorrection,
+			Amount:       req.FreeRecordBalance,
+			BalanceAfter: req.FreeRecordBalance,
+			Reason:       "opening balance",
+		})
+	}
+	created, _ := s.terminal(terminal.ID)
+	if err := s.writeAudit(meta, models.AuditTerminal, terminal.ID, models.AuditCreate, nil, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Update перезаписывает данные торговой точки, если её версия всё ещё равна terminal.Version,
+// и увеличивает версию. При смене фискального модуля закрывает прежнюю привязку
+// и открывает новую. Баланс и статус здесь не меняются.
+func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Terminal, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.terminal(terminal.ID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, terminal.Version); err != nil {
+		return err
+	}
+	if before.Status == models.TerminalDecommissioned {
+		return repository.ErrTerminalDecommissioned
+	}
+
+	updated := *s.terminals[terminal.ID]
+	updated.INN = terminal.INN
+	updated.Address = terminal.Address
+	updated.CashRegisterNumber = terminal.CashRegisterNumber
+	updated.ModuleNumber = terminal.ModuleNumber
+	updated.AssemblyNumber = terminal.AssemblyNumber
+	updated.LastRequestDate = terminal.LastRequestDate
+	updated.DatabaseUpdateDate = terminal.DatabaseUpdateDate
+	updated.UserID = terminal.UserID
+	updated.FiscalModuleID = terminal.FiscalModuleID
+	updated.Version = before.Version + 1
+	if err := s.checkTerminal(&updated); err != nil {
+		return err
+	}
+
+	changed := (before.FiscalModuleID != nil) != (terminal.FiscalModuleID != nil) ||
+		(terminal.FiscalModuleID != nil && *terminal.FiscalModuleID != *before.FiscalModuleID)
+	if changed {
+		if err := s.checkBinding(terminal.ID, terminal.FiscalModuleID); err != nil {
+			return err
+		}
+	}
+
+	if terminal.INN != before.INN {
+		if err := s.ensureCompany(terminal.INN, "", meta); err != nil {
+			return err
+		}
+	}
+	s.storeTerminal(&updated)
+	if changed {
+		s.unbind(terminal.ID)
+		if terminal.FiscalModuleID != nil {
+			s.bind(terminal.ID, *terminal.FiscalModuleID)
+		}
+	}
+	terminal.Version = updated.Version
+	after, _ := s.terminal(terminal.ID)
+	return s.writeAudit(meta, models.AuditTerminal, terminal.ID, models.AuditUpdate, before, after)
+}
+
+// Delete удаляет торговую точку версии version вместе с её историей привязок, статусов
+// и баланса. Точку, у которой были смены, удалить нельзя.
+func (r *TerminalRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.terminal(id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+	for _, shift := range s.shifts {
+		if shift.TerminalID == id {
+			return stillReferenced("shifts", "shifts_terminal_id_fkey", id)
+		}
+	}
+
+	delete(s.terminals, id)
+	bindings := s.bindings[:0]
+	for _, binding := range s.bindings {
+		if binding.TerminalID != id {
+			bindings = append(bindings, binding)
+		}
+	}
+	s.bindings = bindings
+	changes := s.statusChanges[:0]
+	for _, change := range s.statusChanges {
+		if change.TerminalID != id {
+			changes = append(changes, change)
+		}
+	}
+	s.statusChanges = changes
+	movements := s.movements[:0]
+	for _, movement := range s.movements {
+		if movement.TerminalID != id {
+			movements = append(movements, movement)
+		}
+	}
+	s.movements = movements
+	return s.writeAudit(meta, models.AuditTerminal, id, models.AuditDelete, before, nil)
+}
+
+// Reassign передаёт все торговые точки пользователя fromUserID, в том числе выведенные
+// из эксплуатации, пользователю toUserID и возвращает их число
+func (r *TerminalRepository) Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, terminal := range s.terminals {
+		if terminal.UserID != fromUserID {
+			continue
+		}
+		if _, ok := s.users[toUserID]; !ok {
+			return 0, missingReference("terminals", "terminals_user_id_fkey")
+		}
+		before, _ := s.terminal(terminal.ID)
+		terminal.UserID = toUserID
+		terminal.Version++
+		after, _ := s.terminal(terminal.ID)
+		if err := s.writeAudit(meta, models.AuditTerminal, terminal.ID, models.AuditUpdate, before, after); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// CheckIn отмечает обращение кассы, найденной по номеру ККМ и номеру модуля.
+// Если ownerID задан, обновляется только касса этого владельца.
+// Выведенные из эксплуатации кассы считаются ненайденными.
+func (r *TerminalRepository) CheckIn(ctx context.Context, cashRegisterNumber, moduleNumber string, ownerID *int) (*models.Terminal, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, terminal := range s.terminals {
+		if terminal.CashRegisterNumber != cashRegisterNumber || terminal.ModuleNumber != moduleNumber ||
+			(ownerID != nil && terminal.UserID != *ownerID) || terminal.Status == models.TerminalDecommissioned {
+			continue
+		}
+		terminal.LastRequestDate = timePtr(now())
+		terminal.IsOnline = true
+		return &models.Terminal{
+			ID:                 terminal.ID,
+			CashRegisterNumber: cashRegisterNumber,
+			ModuleNumber:       moduleNumber,
+			LastRequestDate:    terminal.LastRequestDate,
+			DatabaseUpdateDate: terminal.DatabaseUpdateDate,
+			IsOnline:           terminal.IsOnline,
+			UserID:             terminal.UserID,
+		}, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// MarkOffline переводит в офлайн кассы, которые не выходили на связь дольше window
+func (r *TerminalRepository) MarkOffline(ctx context.Context, window time.Duration) (int64, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadline := now().Add(-window)
+	var count int64
+	for _, terminal := range s.terminals {
+		if terminal.IsOnline && (terminal.LastRequestDate == nil || terminal.LastRequestDate.Before(deadline)) {
+			terminal.IsOnline = false
+			count++
+		}
+	}
+	return count, nil
+}
+
+// checkTerminal проверяет уникальные номера торговой точки и её ссылки на владельца и модуль
+func (s *Store) checkTerminal(terminal *models.Terminal) error {
+	for _, other := range s.terminals {
+		if other.ID == terminal.ID {
+			continue
+		}
+		switch {
+		case other.CashRegisterNumber == terminal.CashRegisterNumber:
+			return uniqueViolation("terminals", "terminals_cash_register_number_key")
+		case other.ModuleNumber == terminal.ModuleNumber:
+			return uniqueViolation("terminals", "terminals_module_number_key")
+		case other.AssemblyNumber == terminal.AssemblyNumber:
+			return uniqueViolation("terminals", "terminals_assembly_number_key")
+		case terminal.FiscalModuleID != nil && other.FiscalModuleID != nil && *other.FiscalModuleID == *terminal.FiscalModuleID:
+			return uniqueViolation("terminals", "terminals_fiscal_module_id_key")
+		}
+	}
+	if _, ok := s.users[terminal.UserID]; !ok {
+		return missingReference("terminals", "terminals_user_id_fkey")
+	}
+	if terminal.FiscalModuleID != nil {
+		if _, ok := s.modules[*terminal.FiscalModuleID]; !ok {
+			return missingReference("terminals", "terminals_fiscal_module_id_fkey")
+		}
+	}
+	return nil
+}
+
+// checkBinding проверяет, что модуль moduleID можно привязать к точке terminalID:
+// у модуля не должно быть действующей привязки к другой точке
+func (s *Store) checkBinding(terminalID int, moduleID *int) error {
+	if moduleID == nil {
+		return nil
+	}
+	for _, binding := range s.bindings {
+		if binding.UnboundAt == nil && binding.FiscalModuleID == *moduleID && binding.TerminalID != terminalID {
+			return uniqueViolation("fiscal_module_bindings", "idx_fiscal_module_bindings_active_module")
+		}
+	}
+	return nil
+}
+
+func (s *Store) storeTerminal(terminal *models.Terminal) {
+	stored := *terminal
+	stored.CompanyName = ""
+	stored.FiscalModule = nil
+	s.terminals[terminal.ID] = &stored
+}
+
+func (s *Store) bind(terminalID, moduleID int) {
+	s.bindings = append(s.bindings, &models.FiscalModuleBinding{
+		ID:             s.nextID("fiscal_module_bindings"),
+		TerminalID:     terminalID,
+		FiscalModuleID: moduleID,
+		BoundAt:        now(),
+	})
+}
+
+func (s *Store) unbind(terminalID int) {
+	for _, binding := range s.bindings {
+		if binding.TerminalID == terminalID && binding.UnboundAt == nil {
+			binding.UnboundAt = timePtr(now())
+		}
+	}
+}
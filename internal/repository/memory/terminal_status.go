@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+// ChangeStatus переводит торговую точку из change.FromStatus в change.ToStatus и записывает
+// переход в историю. Если текущий статус уже не равен FromStatus, возвращается
+// repository.ErrStatusChanged. При выводе из эксплуатации точка уходит в офлайн
+// и освобождает фискальный модуль.
+func (r *TerminalRepository) ChangeStatus(ctx context.Context, change *models.TerminalStatusChange, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terminal, ok := s.terminals[change.TerminalID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	before, _ := s.terminal(change.TerminalID)
+	if terminal.Status != change.FromStatus {
+		return repository.ErrStatusChanged
+	}
+	if change.ToStatus == models.TerminalDecommissioned && s.openShift(terminal.ID) != nil {
+		return repository.ErrShiftStillOpen
+	}
+
+	change.ChangedAt = now()
+	terminal.Status = change.ToStatus
+	terminal.StatusChangedAt = timePtr(change.ChangedAt)
+	terminal.Version++
+	if change.ToStatus == models.TerminalDecommissioned {
+		s.unbind(terminal.ID)
+		terminal.FiscalModuleID = nil
+		terminal.IsOnline = false
+	}
+
+	change.ID = s.nextID("terminal_status_changes")
+	stored := *change
+	s.statusChanges = append(s.statusChanges, &stored)
+	after, _ := s.terminal(change.TerminalID)
+	return s.writeAudit(meta, models.AuditTerminal, change.TerminalID, models.AuditUpdate, before, after)
+}
+
+// GetStatusHistory возвращает историю смены статусов торговой точки в порядке записи
+func (r *TerminalRepository) GetStatusHistory(ctx context.Context, terminalID int) ([]models.TerminalStatusChange, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes := []models.TerminalStatusChange{}
+	for _, change := range s.statusChanges {
+		if change.TerminalID == terminalID {
+			changes = append(changes, *change)
+		}
+	}
+	return changes, nil
+}
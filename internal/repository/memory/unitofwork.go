@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/idkOybek/internal/services"
+)
+
+// UnitOfWork выполняет единицы работы над хранилищем: если функция вернула ошибку,
+// хранилище возвращается к снимку, снятому перед её вызовом. Единицы работы выполняются
+// по одной; изменения, сделанные в это время в обход единицы работы, откат тоже отменяет.
+type UnitOfWork struct {
+	store *Store
+	mu    sync.Mutex
+}
+
+func NewUnitOfWork(store *Store) *UnitOfWork {
+	return &UnitOfWork{store: store}
+}
+
+type unitOfWorkKey struct{}
+
+// Do выполняет fn с репозиториями хранилища. Вложенный вызов с контекстом, полученным fn,
+// при ошибке откатывает только свои изменения.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos services.Repositories) error) error {
+	if ctx.Value(unitOfWorkKey{}) != u {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		ctx = context.WithValue(ctx, unitOfWorkKey{}, u)
+	}
+
+	snapshot := u.store.snapshot()
+	repos := services.Repositories{
+		Users:     NewUserRepository(u.store),
+		Fiscal:    NewFiscalRepository(u.store),
+		Terminals: NewTerminalRepository(u.store),
+	}
+	if err := fn(ctx, repos); err != nil {
+		u.store.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// snapshot копирует все таблицы хранилища вместе со строками
+func (s *Store) snapshot() *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tables()
+}
+
+// restore возвращает хранилище к снимку
+func (s *Store) restore(snapshot *Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setTables(snapshot)
+}
+
+// tables выполняет snapshot под уже взятой блокировкой
+func (s *Store) tables() *Store {
+	return &Store{
+		seq:               cloneMap(s.seq),
+		users:             cloneRows(s.users),
+		companies:         cloneRows(s.companies),
+		sessions:          cloneRows(s.sessions),
+		modules:           cloneRows(s.modules),
+		lastReceiptNumber: cloneMap(s.lastReceiptNumber),
+		lastZReport:       cloneMap(s.lastZReport),
+		terminals:         cloneRows(s.terminals),
+		bindings:          cloneList(s.bindings),
+		statusChanges:     cloneList(s.statusChanges),
+		movements:         cloneList(s.movements),
+		shifts:            cloneRows(s.shifts),
+		zReports:          cloneList(s.zReports),
+		receipts:          cloneRows(s.receipts),
+		outbox:            cloneRows(s.outbox),
+		audit:             cloneList(s.audit),
+		imports:           cloneRows(s.imports),
+	}
+}
+
+// setTables выполняет restore под уже взятой блокировкой
+func (s *Store) setTables(snapshot *Store) {
+	s.seq = snapshot.seq
+	s.users = snapshot.users
+	s.companies = snapshot.companies
+	s.sessions = snapshot.sessions
+	s.modules = snapshot.modules
+	s.lastReceiptNumber = snapshot.lastReceiptNumber
+	s.lastZReport = snapshot.lastZReport
+	s.terminals = snapshot.terminals
+	s.bindings = snapshot.bindings
+	s.statusChanges = snapshot.statusChanges
+	s.movements = snapshot.movements
+	s.shifts = snapshot.shifts
+	s.zReports = snapshot.zReports
+	s.receipts = snapshot.receipts
+	s.outbox = snapshot.outbox
+	s.audit = snapshot.audit
+	s.imports = snapshot.imports
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneRows[T any](rows map[int]*T) map[int]*T {
+	clone := make(map[int]*T, len(rows))
+	for id, row := range rows {
+		copied := *row
+		clone[id] = &copied
+	}
+	return clone
+}
+
+func cloneList[T any](rows []*T) []*T {
+	clone := make([]*T, 0, len(rows))
+	for _, row := range rows {
+		copied := *row
+		clone = append(clone, &copied)
+	}
+	return clone
+}
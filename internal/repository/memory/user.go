@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+var userSorts = sortKeys[models.User]{
+	"id":       func(u *models.User) interface{} { return u.ID },
+	"inn":      func(u *models.User) interface{} { return u.INN },
+	"username": func(u *models.User) interface{} { return u.Username },
+}
+
+// List возвращает страницу пользователей, удовлетворяющих фильтру
+func (r *UserRepository) List(ctx context.Context, filter models.UserFilter) (*models.UserList, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []models.User{}
+	for _, user := range s.users {
+		switch {
+		case filter.INN != "" && user.INN != filter.INN,
+			filter.Username != "" && !containsFold(user.Username, filter.Username),
+			filter.Role != "" && user.Role != filter.Role,
+			filter.IsActive != nil && user.IsActive != *filter.IsActive:
+			continue
+		}
+		users = append(users, *user)
+	}
+
+	items, total, next, err := page(users, userSorts, filter.ListParams, func(u *models.User) int { return u.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserList{Items: models.NewUserResponses(items), Total: total, NextCursor: next}, nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Create добавляет пользователя и записывает создание в журнал аудита.
+// Компания с ИНН пользователя создаётся, если её ещё нет.
+func (r *UserRepository) Create(ctx context.Context, user *models.User, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUsername(user.Username, 0); err != nil {
+		return err
+	}
+	if err := s.ensureCompany(user.INN, "", meta); err != nil {
+		return err
+	}
+
+	user.ID = s.nextID("users")
+	user.Version = 1
+	stored := *user
+	s.users[user.ID] = &stored
+	return s.writeAudit(meta, models.AuditUser, user.ID, models.AuditCreate, nil, user)
+}
+
+// Update перезаписывает пользователя, если его версия всё ещё равна user.Version, и увеличивает версию
+func (r *UserRepository) Update(ctx context.Context, user *models.User, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, user.Version); err != nil {
+		return err
+	}
+	if err := s.checkUsername(user.Username, user.ID); err != nil {
+		return err
+	}
+	if user.INN != before.INN {
+		if err := s.ensureCompany(user.INN, "", meta); err != nil {
+			return err
+		}
+	}
+
+	user.Version = before.Version + 1
+	stored := *user
+	s.users[user.ID] = &stored
+	return s.writeAudit(meta, models.AuditUser, user.ID, models.AuditUpdate, before, user)
+}
+
+// Delete удаляет пользователя версии version. Пользователя, за которым закреплены
+// торговые точки или фискальные модули, удалить нельзя; его сессии удаляются.
+func (r *UserRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+	for _, terminal := range s.terminals {
+		if terminal.UserID == id {
+			return stillReferenced("terminals", "terminals_user_id_fkey", id)
+		}
+	}
+	for _, module := range s.modules {
+		if module.UserID == id {
+			return stillReferenced("fiscal_modules", "fiscal_modules_user_id_fkey", id)
+		}
+	}
+
+	delete(s.users, id)
+	for sessionID, session := range s.sessions {
+		if session.UserID == id {
+			delete(s.sessions, sessionID)
+		}
+	}
+	// Ссылки журналов на пользователя обнуляются, как ON DELETE SET NULL
+	clearActor := func(actorID **int) {
+		if *actorID != nil && **actorID == id {
+			*actorID = nil
+		}
+	}
+	for _, change := range s.statusChanges {
+		clearActor(&change.ActorID)
+	}
+	for _, movement := range s.movements {
+		clearActor(&movement.ActorID)
+	}
+	for _, shift := range s.shifts {
+		clearActor(&shift.OpenedBy)
+		clearActor(&shift.ClosedBy)
+	}
+	return s.writeAudit(meta, models.AuditUser, id, models.AuditDelete, before, nil)
+}
+
+// checkUsername проверяет уникальность имени пользователя среди всех, кроме exceptID
+func (s *Store) checkUsername(username string, exceptID int) error {
+	for _, other := range s.users {
+		if other.ID != exceptID && other.Username == username {
+			return uniqueViolation("users", "users_username_key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type OutboxRepository struct {
+	db conn
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: pool{db}}
+}
+
+const outboxColumns = "id, kind, receipt_id, z_report_id, status, attempts, next_attempt_at, last_error, ack_id, acknowledged_at, created_at"
+
+var outboxPage = pageSpec{
+	table:   "ofd_outbox",
+	columns: outboxColumns,
+	sorts: map[string]sortColumn{
+		"id":              {expr: "id", cast: "int"},
+		"next_attempt_at": {expr: "next_attempt_at", cast: "timestamp"},
+		"attempts":        {expr: "attempts", cast: "int"},
+	},
+}
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, delivery *models.OFDDelivery, extra ...interface{}) error {
+	dest := []interface{}{&delivery.ID, &delivery.Kind, &delivery.ReceiptID, &delivery.ZReportID, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError, &delivery.AckID, &delivery.AcknowledgedAt, &delivery.CreatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// enqueueOFD ставит документ в очередь отправки в ОФД в рамках транзакции, сохраняющей сам документ
+func enqueueOFD(ctx context.Context, tx executor, kind models.OFDDocumentKind, documentID int, document interface{}) error {
+	payload, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	var receiptID, zReportID *int
+	if kind == models.OFDReceipt {
+		receiptID = &documentID
+	} else {
+		zReportID = &documentID
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO ofd_outbox (kind, receipt_id, z_report_id, payload) VALUES ($1, $2, $3, $4)", kind, receiptID, zReportID, payload)
+	return err
+}
+
+// Claim забирает до limit документов, срок отправки которых наступил, и откладывает их
+// следующую попытку на lease. Если обработчик не отчитается за это время, документ
+// будет взят повторно. Параллельные вызовы не получают одни и те же строки.
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OFDDocument, error) {
+	query := `UPDATE ofd_outbox SET next_attempt_at = now() + make_interval(secs => $2), updated_at = now()
+		WHERE id IN (
+			SELECT id FROM ofd_outbox
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []models.OFDDocument
+	for rows.Next() {
+		var document models.OFDDocument
+		if err := rows.Scan(&document.ID, &document.Kind, &document.Payload, &document.Attempts); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// Acknowledge отмечает документ доставленным и сохраняет номер квитанции ОФД
+func (r *OutboxRepository) Acknowledge(ctx context.Context, id int, ackID string) error {
+	query := "UPDATE ofd_outbox SET status='acknowledged', attempts=attempts+1, ack_id=$2, acknowledged_at=now(), last_error=NULL, updated_at=now() WHERE id=$1 AND status='pending'"
+	return requireAffected(r.db.ExecContext(ctx, query, id, ackID))
+}
+
+// Reschedule записывает неудачную попытку и назначает следующую на retryAt
+func (r *OutboxRepository) Reschedule(ctx context.Context, id int, retryAt time.Time, reason string) error {
+	query := "UPDATE ofd_outbox SET attempts=attempts+1, next_attempt_at=$2::timestamptz, last_error=$3, updated_at=now() WHERE id=$1 AND status='pending'"
+	return requireAffected(r.db.ExecContext(ctx, query, id, retryAt, reason))
+}
+
+// DeadLetter прекращает попытки доставки документа
+func (r *OutboxRepository) DeadLetter(ctx context.Context, id int, reason string) error {
+	query := "UPDATE ofd_outbox SET status='dead', attempts=attempts+1, last_error=$2, updated_at=now() WHERE id=$1 AND status='pending'"
+	return requireAffected(r.db.ExecContext(ctx, query, id, reason))
+}
+
+// Requeue возвращает недоставленный документ в очередь с обнулённым счётчиком попыток
+func (r *OutboxRepository) Requeue(ctx context.Context, id int) (*models.OFDDelivery, error) {
+	query := "UPDATE ofd_outbox SET status='pending', attempts=0, next_attempt_at=now(), updated_at=now() WHERE id=$1 AND status='dead' RETURNING " + outboxColumns
+	var delivery models.OFDDelivery
+	if err := scanDelivery(r.db.QueryRowContext(ctx, query, id), &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// List возвращает страницу очереди отправки в ОФД
+func (r *OutboxRepository) List(ctx context.Context, filter models.OFDDeliveryFilter) (*models.OFDDeliveryList, error) {
+	where := &whereBuilder{}
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	if filter.Kind != "" {
+		where.add("kind = ?", filter.Kind)
+	}
+
+	items, total, next, err := fetchPage(ctx, r.db, outboxPage, where, filter.ListParams,
+		func(rows *sql.Rows, delivery *models.OFDDelivery, sortKey *string) error {
+			return scanDelivery(rows, delivery, sortKey)
+		},
+		func(delivery *models.OFDDelivery) int { return delivery.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &models.OFDDeliveryList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// deliveryForReceipt возвращает состояние доставки чека в ОФД или nil, если чек не ставился в очередь
+func deliveryForReceipt(ctx context.Context, q queryer, receiptID int) (*models.OFDDelivery, error) {
+	var delivery models.OFDDelivery
+	err := scanDelivery(q.QueryRowContext(ctx, "SELECT "+outboxColumns+" FROM ofd_outbox WHERE receipt_id=$1", receiptID), &delivery)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+var (
+	ErrInvalidSort   = apperrors.New(apperrors.CodeBadRequest, "Unsupported sort field")
+	ErrInvalidCursor = apperrors.New(apperrors.CodeBadRequest, "Invalid or stale cursor")
+)
+
+// whereBuilder собирает условия WHERE с нумерованными параметрами.
+// Условия — константные фрагменты SQL с плейсхолдерами "?", значения передаются только как параметры.
+type whereBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+func (b *whereBuilder) add(cond string, args ...interface{}) {
+	for _, arg := range args {
+		b.args = append(b.args, arg)
+		cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(b.args)), 1)
+	}
+	b.conds = append(b.conds, cond)
+}
+
+func (b *whereBuilder) sql() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// containsPattern превращает подстроку в шаблон ILIKE, экранируя спецсимволы
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// sortColumn описывает допустимое поле сортировки: выражение SQL и тип для сравнения с курсором
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+// pageCursor — позиция последней строки страницы. Курсор действителен только для той же сортировки.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// pageSpec описывает таблицу, для которой строится постраничная выборка
+type pageSpec struct {
+	table   string
+	columns string
+	sorts   map[string]sortColumn
+}
+
+// fetchPage выполняет keyset-выборку: сортировка по (поле, id), курсор задаёт последнюю
+// увиденную пару. Возвращает строки страницы, общее число строк под фильтрами и курсор следующей страницы.
+func fetchPage[T any](ctx context.Context, db queryer, spec pageSpec, where *whereBuilder, params models.ListParams,
+	scan func(rows *sql.Rows, item *T, sortKey *string) error, idOf func(item *T) int) ([]T, int, string, error) {
+	sortName := params.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	column, ok := spec.sorts[sortName]
+	if !ok {
+		return nil, 0, "", ErrInvalidSort
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM " + spec.table + where.sql()
+	if err := db.QueryRowContext(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, "", err
+	}
+
+	direction, comparison := "ASC", ">"
+	if params.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != "" {
+		cursor, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if cursor.Sort != sortName || cursor.Desc != params.Desc {
+			return nil, 0, "", ErrInvalidCursor
+		}
+		where.add(fmt.Sprintf("(%s, id) %s (?::%s, ?)", column.expr, comparison, column.cast), cursor.Value, cursor.ID)
+	}
+
+	query := fmt.Sprintf("SELECT %s, (%s)::text FROM %s%s ORDER BY %s %s, id %s LIMIT %d",
+		spec.columns, column.expr, spec.table, where.sql(), column.expr, direction, direction, limit+1)
+	rows, err := db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer rows.Close()
+
+	items := make([]T, 0, limit)
+	var lastKey string
+	for rows.Next() {
+		var item T
+		var sortKey string
+		if err := scan(rows, &item, &sortKey); err != nil {
+			return nil, 0, "", err
+		}
+		if len(items) == limit {
+			// Лишняя строка только подтверждает наличие следующей страницы
+			last := &items[len(items)-1]
+			next := encodeCursor(pageCursor{Sort: sortName, Desc: params.Desc, Value: lastKey, ID: idOf(last)})
+			return items, total, next, rows.Err()
+		}
+		items = append(items, item)
+		lastKey = sortKey
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, "", err
+	}
+	return items, total, "", nil
+}
+
+// streamAll выполняет выборку под фильтрами без деления на страницы в порядке сортировки params
+// и передаёт строки fn по одной, не накапливая их в памяти. Ошибка fn прерывает выборку.
+func streamAll[T any](ctx context.Context, db queryer, spec pageSpec, where *whereBuilder, params models.ListParams,
+	scan func(rows *sql.Rows, item *T) error, fn func(item *T) error) error {
+	sortName := params.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	column, ok := spec.sorts[sortName]
+	if !ok {
+		return ErrInvalidSort
+	}
+	direction := "ASC"
+	if params.Desc {
+		direction = "DESC"
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, id %s",
+		spec.columns, spec.table, where.sql(), column.expr, direction, direction)
+	rows, err := db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return err
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
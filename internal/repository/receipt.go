@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+var (
+	// ErrModuleNotBound возвращается, если модуль чека не привязан к торговой точке, передавшей чек
+	ErrModuleNotBound = &apperrors.Error{Code: apperrors.CodeConflict, Message: "Fiscal module is not bound to this terminal", Field: "module_number"}
+	// ErrReceiptNumberOutOfOrder возвращается, если номер чека не больше последнего принятого номера модуля
+	ErrReceiptNumberOutOfOrder = &apperrors.Error{Code: apperrors.CodeConflict, Message: "Receipt number must be greater than the last accepted receipt number of the fiscal module", Field: "receipt_number"}
+	// ErrShiftModuleChanged возвращается, если модуль точки сменился после открытия смены
+	ErrShiftModuleChanged = &apperrors.Error{Code: apperrors.CodeConflict, Message: "Fiscal module changed during the shift; close the shift and open a new one", Field: "module_number"}
+)
+
+type ReceiptRepository struct {
+	db conn
+}
+
+func NewReceiptRepository(db *sql.DB) *ReceiptRepository {
+	return &ReceiptRepository{db: pool{db}}
+}
+
+const receiptColumns = "id, terminal_id, shift_id, fiscal_module_id, module_number, receipt_number, type, inn, total, vat_total, fiscal_sign, issued_at, created_at"
+
+var receiptPage = pageSpec{
+	table:   "receipts",
+	columns: receiptColumns,
+	sorts: map[string]sortColumn{
+		"id":             {expr: "id", cast: "int"},
+		"issued_at":      {expr: "issued_at", cast: "timestamp"},
+		"receipt_number": {expr: "receipt_number", cast: "bigint"},
+		"total":          {expr: "total", cast: "bigint"},
+	},
+}
+
+// Create сохраняет чек вместе с позициями и оплатами. В одной транзакции проверяет, что модуль
+// привязан к торговой точке, что у точки открыта смена не дольше MaxShiftDuration,
+// что номер чека больше последнего принятого номера модуля, и списывает одну бесплатную
+// запись с баланса точки. Чек ставится в очередь отправки в ОФД той же транзакцией.
+// Смена блокируется на чтение, чтобы её нельзя было закрыть,
+// пока чек не сохранён.
+// Если ownerID задан, чек принимается только от точки этого владельца.
+func (r *ReceiptRepository) Create(ctx context.Context, receipt *models.Receipt, ownerID *int) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var boundModuleID sql.NullInt64
+	var userID int
+	err = tx.QueryRowContext(ctx, "SELECT fiscal_module_id, inn, user_id FROM terminals WHERE id=$1 FOR UPDATE", receipt.TerminalID).Scan(&boundModuleID, &receipt.INN, &userID)
+	if err != nil {
+		return err
+	}
+	if ownerID != nil && *ownerID != userID {
+		return sql.ErrNoRows
+	}
+	if !boundModuleID.Valid || int(boundModuleID.Int64) != receipt.FiscalModuleID {
+		return ErrModuleNotBound
+	}
+
+	var shiftID, shiftModuleID int
+	var expired bool
+	query := "SELECT id, fiscal_module_id, opened_at < now() - make_interval(secs => $2) FROM shifts WHERE terminal_id=$1 AND closed_at IS NULL FOR SHARE"
+	err = tx.QueryRowContext(ctx, query, receipt.TerminalID, models.MaxShiftDuration.Seconds()).Scan(&shiftID, &shiftModuleID, &expired)
+	if err == sql.ErrNoRows {
+		return ErrNoOpenShift
+	}
+	if err != nil {
+		return err
+	}
+	if expired {
+		return ErrShiftExpired
+	}
+	if shiftModuleID != receipt.FiscalModuleID {
+		return ErrShiftModuleChanged
+	}
+	receipt.ShiftID = &shiftID
+
+	var lastNumber int64
+	err = tx.QueryRowContext(ctx, "SELECT last_receipt_number FROM fiscal_modules WHERE id=$1 FOR UPDATE", receipt.FiscalModuleID).Scan(&lastNumber)
+	if err != nil {
+		return err
+	}
+	if receipt.ReceiptNumber <= lastNumber {
+		return ErrReceiptNumberOutOfOrder
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE fiscal_modules SET last_receipt_number=$1, updated_at=now() WHERE id=$2", receipt.ReceiptNumber, receipt.FiscalModuleID)
+	if err != nil {
+		return err
+	}
+
+	query = "INSERT INTO receipts (terminal_id, shift_id, fiscal_module_id, module_number, receipt_number, type, inn, total, vat_total, fiscal_sign, issued_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::timestamptz) RETURNING id, created_at"
+	err = tx.QueryRowContext(ctx, query, receipt.TerminalID, receipt.ShiftID, receipt.FiscalModuleID, receipt.ModuleNumber, receipt.ReceiptNumber, receipt.Type, receipt.INN, receipt.Total, receipt.VATTotal, receipt.FiscalSign, receipt.IssuedAt).Scan(&receipt.ID, &receipt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range receipt.Items {
+		query := "INSERT INTO receipt_items (receipt_id, position, name, quantity, price, vat_rate, vat_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+		_, err := tx.ExecContext(ctx, query, receipt.ID, i+1, item.Name, item.Quantity, item.Price, item.VATRate, item.VATAmount, item.Total)
+		if err != nil {
+			return err
+		}
+	}
+	for _, payment := range receipt.Payments {
+		query := "INSERT INTO receipt_payments (receipt_id, type, amount) VALUES ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, query, receipt.ID, payment.Type, payment.Amount); err != nil {
+			return err
+		}
+	}
+
+	if err := enqueueOFD(ctx, tx, models.OFDReceipt, receipt.ID, receipt); err != nil {
+		return err
+	}
+
+	consumption := &models.BalanceMovement{
+		TerminalID: receipt.TerminalID,
+		Kind:       models.BalanceMovementConsumption,
+		Amount:     -1,
+		Reason:     fmt.Sprintf("receipt %d of module %s", receipt.ReceiptNumber, receipt.ModuleNumber),
+	}
+	if err := applyBalanceMovement(ctx, tx, consumption); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// receiptWhere строит условия выборки чеков по фильтру
+func receiptWhere(filter models.ReceiptFilter) *whereBuilder {
+	where := &whereBuilder{}
+	if filter.TerminalID != nil {
+		where.add("terminal_id = ?", *filter.TerminalID)
+	}
+	if filter.FiscalModuleID != nil {
+		where.add("fiscal_module_id = ?", *filter.FiscalModuleID)
+	}
+	if filter.UserID != nil {
+		where.add("terminal_id IN (SELECT id FROM terminals WHERE user_id = ?)", *filter.UserID)
+	}
+	if filter.INN != "" {
+		where.add("inn = ?", filter.INN)
+	}
+	if filter.Type != "" {
+		where.add("type = ?", filter.Type)
+	}
+	if filter.IssuedFrom != nil {
+		where.add("issued_at >= ?::timestamptz", *filter.IssuedFrom)
+	}
+	if filter.IssuedTo != nil {
+		where.add("issued_at < ?::timestamptz", *filter.IssuedTo)
+	}
+	return where
+}
+
+func scanReceiptInto(row interface{ Scan(...interface{}) error }, receipt *models.Receipt, extra ...interface{}) error {
+	dest := []interface{}{&receipt.ID, &receipt.TerminalID, &receipt.ShiftID, &receipt.FiscalModuleID, &receipt.ModuleNumber, &receipt.ReceiptNumber, &receipt.Type, &receipt.INN, &receipt.Total, &receipt.VATTotal, &receipt.FiscalSign, &receipt.IssuedAt, &receipt.CreatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// List возвращает страницу чеков без позиций и оплат
+func (r *ReceiptRepository) List(ctx context.Context, filter models.ReceiptFilter) (*models.ReceiptList, error) {
+	items, total, next, err := fetchPage(ctx, r.db, receiptPage, receiptWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, receipt *models.Receipt, sortKey *string) error {
+			return scanReceiptInto(rows, receipt, sortKey)
+		},
+		func(receipt *models.Receipt) int { return receipt.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &models.ReceiptList{Items: items, Total: total, NextCursor: next}, nil
+}
+
+// Export передаёт fn заголовки всех чеков под фильтром в порядке его сортировки,
+// без позиций и оплат
+func (r *ReceiptRepository) Export(ctx context.Context, filter models.ReceiptFilter, fn func(receipt *models.Receipt) error) error {
+	return streamAll(ctx, r.db, receiptPage, receiptWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, receipt *models.Receipt) error {
+			return scanReceiptInto(rows, receipt)
+		}, fn)
+}
+
+// GetByID возвращает чек вместе с позициями, оплатами и состоянием доставки в ОФД.
+// Если ownerID задан, чеки чужих торговых точек считаются ненайденными.
+func (r *ReceiptRepository) GetByID(ctx context.Context, id int, ownerID *int) (*models.Receipt, error) {
+	query := "SELECT " + receiptColumns + " FROM receipts WHERE id=$1 AND ($2::int IS NULL OR terminal_id IN (SELECT id FROM terminals WHERE user_id=$2))"
+	var receipt models.Receipt
+	err := scanReceiptInto(r.db.QueryRowContext(ctx, query, id, ownerID), &receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT name, quantity, price, vat_rate, vat_amount, total FROM receipt_items WHERE receipt_id=$1 ORDER BY position", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.ReceiptItem
+		if err := rows.Scan(&item.Name, &item.Quantity, &item.Price, &item.VATRate, &item.VATAmount, &item.Total); err != nil {
+			return nil, err
+		}
+		receipt.Items = append(receipt.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	payments, err := r.db.QueryContext(ctx, "SELECT type, amount FROM receipt_payments WHERE receipt_id=$1 ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer payments.Close()
+	for payments.Next() {
+		var payment models.ReceiptPayment
+		if err := payments.Scan(&payment.Type, &payment.Amount); err != nil {
+			return nil, err
+		}
+		receipt.Payments = append(receipt.Payments, payment)
+	}
+	if err := payments.Err(); err != nil {
+		return nil, err
+	}
+
+	if receipt.OFD, err = deliveryForReceipt(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
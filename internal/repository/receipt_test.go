@@ -0,0 +1,409 @@
+package repository_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+// newReceipt описывает чек из одной позиции со ставкой НДС 12%, оплаченный наличными и картой
+func newReceipt(terminalID int, module *models.FiscalModule, number int64, kind models.ReceiptType, total int64, issuedAt time.Time) *models.Receipt {
+	vat := total * 12 / 112
+	card := total / 2
+	return &models.Receipt{
+		TerminalID:     terminalID,
+		FiscalModuleID: module.ID,
+		ModuleNumber:   module.FiscalNumber,
+		ReceiptNumber:  number,
+		Type:           kind,
+		Total:          total,
+		VATTotal:       vat,
+		FiscalSign:     fmt.Sprintf("sign-%d", number),
+		IssuedAt:       issuedAt,
+		Items:          []models.ReceiptItem{{Name: "Bread", Quantity: 2, Price: total / 2, VATRate: 12, VATAmount: vat, Total: total}},
+		Payments:       []models.ReceiptPayment{{Type: models.PaymentCash, Amount: total - card}, {Type: models.PaymentCard, Amount: card}},
+	}
+}
+
+func TestShiftsAndReceipts(t *testing.T) {
+	db := newTestDB(t)
+	terminals := repository.NewTerminalRepository(db)
+	receipts := repository.NewReceiptRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+	first := createModule(t, db, "F-1", "FN-1", owner.ID)
+	second := createModule(t, db, "F-2", "FN-2", owner.ID)
+	terminal := createTerminal(t, db, "CR-1", &first.ID, owner.ID)
+	unbound := createTerminal(t, db, "CR-2", nil, owner.ID)
+
+	base := time.Now().Truncate(time.Second)
+	east := time.FixedZone("UTC+5", 5*60*60)
+	var shift *models.Shift
+	var sale, refund, moved *models.Receipt
+
+	t.Run("open shift", func(t *testing.T) {
+		_, err := terminals.OpenShift(ctx, terminal.ID, &owner.ID)
+		expectError(t, err, apperrors.CodeConflict, "")
+		changeStatus(t, db, terminal.ID, models.TerminalRegistered, models.TerminalActive)
+		changeStatus(t, db, unbound.ID, models.TerminalRegistered, models.TerminalActive)
+		_, err = terminals.OpenShift(ctx, unbound.ID, nil)
+		expectError(t, err, apperrors.CodeConflict, "")
+		_, err = terminals.OpenShift(ctx, 999, nil)
+		expectError(t, err, apperrors.CodeNotFound, "")
+
+		shift, err = terminals.OpenShift(ctx, terminal.ID, &owner.ID)
+		mustNot(t, err)
+		if shift.TerminalID != terminal.ID || shift.FiscalModuleID != first.ID || shift.ClosedAt != nil || shift.OpenedBy == nil || *shift.OpenedBy != owner.ID {
+			t.Errorf("opened shift %+v", shift)
+		}
+		_, err = terminals.OpenShift(ctx, terminal.ID, nil)
+		expectError(t, err, apperrors.CodeConflict, "")
+
+		open, err := terminals.GetOpenShift(ctx, terminal.ID)
+		mustNot(t, err)
+		if open.ID != shift.ID || !open.OpenedAt.Equal(shift.OpenedAt) {
+			t.Errorf("open shift %+v, want %+v", open, shift)
+		}
+		_, err = terminals.GetOpenShift(ctx, unbound.ID)
+		expectError(t, err, apperrors.CodeConflict, "")
+	})
+
+	t.Run("create receipt", func(t *testing.T) {
+		sale = newReceipt(terminal.ID, first, 1, models.ReceiptSale, 1000, base.Add(-2*time.Hour).In(east))
+		mustNot(t, receipts.Create(ctx, sale, &owner.ID))
+		if sale.ID == 0 || sale.ShiftID == nil || *sale.ShiftID != shift.ID || sale.INN != innSpare || sale.CreatedAt.IsZero() {
+			t.Errorf("created receipt %+v", sale)
+		}
+
+		cases := []struct {
+			name    string
+			receipt *models.Receipt
+			ownerID *int
+			code    apperrors.Code
+			field   string
+		}{
+			{"repeated number", newReceipt(terminal.ID, first, 1, models.ReceiptSale, 100, base), nil, apperrors.CodeConflict, "receipt_number"},
+			{"foreign module", newReceipt(terminal.ID, second, 2, models.ReceiptSale, 100, base), nil, apperrors.CodeConflict, "module_number"},
+			{"terminal without module", newReceipt(unbound.ID, first, 2, models.ReceiptSale, 100, base), nil, apperrors.CodeConflict, "module_number"},
+			{"foreign owner", newReceipt(terminal.ID, first, 2, models.ReceiptSale, 100, base), &other.ID, apperrors.CodeNotFound, ""},
+			{"missing terminal", newReceipt(999, first, 2, models.ReceiptSale, 100, base), nil, apperrors.CodeNotFound, ""},
+			{"negative total", newReceipt(terminal.ID, first, 2, models.ReceiptSale, -100, base), nil, apperrors.CodeValidation, ""},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				expectError(t, receipts.Create(ctx, tc.receipt, tc.ownerID), tc.code, tc.field)
+			})
+		}
+
+		// Отклонённые чеки не сдвигают номер модуля и не списывают баланс
+		refund = newReceipt(terminal.ID, first, 2, models.ReceiptRefund, 300, base.Add(-time.Hour))
+		refund.Items[0].VATRate, refund.Items[0].VATAmount, refund.VATTotal = 0, 0, 0
+		mustNot(t, receipts.Create(ctx, refund, nil))
+		stored, err := terminals.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.FreeRecordBalance != 8 {
+			t.Errorf("balance %d after two receipts, want 8", stored.FreeRecordBalance)
+		}
+	})
+
+	t.Run("shift report", func(t *testing.T) {
+		report, err := terminals.ShiftReport(ctx, terminal.ID)
+		mustNot(t, err)
+		if report.ShiftID != shift.ID || report.ClosedAt != nil || report.SaleCount != 1 || report.RefundCount != 1 {
+			t.Errorf("report %+v", report)
+		}
+		if report.SalesTotal != 1000 || report.RefundsTotal != 300 || report.NetTotal != 700 || report.SalesVAT != 107 || report.RefundsVAT != 0 {
+			t.Errorf("report totals %+v", report)
+		}
+		wantPayments := []models.PaymentTotals{{Type: models.PaymentCard, Sales: 500, Refunds: 150}, {Type: models.PaymentCash, Sales: 500, Refunds: 150}}
+		if fmt.Sprint(report.ByPaymentType) != fmt.Sprint(wantPayments) {
+			t.Errorf("payment totals %+v, want %+v", report.ByPaymentType, wantPayments)
+		}
+		wantRates := []models.VATRateTotals{{Rate: 0, Refunds: 300}, {Rate: 12, Sales: 1000, SalesVAT: 107}}
+		if fmt.Sprint(report.ByVATRate) != fmt.Sprint(wantRates) {
+			t.Errorf("VAT totals %+v, want %+v", report.ByVATRate, wantRates)
+		}
+
+		_, err = terminals.ShiftReport(ctx, unbound.ID)
+		expectError(t, err, apperrors.CodeConflict, "")
+	})
+
+	t.Run("close shift", func(t *testing.T) {
+		// Модуль сменился посреди смены: чеки нового модуля не принимаются до её закрытия
+		current, err := terminals.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		current.FiscalModuleID = &second.ID
+		mustNot(t, terminals.Update(ctx, current, meta))
+		moved = newReceipt(terminal.ID, second, 1, models.ReceiptSale, 500, base.Add(-30*time.Minute))
+		expectError(t, receipts.Create(ctx, moved, nil), apperrors.CodeConflict, "module_number")
+
+		report, err := terminals.CloseShift(ctx, terminal.ID, &other.ID)
+		mustNot(t, err)
+		if report.ID == 0 || report.ReportNumber != 1 || report.Report.ShiftID != shift.ID || report.Report.ClosedAt == nil || report.Report.NetTotal != 700 {
+			t.Errorf("Z-report %+v", report)
+		}
+		_, err = terminals.CloseShift(ctx, terminal.ID, nil)
+		expectError(t, err, apperrors.CodeConflict, "")
+		expectError(t, receipts.Create(ctx, moved, nil), apperrors.CodeConflict, "")
+
+		// Новая смена открывается на новом модуле, нумерация Z-отчётов у модуля своя
+		next, err := terminals.OpenShift(ctx, terminal.ID, nil)
+		mustNot(t, err)
+		if next.FiscalModuleID != second.ID {
+			t.Errorf("shift opened on module %d, want %d", next.FiscalModuleID, second.ID)
+		}
+		mustNot(t, receipts.Create(ctx, moved, nil))
+		nextReport, err := terminals.CloseShift(ctx, terminal.ID, nil)
+		mustNot(t, err)
+		if nextReport.ReportNumber != 1 || nextReport.Report.SaleCount != 1 {
+			t.Errorf("Z-report %+v", nextReport)
+		}
+
+		reports, err := terminals.GetZReports(ctx, terminal.ID)
+		mustNot(t, err)
+		if len(reports) != 2 || reports[0].ID != report.ID || reports[1].ID != nextReport.ID {
+			t.Fatalf("Z-reports %+v", reports)
+		}
+		if !reports[0].Report.ClosedAt.Equal(*report.Report.ClosedAt) || reports[0].Report.SalesTotal != 1000 || reports[0].Report.FiscalModuleID != first.ID {
+			t.Errorf("stored Z-report %+v, want %+v", reports[0], report)
+		}
+		none, err := terminals.GetZReports(ctx, unbound.ID)
+		mustNot(t, err)
+		if none == nil || len(none) != 0 {
+			t.Errorf("Z-reports of a terminal without shifts: %#v", none)
+		}
+	})
+
+	t.Run("expired shift", func(t *testing.T) {
+		_, err := terminals.OpenShift(ctx, terminal.ID, nil)
+		mustNot(t, err)
+		_, err = db.ExecContext(ctx, "UPDATE shifts SET opened_at = now() - interval '25 hours' WHERE terminal_id=$1 AND closed_at IS NULL", terminal.ID)
+		mustNot(t, err)
+		late := newReceipt(terminal.ID, second, 2, models.ReceiptSale, 100, base)
+		expectError(t, receipts.Create(ctx, late, nil), apperrors.CodeConflict, "")
+		_, err = terminals.CloseShift(ctx, terminal.ID, nil)
+		mustNot(t, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		between := base.Add(-90 * time.Minute).In(east)
+		cases := []struct {
+			name   string
+			filter models.ReceiptFilter
+			want   []int
+		}{
+			{"all", models.ReceiptFilter{}, []int{sale.ID, refund.ID, moved.ID}},
+			{"by terminal", models.ReceiptFilter{TerminalID: &terminal.ID}, []int{sale.ID, refund.ID, moved.ID}},
+			{"by module", models.ReceiptFilter{FiscalModuleID: &second.ID}, []int{moved.ID}},
+			{"by owner", models.ReceiptFilter{UserID: &owner.ID}, []int{sale.ID, refund.ID, moved.ID}},
+			{"by foreign owner", models.ReceiptFilter{UserID: &other.ID}, nil},
+			{"by INN", models.ReceiptFilter{INN: innSpare}, []int{sale.ID, refund.ID, moved.ID}},
+			{"refunds", models.ReceiptFilter{Type: models.ReceiptRefund}, []int{refund.ID}},
+			{"issued since", models.ReceiptFilter{IssuedFrom: &between}, []int{refund.ID, moved.ID}},
+			{"issued before", models.ReceiptFilter{IssuedTo: &between}, []int{sale.ID}},
+			{"by total descending", models.ReceiptFilter{ListParams: models.ListParams{Sort: "total", Desc: true}}, []int{sale.ID, moved.ID, refund.ID}},
+			{"by issue time descending", models.ReceiptFilter{ListParams: models.ListParams{Sort: "issued_at", Desc: true}}, []int{moved.ID, refund.ID, sale.ID}},
+			{"by number", models.ReceiptFilter{ListParams: models.ListParams{Sort: "receipt_number"}}, []int{sale.ID, moved.ID, refund.ID}},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				params := tc.filter.ListParams
+				params.Limit = 1
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.Receipt, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := receipts.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(receipt models.Receipt) int { return receipt.ID })
+				expectIDs(t, ids, tc.want...)
+
+				var exported []int
+				mustNot(t, receipts.Export(ctx, tc.filter, func(receipt *models.Receipt) error {
+					if receipt.Items != nil || receipt.Payments != nil || receipt.OFD != nil {
+						t.Errorf("exported receipt %d with details", receipt.ID)
+					}
+					exported = append(exported, receipt.ID)
+					return nil
+				}))
+				expectIDs(t, exported, tc.want...)
+			})
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := receipts.GetByID(ctx, sale.ID, &owner.ID)
+		mustNot(t, err)
+		if !got.IssuedAt.Equal(sale.IssuedAt) || got.ReceiptNumber != 1 || got.FiscalSign != "sign-1" || *got.ShiftID != shift.ID {
+			t.Errorf("got %+v, want %+v", got, sale)
+		}
+		if fmt.Sprint(got.Items) != fmt.Sprint(sale.Items) || fmt.Sprint(got.Payments) != fmt.Sprint(sale.Payments) {
+			t.Errorf("got items %+v and payments %+v, want %+v and %+v", got.Items, got.Payments, sale.Items, sale.Payments)
+		}
+		if got.OFD == nil || got.OFD.Kind != models.OFDReceipt || got.OFD.Status != models.OFDPending || *got.OFD.ReceiptID != sale.ID {
+			t.Errorf("OFD delivery %+v", got.OFD)
+		}
+
+		_, err = receipts.GetByID(ctx, sale.ID, &other.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		_, err = receipts.GetByID(ctx, 999, nil)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("delete terminal with receipts", func(t *testing.T) {
+		current, err := terminals.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		expectError(t, terminals.Delete(ctx, terminal.ID, current.Version, meta), apperrors.CodeConflict, "")
+	})
+}
+
+func TestOutboxRepository(t *testing.T) {
+	db := newTestDB(t)
+	terminals := repository.NewTerminalRepository(db)
+	receipts := repository.NewReceiptRepository(db)
+	outbox := repository.NewOutboxRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	module := createModule(t, db, "F-1", "FN-1", owner.ID)
+	terminal := createTerminal(t, db, "CR-1", &module.ID, owner.ID)
+	changeStatus(t, db, terminal.ID, models.TerminalRegistered, models.TerminalActive)
+	_, err := terminals.OpenShift(ctx, terminal.ID, nil)
+	mustNot(t, err)
+	for number := int64(1); number <= 2; number++ {
+		mustNot(t, receipts.Create(ctx, newReceipt(terminal.ID, module, number, models.ReceiptSale, 1000, time.Now()), nil))
+	}
+	zReport, err := terminals.CloseShift(ctx, terminal.ID, nil)
+	mustNot(t, err)
+
+	claim := func(limit int) []int {
+		t.Helper()
+		documents, err := outbox.Claim(ctx, limit, time.Minute)
+		mustNot(t, err)
+		ids := []int{}
+		for _, document := range documents {
+			ids = append(ids, document.ID)
+		}
+		return ids
+	}
+	list, err := outbox.List(ctx, models.OFDDeliveryFilter{})
+	mustNot(t, err)
+	if list.Total != 3 {
+		t.Fatalf("%d queued documents, want 3", list.Total)
+	}
+	first, second, third := list.Items[0].ID, list.Items[1].ID, list.Items[2].ID
+
+	t.Run("claim", func(t *testing.T) {
+		documents, err := outbox.Claim(ctx, 2, time.Minute)
+		mustNot(t, err)
+		if len(documents) != 2 || documents[0].ID != first || documents[1].ID != second {
+			t.Fatalf("claimed %+v", documents)
+		}
+		var receipt models.Receipt
+		mustNot(t, json.Unmarshal(documents[1].Payload, &receipt))
+		if documents[1].Kind != models.OFDReceipt || receipt.ReceiptNumber != 2 || len(receipt.Items) != 1 {
+			t.Errorf("claimed document %s: %+v", documents[1].Kind, receipt)
+		}
+
+		// Взятые документы не выдаются повторно до истечения аренды
+		leased, err := outbox.Claim(ctx, 10, time.Minute)
+		mustNot(t, err)
+		var report models.ZReport
+		if len(leased) != 1 || leased[0].Kind != models.OFDZReport {
+			t.Fatalf("claimed %+v", leased)
+		}
+		mustNot(t, json.Unmarshal(leased[0].Payload, &report))
+		if report.ID != zReport.ID || report.Report.SaleCount != 2 {
+			t.Errorf("claimed Z-report %+v", report)
+		}
+		expectIDs(t, claim(10))
+	})
+
+	t.Run("acknowledge", func(t *testing.T) {
+		mustNot(t, outbox.Acknowledge(ctx, first, "ack-1"))
+		expectError(t, outbox.Acknowledge(ctx, first, "ack-2"), apperrors.CodeNotFound, "")
+		expectError(t, outbox.Acknowledge(ctx, 999, "ack-3"), apperrors.CodeNotFound, "")
+
+		list, err := outbox.List(ctx, models.OFDDeliveryFilter{Status: models.OFDAcknowledged})
+		mustNot(t, err)
+		if len(list.Items) != 1 {
+			t.Fatalf("acknowledged %+v", list.Items)
+		}
+		delivery := list.Items[0]
+		if delivery.ID != first || delivery.Attempts != 1 || delivery.AckID == nil || *delivery.AckID != "ack-1" || delivery.AcknowledgedAt == nil || delivery.LastError != nil {
+			t.Errorf("acknowledged delivery %+v", delivery)
+		}
+	})
+
+	t.Run("reschedule", func(t *testing.T) {
+		// Время повтора в другом поясе сравнивается как момент, а не как местное время
+		retryAt := time.Now().Add(-time.Minute).In(time.FixedZone("UTC+5", 5*60*60))
+		mustNot(t, outbox.Reschedule(ctx, second, retryAt, "timeout"))
+		expectError(t, outbox.Reschedule(ctx, first, retryAt, "timeout"), apperrors.CodeNotFound, "")
+
+		documents, err := outbox.Claim(ctx, 10, time.Minute)
+		mustNot(t, err)
+		if len(documents) != 1 || documents[0].ID != second || documents[0].Attempts != 1 {
+			t.Fatalf("claimed %+v", documents)
+		}
+
+		later := time.Now().Add(time.Hour).In(time.FixedZone("UTC-5", -5*60*60))
+		mustNot(t, outbox.Reschedule(ctx, second, later, "timeout"))
+		expectIDs(t, claim(10))
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		mustNot(t, outbox.DeadLetter(ctx, third, "rejected"))
+		expectError(t, outbox.DeadLetter(ctx, third, "rejected"), apperrors.CodeNotFound, "")
+		expectError(t, outbox.Reschedule(ctx, third, time.Now(), "timeout"), apperrors.CodeNotFound, "")
+
+		_, err := outbox.Requeue(ctx, first)
+		if err != sql.ErrNoRows {
+			t.Errorf("requeue of an acknowledged document: %v", err)
+		}
+		requeued, err := outbox.Requeue(ctx, third)
+		mustNot(t, err)
+		if requeued.Status != models.OFDPending || requeued.Attempts != 0 || requeued.LastError == nil || *requeued.LastError != "rejected" || requeued.ZReportID == nil {
+			t.Errorf("requeued %+v", requeued)
+		}
+		_, err = outbox.Requeue(ctx, third)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		expectIDs(t, claim(10), third)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			filter models.OFDDeliveryFilter
+			want   []int
+		}{
+			{"all", models.OFDDeliveryFilter{}, []int{first, second, third}},
+			{"pending", models.OFDDeliveryFilter{Status: models.OFDPending}, []int{second, third}},
+			{"Z-reports", models.OFDDeliveryFilter{Kind: models.OFDZReport}, []int{third}},
+			{"by attempts descending", models.OFDDeliveryFilter{ListParams: models.ListParams{Sort: "attempts", Desc: true}}, []int{second, first, third}},
+			{"by next attempt descending", models.OFDDeliveryFilter{ListParams: models.ListParams{Sort: "next_attempt_at", Desc: true}}, []int{second, third, first}},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				params := tc.filter.ListParams
+				params.Limit = 1
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.OFDDelivery, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := outbox.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(delivery models.OFDDelivery) int { return delivery.ID })
+				expectIDs(t, ids, tc.want...)
+			})
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type SessionRepository struct {
+	db conn
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: pool{db}}
+}
+
+// Create сохраняет новую сессию с хешем refresh токена
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session, tokenHash string) error {
+	query := "INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5::timestamptz) RETURNING id, created_at, last_used_at"
+	return r.db.QueryRowContext(ctx, query, session.UserID, tokenHash, session.UserAgent, session.IP, session.ExpiresAt).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+}
+
+// Rotate заменяет refresh токен действующей сессии и продлевает её до expiresAt.
+// Возвращает sql.ErrNoRows, если токен не принадлежит действующей сессии.
+func (r *SessionRepository) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.Session, error) {
+	query := `UPDATE sessions
+		SET refresh_token_hash=$2, previous_token_hash=$1, last_used_at=now(), expires_at=$3::timestamptz
+		WHERE refresh_token_hash=$1 AND revoked_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, user_agent, ip, created_at, last_used_at, expires_at`
+	var session models.Session
+	err := r.db.QueryRowContext(ctx, query, oldHash, newHash, expiresAt).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeByPreviousToken отзывает сессию, чей уже заменённый refresh токен предъявлен повторно.
+// Повторное предъявление означает, что токен мог быть украден.
+func (r *SessionRepository) RevokeByPreviousToken(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE sessions SET revoked_at=now() WHERE previous_token_hash=$1 AND revoked_at IS NULL", tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Revoke отзывает сессию пользователя
+func (r *SessionRepository) Revoke(ctx context.Context, sessionID, userID int) error {
+	query := "UPDATE sessions SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL"
+	return requireAffected(r.db.ExecContext(ctx, query, sessionID, userID))
+}
+
+// RevokeAllForUser отзывает все действующие сессии пользователя
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE sessions SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetActiveUser возвращает владельца сессии, если сессия не отозвана и не истекла.
+// Данные пользователя читаются из базы, поэтому смена роли или деактивация действуют сразу.
+func (r *SessionRepository) GetActiveUser(ctx context.Context, sessionID, userID int) (*models.User, error) {
+	query := `SELECT u.id, u.inn, u.username, u.is_active, u.is_admin, u.role
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id=$1 AND s.user_id=$2 AND s.revoked_at IS NULL AND s.expires_at > now()`
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, sessionID, userID).Scan(&user.ID, &user.INN, &user.Username, &user.IsActive, &user.IsAdmin, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+var (
+	// ErrShiftAlreadyOpen возвращается при открытии второй смены на торговой точке
+	ErrShiftAlreadyOpen = apperrors.New(apperrors.CodeConflict, "Terminal already has an open shift")
+	// ErrNoOpenShift возвращается, если у торговой точки нет открытой смены
+	ErrNoOpenShift = apperrors.New(apperrors.CodeConflict, "Terminal has no open shift")
+	// ErrShiftExpired возвращается при приёме чека в смену, открытую дольше MaxShiftDuration
+	ErrShiftExpired = apperrors.New(apperrors.CodeConflict, "Shift has been open for more than 24 hours; close it with a Z-report")
+	// ErrShiftNotAllowed возвращается при открытии смены точкой, которая не активна или не имеет фискального модуля
+	ErrShiftNotAllowed = apperrors.New(apperrors.CodeConflict, "Only an active terminal with a bound fiscal module can open a shift")
+)
+
+// queryer — общий интерфейс соединений и транзакций для чтения
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const shiftColumns = "id, terminal_id, fiscal_module_id, opened_at, closed_at, opened_by, closed_by"
+
+func scanShift(row interface{ Scan(...interface{}) error }) (*models.Shift, error) {
+	var shift models.Shift
+	var openedBy, closedBy sql.NullInt64
+	err := row.Scan(&shift.ID, &shift.TerminalID, &shift.FiscalModuleID, &shift.OpenedAt, &shift.ClosedAt, &openedBy, &closedBy)
+	if err != nil {
+		return nil, err
+	}
+	if openedBy.Valid {
+		id := int(openedBy.Int64)
+		shift.OpenedBy = &id
+	}
+	if closedBy.Valid {
+		id := int(closedBy.Int64)
+		shift.ClosedBy = &id
+	}
+	return &shift, nil
+}
+
+// OpenShift открывает смену на активной торговой точке с привязанным фискальным модулем
+func (r *TerminalRepository) OpenShift(ctx context.Context, terminalID int, actorID *int) (*models.Shift, error) {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var moduleID sql.NullInt64
+	var status models.TerminalStatus
+	err = tx.QueryRowContext(ctx, "SELECT fiscal_module_id, status FROM terminals WHERE id=$1 FOR UPDATE", terminalID).Scan(&moduleID, &status)
+	if err != nil {
+		return nil, err
+	}
+	if status != models.TerminalActive || !moduleID.Valid {
+		return nil, ErrShiftNotAllowed
+	}
+
+	var open bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM shifts WHERE terminal_id=$1 AND closed_at IS NULL)", terminalID).Scan(&open)
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, ErrShiftAlreadyOpen
+	}
+
+	query := "INSERT INTO shifts (terminal_id, fiscal_module_id, opened_by) VALUES ($1, $2, $3) RETURNING " + shiftColumns
+	shift, err := scanShift(tx.QueryRowContext(ctx, query, terminalID, moduleID.Int64, actorID))
+	if err != nil {
+		return nil, err
+	}
+
+	return shift, tx.Commit()
+}
+
+// GetOpenShift возвращает открытую смену торговой точки или ErrNoOpenShift
+func (r *TerminalRepository) GetOpenShift(ctx context.Context, terminalID int) (*models.Shift, error) {
+	query := "SELECT " + shiftColumns + " FROM shifts WHERE terminal_id=$1 AND closed_at IS NULL"
+	shift, err := scanShift(r.db.QueryRowContext(ctx, query, terminalID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoOpenShift
+	}
+	return shift, err
+}
+
+// ShiftReport считает промежуточные итоги открытой смены (X-отчёт)
+func (r *TerminalRepository) ShiftReport(ctx context.Context, terminalID int) (*models.ShiftReport, error) {
+	shift, err := r.GetOpenShift(ctx, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	return shiftTotals(ctx, r.db, shift)
+}
+
+// CloseShift закрывает открытую смену, сохраняет Z-отчёт со следующим номером фискального модуля
+// и ставит его в очередь отправки в ОФД
+func (r *TerminalRepository) CloseShift(ctx context.Context, terminalID int, actorID *int) (*models.ZReport, error) {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + shiftColumns + " FROM shifts WHERE terminal_id=$1 AND closed_at IS NULL FOR UPDATE"
+	shift, err := scanShift(tx.QueryRowContext(ctx, query, terminalID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoOpenShift
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, "UPDATE shifts SET closed_at=now(), closed_by=$1 WHERE id=$2 RETURNING closed_at", actorID, shift.ID).Scan(&shift.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	shift.ClosedBy = actorID
+
+	report, err := shiftTotals(ctx, tx, shift)
+	if err != nil {
+		return nil, err
+	}
+
+	zReport := &models.ZReport{Report: *report}
+	err = tx.QueryRowContext(ctx, "UPDATE fiscal_modules SET last_z_report_number=last_z_report_number+1, updated_at=now() WHERE id=$1 RETURNING last_z_report_number", shift.FiscalModuleID).Scan(&zReport.ReportNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	query = "INSERT INTO z_reports (shift_id, fiscal_module_id, report_number, report) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	err = tx.QueryRowContext(ctx, query, shift.ID, shift.FiscalModuleID, zReport.ReportNumber, payload).Scan(&zReport.ID, &zReport.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := enqueueOFD(ctx, tx, models.OFDZReport, zReport.ID, zReport); err != nil {
+		return nil, err
+	}
+
+	return zReport, tx.Commit()
+}
+
+// GetZReports возвращает Z-отчёты торговой точки в порядке закрытия смен
+func (r *TerminalRepository) GetZReports(ctx context.Context, terminalID int) ([]models.ZReport, error) {
+	query := "SELECT z.id, z.report_number, z.report, z.created_at FROM z_reports z JOIN shifts s ON s.id = z.shift_id WHERE s.terminal_id=$1 ORDER BY z.id"
+	rows, err := r.db.QueryContext(ctx, query, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.ZReport{}
+	for rows.Next() {
+		var report models.ZReport
+		var payload []byte
+		if err := rows.Scan(&report.ID, &report.ReportNumber, &payload, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(payload, &report.Report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// shiftTotals собирает итоги смены по сохранённым чекам
+func shiftTotals(ctx context.Context, q queryer, shift *models.Shift) (*models.ShiftReport, error) {
+	report := &models.ShiftReport{
+		ShiftID:        shift.ID,
+		TerminalID:     shift.TerminalID,
+		FiscalModuleID: shift.FiscalModuleID,
+		OpenedAt:       shift.OpenedAt,
+		ClosedAt:       shift.ClosedAt,
+		ByPaymentType:  []models.PaymentTotals{},
+		ByVATRate:      []models.VATRateTotals{},
+	}
+	if err := q.QueryRowContext(ctx, "SELECT now()").Scan(&report.GeneratedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT type, COUNT(*), COALESCE(SUM(total), 0), COALESCE(SUM(vat_total), 0) FROM receipts WHERE shift_id=$1 GROUP BY type", shift.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var kind models.ReceiptType
+		var count int
+		var total, vat int64
+		if err := rows.Scan(&kind, &count, &total, &vat); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if kind == models.ReceiptRefund {
+			report.RefundCount, report.RefundsTotal, report.RefundsVAT = count, total, vat
+		} else {
+			report.SaleCount, report.SalesTotal, report.SalesVAT = count, total, vat
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.NetTotal = report.SalesTotal - report.RefundsTotal
+
+	byPayment := map[models.PaymentType]*models.PaymentTotals{}
+	rows, err = q.QueryContext(ctx, "SELECT r.type, p.type, SUM(p.amount) FROM receipts r JOIN receipt_payments p ON p.receipt_id = r.id WHERE r.shift_id=$1 GROUP BY r.type, p.type", shift.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var kind models.ReceiptType
+		var paymentType models.PaymentType
+		var amount int64
+		if err := rows.Scan(&kind, &paymentType, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		totals, ok := byPayment[paymentType]
+		if !ok {
+			totals = &models.PaymentTotals{Type: paymentType}
+			byPayment[paymentType] = totals
+		}
+		if kind == models.ReceiptRefund {
+			totals.Refunds += amount
+		} else {
+			totals.Sales += amount
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, totals := range byPayment {
+		report.ByPaymentType = append(report.ByPaymentType, *totals)
+	}
+	sort.Slice(report.ByPaymentType, func(i, j int) bool { return report.ByPaymentType[i].Type < report.ByPaymentType[j].Type })
+
+	byRate := map[int]*models.VATRateTotals{}
+	rows, err = q.QueryContext(ctx, "SELECT r.type, i.vat_rate, SUM(i.total), SUM(i.vat_amount) FROM receipts r JOIN receipt_items i ON i.receipt_id = r.id WHERE r.shift_id=$1 GROUP BY r.type, i.vat_rate", shift.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var kind models.ReceiptType
+		var rate int
+		var total, vat int64
+		if err := rows.Scan(&kind, &rate, &total, &vat); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		totals, ok := byRate[rate]
+		if !ok {
+			totals = &models.VATRateTotals{Rate: rate}
+			byRate[rate] = totals
+		}
+		if kind == models.ReceiptRefund {
+			totals.Refunds += total
+			totals.RefundsVAT += vat
+		} else {
+			totals.Sales += total
+			totals.SalesVAT += vat
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, totals := range byRate {
+		report.ByVATRate = append(report.ByVATRate, *totals)
+	}
+	sort.Slice(report.ByVATRate, func(i, j int) bool { return report.ByVATRate[i].Rate < report.ByVATRate[j].Rate })
+
+	return report, nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/models"
+)
+
+type TaxIDRepository struct {
+	db conn
+}
+
+func NewTaxIDRepository(db *sql.DB) *TaxIDRepository {
+	return &TaxIDRepository{db: pool{db}}
+}
+
+// taxIDQueries — запросы, выбирающие ИНН объектов каждого вида
+var taxIDQueries = map[models.TaxIDEntity]string{
+	models.TaxIDUser:     "SELECT id, inn FROM users ORDER BY id",
+	models.TaxIDTerminal: "SELECT id, inn FROM terminals ORDER BY id",
+	models.TaxIDCompany:  "SELECT id, inn FROM companies ORDER BY id",
+}
+
+// Stream передаёт fn ИНН всех объектов вида entity, не накапливая их в памяти
+func (r *TaxIDRepository) Stream(ctx context.Context, entity models.TaxIDEntity, fn func(record models.TaxIDRecord) error) error {
+	rows, err := r.db.QueryContext(ctx, taxIDQueries[entity])
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := models.TaxIDRecord{EntityType: entity}
+		if err := rows.Scan(&record.EntityID, &record.INN); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -3,65 +3,319 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/idkOybek/internal/models"
 )
 
 type TerminalRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewTerminalRepository(db *sql.DB) *TerminalRepository {
-	return &TerminalRepository{db: db}
+	return &TerminalRepository{db: pool{db}}
 }
 
-func (r *TerminalRepository) GetAll(ctx context.Context) ([]models.Terminal, error) {
-	query := "SELECT id, inn, company_name, address, cash_register_number, module_number, assembly_number, last_request_date, database_update_date, status, user_id, created_at, updated_at, free_record_balance FROM terminals"
-	rows, err := r.db.QueryContext(ctx, query)
+// terminalCompanyName — название компании торговой точки; у самой точки оно не хранится
+const terminalCompanyName = "(SELECT legal_name FROM companies WHERE companies.inn = terminals.inn)"
+
+const terminalColumns = "id, inn, " + terminalCompanyName + " AS company_name, address, cash_register_number, module_number, assembly_number, last_request_date, database_update_date, status, status_changed_at, is_online, user_id, free_record_balance, fiscal_module_id, version"
+
+var terminalPage = pageSpec{
+	table:   "terminals",
+	columns: terminalColumns,
+	sorts: map[string]sortColumn{
+		"id":                   {expr: "id", cast: "int"},
+		"inn":                  {expr: "inn", cast: "text"},
+		"company_name":         {expr: terminalCompanyName, cast: "text"},
+		"cash_register_number": {expr: "cash_register_number", cast: "text"},
+		"free_record_balance":  {expr: "free_record_balance", cast: "int"},
+		"last_request_date":    {expr: "COALESCE(last_request_date, '-infinity'::timestamp)", cast: "timestamp"},
+	},
+}
+
+// terminalWhere строит условия выборки торговых точек по фильтру
+func terminalWhere(filter models.TerminalFilter) *whereBuilder {
+	where := &whereBuilder{}
+	if filter.INN != "" {
+		where.add("inn = ?", filter.INN)
+	}
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	if filter.UserID != nil {
+		where.add("user_id = ?", *filter.UserID)
+	}
+	if filter.CompanyName != "" {
+		where.add("inn IN (SELECT inn FROM companies WHERE legal_name ILIKE ?)", containsPattern(filter.CompanyName))
+	}
+	if filter.IsOnline != nil {
+		where.add("is_online = ?", *filter.IsOnline)
+	}
+	if filter.LastRequestFrom != nil {
+		where.add("last_request_date >= ?::timestamptz", *filter.LastRequestFrom)
+	}
+	if filter.LastRequestTo != nil {
+		where.add("last_request_date < ?::timestamptz", *filter.LastRequestTo)
+	}
+	return where
+}
+
+// List возвращает страницу торговых точек, удовлетворяющих фильтру
+func (r *TerminalRepository) List(ctx context.Context, filter models.TerminalFilter) (*models.TerminalList, error) {
+	items, total, next, err := fetchPage(ctx, r.db, terminalPage, terminalWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, terminal *models.Terminal, sortKey *string) error {
+			return scanTerminalInto(rows, terminal, sortKey)
+		},
+		func(terminal *models.Terminal) int { return terminal.ID })
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return &models.TerminalList{Items: items, Total: total, NextCursor: next}, nil
+}
 
-	var terminals []models.Terminal
-	for rows.Next() {
-		var terminal models.Terminal
-		err := rows.Scan(&terminal.ID, &terminal.INN, &terminal.CompanyName, &terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber, &terminal.AssemblyNumber, &terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.Status, &terminal.UserID, &terminal.FreeRecordBalance)
-		if err != nil {
-			return nil, err
-		}
-		terminals = append(terminals, terminal)
+// Export передаёт fn все торговые точки под фильтром в порядке его сортировки;
+// курсор и размер страницы не учитываются
+func (r *TerminalRepository) Export(ctx context.Context, filter models.TerminalFilter, fn func(terminal *models.Terminal) error) error {
+	return streamAll(ctx, r.db, terminalPage, terminalWhere(filter), filter.ListParams,
+		func(rows *sql.Rows, terminal *models.Terminal) error {
+			return scanTerminalInto(rows, terminal)
+		}, fn)
+}
+
+func scanTerminalInto(row interface{ Scan(...interface{}) error }, terminal *models.Terminal, extra ...interface{}) error {
+	dest := []interface{}{&terminal.ID, &terminal.INN, &terminal.CompanyName, &terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber, &terminal.AssemblyNumber, &terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.Status, &terminal.StatusChangedAt, &terminal.IsOnline, &terminal.UserID, &terminal.FreeRecordBalance, &terminal.FiscalModuleID, &terminal.Version}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func scanTerminal(row interface{ Scan(...interface{}) error }) (*models.Terminal, error) {
+	var terminal models.Terminal
+	if err := scanTerminalInto(row, &terminal); err != nil {
+		return nil, err
 	}
-	return terminals, nil
+	return &terminal, nil
 }
 
 func (r *TerminalRepository) GetByID(ctx context.Context, id int) (*models.Terminal, error) {
-	query := "SELECT id, inn, company_name, address, cash_register_number, module_number, assembly_number, last_request_date, database_update_date, status, user_id, free_record_balance FROM terminals WHERE id=$1"
-	row := r.db.QueryRowContext(ctx, query, id)
+	query := "SELECT " + terminalColumns + " FROM terminals WHERE id=$1"
+	return scanTerminal(r.db.QueryRowContext(ctx, query, id))
+}
 
-	var terminal models.Terminal
-	err := row.Scan(&terminal.ID, &terminal.INN, &terminal.CompanyName, &terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber, &terminal.AssemblyNumber, &terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.Status, &terminal.UserID, &terminal.FreeRecordBalance)
+// lockTerminal читает торговую точку в транзакции и блокирует её строку до конца транзакции
+func lockTerminal(ctx context.Context, tx executor, id int) (*models.Terminal, error) {
+	return scanTerminal(tx.QueryRowContext(ctx, "SELECT "+terminalColumns+" FROM terminals WHERE id=$1 FOR UPDATE", id))
+}
+
+// Create добавляет торговую точку, привязывает к ней фискальный модуль fiscalModuleID,
+// отражает начальный баланс в журнале движений и создание в журнале аудита
+// и возвращает сохранённую точку
+func (r *TerminalRepository) Create(ctx context.Context, terminal *models.TerminalCreateRequest, fiscalModuleID *int, meta models.AuditMeta) (*models.Terminal, error) {
+	tx, err := r.db.begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	return &terminal, nil
+	created, err := insertTerminal(ctx, tx, terminal, fiscalModuleID, meta)
+	if err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
 }
 
-func (r *TerminalRepository) Create(ctx context.Context, terminal *models.TerminalCreateRequest) error {
-	query := "INSERT INTO terminals (inn, company_name, address, cash_register_number, module_number, assembly_number, status, user_id, free_record_balance) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
-	_, err := r.db.ExecContext(ctx, query, terminal.INN, terminal.CompanyName, terminal.Address, terminal.CashRegisterNumber, terminal.ModuleNumber, terminal.AssemblyNumber, terminal.Status, terminal.UserID, terminal.FreeRecordBalance)
-	return err
+// insertTerminal выполняет Create в рамках транзакции tx и возвращает сохранённую точку.
+// Компания с ИНН точки создаётся, если её ещё нет.
+func insertTerminal(ctx context.Context, tx executor, terminal *models.TerminalCreateRequest, fiscalModuleID *int, meta models.AuditMeta) (*models.Terminal, error) {
+	if err := ensureCompany(ctx, tx, terminal.INN, terminal.CompanyName, meta); err != nil {
+		return nil, err
+	}
+
+	var id int
+	query := "INSERT INTO terminals (inn, address, cash_register_number, module_number, assembly_number, status, user_id, free_record_balance, fiscal_module_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
+	err := tx.QueryRowContext(ctx, query, terminal.INN, terminal.Address, terminal.CashRegisterNumber, terminal.ModuleNumber, terminal.AssemblyNumber, models.TerminalRegistered, terminal.UserID, terminal.FreeRecordBalance, fiscalModuleID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if fiscalModuleID != nil {
+		if err := bindFiscalModule(ctx, tx, id, *fiscalModuleID); err != nil {
+			return nil, err
+		}
+	}
+
+	if terminal.FreeRecordBalance != 0 {
+		opening := &models.BalanceMovement{
+			TerminalID:   id,
+			Kind:         models.BalanceMovementCorrection,
+			Amount:       terminal.FreeRecordBalance,
+			BalanceAfter: terminal.FreeRecordBalance,
+			Reason:       "opening balance",
+		}
+		if err := insertBalanceMovement(ctx, tx, opening); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := lockTerminal(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, meta, models.AuditTerminal, id, models.AuditCreate, nil, created); err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
-func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Terminal) error {
-	query := "UPDATE terminals SET inn=$1, company_name=$2, address=$3, cash_register_number=$4, module_number=$5, assembly_number=$6, last_request_date=$7, database_update_date=$8, status=$9, user_id=$10, free_record_balance=$11 WHERE id=$12"
-	_, err := r.db.ExecContext(ctx, query, terminal.INN, terminal.CompanyName, terminal.Address, terminal.CashRegisterNumber, terminal.ModuleNumber, terminal.AssemblyNumber, terminal.LastRequestDate, terminal.DatabaseUpdateDate, terminal.Status, terminal.UserID, terminal.FreeRecordBalance, terminal.ID)
+// Update перезаписывает данные торговой точки, если её версия всё ещё равна terminal.Version,
+// и увеличивает версию. При смене фискального модуля закрывает
+// прежнюю привязку и открывает новую. Баланс и статус здесь не меняются: они изменяются
+// только через ApplyBalanceMovement и ChangeStatus.
+func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Terminal, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockTerminal(ctx, tx, terminal.ID)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, terminal.Version); err != nil {
+		return err
+	}
+	if before.Status == models.TerminalDecommissioned {
+		return ErrTerminalDecommissioned
+	}
+
+	if terminal.INN != before.INN {
+		if err := ensureCompany(ctx, tx, terminal.INN, "", meta); err != nil {
+			return err
+		}
+	}
+
+	query := "UPDATE terminals SET inn=$1, address=$2, cash_register_number=$3, module_number=$4, assembly_number=$5, last_request_date=$6::timestamptz, database_update_date=$7::timestamptz, user_id=$8, fiscal_module_id=$9, version=version+1, updated_at=now() WHERE id=$10"
+	_, err = tx.ExecContext(ctx, query, terminal.INN, terminal.Address, terminal.CashRegisterNumber, terminal.ModuleNumber, terminal.AssemblyNumber, terminal.LastRequestDate, terminal.DatabaseUpdateDate, terminal.UserID, terminal.FiscalModuleID, terminal.ID)
+	if err != nil {
+		return err
+	}
+
+	changed := (before.FiscalModuleID != nil) != (terminal.FiscalModuleID != nil) ||
+		(terminal.FiscalModuleID != nil && *terminal.FiscalModuleID != *before.FiscalModuleID)
+	if changed {
+		if err := unbindFiscalModule(ctx, tx, terminal.ID); err != nil {
+			return err
+		}
+		if terminal.FiscalModuleID != nil {
+			if err := bindFiscalModule(ctx, tx, terminal.ID, *terminal.FiscalModuleID); err != nil {
+				return err
+			}
+		}
+	}
+
+	after, err := lockTerminal(ctx, tx, terminal.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, meta, models.AuditTerminal, terminal.ID, models.AuditUpdate, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func bindFiscalModule(ctx context.Context, tx executor, terminalID, fiscalModuleID int) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO fiscal_module_bindings (terminal_id, fiscal_module_id) VALUES ($1, $2)", terminalID, fiscalModuleID)
 	return err
 }
 
-func (r *TerminalRepository) Delete(ctx context.Context, id int) error {
-	query := "DELETE FROM terminals WHERE id=$1"
-	_, err := r.db.ExecContext(ctx, query, id)
+func unbindFiscalModule(ctx context.Context, tx executor, terminalID int) error {
+	_, err := tx.ExecContext(ctx, "UPDATE fiscal_module_bindings SET unbound_at=now() WHERE terminal_id=$1 AND unbound_at IS NULL", terminalID)
 	return err
 }
+
+// Delete удаляет торговую точку версии version и сохраняет её последнее состояние в журнале аудита
+func (r *TerminalRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockTerminal(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM terminals WHERE id=$1", id); err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditTerminal, id, models.AuditDelete, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reassign передаёт все торговые точки пользователя fromUserID, в том числе выведенные
+// из эксплуатации, пользователю toUserID и возвращает их число
+func (r *TerminalRepository) Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error) {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := selectIDs(ctx, tx, "SELECT id FROM terminals WHERE user_id=$1 ORDER BY id FOR UPDATE", fromUserID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		before, err := lockTerminal(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE terminals SET user_id=$1, version=version+1, updated_at=now() WHERE id=$2", toUserID, id); err != nil {
+			return 0, err
+		}
+		after, err := lockTerminal(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeAudit(ctx, tx, meta, models.AuditTerminal, id, models.AuditUpdate, before, after); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), tx.Commit()
+}
+
+// CheckIn отмечает обращение кассы, найденной по номеру ККМ и номеру модуля,
+// и возвращает её ID, время обращения и дату последнего обновления базы на сервере.
+// Если ownerID задан, обновляется только касса этого владельца.
+// Выведенные из эксплуатации кассы считаются ненайденными.
+func (r *TerminalRepository) CheckIn(ctx context.Context, cashRegisterNumber, moduleNumber string, ownerID *int) (*models.Terminal, error) {
+	query := "UPDATE terminals SET last_request_date=now(), is_online=true WHERE cash_register_number=$1 AND module_number=$2 AND ($3::int IS NULL OR user_id=$3) AND status <> 'decommissioned' RETURNING id, last_request_date, database_update_date, is_online, user_id"
+	row := r.db.QueryRowContext(ctx, query, cashRegisterNumber, moduleNumber, ownerID)
+
+	terminal := models.Terminal{CashRegisterNumber: cashRegisterNumber, ModuleNumber: moduleNumber}
+	err := row.Scan(&terminal.ID, &terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.IsOnline, &terminal.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &terminal, nil
+}
+
+// MarkOffline переводит в офлайн кассы, которые не выходили на связь дольше window
+func (r *TerminalRepository) MarkOffline(ctx context.Context, window time.Duration) (int64, error) {
+	query := "UPDATE terminals SET is_online=false WHERE is_online AND (last_request_date IS NULL OR last_request_date < now() - make_interval(secs => $1))"
+	result, err := r.db.ExecContext(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
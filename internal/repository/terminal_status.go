@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+)
+
+var (
+	// ErrTerminalDecommissioned возвращается при изменении выведенной из эксплуатации точки
+	ErrTerminalDecommissioned = apperrors.New(apperrors.CodeConflict, "Terminal is decommissioned")
+	// ErrStatusChanged возвращается, если статус точки изменился параллельно с запросом
+	ErrStatusChanged = apperrors.New(apperrors.CodeConflict, "Terminal status was changed concurrently")
+	// ErrShiftStillOpen возвращается при выводе из эксплуатации точки с открытой сменой
+	ErrShiftStillOpen = apperrors.New(apperrors.CodeConflict, "Close the open shift with a Z-report before decommissioning the terminal")
+)
+
+// ChangeStatus переводит торговую точку из change.FromStatus в change.ToStatus и записывает
+// переход в историю. Если текущий статус уже не равен FromStatus, возвращается ErrStatusChanged.
+// При выводе из эксплуатации точка уходит в офлайн и освобождает фискальный модуль; точку
+// с открытой сменой вывести нельзя (ErrShiftStillOpen), иначе смену не закрыть Z-отчётом.
+func (r *TerminalRepository) ChangeStatus(ctx context.Context, change *models.TerminalStatusChange, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockTerminal(ctx, tx, change.TerminalID)
+	if err != nil {
+		return err
+	}
+
+	if change.ToStatus == models.TerminalDecommissioned {
+		// Смена открывается под той же блокировкой точки, поэтому проверка не устареет до коммита
+		var open bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM shifts WHERE terminal_id=$1 AND closed_at IS NULL)", change.TerminalID).Scan(&open)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrShiftStillOpen
+		}
+	}
+
+	query := "UPDATE terminals SET status=$1, status_changed_at=now(), version=version+1, updated_at=now() WHERE id=$2 AND status=$3 RETURNING status_changed_at"
+	err = tx.QueryRowContext(ctx, query, change.ToStatus, change.TerminalID, change.FromStatus).Scan(&change.ChangedAt)
+	if err == sql.ErrNoRows {
+		return ErrStatusChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	if change.ToStatus == models.TerminalDecommissioned {
+		if err := unbindFiscalModule(ctx, tx, change.TerminalID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE terminals SET fiscal_module_id=NULL, is_online=false WHERE id=$1", change.TerminalID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = "INSERT INTO terminal_status_changes (terminal_id, from_status, to_status, reason, actor_id, changed_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	err = tx.QueryRowContext(ctx, query, change.TerminalID, change.FromStatus, change.ToStatus, change.Reason, change.ActorID, change.ChangedAt).Scan(&change.ID)
+	if err != nil {
+		return err
+	}
+
+	after, err := lockTerminal(ctx, tx, change.TerminalID)
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, meta, models.AuditTerminal, change.TerminalID, models.AuditUpdate, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetStatusHistory возвращает историю смены статусов торговой точки в порядке записи
+func (r *TerminalRepository) GetStatusHistory(ctx context.Context, terminalID int) ([]models.TerminalStatusChange, error) {
+	query := "SELECT id, terminal_id, from_status, to_status, reason, actor_id, changed_at FROM terminal_status_changes WHERE terminal_id=$1 ORDER BY id"
+	rows, err := r.db.QueryContext(ctx, query, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.TerminalStatusChange{}
+	for rows.Next() {
+		var change models.TerminalStatusChange
+		var actorID sql.NullInt64
+		err := rows.Scan(&change.ID, &change.TerminalID, &change.FromStatus, &change.ToStatus, &change.Reason, &actorID, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			change.ActorID = &id
+		}
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,480 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+func TestTerminalRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewTerminalRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+	first := createModule(t, db, "F-1", "FN-1", owner.ID)
+	second := createModule(t, db, "F-2", "FN-2", owner.ID)
+
+	terminal := createTerminal(t, db, "CR-1", &first.ID, owner.ID)
+	var spare *models.Terminal
+
+	t.Run("create", func(t *testing.T) {
+		if terminal.ID == 0 || terminal.Version != 1 || terminal.Status != models.TerminalRegistered || terminal.StatusChangedAt == nil {
+			t.Fatalf("created terminal %+v", terminal)
+		}
+		if terminal.CompanyName != "Spare LLC" || terminal.FreeRecordBalance != 10 || terminal.IsOnline {
+			t.Errorf("created terminal %+v", terminal)
+		}
+		if terminal.LastRequestDate != nil || terminal.DatabaseUpdateDate != nil {
+			t.Errorf("new terminal has request dates %v and %v", terminal.LastRequestDate, terminal.DatabaseUpdateDate)
+		}
+		if terminal.FiscalModuleID == nil || *terminal.FiscalModuleID != first.ID {
+			t.Errorf("fiscal module %v, want %d", terminal.FiscalModuleID, first.ID)
+		}
+
+		cases := []struct {
+			name     string
+			change   func(req *models.TerminalCreateRequest)
+			moduleID *int
+			code     apperrors.Code
+			field    string
+		}{
+			{"duplicate cash register", func(req *models.TerminalCreateRequest) { req.CashRegisterNumber = "CR-1" }, nil, apperrors.CodeConflict, "cash_register_number"},
+			{"duplicate module number", func(req *models.TerminalCreateRequest) { req.ModuleNumber = "M-CR-1" }, nil, apperrors.CodeConflict, "module_number"},
+			{"duplicate assembly number", func(req *models.TerminalCreateRequest) { req.AssemblyNumber = "A-CR-1" }, nil, apperrors.CodeConflict, "assembly_number"},
+			{"bound fiscal module", func(req *models.TerminalCreateRequest) {}, &first.ID, apperrors.CodeConflict, "fiscal_module_id"},
+			{"unknown fiscal module", func(req *models.TerminalCreateRequest) {}, intPtr(999), apperrors.CodeInvalidReference, "fiscal_module_id"},
+			{"unknown user", func(req *models.TerminalCreateRequest) { req.UserID = 999 }, nil, apperrors.CodeInvalidReference, "user_id"},
+			{"negative balance", func(req *models.TerminalCreateRequest) { req.FreeRecordBalance = -1 }, nil, apperrors.CodeValidation, ""},
+			{"another company name", func(req *models.TerminalCreateRequest) { req.INN, req.CompanyName = innSpare, "Renamed LLC" }, nil, apperrors.CodeConflict, "company_name"},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := terminalRequest("CR-9", owner.ID)
+				req.INN = innAdmin
+				tc.change(req)
+				_, err := repo.Create(ctx, req, tc.moduleID, meta)
+				expectError(t, err, tc.code, tc.field)
+			})
+		}
+
+		// Неудачные попытки не оставляют ни точек, ни компаний
+		list, err := repo.List(ctx, models.TerminalFilter{})
+		mustNot(t, err)
+		companies, err := repository.NewCompanyRepository(db).List(ctx, models.CompanyFilter{INN: innAdmin})
+		mustNot(t, err)
+		if list.Total != 1 || companies.Total != 0 {
+			t.Errorf("%d terminals and %d companies after failed creations", list.Total, companies.Total)
+		}
+
+		// Название существующей компании не меняется при заведении новой точки
+		req := terminalRequest("CR-2", other.ID)
+		req.CompanyName = "Renamed LLC"
+		created, err := repo.Create(ctx, req, nil, meta)
+		mustNot(t, err)
+		if created.CompanyName != "Spare LLC" || created.FiscalModuleID != nil || created.FreeRecordBalance != 10 {
+			t.Errorf("created terminal %+v", created)
+		}
+		spare = created
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if got.CashRegisterNumber != "CR-1" || got.Version != terminal.Version || !got.StatusChangedAt.Equal(*terminal.StatusChangedAt) {
+			t.Errorf("got %+v, want %+v", got, terminal)
+		}
+		_, err = repo.GetByID(ctx, 999)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		east := time.FixedZone("UTC+5", 5*60*60)
+		lastRequest := time.Now().Add(-time.Hour).Truncate(time.Second).In(east)
+		updated := *terminal
+		updated.Address = "Samarkand"
+		updated.LastRequestDate = &lastRequest
+		updated.DatabaseUpdateDate = &lastRequest
+		updated.FiscalModuleID = &second.ID
+		mustNot(t, repo.Update(ctx, &updated, meta))
+
+		stored, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.Version != 2 || stored.Address != "Samarkand" || *stored.FiscalModuleID != second.ID {
+			t.Errorf("stored %+v", stored)
+		}
+		if stored.LastRequestDate == nil || !stored.LastRequestDate.Equal(lastRequest) || !stored.DatabaseUpdateDate.Equal(lastRequest) {
+			t.Errorf("request dates %v and %v, want %v", stored.LastRequestDate, stored.DatabaseUpdateDate, lastRequest)
+		}
+
+		// Новый ИНН заводит компанию без названия; NULL в датах сохраняется как NULL
+		stored.INN = innOther
+		stored.LastRequestDate = nil
+		stored.FiscalModuleID = nil
+		mustNot(t, repo.Update(ctx, stored, meta))
+		cleared, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if cleared.LastRequestDate != nil || cleared.DatabaseUpdateDate == nil || cleared.FiscalModuleID != nil || cleared.INN != innOther || cleared.CompanyName != "" {
+			t.Errorf("stored %+v", cleared)
+		}
+
+		cases := []struct {
+			name   string
+			change func(terminal *models.Terminal)
+			code   apperrors.Code
+			field  string
+		}{
+			{"stale version", func(terminal *models.Terminal) { terminal.Version = 1 }, apperrors.CodePreconditionFailed, ""},
+			{"missing", func(terminal *models.Terminal) { terminal.ID = 999 }, apperrors.CodeNotFound, ""},
+			{"duplicate cash register", func(terminal *models.Terminal) { terminal.CashRegisterNumber = "CR-2" }, apperrors.CodeConflict, "cash_register_number"},
+			{"unknown user", func(terminal *models.Terminal) { terminal.UserID = 999 }, apperrors.CodeInvalidReference, "user_id"},
+			{"unknown fiscal module", func(terminal *models.Terminal) { terminal.FiscalModuleID = intPtr(999) }, apperrors.CodeInvalidReference, "fiscal_module_id"},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				changed := *cleared
+				tc.change(&changed)
+				expectError(t, repo.Update(ctx, &changed, meta), tc.code, tc.field)
+			})
+		}
+		*terminal = *cleared
+	})
+
+	t.Run("check in", func(t *testing.T) {
+		before := time.Now().Add(-time.Minute)
+		checked, err := repo.CheckIn(ctx, "CR-1", "M-CR-1", nil)
+		mustNot(t, err)
+		if checked.ID != terminal.ID || !checked.IsOnline || checked.UserID != owner.ID || checked.LastRequestDate == nil || checked.LastRequestDate.Before(before) {
+			t.Errorf("checked in %+v", checked)
+		}
+		if checked.DatabaseUpdateDate == nil || !checked.DatabaseUpdateDate.Equal(*terminal.DatabaseUpdateDate) {
+			t.Errorf("database update date %v, want %v", checked.DatabaseUpdateDate, terminal.DatabaseUpdateDate)
+		}
+		if _, err := repo.CheckIn(ctx, "CR-1", "M-CR-1", &owner.ID); err != nil {
+			t.Errorf("check-in by the owner: %v", err)
+		}
+
+		_, err = repo.CheckIn(ctx, "CR-1", "M-CR-1", &other.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		_, err = repo.CheckIn(ctx, "CR-1", "M-CR-2", nil)
+		expectError(t, err, apperrors.CodeNotFound, "")
+
+		// Обращение кассы не меняет версию записи
+		stored, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.Version != terminal.Version {
+			t.Errorf("version %d after check-in, want %d", stored.Version, terminal.Version)
+		}
+	})
+
+	t.Run("mark offline", func(t *testing.T) {
+		// CR-2 на связи, но давно не обращался; CR-1 на связи без даты обращения
+		_, err := repo.CheckIn(ctx, "CR-2", "M-CR-2", nil)
+		mustNot(t, err)
+		stale, err := repo.GetByID(ctx, spare.ID)
+		mustNot(t, err)
+		lastRequest := time.Now().Add(-2 * time.Hour)
+		stale.LastRequestDate = &lastRequest
+		mustNot(t, repo.Update(ctx, stale, meta))
+		current, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		current.LastRequestDate = nil
+		mustNot(t, repo.Update(ctx, current, meta))
+
+		marked, err := repo.MarkOffline(ctx, time.Hour)
+		mustNot(t, err)
+		if marked != 2 {
+			t.Errorf("marked %d terminals offline, want 2", marked)
+		}
+		if marked, _ := repo.MarkOffline(ctx, time.Hour); marked != 0 {
+			t.Errorf("marked %d terminals offline again", marked)
+		}
+
+		_, err = repo.CheckIn(ctx, "CR-1", "M-CR-1", nil)
+		mustNot(t, err)
+		if marked, _ := repo.MarkOffline(ctx, time.Hour); marked != 0 {
+			t.Errorf("marked a terminal offline right after its check-in")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		current, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		expectError(t, repo.Delete(ctx, terminal.ID, current.Version-1, meta), apperrors.CodePreconditionFailed, "")
+		mustNot(t, repo.Delete(ctx, terminal.ID, current.Version, meta))
+		expectError(t, repo.Delete(ctx, terminal.ID, current.Version, meta), apperrors.CodeNotFound, "")
+		_, err = repo.GetByID(ctx, terminal.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+
+		// Журналы точки удаляются вместе с ней
+		history, err := repo.GetBalanceHistory(ctx, terminal.ID)
+		mustNot(t, err)
+		bindings, err := repository.NewFiscalRepository(db).GetBindings(ctx, first.ID)
+		mustNot(t, err)
+		if len(history) != 0 || len(bindings) != 0 {
+			t.Errorf("%d balance movements and %d bindings left after deletion", len(history), len(bindings))
+		}
+	})
+}
+
+func TestTerminalList(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewTerminalRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+
+	base := time.Now().Truncate(time.Second)
+	setLastRequest := func(id int, at *time.Time) {
+		t.Helper()
+		terminal, err := repo.GetByID(ctx, id)
+		mustNot(t, err)
+		terminal.LastRequestDate = at
+		mustNot(t, repo.Update(ctx, terminal, meta))
+	}
+	earlier, later := base.Add(-2*time.Hour), base.Add(-time.Hour)
+
+	// t1 и t4 ни разу не обращались; у t3 обращение есть и он на связи
+	t1 := createTerminal(t, db, "CR-1", nil, owner.ID).ID
+	t2 := createTerminal(t, db, "CR-2", nil, owner.ID).ID
+	t3 := createTerminal(t, db, "CR-3", nil, other.ID).ID
+	acme := terminalRequest("CR-4", other.ID)
+	acme.INN, acme.CompanyName = innAdmin, "Acme"
+	created, err := repo.Create(ctx, acme, nil, meta)
+	mustNot(t, err)
+	t4 := created.ID
+
+	setLastRequest(t2, &earlier)
+	_, err = repo.CheckIn(ctx, "CR-3", "M-CR-3", nil)
+	mustNot(t, err)
+	setLastRequest(t3, &later)
+	changeStatus(t, db, t2, models.TerminalRegistered, models.TerminalActive)
+	mustNot(t, repo.ApplyBalanceMovement(ctx, &models.BalanceMovement{TerminalID: t1, Kind: models.BalanceMovementTopUp, Amount: 5}))
+
+	online := true
+	between := base.Add(-90 * time.Minute).In(time.FixedZone("UTC+5", 5*60*60))
+	cases := []struct {
+		name   string
+		filter models.TerminalFilter
+		want   []int
+	}{
+		{"all", models.TerminalFilter{}, []int{t1, t2, t3, t4}},
+		{"by INN", models.TerminalFilter{INN: innSpare}, []int{t1, t2, t3}},
+		{"by company name", models.TerminalFilter{CompanyName: "acm"}, []int{t4}},
+		{"by user", models.TerminalFilter{UserID: &other.ID}, []int{t3, t4}},
+		{"by status", models.TerminalFilter{Status: models.TerminalActive}, []int{t2}},
+		{"online", models.TerminalFilter{IsOnline: &online}, []int{t3}},
+		{"requested since", models.TerminalFilter{LastRequestFrom: &between}, []int{t3}},
+		{"requested before", models.TerminalFilter{LastRequestTo: &between}, []int{t2}},
+		// Точки без обращений идут первыми по возрастанию и последними по убыванию
+		{"by last request", models.TerminalFilter{ListParams: models.ListParams{Sort: "last_request_date"}}, []int{t1, t4, t2, t3}},
+		{"by last request descending", models.TerminalFilter{ListParams: models.ListParams{Sort: "last_request_date", Desc: true}}, []int{t3, t2, t4, t1}},
+		{"by company", models.TerminalFilter{ListParams: models.ListParams{Sort: "company_name"}}, []int{t4, t1, t2, t3}},
+		{"by balance", models.TerminalFilter{ListParams: models.ListParams{Sort: "free_record_balance"}}, []int{t2, t3, t4, t1}},
+		{"by cash register descending", models.TerminalFilter{ListParams: models.ListParams{Sort: "cash_register_number", Desc: true}}, []int{t4, t3, t2, t1}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, limit := range []int{1, 3, 0} {
+				params := tc.filter.ListParams
+				params.Limit = limit
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.Terminal, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := repo.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					if list.Total != len(tc.want) {
+						t.Errorf("total %d, want %d", list.Total, len(tc.want))
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(terminal models.Terminal) int { return terminal.ID })
+				expectIDs(t, ids, tc.want...)
+			}
+
+			var exported []int
+			mustNot(t, repo.Export(ctx, tc.filter, func(terminal *models.Terminal) error {
+				exported = append(exported, terminal.ID)
+				return nil
+			}))
+			expectIDs(t, exported, tc.want...)
+		})
+	}
+
+	_, err = repo.List(ctx, models.TerminalFilter{ListParams: models.ListParams{Sort: "address"}})
+	expectError(t, err, apperrors.CodeBadRequest, "")
+	err = repo.Export(ctx, models.TerminalFilter{ListParams: models.ListParams{Sort: "address"}}, func(*models.Terminal) error { return nil })
+	expectError(t, err, apperrors.CodeBadRequest, "")
+}
+
+func TestTerminalStatusAndBalance(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewTerminalRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	cashier := createUser(t, db, "cashier", innOwner)
+	module := createModule(t, db, "F-1", "FN-1", owner.ID)
+	terminal := createTerminal(t, db, "CR-1", &module.ID, owner.ID)
+
+	t.Run("status", func(t *testing.T) {
+		change := &models.TerminalStatusChange{TerminalID: terminal.ID, FromStatus: models.TerminalRegistered, ToStatus: models.TerminalActive, Reason: "installed", ActorID: &cashier.ID}
+		mustNot(t, repo.ChangeStatus(ctx, change, meta))
+		if change.ID == 0 || change.ChangedAt.IsZero() {
+			t.Fatalf("recorded change %+v", change)
+		}
+		stored, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.Status != models.TerminalActive || stored.Version != 2 || !stored.StatusChangedAt.Equal(change.ChangedAt) {
+			t.Errorf("terminal after activation %+v", stored)
+		}
+
+		// Статус уже изменился: переход из registered больше невозможен
+		again := *change
+		expectError(t, repo.ChangeStatus(ctx, &again, meta), apperrors.CodeConflict, "")
+		missing := models.TerminalStatusChange{TerminalID: 999, FromStatus: models.TerminalRegistered, ToStatus: models.TerminalActive}
+		expectError(t, repo.ChangeStatus(ctx, &missing, meta), apperrors.CodeNotFound, "")
+		invalid := models.TerminalStatusChange{TerminalID: terminal.ID, FromStatus: models.TerminalActive, ToStatus: "lost"}
+		expectError(t, repo.ChangeStatus(ctx, &invalid, meta), apperrors.CodeValidation, "")
+	})
+
+	t.Run("balance", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			status   models.TerminalStatus // статус, в который точка переводится перед движением
+			movement models.BalanceMovement
+			balance  int
+			code     apperrors.Code
+		}{
+			{name: "top up", movement: models.BalanceMovement{Kind: models.BalanceMovementTopUp, Amount: 5, ActorID: &cashier.ID, Reason: "payment"}, balance: 15},
+			{name: "consume", movement: models.BalanceMovement{Kind: models.BalanceMovementConsumption, Amount: -1}, balance: 14},
+			{name: "overdraw", movement: models.BalanceMovement{Kind: models.BalanceMovementConsumption, Amount: -15}, balance: 14, code: apperrors.CodeConflict},
+			{name: "zero amount", movement: models.BalanceMovement{Kind: models.BalanceMovementCorrection}, balance: 14, code: apperrors.CodeValidation},
+			{name: "consume while blocked", status: models.TerminalBlocked, movement: models.BalanceMovement{Kind: models.BalanceMovementConsumption, Amount: -1}, balance: 14, code: apperrors.CodeConflict},
+			{name: "top up while blocked", movement: models.BalanceMovement{Kind: models.BalanceMovementTopUp, Amount: 1}, balance: 15},
+			{name: "correction down to zero", status: models.TerminalActive, movement: models.BalanceMovement{Kind: models.BalanceMovementCorrection, Amount: -15}, balance: 0},
+		}
+		current := models.TerminalActive
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				if tc.status != "" {
+					changeStatus(t, db, terminal.ID, current, tc.status)
+					current = tc.status
+				}
+				before, err := repo.GetByID(ctx, terminal.ID)
+				mustNot(t, err)
+				movement := tc.movement
+				movement.TerminalID = terminal.ID
+				err = repo.ApplyBalanceMovement(ctx, &movement)
+				if tc.code != "" {
+					expectError(t, err, tc.code, "")
+				} else {
+					mustNot(t, err)
+					if movement.ID == 0 || movement.BalanceAfter != tc.balance || movement.CreatedAt.IsZero() {
+						t.Errorf("applied movement %+v, want balance %d", movement, tc.balance)
+					}
+				}
+				stored, err := repo.GetByID(ctx, terminal.ID)
+				mustNot(t, err)
+				if stored.FreeRecordBalance != tc.balance {
+					t.Errorf("balance %d, want %d", stored.FreeRecordBalance, tc.balance)
+				}
+				// Движение меняет представление точки, поэтому увеличивает её версию
+				want := before.Version + 1
+				if tc.code != "" {
+					want = before.Version
+				}
+				if stored.Version != want {
+					t.Errorf("version %d, want %d", stored.Version, want)
+				}
+			})
+		}
+
+		missing := models.BalanceMovement{TerminalID: 999, Kind: models.BalanceMovementTopUp, Amount: 1}
+		expectError(t, repo.ApplyBalanceMovement(ctx, &missing), apperrors.CodeNotFound, "")
+	})
+
+	t.Run("history", func(t *testing.T) {
+		// Удаление автора обнуляет ссылки на него, но не записи журналов
+		mustNot(t, repository.NewUserRepository(db).Delete(ctx, cashier.ID, cashier.Version, meta))
+
+		movements, err := repo.GetBalanceHistory(ctx, terminal.ID)
+		mustNot(t, err)
+		wantAfter := []int{10, 15, 14, 15, 0}
+		if len(movements) != len(wantAfter) {
+			t.Fatalf("got %d movements, want %d", len(movements), len(wantAfter))
+		}
+		for i, movement := range movements {
+			if movement.BalanceAfter != wantAfter[i] || movement.ActorID != nil || movement.TerminalID != terminal.ID {
+				t.Errorf("movement %d: %+v, want balance %d", i, movement, wantAfter[i])
+			}
+			if i > 0 && movement.ID <= movements[i-1].ID {
+				t.Errorf("movements out of order: %d after %d", movement.ID, movements[i-1].ID)
+			}
+		}
+		if movements[0].Kind != models.BalanceMovementCorrection || movements[0].Reason != "opening balance" || movements[1].Reason != "payment" {
+			t.Errorf("movements %+v", movements[:2])
+		}
+
+		changes, err := repo.GetStatusHistory(ctx, terminal.ID)
+		mustNot(t, err)
+		wantTo := []models.TerminalStatus{models.TerminalActive, models.TerminalBlocked, models.TerminalActive}
+		if len(changes) != len(wantTo) {
+			t.Fatalf("got %d status changes, want %d", len(changes), len(wantTo))
+		}
+		from := models.TerminalRegistered
+		for i, change := range changes {
+			if change.FromStatus != from || change.ToStatus != wantTo[i] || change.ActorID != nil {
+				t.Errorf("change %d: %+v, want %s -> %s", i, change, from, wantTo[i])
+			}
+			from = change.ToStatus
+		}
+
+		empty, err := repo.GetStatusHistory(ctx, 999)
+		mustNot(t, err)
+		none, err := repo.GetBalanceHistory(ctx, 999)
+		mustNot(t, err)
+		if empty == nil || len(empty) != 0 || none == nil || len(none) != 0 {
+			t.Errorf("history of a missing terminal: %#v, %#v", empty, none)
+		}
+	})
+
+	t.Run("decommission", func(t *testing.T) {
+		_, err := repo.CheckIn(ctx, "CR-1", "M-CR-1", nil)
+		mustNot(t, err)
+
+		// Открытую смену нужно закрыть Z-отчётом, пока у точки есть модуль
+		_, err = repo.OpenShift(ctx, terminal.ID, &owner.ID)
+		mustNot(t, err)
+		open := &models.TerminalStatusChange{TerminalID: terminal.ID, FromStatus: models.TerminalActive, ToStatus: models.TerminalDecommissioned, Reason: "closed"}
+		expectError(t, repo.ChangeStatus(ctx, open, meta), apperrors.CodeConflict, "")
+		stored, err := repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.Status != models.TerminalActive || stored.FiscalModuleID == nil {
+			t.Fatalf("terminal with an open shift changed: %+v", stored)
+		}
+		_, err = repo.CloseShift(ctx, terminal.ID, &owner.ID)
+		mustNot(t, err)
+		changeStatus(t, db, terminal.ID, models.TerminalActive, models.TerminalDecommissioned)
+
+		stored, err = repo.GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if stored.FiscalModuleID != nil || stored.IsOnline || stored.Status != models.TerminalDecommissioned {
+			t.Errorf("decommissioned terminal %+v", stored)
+		}
+		current, err := repository.NewFiscalRepository(db).GetCurrentTerminal(ctx, module.ID)
+		mustNot(t, err)
+		if current != nil {
+			t.Errorf("module still bound to %+v", current)
+		}
+
+		expectError(t, repo.Update(ctx, stored, meta), apperrors.CodeConflict, "")
+		_, err = repo.CheckIn(ctx, "CR-1", "M-CR-1", nil)
+		if err != sql.ErrNoRows {
+			t.Errorf("check-in of a decommissioned terminal: %v", err)
+		}
+		consume := models.BalanceMovement{TerminalID: terminal.ID, Kind: models.BalanceMovementConsumption, Amount: -1}
+		expectError(t, repo.ApplyBalanceMovement(ctx, &consume), apperrors.CodeConflict, "")
+	})
+}
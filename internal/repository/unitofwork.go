@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/lib/pq"
+)
+
+// executor — общий интерфейс соединений и транзакций для чтения и записи
+type executor interface {
+	queryer
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// txn — транзакция, открытая репозиторием: транзакция базы или точка сохранения
+// внутри транзакции единицы работы
+type txn interface {
+	executor
+	Commit() error
+	Rollback() error
+}
+
+// conn — то, через что работает репозиторий: пул соединений или транзакция единицы работы.
+// Методы, меняющие несколько строк, открывают через begin свою транзакцию; внутри
+// единицы работы она становится точкой сохранения.
+type conn interface {
+	executor
+	begin(ctx context.Context) (txn, error)
+}
+
+// pool — пул соединений; каждая транзакция репозитория — отдельная транзакция базы
+type pool struct {
+	*sql.DB
+}
+
+func (p pool) begin(ctx context.Context) (txn, error) {
+	return p.BeginTx(ctx, nil)
+}
+
+// scope — транзакция единицы работы. Не предназначена для одновременного
+// использования из нескольких горутин, как и *sql.Tx.
+type scope struct {
+	*sql.Tx
+	db         *sql.DB
+	savepoints int
+}
+
+func (s *scope) begin(ctx context.Context) (txn, error) {
+	s.savepoints++
+	name := fmt.Sprintf("sp_%d", s.savepoints)
+	if _, err := s.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+	return &savepoint{executor: s.Tx, ctx: ctx, name: name}, nil
+}
+
+// savepoint — вложенная транзакция. Откат возвращает транзакцию единицы работы
+// в состояние на момент begin, в том числе после ошибки запроса.
+type savepoint struct {
+	executor
+	ctx  context.Context
+	name string
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.ExecContext(s.ctx, "RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+s.name+"; RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
+// Tx — репозитории, работающие в одной транзакции единицы работы
+type Tx struct {
+	Users     *UserRepository
+	Sessions  *SessionRepository
+	Companies *CompanyRepository
+	Fiscal    *FiscalRepository
+	Terminals *TerminalRepository
+	Receipts  *ReceiptRepository
+}
+
+func newTx(c conn) *Tx {
+	return &Tx{
+		Users:     &UserRepository{db: c},
+		Sessions:  &SessionRepository{db: c},
+		Companies: &CompanyRepository{db: c},
+		Fiscal:    &FiscalRepository{db: c},
+		Terminals: &TerminalRepository{db: c},
+		Receipts:  &ReceiptRepository{db: c},
+	}
+}
+
+// unitOfWorkAttempts — сколько раз выполняется функция единицы работы,
+// если транзакция не может быть сериализована
+const unitOfWorkAttempts = 3
+
+// unitOfWorkBackoff — пауза перед повтором, растущая с номером попытки
+const unitOfWorkBackoff = 20 * time.Millisecond
+
+type scopeKey struct{}
+
+// UnitOfWork выполняет функции в сериализуемых транзакциях с репозиториями этих транзакций
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do выполняет fn с репозиториями одной транзакции и фиксирует её, если fn вернула nil,
+// иначе откатывает. При ошибке сериализации или взаимной блокировке fn выполняется
+// заново в новой транзакции, поэтому она не должна иметь побочных эффектов вне базы.
+// Вызов Do с контекстом, полученным fn, выполняется в точке сохранения той же транзакции:
+// его ошибка откатывает только его изменения, а повтор делает внешний вызов.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	if outer, ok := ctx.Value(scopeKey{}).(*scope); ok && outer.db == u.db {
+		return u.nested(ctx, outer, fn)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := u.run(ctx, fn)
+		if err == nil || attempt == unitOfWorkAttempts || !isRetryable(err) {
+			return err
+		}
+		logger.InfoLogger.Printf("Retrying transaction after attempt %d: %v", attempt, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * unitOfWorkBackoff):
+		}
+	}
+}
+
+func (u *UnitOfWork) run(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	sqlTx, err := u.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	s := &scope{Tx: sqlTx, db: u.db}
+	if err := fn(context.WithValue(ctx, scopeKey{}, s), newTx(s)); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func (u *UnitOfWork) nested(ctx context.Context, outer *scope, fn func(ctx context.Context, tx *Tx) error) error {
+	sp, err := outer.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer sp.Rollback()
+
+	if err := fn(ctx, newTx(outer)); err != nil {
+		return err
+	}
+	return sp.Commit()
+}
+
+// isRetryable сообщает, завершилась ли транзакция ошибкой сериализации
+// или взаимной блокировкой, после которых её можно повторить
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -0,0 +1,109 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	db := newTestDB(t)
+	uow := repository.NewUnitOfWork(db)
+	users := repository.NewUserRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+	errAbort := errors.New("abort")
+
+	t.Run("commit", func(t *testing.T) {
+		var terminal *models.Terminal
+		err := uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+			module := &models.FiscalModule{FactoryNumber: "F-1", FiscalNumber: "FN-1", UserID: owner.ID}
+			if err := tx.Fiscal.Create(ctx, module, meta); err != nil {
+				return err
+			}
+			var err error
+			terminal, err = tx.Terminals.Create(ctx, terminalRequest("CR-1", owner.ID), &module.ID, meta)
+			return err
+		})
+		mustNot(t, err)
+		got, err := repository.NewTerminalRepository(db).GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if got.FiscalModuleID == nil {
+			t.Error("terminal created without its module")
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		var created *models.User
+		err := uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+			created = &models.User{INN: innSpare, Username: "rolled-back", Password: "hash", Role: models.RoleOwner}
+			if err := tx.Users.Create(ctx, created, meta); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("error %v, want %v", err, errAbort)
+		}
+		_, err = users.GetByID(ctx, created.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	// Ошибка вложенной единицы работы, в том числе ошибка запроса,
+	// откатывает только её изменения
+	t.Run("nested", func(t *testing.T) {
+		var kept, dropped *models.User
+		err := uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+			kept = &models.User{INN: innSpare, Username: "kept", Password: "hash", Role: models.RoleOwner}
+			if err := tx.Users.Create(ctx, kept, meta); err != nil {
+				return err
+			}
+			err := uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+				dropped = &models.User{INN: innSpare, Username: "dropped", Password: "hash", Role: models.RoleOwner}
+				if err := tx.Users.Create(ctx, dropped, meta); err != nil {
+					return err
+				}
+				return tx.Users.Create(ctx, &models.User{INN: innSpare, Username: "kept", Password: "hash", Role: models.RoleOwner}, meta)
+			})
+			expectError(t, err, apperrors.CodeConflict, "username")
+			return nil
+		})
+		mustNot(t, err)
+		_, err = users.GetByID(ctx, kept.ID)
+		mustNot(t, err)
+		_, err = users.GetByID(ctx, dropped.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("delete reassigning", func(t *testing.T) {
+		terminal := createTerminal(t, db, "CR-2", nil, owner.ID)
+		changeStatus(t, db, terminal.ID, models.TerminalRegistered, models.TerminalDecommissioned)
+		err := uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+			terminals, err := tx.Terminals.Reassign(ctx, owner.ID, other.ID, meta)
+			if err != nil {
+				return err
+			}
+			modules, err := tx.Fiscal.Reassign(ctx, owner.ID, other.ID, meta)
+			if err != nil {
+				return err
+			}
+			if terminals != 2 || modules != 1 {
+				t.Errorf("reassigned %d terminals and %d modules, want 2 and 1", terminals, modules)
+			}
+			return tx.Users.Delete(ctx, owner.ID, owner.Version, meta)
+		})
+		mustNot(t, err)
+
+		moved, err := repository.NewTerminalRepository(db).GetByID(ctx, terminal.ID)
+		mustNot(t, err)
+		if moved.UserID != other.ID || moved.Version != terminal.Version+2 {
+			t.Errorf("decommissioned terminal after reassignment %+v", moved)
+		}
+		_, err = users.GetByID(ctx, owner.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+}
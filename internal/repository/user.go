@@ -8,73 +8,152 @@ import (
 )
 
 type UserRepository struct {
-	db *sql.DB
+	db conn
 }
 
 func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+	return &UserRepository{db: pool{db}}
 }
 
-func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
-	query := "SELECT id, inn, username, password, is_active, is_admin FROM users WHERE username=$1"
-	row := r.db.QueryRowContext(ctx, query, username)
+const userColumns = "id, inn, username, password, is_active, is_admin, role, version"
 
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
 	var user models.User
-	err := row.Scan(&user.ID, &user.INN, &user.Username, &user.Password, &user.IsActive, &user.IsAdmin)
+	err := row.Scan(&user.ID, &user.INN, &user.Username, &user.Password, &user.IsActive, &user.IsAdmin, &user.Role, &user.Version)
 	if err != nil {
 		return nil, err
 	}
-
 	return &user, nil
 }
 
-func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	query := "INSERT INTO users (inn, username, password, is_active, is_admin) VALUES ($1, $2, $3, $4, $5) RETURNING id"
-	err := r.db.QueryRowContext(ctx, query, user.INN, user.Username, user.Password, user.IsActive, user.IsAdmin).Scan(&user.ID)
-	return err
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE username=$1"
+	return scanUser(r.db.QueryRowContext(ctx, query, username))
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
-	query := "SELECT id, inn, username, password, is_active, is_admin FROM users WHERE id=$1"
-	row := r.db.QueryRowContext(ctx, query, id)
+// Create добавляет пользователя и записывает создание в журнал аудита.
+// Компания с ИНН пользователя создаётся, если её ещё нет.
+func (r *UserRepository) Create(ctx context.Context, user *models.User, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	var user models.User
-	err := row.Scan(&user.ID, &user.INN, &user.Username, &user.Password, &user.IsActive, &user.IsAdmin)
+	if err := ensureCompany(ctx, tx, user.INN, "", meta); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO users (inn, username, password, is_active, is_admin, role) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, version"
+	err = tx.QueryRowContext(ctx, query, user.INN, user.Username, user.Password, user.IsActive, user.IsAdmin, user.Role).Scan(&user.ID, &user.Version)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &user, nil
+	if err := writeAudit(ctx, tx, meta, models.AuditUser, user.ID, models.AuditCreate, nil, user); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	query := "UPDATE users SET inn=$1, username=$2, password=$3, is_active=$4, is_admin=$5 WHERE id=$6"
-	_, err := r.db.ExecContext(ctx, query, user.INN, user.Username, user.Password, user.IsActive, user.IsAdmin, user.ID)
-	return err
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id=$1"
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id int) error {
-	query := "DELETE FROM users WHERE id=$1"
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+// Update перезаписывает пользователя, если его версия всё ещё равна user.Version,
+// увеличивает версию и записывает изменённые поля в журнал аудита
+func (r *UserRepository) Update(ctx context.Context, user *models.User, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanUser(tx.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1 FOR UPDATE", user.ID))
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, user.Version); err != nil {
+		return err
+	}
+	if user.INN != before.INN {
+		if err := ensureCompany(ctx, tx, user.INN, "", meta); err != nil {
+			return err
+		}
+	}
+
+	query := "UPDATE users SET inn=$1, username=$2, password=$3, is_active=$4, is_admin=$5, role=$6, version=version+1, updated_at=now() WHERE id=$7 RETURNING version"
+	err = tx.QueryRowContext(ctx, query, user.INN, user.Username, user.Password, user.IsActive, user.IsAdmin, user.Role, user.ID).Scan(&user.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditUser, user.ID, models.AuditUpdate, before, user); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *UserRepository) GetAll(ctx context.Context) ([]models.User, error) {
-	query := "SELECT id, inn, username, password, is_active, is_admin FROM users"
-	rows, err := r.db.QueryContext(ctx, query)
+// Delete удаляет пользователя версии version и сохраняет его последнее состояние в журнале аудита
+func (r *UserRepository) Delete(ctx context.Context, id, version int, meta models.AuditMeta) error {
+	tx, err := r.db.begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.INN, &user.Username, &user.Password, &user.IsActive, &user.IsAdmin)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, user)
+	before, err := scanUser(tx.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1 FOR UPDATE", id))
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=$1", id); err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, meta, models.AuditUser, id, models.AuditDelete, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var userPage = pageSpec{
+	table:   "users",
+	columns: userColumns,
+	sorts: map[string]sortColumn{
+		"id":       {expr: "id", cast: "int"},
+		"inn":      {expr: "inn", cast: "text"},
+		"username": {expr: "username", cast: "text"},
+	},
+}
+
+// List возвращает страницу пользователей, удовлетворяющих фильтру
+func (r *UserRepository) List(ctx context.Context, filter models.UserFilter) (*models.UserList, error) {
+	where := &whereBuilder{}
+	if filter.INN != "" {
+		where.add("inn = ?", filter.INN)
+	}
+	if filter.Username != "" {
+		where.add("username ILIKE ?", containsPattern(filter.Username))
+	}
+	if filter.Role != "" {
+		where.add("role = ?", filter.Role)
+	}
+	if filter.IsActive != nil {
+		where.add("is_active = ?", *filter.IsActive)
+	}
+
+	items, total, next, err := fetchPage(ctx, r.db, userPage, where, filter.ListParams,
+		func(rows *sql.Rows, user *models.User, sortKey *string) error {
+			return rows.Scan(&user.ID, &user.INN, &user.Username, &user.Password, &user.IsActive, &user.IsAdmin, &user.Role, &user.Version, sortKey)
+		},
+		func(user *models.User) int { return user.ID })
+	if err != nil {
+		return nil, err
 	}
-	return users, nil
+	return &models.UserList{Items: models.NewUserResponses(items), Total: total, NextCursor: next}, nil
 }
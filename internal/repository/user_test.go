@@ -0,0 +1,374 @@
+package repository_test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+func TestUserRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewUserRepository(db)
+
+	user := createUser(t, db, "a_b", innOwner)
+	if user.ID == 0 || user.Version != 1 {
+		t.Fatalf("created user %+v, want an ID and version 1", user)
+	}
+	createUser(t, db, "axb", innOther)
+	admin := &models.User{INN: innAdmin, Username: "admin", Password: "hash", IsActive: true, IsAdmin: true, Role: models.RoleAdmin}
+	mustNot(t, repo.Create(ctx, admin, meta))
+
+	t.Run("create", func(t *testing.T) {
+		cases := []struct {
+			name  string
+			user  models.User
+			code  apperrors.Code
+			field string
+		}{
+			{"duplicate username", models.User{INN: innSpare, Username: "a_b", Password: "hash", Role: models.RoleOwner}, apperrors.CodeConflict, "username"},
+			{"unknown role", models.User{INN: innSpare, Username: "root", Password: "hash", Role: "root"}, apperrors.CodeValidation, ""},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				expectError(t, repo.Create(ctx, &tc.user, meta), tc.code, tc.field)
+			})
+		}
+
+		// Компания с ИНН пользователя создаётся без названия
+		companies, err := repository.NewCompanyRepository(db).List(ctx, models.CompanyFilter{INN: innOwner})
+		mustNot(t, err)
+		if companies.Total != 1 || companies.Items[0].LegalName != "" {
+			t.Errorf("companies for %s: %+v", innOwner, companies.Items)
+		}
+		// Неудачное создание откатывает и компанию
+		companies, err = repository.NewCompanyRepository(db).List(ctx, models.CompanyFilter{INN: innSpare})
+		mustNot(t, err)
+		if companies.Total != 0 {
+			t.Errorf("failed user creation left company %+v", companies.Items)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		byName, err := repo.GetByUsername(ctx, "a_b")
+		mustNot(t, err)
+		byID, err := repo.GetByID(ctx, user.ID)
+		mustNot(t, err)
+		if *byName != *user || *byID != *user {
+			t.Errorf("got %+v and %+v, want %+v", byName, byID, user)
+		}
+
+		_, err = repo.GetByUsername(ctx, "nobody")
+		expectError(t, err, apperrors.CodeNotFound, "")
+		_, err = repo.GetByID(ctx, 999)
+		expectError(t, err, apperrors.CodeNotFound, "")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		changed := *user
+		changed.INN = innSpare
+		changed.Role = models.RoleTechnician
+		mustNot(t, repo.Update(ctx, &changed, meta))
+		if changed.Version != 2 {
+			t.Errorf("version %d after update, want 2", changed.Version)
+		}
+		stored, err := repo.GetByID(ctx, user.ID)
+		mustNot(t, err)
+		if *stored != changed {
+			t.Errorf("stored %+v, want %+v", stored, changed)
+		}
+		// Новый ИНН заводит компанию
+		companies, err := repository.NewCompanyRepository(db).List(ctx, models.CompanyFilter{INN: innSpare})
+		mustNot(t, err)
+		if companies.Total != 1 {
+			t.Errorf("no company created for the new INN %s", innSpare)
+		}
+
+		stale := changed
+		stale.Version = 1
+		expectError(t, repo.Update(ctx, &stale, meta), apperrors.CodePreconditionFailed, "")
+
+		duplicate := changed
+		duplicate.Username = "axb"
+		expectError(t, repo.Update(ctx, &duplicate, meta), apperrors.CodeConflict, "username")
+
+		missing := changed
+		missing.ID = 999
+		expectError(t, repo.Update(ctx, &missing, meta), apperrors.CodeNotFound, "")
+		*user = changed
+	})
+
+	t.Run("list", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			filter models.UserFilter
+			want   []int
+		}{
+			{"all", models.UserFilter{}, []int{user.ID, user.ID + 1, admin.ID}},
+			{"by role", models.UserFilter{Role: models.RoleAdmin}, []int{admin.ID}},
+			{"by INN", models.UserFilter{INN: innOther}, []int{user.ID + 1}},
+			// Подчёркивание в подстроке ищется буквально, а не как шаблон ILIKE
+			{"by username", models.UserFilter{Username: "A_"}, []int{user.ID}},
+			{"by username descending", models.UserFilter{ListParams: models.ListParams{Sort: "username", Desc: true}}, []int{user.ID + 1, admin.ID, user.ID}},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				params := tc.filter.ListParams
+				params.Limit = 1
+				ids := pageIDs(t, params, func(params models.ListParams) ([]models.UserResponse, string, error) {
+					filter := tc.filter
+					filter.ListParams = params
+					list, err := repo.List(ctx, filter)
+					if err != nil {
+						return nil, "", err
+					}
+					if list.Total != len(tc.want) {
+						t.Errorf("total %d, want %d", list.Total, len(tc.want))
+					}
+					return list.Items, list.NextCursor, nil
+				}, func(user models.UserResponse) int { return user.ID })
+				expectIDs(t, ids, tc.want...)
+			})
+		}
+
+		_, err := repo.List(ctx, models.UserFilter{ListParams: models.ListParams{Sort: "password"}})
+		expectError(t, err, apperrors.CodeBadRequest, "")
+		_, err = repo.List(ctx, models.UserFilter{ListParams: models.ListParams{Cursor: "garbage"}})
+		expectError(t, err, apperrors.CodeBadRequest, "")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		createModule(t, db, "F-1", "FN-1", admin.ID)
+		expectError(t, repo.Delete(ctx, admin.ID, admin.Version, meta), apperrors.CodeConflict, "")
+
+		session := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+		mustNot(t, repository.NewSessionRepository(db).Create(ctx, session, tokenHash("a")))
+
+		expectError(t, repo.Delete(ctx, user.ID, 1, meta), apperrors.CodePreconditionFailed, "")
+		mustNot(t, repo.Delete(ctx, user.ID, user.Version, meta))
+		expectError(t, repo.Delete(ctx, user.ID, user.Version, meta), apperrors.CodeNotFound, "")
+
+		// Сессии удалённого пользователя удаляются вместе с ним
+		var sessions int
+		mustNot(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sessions WHERE user_id=$1", user.ID).Scan(&sessions))
+		if sessions != 0 {
+			t.Errorf("%d sessions left after deleting the user", sessions)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		records, err := repository.NewAuditRepository(db).List(ctx, models.AuditFilter{EntityType: models.AuditUser, EntityID: &user.ID})
+		mustNot(t, err)
+		var actions []string
+		for _, record := range records.Items {
+			actions = append(actions, string(record.Action))
+		}
+		if strings.Join(actions, ",") != "create,update,delete" {
+			t.Fatalf("audit actions %v, want create, update, delete", actions)
+		}
+		if change := records.Items[0].Changes["password"]; change.New != "******" {
+			t.Errorf("password recorded as %v", change.New)
+		}
+		if records.Items[0].RequestID != meta.RequestID || records.Items[0].IP != meta.IP || records.Items[0].ActorID != nil {
+			t.Errorf("audit meta %+v", records.Items[0])
+		}
+	})
+}
+
+// tokenHash возвращает хеш refresh токена длиной 64 символа
+func tokenHash(seed string) string {
+	return strings.Repeat(seed, 64/len(seed))
+}
+
+func TestSessionRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewSessionRepository(db)
+	user := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+
+	// Смещение зоны не должно сдвигать срок действия: время сохраняется как момент, а не как показания часов
+	east := time.FixedZone("UTC+5", 5*60*60)
+	west := time.FixedZone("UTC-5", -5*60*60)
+	newSession := func(t *testing.T, userID int, hash string, expiresAt time.Time) *models.Session {
+		t.Helper()
+		session := &models.Session{UserID: userID, UserAgent: "test", IP: "10.0.0.1", ExpiresAt: expiresAt}
+		mustNot(t, repo.Create(ctx, session, hash))
+		if session.ID == 0 || session.CreatedAt.IsZero() || session.LastUsedAt.IsZero() {
+			t.Fatalf("created session %+v", session)
+		}
+		return session
+	}
+
+	t.Run("create", func(t *testing.T) {
+		newSession(t, user.ID, tokenHash("a"), time.Now().Add(time.Hour))
+		err := repo.Create(ctx, &models.Session{UserID: other.ID, ExpiresAt: time.Now().Add(time.Hour)}, tokenHash("a"))
+		expectError(t, err, apperrors.CodeConflict, "refresh_token_hash")
+		err = repo.Create(ctx, &models.Session{UserID: 999, ExpiresAt: time.Now().Add(time.Hour)}, tokenHash("z"))
+		expectError(t, err, apperrors.CodeInvalidReference, "user_id")
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			hash      string
+			expiresAt time.Time
+			active    bool
+		}{
+			{"future in a western zone", tokenHash("b"), time.Now().Add(time.Hour).In(west), true},
+			{"past in an eastern zone", tokenHash("c"), time.Now().Add(-time.Minute).In(east), false},
+			{"past in UTC", tokenHash("d"), time.Now().Add(-time.Minute).UTC(), false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				session := newSession(t, user.ID, tc.hash, tc.expiresAt)
+				_, err := repo.GetActiveUser(ctx, session.ID, user.ID)
+				if active := err == nil; active != tc.active {
+					t.Fatalf("active %v (%v), want %v", active, err, tc.active)
+				}
+				_, err = repo.Rotate(ctx, tc.hash, tokenHash(tc.hash[:1]+"x"), time.Now().Add(time.Hour))
+				if rotated := err == nil; rotated != tc.active {
+					t.Fatalf("rotated %v (%v), want %v", rotated, err, tc.active)
+				}
+			})
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		session := newSession(t, user.ID, tokenHash("e"), time.Now().Add(time.Hour))
+		expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Second).In(east)
+		rotated, err := repo.Rotate(ctx, tokenHash("e"), tokenHash("f"), expiresAt)
+		mustNot(t, err)
+		if rotated.ID != session.ID || rotated.UserID != user.ID || rotated.UserAgent != "test" || rotated.IP != "10.0.0.1" {
+			t.Errorf("rotated session %+v, want %+v", rotated, session)
+		}
+		if !rotated.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("expires at %v, want %v", rotated.ExpiresAt, expiresAt)
+		}
+
+		_, err = repo.Rotate(ctx, tokenHash("e"), tokenHash("g"), expiresAt)
+		expectError(t, err, apperrors.CodeNotFound, "")
+
+		// Повторное предъявление заменённого токена отзывает сессию
+		revoked, err := repo.RevokeByPreviousToken(ctx, tokenHash("e"))
+		mustNot(t, err)
+		if revoked != 1 {
+			t.Errorf("revoked %d sessions, want 1", revoked)
+		}
+		_, err = repo.GetActiveUser(ctx, session.ID, user.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		_, err = repo.Rotate(ctx, tokenHash("f"), tokenHash("g"), expiresAt)
+		expectError(t, err, apperrors.CodeNotFound, "")
+		if revoked, _ := repo.RevokeByPreviousToken(ctx, tokenHash("e")); revoked != 0 {
+			t.Errorf("revoked %d sessions again", revoked)
+		}
+	})
+
+	t.Run("get active user", func(t *testing.T) {
+		session := newSession(t, user.ID, tokenHash("h"), time.Now().Add(time.Hour))
+		active, err := repo.GetActiveUser(ctx, session.ID, user.ID)
+		mustNot(t, err)
+		if active.ID != user.ID || active.Username != user.Username || active.Role != user.Role || active.Password != "" {
+			t.Errorf("active user %+v", active)
+		}
+		_, err = repo.GetActiveUser(ctx, session.ID, other.ID)
+		expectError(t, err, apperrors.CodeNotFound, "")
+
+		// Деактивация пользователя видна сразу
+		user.IsActive = false
+		mustNot(t, repository.NewUserRepository(db).Update(ctx, user, meta))
+		active, err = repo.GetActiveUser(ctx, session.ID, user.ID)
+		mustNot(t, err)
+		if active.IsActive {
+			t.Error("deactivated user reported as active")
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		session := newSession(t, other.ID, tokenHash("i"), time.Now().Add(time.Hour))
+		newSession(t, other.ID, tokenHash("j"), time.Now().Add(time.Hour))
+		newSession(t, other.ID, tokenHash("k"), time.Now().Add(time.Hour))
+
+		if err := repo.Revoke(ctx, session.ID, user.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("revoking a foreign session: %v", err)
+		}
+		mustNot(t, repo.Revoke(ctx, session.ID, other.ID))
+		if err := repo.Revoke(ctx, session.ID, other.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("revoking a revoked session: %v", err)
+		}
+
+		revoked, err := repo.RevokeAllForUser(ctx, other.ID)
+		mustNot(t, err)
+		if revoked != 2 {
+			t.Errorf("revoked %d sessions, want 2", revoked)
+		}
+		if revoked, _ := repo.RevokeAllForUser(ctx, other.ID); revoked != 0 {
+			t.Errorf("revoked %d sessions again", revoked)
+		}
+	})
+}
+
+func TestTaxIDRepository(t *testing.T) {
+	db := newTestDB(t)
+	repo := repository.NewTaxIDRepository(db)
+	owner := createUser(t, db, "owner", innOwner)
+	other := createUser(t, db, "other", innOther)
+	terminal := createTerminal(t, db, "CR-1", nil, owner.ID)
+
+	cases := []struct {
+		entity models.TaxIDEntity
+		want   []models.TaxIDRecord
+	}{
+		{models.TaxIDUser, []models.TaxIDRecord{
+			{EntityType: models.TaxIDUser, EntityID: owner.ID, INN: innOwner},
+			{EntityType: models.TaxIDUser, EntityID: other.ID, INN: innOther},
+		}},
+		{models.TaxIDTerminal, []models.TaxIDRecord{
+			{EntityType: models.TaxIDTerminal, EntityID: terminal.ID, INN: innSpare},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.entity), func(t *testing.T) {
+			var got []models.TaxIDRecord
+			mustNot(t, repo.Stream(ctx, tc.entity, func(record models.TaxIDRecord) error {
+				got = append(got, record)
+				return nil
+			}))
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("record %d is %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("company", func(t *testing.T) {
+		var inns []string
+		mustNot(t, repo.Stream(ctx, models.TaxIDCompany, func(record models.TaxIDRecord) error {
+			inns = append(inns, record.INN)
+			return nil
+		}))
+		if strings.Join(inns, ",") != strings.Join([]string{innOwner, innOther, innSpare}, ",") {
+			t.Errorf("company INNs %v", inns)
+		}
+	})
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := repo.Stream(ctx, models.TaxIDUser, func(models.TaxIDRecord) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("error %v after %d calls", err, calls)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "github.com/idkOybek/internal/apperrors"
+
+// ErrVersionMismatch возвращается, если запись изменилась после того, как клиент её прочитал
+var ErrVersionMismatch = apperrors.New(apperrors.CodePreconditionFailed, "Resource was modified by another request; reload it and retry")
+
+// checkVersion сравнивает версию заблокированной строки с версией, которую ожидает клиент
+func checkVersion(current, expected int) error {
+	if current != expected {
+		return ErrVersionMismatch
+	}
+	return nil
+}
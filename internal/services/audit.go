@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/middleware"
+	"github.com/idkOybek/internal/models"
+)
+
+type AuditService struct {
+	repo AuditRepository
+}
+
+func NewAuditService(repo AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// ListRecords возвращает страницу журнала аудита
+func (s *AuditService) ListRecords(ctx context.Context, filter models.AuditFilter) (*models.AuditRecordList, error) {
+	records, err := s.repo.List(ctx, filter)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error listing audit records: %v", err)
+		return nil, err
+	}
+	return records, nil
+}
+
+// auditMeta собирает из контекста запроса автора изменения, ID запроса и адрес клиента
+func auditMeta(ctx context.Context) models.AuditMeta {
+	var meta models.AuditMeta
+	if user, ok := middleware.GetUserFromContext(ctx); ok {
+		id := user.ID
+		meta.ActorID = &id
+	}
+	meta.RequestID, meta.IP = middleware.GetRequestInfo(ctx)
+	return meta
+}
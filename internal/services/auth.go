@@ -2,47 +2,179 @@ package services
 
 import (
 	"context"
-	"errors"
+	"time"
 
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
 	"github.com/idkOybek/internal/models"
-	"github.com/idkOybek/internal/repository"
 	"github.com/idkOybek/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials  = apperrors.New(apperrors.CodeUnauthorized, "Invalid credentials")
+	ErrUserInactive        = apperrors.New(apperrors.CodeForbidden, "User is deactivated")
+	ErrInvalidRefreshToken = apperrors.New(apperrors.CodeUnauthorized, "Invalid or expired refresh token")
+	ErrSessionRevoked      = apperrors.New(apperrors.CodeUnauthorized, "Session has been revoked or has expired")
+	ErrEmptyPassword       = &apperrors.Error{Code: apperrors.CodeValidation, Message: "Password must not be empty", Field: "password"}
+)
+
 type AuthService struct {
-	userRepo *repository.UserRepository
+	userRepo    UserRepository
+	sessionRepo SessionRepository
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
 }
 
-func NewAuthService(userRepo *repository.UserRepository) *AuthService {
-	return &AuthService{userRepo: userRepo}
+func NewAuthService(userRepo UserRepository, sessionRepo SessionRepository, accessTTL, refreshTTL time.Duration) *AuthService {
+	return &AuthService{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}
 }
 
-func (s *AuthService) RegisterUser(ctx context.Context, user models.User) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+// RegisterUser регистрирует пользователя с ролью владельца. Повышенные роли
+// назначает только администратор через /api/users.
+func (s *AuthService) RegisterUser(ctx context.Context, user *models.User) error {
+	user.Role = models.RoleOwner
+	user.IsAdmin = false
+	if err := checkTaxID(user.INN); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.HashPassword(user.Password)
 	if err != nil {
 		return err
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
-	return s.userRepo.Create(ctx, &user)
+	return s.userRepo.Create(ctx, user, auditMeta(ctx))
+}
+
+// HashPassword возвращает bcrypt-хеш пароля. Все пароли попадают в базу только через него.
+func (s *AuthService) HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", &apperrors.Error{Code: apperrors.CodeValidation, Message: err.Error(), Field: "password", Err: err}
+	}
+	return string(hashed), nil
 }
 
-func (s *AuthService) AuthenticateUser(ctx context.Context, username, password string) (*models.User, string, error) {
+// AuthenticateUser проверяет учётные данные и открывает новую сессию.
+// client несёт сведения об устройстве входа (user agent, IP).
+func (s *AuthService) AuthenticateUser(ctx context.Context, username, password string, client models.Session) (*models.User, *models.TokenPair, error) {
 	user, err := s.userRepo.GetByUsername(ctx, username)
 	if err != nil {
-		return nil, "", err
+		if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+			return nil, nil, ErrInvalidCredentials
+		}
+		return nil, nil, err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return nil, "", errors.New("invalid password")
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	token, err := utils.GenerateJWT(user)
+	if !user.IsActive {
+		return nil, nil, ErrUserInactive
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+
+	session := client
+	session.UserID = user.ID
+	session.ExpiresAt = time.Now().Add(s.refreshTTL)
+	if err := s.sessionRepo.Create(ctx, &session, refreshHash); err != nil {
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	accessToken, expiresAt, err := utils.GenerateJWT(user, session.ID, s.accessTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, &models.TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+// Refresh обменивает refresh токен на новую пару токенов. Старый refresh токен
+// перестаёт действовать; его повторное предъявление отзывает всю сессию.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	oldHash := utils.HashRefreshToken(refreshToken)
+	newToken, newHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.Rotate(ctx, oldHash, newHash, time.Now().Add(s.refreshTTL))
+	if err != nil {
+		if apperrors.Classify(err).Code != apperrors.CodeNotFound {
+			return nil, err
+		}
+		revoked, revokeErr := s.sessionRepo.RevokeByPreviousToken(ctx, oldHash)
+		if revokeErr != nil {
+			return nil, revokeErr
+		}
+		if revoked > 0 {
+			logger.ErrorLogger.Printf("Reuse of a rotated refresh token detected, revoked %d session(s)", revoked)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		if err := s.sessionRepo.Revoke(ctx, session.ID, user.ID); err != nil {
+			logger.ErrorLogger.Printf("Error revoking session %d of deactivated user %d: %v", session.ID, user.ID, err)
+		}
+		return nil, ErrUserInactive
+	}
+
+	accessToken, expiresAt, err := utils.GenerateJWT(user, session.ID, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{AccessToken: accessToken, RefreshToken: newToken, ExpiresAt: expiresAt}, nil
+}
+
+// Logout отзывает текущую сессию пользователя
+func (s *AuthService) Logout(ctx context.Context, sessionID, userID int) error {
+	if err := s.sessionRepo.Revoke(ctx, sessionID, userID); err != nil {
+		if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	return nil
+}
+
+// LogoutEverywhere отзывает все сессии пользователя и возвращает их количество
+func (s *AuthService) LogoutEverywhere(ctx context.Context, userID int) (int64, error) {
+	return s.sessionRepo.RevokeAllForUser(ctx, userID)
+}
+
+// ValidateSession проверяет, что сессия действует, а пользователь не деактивирован,
+// и возвращает актуальные данные пользователя
+func (s *AuthService) ValidateSession(ctx context.Context, sessionID, userID int) (*models.User, error) {
+	user, err := s.sessionRepo.GetActiveUser(ctx, sessionID, userID)
+	if err != nil {
+		if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+			return nil, ErrSessionRevoked
+		}
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	return user, nil
 }
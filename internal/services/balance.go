@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+var (
+	// ErrInvalidAmount возвращается при недопустимом количестве записей в движении
+	ErrInvalidAmount = apperrors.New(apperrors.CodeBadRequest, "Amount must be a non-zero number of records")
+	// ErrInsufficientBalance возвращается при попытке списать больше остатка
+	ErrInsufficientBalance = repository.ErrInsufficientBalance
+)
+
+// TopUp пополняет баланс бесплатных записей торговой точки
+func (s *TerminalService) TopUp(ctx context.Context, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	return s.applyBalanceMovement(ctx, terminalID, models.BalanceMovementTopUp, amount, actorID, reason)
+}
+
+// Consume списывает записи с баланса; списание сверх остатка отклоняется
+func (s *TerminalService) Consume(ctx context.Context, terminalID, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	return s.applyBalanceMovement(ctx, terminalID, models.BalanceMovementConsumption, -amount, actorID, reason)
+}
+
+// Adjust корректирует баланс на delta в любую сторону, не допуская отрицательного остатка
+func (s *TerminalService) Adjust(ctx context.Context, terminalID, delta int, actorID *int, reason string) (*models.BalanceMovement, error) {
+	if delta == 0 {
+		return nil, ErrInvalidAmount
+	}
+	return s.applyBalanceMovement(ctx, terminalID, models.BalanceMovementCorrection, delta, actorID, reason)
+}
+
+// GetBalance возвращает текущий баланс торговой точки и журнал его движений
+func (s *TerminalService) GetBalance(ctx context.Context, terminalID int) (*models.TerminalBalanceResponse, error) {
+	terminal, err := s.repo.GetByID(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving terminal %d for balance: %v", terminalID, err)
+		return nil, apperrors.NotFound(err, "Terminal not found")
+	}
+
+	history, err := s.repo.GetBalanceHistory(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving balance history for terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+
+	ledgerTotal := 0
+	for _, movement := range history {
+		ledgerTotal += movement.Amount
+	}
+	if ledgerTotal != terminal.FreeRecordBalance {
+		logger.ErrorLogger.Printf("Balance of terminal %d (%d) does not match its ledger (%d)", terminalID, terminal.FreeRecordBalance, ledgerTotal)
+	}
+
+	return &models.TerminalBalanceResponse{
+		TerminalID:  terminalID,
+		Balance:     terminal.FreeRecordBalance,
+		LedgerTotal: ledgerTotal,
+		History:     history,
+	}, nil
+}
+
+func (s *TerminalService) applyBalanceMovement(ctx context.Context, terminalID int, kind models.BalanceMovementKind, amount int, actorID *int, reason string) (*models.BalanceMovement, error) {
+	movement := &models.BalanceMovement{
+		TerminalID: terminalID,
+		Kind:       kind,
+		Amount:     amount,
+		ActorID:    actorID,
+		Reason:     reason,
+	}
+	if err := s.repo.ApplyBalanceMovement(ctx, movement); err != nil {
+		logger.ErrorLogger.Printf("Error applying %s of %d to terminal %d: %v", kind, amount, terminalID, err)
+		return nil, apperrors.NotFound(err, "Terminal not found")
+	}
+	return movement, nil
+}
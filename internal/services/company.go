@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+)
+
+type CompanyService struct {
+	repo            CompanyRepository
+	terminalService *TerminalService
+	fiscalService   *FiscalService
+}
+
+func NewCompanyService(repo CompanyRepository, terminalService *TerminalService, fiscalService *FiscalService) *CompanyService {
+	return &CompanyService{
+		repo:            repo,
+		terminalService: terminalService,
+		fiscalService:   fiscalService,
+	}
+}
+
+func (s *CompanyService) ListCompanies(ctx context.Context, filter models.CompanyFilter) (*models.CompanyList, error) {
+	return s.repo.List(ctx, filter)
+}
+
+func (s *CompanyService) GetCompanyByID(ctx context.Context, id int) (*models.Company, error) {
+	company, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, apperrors.NotFound(err, "Company not found")
+	}
+	return company, nil
+}
+
+// IsRelated сообщает, относится ли пользователь к компании: зарегистрирован с её ИНН
+// или владеет её торговой точкой
+func (s *CompanyService) IsRelated(ctx context.Context, company *models.Company, userID int) (bool, error) {
+	return s.repo.IsRelated(ctx, company.INN, userID)
+}
+
+// IsSoleOwner сообщает, может ли пользователь менять компанию: он относится к ней,
+// и других владельцев торговых точек или пользователей с её ИНН нет
+func (s *CompanyService) IsSoleOwner(ctx context.Context, company *models.Company, userID int) (bool, error) {
+	return s.repo.IsSoleOwner(ctx, company.INN, userID)
+}
+
+func (s *CompanyService) CreateCompany(ctx context.Context, company *models.Company) error {
+	if err := checkTaxID(company.INN); err != nil {
+		return err
+	}
+	if err := s.repo.Create(ctx, company, auditMeta(ctx)); err != nil {
+		logger.ErrorLogger.Printf("Error creating company in repository: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateCompany изменяет только переданные в patch поля компании версии version
+// и возвращает сохранённую компанию
+func (s *CompanyService) UpdateCompany(ctx context.Context, id, version int, patch *models.CompanyUpdateRequest) (*models.Company, error) {
+	company, err := s.GetCompanyByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	company.Version = version
+
+	if patch.INN != nil {
+		if err := checkTaxID(*patch.INN); err != nil {
+			return nil, err
+		}
+		company.INN = *patch.INN
+	}
+	setString := func(dst *string, v *string) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setString(&company.LegalName, patch.LegalName)
+	setString(&company.LegalAddress, patch.LegalAddress)
+	setString(&company.ContactPerson, patch.ContactPerson)
+	setString(&company.Phone, patch.Phone)
+	setString(&company.Email, patch.Email)
+	if patch.VATPayer != nil {
+		company.VATPayer = *patch.VATPayer
+	}
+
+	if err := s.repo.Update(ctx, company, auditMeta(ctx)); err != nil {
+		logger.ErrorLogger.Printf("Error updating company in repository: %v", err)
+		return nil, apperrors.NotFound(err, "Company not found")
+	}
+	return company, nil
+}
+
+func (s *CompanyService) DeleteCompany(ctx context.Context, id, version int) error {
+	return apperrors.NotFound(s.repo.Delete(ctx, id, version, auditMeta(ctx)), "Company not found")
+}
+
+// ListTerminals возвращает страницу торговых точек компании id под фильтром
+func (s *CompanyService) ListTerminals(ctx context.Context, id int, filter models.TerminalFilter) (*models.TerminalList, error) {
+	company, err := s.GetCompanyByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	filter.INN = company.INN
+	return s.terminalService.ListTerminals(ctx, filter)
+}
+
+// ListFiscalModules возвращает страницу фискальных модулей, привязанных к торговым
+// точкам компании id
+func (s *CompanyService) ListFiscalModules(ctx context.Context, id int, filter models.FiscalModuleFilter) (*models.FiscalModuleList, error) {
+	company, err := s.GetCompanyByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	filter.CompanyINN = company.INN
+	return s.fiscalService.List(ctx, filter)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/tabular"
+)
+
+var ErrUnsupportedExportFormat = &apperrors.Error{Code: apperrors.CodeBadRequest, Message: "Export format must be csv, xlsx or pdf", Field: "format"}
+
+// exportColumn описывает столбец выгрузки: имя для параметра columns, заголовок и значение ячейки
+type exportColumn[T any] struct {
+	name  string
+	title string
+	value func(item *T) interface{}
+}
+
+// writeExport выбирает столбцы names (все, если names пуст) и пишет в w строки, которые stream
+// передаёт своей функции. Файл начинает писаться только с первой строкой или после
+// успешного завершения stream, поэтому ошибку до начала выгрузки можно вернуть клиенту.
+func writeExport[T any](w io.Writer, format tabular.Format, title string, all []exportColumn[T], names []string, stream func(fn func(item *T) error) error) error {
+	if !format.Writable() {
+		return ErrUnsupportedExportFormat
+	}
+	columns, err := selectExportColumns(all, names)
+	if err != nil {
+		return err
+	}
+	titles := make([]string, len(columns))
+	for i, c := range columns {
+		titles[i] = c.title
+	}
+
+	var out tabular.Writer
+	open := func() error {
+		if out != nil {
+			return nil
+		}
+		writer, err := tabular.NewWriter(w, format, title, titles)
+		if err != nil {
+			return err
+		}
+		out = writer
+		return nil
+	}
+
+	values := make([]interface{}, len(columns))
+	err = stream(func(item *T) error {
+		if err := open(); err != nil {
+			return err
+		}
+		for i, c := range columns {
+			values[i] = c.value(item)
+		}
+		return out.Write(values)
+	})
+	if errors.Is(err, tabular.ErrTooManyRows) {
+		// PDF ещё ничего не записал в w, поэтому клиент получит 400 вместо обрезанного файла
+		return &apperrors.Error{Code: apperrors.CodeBadRequest, Message: fmt.Sprintf("PDF export is limited to %d rows, narrow the filters or use csv or xlsx", tabular.MaxPDFRows), Field: "format"}
+	}
+	if err != nil {
+		return err
+	}
+	if err := open(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func selectExportColumns[T any](all []exportColumn[T], names []string) ([]exportColumn[T], error) {
+	if len(names) == 0 {
+		return all, nil
+	}
+	byName := make(map[string]exportColumn[T], len(all))
+	for _, c := range all {
+		byName[c.name] = c
+	}
+	selected := make([]exportColumn[T], 0, len(names))
+	for _, name := range names {
+		c, ok := byName[name]
+		if !ok {
+			return nil, &apperrors.Error{Code: apperrors.CodeBadRequest, Message: "Unknown export column " + name, Field: "columns"}
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+func optionalInt(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func optionalTime(v *time.Time) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+var terminalExportColumns = []exportColumn[models.Terminal]{
+	{"id", "ID", func(t *models.Terminal) interface{} { return t.ID }},
+	{"inn", "INN", func(t *models.Terminal) interface{} { return t.INN }},
+	{"company_name", "Company name", func(t *models.Terminal) interface{} { return t.CompanyName }},
+	{"address", "Address", func(t *models.Terminal) interface{} { return t.Address }},
+	{"cash_register_number", "Cash register number", func(t *models.Terminal) interface{} { return t.CashRegisterNumber }},
+	{"module_number", "Module number", func(t *models.Terminal) interface{} { return t.ModuleNumber }},
+	{"assembly_number", "Assembly number", func(t *models.Terminal) interface{} { return t.AssemblyNumber }},
+	{"status", "Status", func(t *models.Terminal) interface{} { return string(t.Status) }},
+	{"is_online", "Online", func(t *models.Terminal) interface{} { return t.IsOnline }},
+	{"last_request_date", "Last request", func(t *models.Terminal) interface{} { return optionalTime(t.LastRequestDate) }},
+	{"database_update_date", "Database update", func(t *models.Terminal) interface{} { return optionalTime(t.DatabaseUpdateDate) }},
+	{"user_id", "Owner ID", func(t *models.Terminal) interface{} { return t.UserID }},
+	{"free_record_balance", "Free records", func(t *models.Terminal) interface{} { return t.FreeRecordBalance }},
+	{"fiscal_module_id", "Fiscal module ID", func(t *models.Terminal) interface{} { return optionalInt(t.FiscalModuleID) }},
+}
+
+var fiscalModuleExportColumns = []exportColumn[models.FiscalModule]{
+	{"id", "ID", func(m *models.FiscalModule) interface{} { return m.ID }},
+	{"factory_number", "Factory number", func(m *models.FiscalModule) interface{} { return m.FactoryNumber }},
+	{"fiscal_number", "Fiscal number", func(m *models.FiscalModule) interface{} { return m.FiscalNumber }},
+	{"user_id", "Owner ID", func(m *models.FiscalModule) interface{} { return m.UserID }},
+}
+
+// Суммы чеков выгружаются в тийинах, как и хранятся
+var receiptExportColumns = []exportColumn[models.Receipt]{
+	{"id", "ID", func(r *models.Receipt) interface{} { return r.ID }},
+	{"terminal_id", "Terminal ID", func(r *models.Receipt) interface{} { return r.TerminalID }},
+	{"shift_id", "Shift ID", func(r *models.Receipt) interface{} { return optionalInt(r.ShiftID) }},
+	{"fiscal_module_id", "Fiscal module ID", func(r *models.Receipt) interface{} { return r.FiscalModuleID }},
+	{"module_number", "Module number", func(r *models.Receipt) interface{} { return r.ModuleNumber }},
+	{"receipt_number", "Receipt number", func(r *models.Receipt) interface{} { return r.ReceiptNumber }},
+	{"type", "Type", func(r *models.Receipt) interface{} { return string(r.Type) }},
+	{"inn", "INN", func(r *models.Receipt) interface{} { return r.INN }},
+	{"total", "Total, tiyin", func(r *models.Receipt) interface{} { return r.Total }},
+	{"vat_total", "VAT, tiyin", func(r *models.Receipt) interface{} { return r.VATTotal }},
+	{"fiscal_sign", "Fiscal sign", func(r *models.Receipt) interface{} { return r.FiscalSign }},
+	{"issued_at", "Issued at", func(r *models.Receipt) interface{} { return r.IssuedAt }},
+}
@@ -2,45 +2,61 @@ package services
 
 import (
 	"context"
+	"io"
 	"log"
 
+	"github.com/idkOybek/internal/apperrors"
 	"github.com/idkOybek/internal/models"
-	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/internal/tabular"
 )
 
 type FiscalService struct {
-	repo *repository.FiscalRepository
+	repo FiscalRepository
 }
 
-func NewFiscalService(repo *repository.FiscalRepository) *FiscalService {
+func NewFiscalService(repo FiscalRepository) *FiscalService {
 	return &FiscalService{repo: repo}
 }
 
-func (s *FiscalService) GetAll(ctx context.Context) ([]models.FiscalModule, error) {
-	log.Println("Service: Fetching all fiscal modules")
-	modules, err := s.repo.GetAll(ctx)
+func (s *FiscalService) List(ctx context.Context, filter models.FiscalModuleFilter) (*models.FiscalModuleList, error) {
+	log.Println("Service: Listing fiscal modules")
+	modules, err := s.repo.List(ctx, filter)
 	if err != nil {
-		log.Printf("Service: Error fetching all fiscal modules: %v", err)
+		log.Printf("Service: Error listing fiscal modules: %v", err)
 		return nil, err
 	}
-	log.Println("Service: Successfully fetched all fiscal modules")
+	log.Println("Service: Successfully listed fiscal modules")
 	return modules, nil
 }
 
+// Export пишет в w фискальные модули под фильтром в формате format; columns выбирает
+// и упорядочивает столбцы, пустой список означает все столбцы
+func (s *FiscalService) Export(ctx context.Context, filter models.FiscalModuleFilter, format tabular.Format, columns []string, w io.Writer) error {
+	log.Println("Service: Exporting fiscal modules")
+	err := writeExport(w, format, "Fiscal modules", fiscalModuleExportColumns, columns, func(fn func(*models.FiscalModule) error) error {
+		return s.repo.Export(ctx, filter, fn)
+	})
+	if err != nil {
+		log.Printf("Service: Error exporting fiscal modules: %v", err)
+	}
+	return err
+}
+
 func (s *FiscalService) GetByID(ctx context.Context, id int) (*models.FiscalModule, error) {
 	log.Printf("Service: Fetching fiscal module by ID: %d", id)
 	module, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		log.Printf("Service: Error fetching fiscal module by ID %d: %v", id, err)
-		return nil, err
+		return nil, apperrors.NotFound(err, "Fiscal module not found")
 	}
 	log.Printf("Service: Successfully fetched fiscal module by ID: %d", id)
 	return module, nil
 }
 
-func (s *FiscalService) Create(ctx context.Context, module models.FiscalModule) error {
+// Create сохраняет модуль и заполняет его ID и версию
+func (s *FiscalService) Create(ctx context.Context, module *models.FiscalModule) error {
 	log.Println("Service: Creating new fiscal module")
-	err := s.repo.Create(ctx, &module)
+	err := s.repo.Create(ctx, module, auditMeta(ctx))
 	if err != nil {
 		log.Printf("Service: Error creating fiscal module: %v", err)
 		return err
@@ -49,24 +65,69 @@ func (s *FiscalService) Create(ctx context.Context, module models.FiscalModule)
 	return nil
 }
 
-func (s *FiscalService) Update(ctx context.Context, module models.FiscalModule) error {
-	log.Printf("Service: Updating fiscal module with ID: %d", module.ID)
-	err := s.repo.Update(ctx, &module)
+// Update изменяет только переданные в patch поля модуля версии version и возвращает сохранённый модуль
+func (s *FiscalService) Update(ctx context.Context, id, version int, patch *models.FiscalModuleUpdateRequest) (*models.FiscalModule, error) {
+	log.Printf("Service: Updating fiscal module with ID: %d", id)
+	module, err := s.GetByID(ctx, id)
 	if err != nil {
-		log.Printf("Service: Error updating fiscal module with ID %d: %v", module.ID, err)
-		return err
+		return nil, err
 	}
-	log.Printf("Service: Successfully updated fiscal module with ID: %d", module.ID)
-	return nil
+	module.Version = version
+	if patch.FactoryNumber != nil {
+		module.FactoryNumber = *patch.FactoryNumber
+	}
+	if patch.FiscalNumber != nil {
+		module.FiscalNumber = *patch.FiscalNumber
+	}
+	if patch.UserID != nil {
+		module.UserID = *patch.UserID
+	}
+
+	err = s.repo.Update(ctx, module, auditMeta(ctx))
+	if err != nil {
+		log.Printf("Service: Error updating fiscal module with ID %d: %v", id, err)
+		return nil, apperrors.NotFound(err, "Fiscal module not found")
+	}
+	log.Printf("Service: Successfully updated fiscal module with ID: %d", id)
+	return s.GetByID(ctx, id)
 }
 
-func (s *FiscalService) Delete(ctx context.Context, id int) error {
+func (s *FiscalService) Delete(ctx context.Context, id, version int) error {
 	log.Printf("Service: Deleting fiscal module with ID: %d", id)
-	err := s.repo.Delete(ctx, id)
+	err := s.repo.Delete(ctx, id, version, auditMeta(ctx))
 	if err != nil {
 		log.Printf("Service: Error deleting fiscal module with ID %d: %v", id, err)
-		return err
+		return apperrors.NotFound(err, "Fiscal module not found")
 	}
 	log.Printf("Service: Successfully deleted fiscal module with ID: %d", id)
 	return nil
 }
+
+func (s *FiscalService) GetByNumber(ctx context.Context, number string) (*models.FiscalModule, error) {
+	log.Printf("Service: Fetching fiscal module by number: %s", number)
+	module, err := s.repo.GetByNumber(ctx, number)
+	if err != nil {
+		log.Printf("Service: Error fetching fiscal module by number %s: %v", number, err)
+		return nil, apperrors.NotFound(err, "Fiscal module not found")
+	}
+	return module, nil
+}
+
+// GetCurrentTerminal возвращает кассу, которую сейчас обслуживает модуль, или nil
+func (s *FiscalService) GetCurrentTerminal(ctx context.Context, moduleID int) (*models.FiscalModuleTerminal, error) {
+	terminal, err := s.repo.GetCurrentTerminal(ctx, moduleID)
+	if err != nil {
+		log.Printf("Service: Error fetching current terminal of fiscal module ID %d: %v", moduleID, err)
+		return nil, err
+	}
+	return terminal, nil
+}
+
+func (s *FiscalService) GetBindings(ctx context.Context, moduleID int) ([]models.FiscalModuleBinding, error) {
+	bindings, err := s.repo.GetBindings(ctx, moduleID)
+	if err != nil {
+		log.Printf("Service: Error fetching binding history of fiscal module ID %d: %v", moduleID, err)
+		return nil, err
+	}
+	return bindings, nil
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/internal/tabular"
+	"github.com/idkOybek/internal/taxid"
+)
+
+var ErrUnknownImportKind = &apperrors.Error{Code: apperrors.CodeBadRequest, Message: "Import kind must be terminals or fiscal_modules", Field: "kind"}
+
+// importRequiredColumns — обязательные столбцы файла; имена совпадают с JSON полями запросов создания
+var importRequiredColumns = map[models.ImportKind][]string{
+	models.ImportTerminals:     {"inn", "company_name", "address", "cash_register_number", "module_number", "assembly_number", "user_id"},
+	models.ImportFiscalModules: {"factory_number", "fiscal_number", "user_id"},
+}
+
+type ImportService struct {
+	repo ImportRepository
+}
+
+func NewImportService(repo ImportRepository) *ImportService {
+	return &ImportService{repo: repo}
+}
+
+// Prepare читает файл импорта, проверяет его заголовок и создаёт задание в состоянии pending
+func (s *ImportService) Prepare(ctx context.Context, kind models.ImportKind, fileName string, dryRun bool, file io.Reader) (*models.ImportJob, *tabular.Table, error) {
+	if !kind.Valid() {
+		return nil, nil, ErrUnknownImportKind
+	}
+	format, err := tabular.FormatFromName(fileName)
+	if err != nil {
+		return nil, nil, &apperrors.Error{Code: apperrors.CodeBadRequest, Message: err.Error(), Field: "file", Err: err}
+	}
+	table, err := tabular.Read(file, format)
+	if err != nil {
+		return nil, nil, &apperrors.Error{Code: apperrors.CodeValidation, Message: err.Error(), Field: "file", Err: err}
+	}
+	for _, column := range importRequiredColumns[kind] {
+		if !table.Has(column) {
+			return nil, nil, &apperrors.Error{Code: apperrors.CodeValidation, Message: "Missing column " + column, Field: "file"}
+		}
+	}
+
+	job := &models.ImportJob{
+		Kind:      kind,
+		FileName:  fileName,
+		Format:    string(format),
+		DryRun:    dryRun,
+		TotalRows: len(table.Records),
+		CreatedBy: auditMeta(ctx).ActorID,
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		logger.ErrorLogger.Printf("Error creating import job: %v", err)
+		return nil, nil, err
+	}
+	return job, table, nil
+}
+
+// Start создаёт задание и выполняет его в фоне. Ход выполнения доступен через GetJob.
+func (s *ImportService) Start(ctx context.Context, kind models.ImportKind, fileName string, dryRun bool, file io.Reader) (*models.ImportJob, error) {
+	job, table, err := s.Prepare(ctx, kind, fileName, dryRun, file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Задание переживает запрос, поэтому выполняется в собственном контексте
+	meta := auditMeta(ctx)
+	background := *job
+	go func() {
+		if err := s.Run(context.Background(), &background, table, meta); err != nil {
+			logger.ErrorLogger.Printf("Error finishing import job %d: %v", background.ID, err)
+		}
+	}()
+	return job, nil
+}
+
+func (s *ImportService) GetJob(ctx context.Context, id int) (*models.ImportJob, error) {
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving import job %d: %v", id, err)
+		return nil, apperrors.NotFound(err, "Import job not found")
+	}
+	return job, nil
+}
+
+// Run проверяет все строки файла и, если ошибок нет и это не dry run, создаёт объекты
+// в одной транзакции. Итог записывается в задание; возвращаемая ошибка означает,
+// что сохранить итог не удалось.
+func (s *ImportService) Run(ctx context.Context, job *models.ImportJob, table *tabular.Table, meta models.AuditMeta) error {
+	s.setStatus(ctx, job, models.ImportValidating)
+
+	var apply func(progress func(done int)) error
+	var err error
+	switch job.Kind {
+	case models.ImportTerminals:
+		var rows []models.ImportTerminalRow
+		rows, job.Errors, err = s.validateTerminals(ctx, table)
+		apply = func(progress func(done int)) error {
+			return s.repo.ApplyTerminals(ctx, rows, meta, progress)
+		}
+	case models.ImportFiscalModules:
+		var rows []models.ImportFiscalModuleRow
+		rows, job.Errors, err = s.validateFiscalModules(ctx, table)
+		apply = func(progress func(done int)) error {
+			return s.repo.ApplyFiscalModules(ctx, rows, meta, progress)
+		}
+	default:
+		err = ErrUnknownImportKind
+	}
+	if err != nil {
+		return s.fail(ctx, job, err)
+	}
+	job.ValidatedRows = job.TotalRows
+
+	switch {
+	case job.DryRun:
+		job.Status = models.ImportCompleted
+	case len(job.Errors) > 0:
+		job.Status = models.ImportFailed
+	default:
+		if err := s.repo.UpdateProgress(ctx, job.ID, job.ValidatedRows, 0); err != nil {
+			logger.ErrorLogger.Printf("Error updating progress of import job %d: %v", job.ID, err)
+		}
+		s.setStatus(ctx, job, models.ImportImporting)
+		err := apply(func(done int) {
+			if err := s.repo.UpdateProgress(ctx, job.ID, job.ValidatedRows, done); err != nil {
+				logger.ErrorLogger.Printf("Error updating progress of import job %d: %v", job.ID, err)
+			}
+		})
+		if err != nil {
+			return s.fail(ctx, job, err)
+		}
+		job.ImportedRows = job.TotalRows
+		job.Status = models.ImportCompleted
+	}
+	return s.finish(ctx, job)
+}
+
+func (s *ImportService) setStatus(ctx context.Context, job *models.ImportJob, status models.ImportStatus) {
+	job.Status = status
+	if err := s.repo.SetStatus(ctx, job.ID, status); err != nil {
+		logger.ErrorLogger.Printf("Error updating status of import job %d: %v", job.ID, err)
+	}
+}
+
+// fail завершает задание с ошибкой: ошибка записи строки относится к этой строке,
+// прочие — к файлу целиком
+func (s *ImportService) fail(ctx context.Context, job *models.ImportJob, err error) error {
+	logger.ErrorLogger.Printf("Import job %d failed: %v", job.ID, err)
+	appErr := apperrors.Classify(err)
+	rowErr := models.ImportRowError{Field: appErr.Field, Message: appErr.Message}
+	if rowErr.Message == "" {
+		rowErr.Message = "Import failed"
+	}
+	var failure *repository.ImportRowFailure
+	if errors.As(err, &failure) {
+		rowErr.Row = failure.Row
+	}
+	job.Errors = append(job.Errors, rowErr)
+	job.ImportedRows = 0
+	job.Status = models.ImportFailed
+	return s.finish(ctx, job)
+}
+
+func (s *ImportService) finish(ctx context.Context, job *models.ImportJob) error {
+	sort.SliceStable(job.Errors, func(i, j int) bool { return job.Errors[i].Row < job.Errors[j].Row })
+	job.ErrorCount = len(job.Errors)
+	if err := s.repo.Finish(ctx, job); err != nil {
+		return err
+	}
+	logger.InfoLogger.Printf("Import job %d (%s, dry run %t) finished as %s: %d row(s), %d error(s), %d imported",
+		job.ID, job.Kind, job.DryRun, job.Status, job.TotalRows, job.ErrorCount, job.ImportedRows)
+	return nil
+}
+
+func (s *ImportService) validateTerminals(ctx context.Context, table *tabular.Table) ([]models.ImportTerminalRow, []models.ImportRowError, error) {
+	v := &importValidator{}
+	rows := make([]models.ImportTerminalRow, 0, len(table.Records))
+	var userIDs []lineInt
+	for _, record := range table.Records {
+		v.required(record, importRequiredColumns[models.ImportTerminals]...)
+		userID, ok := v.integer(record, "user_id")
+		if ok {
+			userIDs = append(userIDs, lineInt{line: record.Line, value: userID})
+		}
+		balance, _ := v.integer(record, "free_record_balance")
+		row := models.ImportTerminalRow{
+			Row: record.Line,
+			Terminal: models.TerminalCreateRequest{
+				INN:                record.Get("inn"),
+				CompanyName:        record.Get("company_name"),
+				Address:            record.Get("address"),
+				CashRegisterNumber: record.Get("cash_register_number"),
+				ModuleNumber:       record.Get("module_number"),
+				AssemblyNumber:     record.Get("assembly_number"),
+				UserID:             userID,
+				FreeRecordBalance:  balance,
+			},
+		}
+		if row.Terminal.INN != "" {
+			if err := taxid.Validate(row.Terminal.INN); err != nil {
+				v.fail(record.Line, "inn", err.Error())
+			}
+		}
+		if row.Terminal.FreeRecordBalance < 0 {
+			v.fail(record.Line, "free_record_balance", "free_record_balance must not be negative")
+		}
+		rows = append(rows, row)
+	}
+
+	columns := map[string]func(row *models.ImportTerminalRow) string{
+		"cash_register_number": func(row *models.ImportTerminalRow) string { return row.Terminal.CashRegisterNumber },
+		"module_number":        func(row *models.ImportTerminalRow) string { return row.Terminal.ModuleNumber },
+		"assembly_number":      func(row *models.ImportTerminalRow) string { return row.Terminal.AssemblyNumber },
+	}
+	for _, column := range repository.ImportUniqueColumns(models.ImportTerminals) {
+		values := make([]lineValue, len(rows))
+		for i := range rows {
+			values[i] = lineValue{line: rows[i].Row, value: columns[column](&rows[i])}
+		}
+		if err := s.checkUnique(ctx, v, models.ImportTerminals, column, values); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.checkUsers(ctx, v, userIDs); err != nil {
+		return nil, nil, err
+	}
+
+	numbers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Terminal.ModuleNumber != "" {
+			numbers = append(numbers, row.Terminal.ModuleNumber)
+		}
+	}
+	modules, err := s.repo.FiscalModulesByNumber(ctx, numbers)
+	if err != nil {
+		return nil, nil, err
+	}
+	usedBy := make(map[int]int)
+	for i := range rows {
+		row := &rows[i]
+		if row.Terminal.ModuleNumber == "" {
+			continue
+		}
+		module, ok := modules[row.Terminal.ModuleNumber]
+		switch {
+		case !ok:
+			v.fail(row.Row, "module_number", ErrUnknownFiscalModule.Message)
+		case module.Bound:
+			v.fail(row.Row, "module_number", ErrFiscalModuleBound.Message)
+		case usedBy[module.ID] != 0:
+			v.fail(row.Row, "module_number", fmt.Sprintf("Fiscal module is already used in row %d", usedBy[module.ID]))
+		default:
+			usedBy[module.ID] = row.Row
+			row.FiscalModuleID = module.ID
+		}
+	}
+	return rows, v.errors, nil
+}
+
+func (s *ImportService) validateFiscalModules(ctx context.Context, table *tabular.Table) ([]models.ImportFiscalModuleRow, []models.ImportRowError, error) {
+	v := &importValidator{}
+	rows := make([]models.ImportFiscalModuleRow, 0, len(table.Records))
+	var userIDs []lineInt
+	for _, record := range table.Records {
+		v.required(record, importRequiredColumns[models.ImportFiscalModules]...)
+		userID, ok := v.integer(record, "user_id")
+		if ok {
+			userIDs = append(userIDs, lineInt{line: record.Line, value: userID})
+		}
+		rows = append(rows, models.ImportFiscalModuleRow{
+			Row: record.Line,
+			Module: models.FiscalModule{
+				FactoryNumber: record.Get("factory_number"),
+				FiscalNumber:  record.Get("fiscal_number"),
+				UserID:        userID,
+			},
+		})
+	}
+
+	for _, column := range repository.ImportUniqueColumns(models.ImportFiscalModules) {
+		values := make([]lineValue, len(rows))
+		for i, row := range rows {
+			value := row.Module.FactoryNumber
+			if column == "fiscal_number" {
+				value = row.Module.FiscalNumber
+			}
+			values[i] = lineValue{line: row.Row, value: value}
+		}
+		if err := s.checkUnique(ctx, v, models.ImportFiscalModules, column, values); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.checkUsers(ctx, v, userIDs); err != nil {
+		return nil, nil, err
+	}
+	return rows, v.errors, nil
+}
+
+type lineValue struct {
+	line  int
+	value string
+}
+
+type lineInt struct {
+	line  int
+	value int
+}
+
+// checkUnique отмечает значения уникального столбца, повторяющиеся в файле или уже занятые в базе
+func (s *ImportService) checkUnique(ctx context.Context, v *importValidator, kind models.ImportKind, column string, values []lineValue) error {
+	firstLine := make(map[string]int)
+	distinct := make([]string, 0, len(values))
+	for _, lv := range values {
+		if lv.value == "" {
+			continue
+		}
+		if first, ok := firstLine[lv.value]; ok {
+			v.fail(lv.line, column, fmt.Sprintf("%s %s is duplicated in row %d", column, lv.value, first))
+			continue
+		}
+		firstLine[lv.value] = lv.line
+		distinct = append(distinct, lv.value)
+	}
+	if len(distinct) == 0 {
+		return nil
+	}
+
+	taken, err := s.repo.TakenValues(ctx, kind, column, distinct)
+	if err != nil {
+		return err
+	}
+	for _, value := range distinct {
+		if taken[value] {
+			v.fail(firstLine[value], column, fmt.Sprintf("%s %s already exists", column, value))
+		}
+	}
+	return nil
+}
+
+// checkUsers отмечает строки, ссылающиеся на несуществующих пользователей
+func (s *ImportService) checkUsers(ctx context.Context, v *importValidator, userIDs []lineInt) error {
+	ids := make([]int, len(userIDs))
+	for i, li := range userIDs {
+		ids[i] = li.value
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	existing, err := s.repo.ExistingUserIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, li := range userIDs {
+		if !existing[li.value] {
+			v.fail(li.line, "user_id", fmt.Sprintf("User %d does not exist", li.value))
+		}
+	}
+	return nil
+}
+
+// importValidator накапливает ошибки по строкам файла
+type importValidator struct {
+	errors []models.ImportRowError
+}
+
+func (v *importValidator) fail(line int, field, message string) {
+	v.errors = append(v.errors, models.ImportRowError{Row: line, Field: field, Message: message})
+}
+
+func (v *importValidator) required(record tabular.Record, columns ...string) {
+	for _, column := range columns {
+		if record.Get(column) == "" {
+			v.fail(record.Line, column, column+" is required")
+		}
+	}
+}
+
+// integer разбирает целое значение столбца. ok ложно, если значения нет или оно не число;
+// во втором случае ошибка строки уже записана.
+func (v *importValidator) integer(record tabular.Record, column string) (value int, ok bool) {
+	raw := record.Get(column)
+	if raw == "" {
+		return 0, false
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		v.fail(record.Line, column, column+" must be an integer")
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+)
+
+type OFDService struct {
+	repo OutboxRepository
+}
+
+func NewOFDService(repo OutboxRepository) *OFDService {
+	return &OFDService{repo: repo}
+}
+
+// ListDeliveries возвращает страницу очереди отправки в ОФД
+func (s *OFDService) ListDeliveries(ctx context.Context, filter models.OFDDeliveryFilter) (*models.OFDDeliveryList, error) {
+	deliveries, err := s.repo.List(ctx, filter)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error listing OFD outbox: %v", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Requeue возвращает недоставленный документ в очередь отправки
+func (s *OFDService) Requeue(ctx context.Context, id int) (*models.OFDDelivery, error) {
+	delivery, err := s.repo.Requeue(ctx, id)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error requeueing OFD outbox %d: %v", id, err)
+		return nil, apperrors.NotFound(err, "Dead-lettered document not found")
+	}
+	logger.InfoLogger.Printf("OFD outbox %d requeued", id)
+	return delivery, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/internal/tabular"
+)
+
+var (
+	// ErrModuleNotBound возвращается, если модуль чека не привязан к передавшей его кассе
+	ErrModuleNotBound = repository.ErrModuleNotBound
+	// ErrReceiptNumberOutOfOrder возвращается при повторном или устаревшем номере чека
+	ErrReceiptNumberOutOfOrder = repository.ErrReceiptNumberOutOfOrder
+)
+
+type ReceiptService struct {
+	repo          ReceiptRepository
+	fiscalService *FiscalService
+}
+
+func NewReceiptService(repo ReceiptRepository, fiscalService *FiscalService) *ReceiptService {
+	return &ReceiptService{
+		repo:          repo,
+		fiscalService: fiscalService,
+	}
+}
+
+// SubmitReceipt проверяет и сохраняет чек кассы, списывая одну бесплатную запись.
+// Если ownerID задан, чек принимается только от кассы этого владельца.
+func (s *ReceiptService) SubmitReceipt(ctx context.Context, req *models.ReceiptCreateRequest, ownerID *int) (*models.Receipt, error) {
+	receipt, err := buildReceipt(req)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := s.fiscalService.GetByNumber(ctx, receipt.ModuleNumber)
+	if err != nil {
+		if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+			return nil, ErrUnknownFiscalModule
+		}
+		return nil, err
+	}
+	receipt.FiscalModuleID = module.ID
+
+	if err := s.repo.Create(ctx, receipt, ownerID); err != nil {
+		logger.ErrorLogger.Printf("Error storing receipt %d of module %s: %v", receipt.ReceiptNumber, receipt.ModuleNumber, err)
+		return nil, apperrors.NotFound(err, "Terminal not found")
+	}
+	return receipt, nil
+}
+
+func (s *ReceiptService) ListReceipts(ctx context.Context, filter models.ReceiptFilter) (*models.ReceiptList, error) {
+	receipts, err := s.repo.List(ctx, filter)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error listing receipts from repository: %v", err)
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// ExportReceipts пишет в w чеки под фильтром в формате format; columns выбирает
+// и упорядочивает столбцы, пустой список означает все столбцы
+func (s *ReceiptService) ExportReceipts(ctx context.Context, filter models.ReceiptFilter, format tabular.Format, columns []string, w io.Writer) error {
+	err := writeExport(w, format, "Receipts", receiptExportColumns, columns, func(fn func(*models.Receipt) error) error {
+		return s.repo.Export(ctx, filter, fn)
+	})
+	if err != nil {
+		logger.ErrorLogger.Printf("Error exporting receipts: %v", err)
+	}
+	return err
+}
+
+// GetReceiptByID возвращает чек с позициями; если ownerID задан, только чек кассы этого владельца
+func (s *ReceiptService) GetReceiptByID(ctx context.Context, id int, ownerID *int) (*models.Receipt, error) {
+	receipt, err := s.repo.GetByID(ctx, id, ownerID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving receipt by ID from repository: %v", err)
+		return nil, apperrors.NotFound(err, "Receipt not found")
+	}
+	return receipt, nil
+}
+
+func invalidReceipt(field, format string, args ...interface{}) error {
+	return &apperrors.Error{Code: apperrors.CodeValidation, Message: fmt.Sprintf(format, args...), Field: field}
+}
+
+// buildReceipt проверяет согласованность чека и считает итоговые суммы. Правила отдельных
+// полей заданы тегами validate в ReceiptCreateRequest и проверяются до вызова сервиса;
+// здесь проверяется только то, что зависит от нескольких полей.
+// Сумма позиций должна совпадать с суммой оплат.
+func buildReceipt(req *models.ReceiptCreateRequest) (*models.Receipt, error) {
+	receipt := &models.Receipt{
+		TerminalID:    req.TerminalID,
+		ModuleNumber:  strings.TrimSpace(req.ModuleNumber),
+		ReceiptNumber: req.ReceiptNumber,
+		Type:          req.Type,
+		FiscalSign:    req.FiscalSign,
+		IssuedAt:      req.IssuedAt,
+		Items:         req.Items,
+		Payments:      req.Payments,
+	}
+
+	for i, item := range req.Items {
+		if item.VATAmount > item.Total {
+			return nil, invalidReceipt(fmt.Sprintf("items[%d].vat_amount", i), "vat_amount must be between 0 and the item total")
+		}
+		receipt.Total += item.Total
+		receipt.VATTotal += item.VATAmount
+	}
+
+	var paid int64
+	for _, payment := range req.Payments {
+		paid += payment.Amount
+	}
+	if paid != receipt.Total {
+		return nil, invalidReceipt("payments", "payments total %d does not match items total %d", paid, receipt.Total)
+	}
+
+	return receipt, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/idkOybek/internal/models"
+)
+
+// Интерфейсы хранилищ, с которыми работают сервисы. Им удовлетворяют репозитории
+// PostgreSQL из пакета repository и хранилище в памяти из repository/memory.
+// Реализация должна соблюдать ограничения схемы: нарушения уникальности и внешних
+// ключей возвращаются как ошибки *pq.Error, отсутствие записи — как sql.ErrNoRows,
+// расхождение версий — как repository.ErrVersionMismatch.
+
+// UserRepository хранит пользователей
+type UserRepository interface {
+	List(ctx context.Context, filter models.UserFilter) (*models.UserList, error)
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	Create(ctx context.Context, user *models.User, meta models.AuditMeta) error
+	Update(ctx context.Context, user *models.User, meta models.AuditMeta) error
+	Delete(ctx context.Context, id, version int, meta models.AuditMeta) error
+}
+
+// SessionRepository хранит сессии входа и хеши их refresh токенов
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session, tokenHash string) error
+	Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.Session, error)
+	RevokeByPreviousToken(ctx context.Context, tokenHash string) (int64, error)
+	Revoke(ctx context.Context, sessionID, userID int) error
+	RevokeAllForUser(ctx context.Context, userID int) (int64, error)
+	GetActiveUser(ctx context.Context, sessionID, userID int) (*models.User, error)
+}
+
+// FiscalRepository хранит фискальные модули и историю их привязок к кассам
+type FiscalRepository interface {
+	List(ctx context.Context, filter models.FiscalModuleFilter) (*models.FiscalModuleList, error)
+	Export(ctx context.Context, filter models.FiscalModuleFilter, fn func(module *models.FiscalModule) error) error
+	GetByID(ctx context.Context, id int) (*models.FiscalModule, error)
+	GetByNumber(ctx context.Context, number string) (*models.FiscalModule, error)
+	Create(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error
+	Update(ctx context.Context, module *models.FiscalModule, meta models.AuditMeta) error
+	Delete(ctx context.Context, id, version int, meta models.AuditMeta) error
+	GetCurrentTerminal(ctx context.Context, moduleID int) (*models.FiscalModuleTerminal, error)
+	GetBindings(ctx context.Context, moduleID int) ([]models.FiscalModuleBinding, error)
+	Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error)
+}
+
+// TerminalRepository хранит торговые точки с их статусами, балансом и сменами
+type TerminalRepository interface {
+	List(ctx context.Context, filter models.TerminalFilter) (*models.TerminalList, error)
+	Export(ctx context.Context, filter models.TerminalFilter, fn func(terminal *models.Terminal) error) error
+	GetByID(ctx context.Context, id int) (*models.Terminal, error)
+	Create(ctx context.Context, terminal *models.TerminalCreateRequest, fiscalModuleID *int, meta models.AuditMeta) (*models.Terminal, error)
+	Update(ctx context.Context, terminal *models.Terminal, meta models.AuditMeta) error
+	Delete(ctx context.Context, id, version int, meta models.AuditMeta) error
+	Reassign(ctx context.Context, fromUserID, toUserID int, meta models.AuditMeta) (int, error)
+	CheckIn(ctx context.Context, cashRegisterNumber, moduleNumber string, ownerID *int) (*models.Terminal, error)
+	MarkOffline(ctx context.Context, window time.Duration) (int64, error)
+
+	ChangeStatus(ctx context.Context, change *models.TerminalStatusChange, meta models.AuditMeta) error
+	GetStatusHistory(ctx context.Context, terminalID int) ([]models.TerminalStatusChange, error)
+
+	ApplyBalanceMovement(ctx context.Context, movement *models.BalanceMovement) error
+	GetBalanceHistory(ctx context.Context, terminalID int) ([]models.BalanceMovement, error)
+
+	OpenShift(ctx context.Context, terminalID int, actorID *int) (*models.Shift, error)
+	GetOpenShift(ctx context.Context, terminalID int) (*models.Shift, error)
+	ShiftReport(ctx context.Context, terminalID int) (*models.ShiftReport, error)
+	CloseShift(ctx context.Context, terminalID int, actorID *int) (*models.ZReport, error)
+	GetZReports(ctx context.Context, terminalID int) ([]models.ZReport, error)
+}
+
+// ReceiptRepository хранит фискальные чеки с позициями и оплатами
+type ReceiptRepository interface {
+	Create(ctx context.Context, receipt *models.Receipt, ownerID *int) error
+	List(ctx context.Context, filter models.ReceiptFilter) (*models.ReceiptList, error)
+	Export(ctx context.Context, filter models.ReceiptFilter, fn func(receipt *models.Receipt) error) error
+	GetByID(ctx context.Context, id int, ownerID *int) (*models.Receipt, error)
+}
+
+// CompanyRepository хранит компании-налогоплательщики
+type CompanyRepository interface {
+	List(ctx context.Context, filter models.CompanyFilter) (*models.CompanyList, error)
+	GetByID(ctx context.Context, id int) (*models.Company, error)
+	IsRelated(ctx context.Context, inn string, userID int) (bool, error)
+	IsSoleOwner(ctx context.Context, inn string, userID int) (bool, error)
+	Create(ctx context.Context, company *models.Company, meta models.AuditMeta) error
+	Update(ctx context.Context, company *models.Company, meta models.AuditMeta) error
+	Delete(ctx context.Context, id, version int, meta models.AuditMeta) error
+}
+
+// OutboxRepository хранит очередь отправки документов в ОФД
+type OutboxRepository interface {
+	List(ctx context.Context, filter models.OFDDeliveryFilter) (*models.OFDDeliveryList, error)
+	Requeue(ctx context.Context, id int) (*models.OFDDelivery, error)
+}
+
+// AuditRepository хранит журнал аудита
+type AuditRepository interface {
+	List(ctx context.Context, filter models.AuditFilter) (*models.AuditRecordList, error)
+}
+
+// ImportRepository хранит задания импорта и создаёт импортируемые объекты
+type ImportRepository interface {
+	Create(ctx context.Context, job *models.ImportJob) error
+	GetByID(ctx context.Context, id int) (*models.ImportJob, error)
+	SetStatus(ctx context.Context, id int, status models.ImportStatus) error
+	UpdateProgress(ctx context.Context, id, validated, imported int) error
+	Finish(ctx context.Context, job *models.ImportJob) error
+	ExistingUserIDs(ctx context.Context, ids []int) (map[int]bool, error)
+	TakenValues(ctx context.Context, kind models.ImportKind, column string, values []string) (map[string]bool, error)
+	FiscalModulesByNumber(ctx context.Context, numbers []string) (map[string]models.ImportModuleRef, error)
+	ApplyTerminals(ctx context.Context, rows []models.ImportTerminalRow, meta models.AuditMeta, progress func(done int)) error
+	ApplyFiscalModules(ctx context.Context, rows []models.ImportFiscalModuleRow, meta models.AuditMeta, progress func(done int)) error
+}
+
+// TaxIDRepository перебирает сохранённые ИНН объектов
+type TaxIDRepository interface {
+	Stream(ctx context.Context, entity models.TaxIDEntity, fn func(record models.TaxIDRecord) error) error
+}
+
+// Repositories — хранилища, работающие в одной транзакции единицы работы
+type Repositories struct {
+	Users     UserRepository
+	Fiscal    FiscalRepository
+	Terminals TerminalRepository
+}
+
+// UnitOfWork выполняет fn с хранилищами одной транзакции: изменения fn фиксируются,
+// только если она вернула nil. fn может быть выполнена повторно, если транзакцию
+// не удалось сериализовать, поэтому она не должна иметь побочных эффектов вне хранилищ.
+// Вложенный вызов с контекстом, полученным fn, при ошибке откатывает только свои изменения.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+var (
+	// ErrShiftAlreadyOpen возвращается при открытии второй смены
+	ErrShiftAlreadyOpen = repository.ErrShiftAlreadyOpen
+	// ErrNoOpenShift возвращается, если у торговой точки нет открытой смены
+	ErrNoOpenShift = repository.ErrNoOpenShift
+	// ErrShiftExpired возвращается при приёме чека в смену длиннее 24 часов
+	ErrShiftExpired = repository.ErrShiftExpired
+)
+
+// OpenShift открывает кассовую смену на торговой точке
+func (s *TerminalService) OpenShift(ctx context.Context, terminalID int, actorID *int) (*models.Shift, error) {
+	shift, err := s.repo.OpenShift(ctx, terminalID, actorID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error opening shift on terminal %d: %v", terminalID, err)
+		return nil, apperrors.NotFound(err, "Terminal not found")
+	}
+	logger.InfoLogger.Printf("Shift %d opened on terminal %d", shift.ID, terminalID)
+	return shift, nil
+}
+
+// GetOpenShift возвращает открытую смену торговой точки
+func (s *TerminalService) GetOpenShift(ctx context.Context, terminalID int) (*models.Shift, error) {
+	shift, err := s.repo.GetOpenShift(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving open shift of terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+	return shift, nil
+}
+
+// XReport возвращает промежуточные итоги открытой смены без её закрытия
+func (s *TerminalService) XReport(ctx context.Context, terminalID int) (*models.ShiftReport, error) {
+	report, err := s.repo.ShiftReport(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error building X-report for terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+	return report, nil
+}
+
+// CloseShift закрывает открытую смену и возвращает сохранённый Z-отчёт
+func (s *TerminalService) CloseShift(ctx context.Context, terminalID int, actorID *int) (*models.ZReport, error) {
+	report, err := s.repo.CloseShift(ctx, terminalID, actorID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error closing shift on terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+	logger.InfoLogger.Printf("Shift %d closed on terminal %d with Z-report %d", report.Report.ShiftID, terminalID, report.ReportNumber)
+	return report, nil
+}
+
+// GetZReports возвращает Z-отчёты торговой точки
+func (s *TerminalService) GetZReports(ctx context.Context, terminalID int) ([]models.ZReport, error) {
+	reports, err := s.repo.GetZReports(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving Z-reports of terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+	return reports, nil
+}
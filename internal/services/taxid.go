@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/taxid"
+)
+
+// checkTaxID проверяет ИНН или ПИНФЛ и возвращает ошибку валидации поля inn
+func checkTaxID(inn string) error {
+	if err := taxid.Validate(inn); err != nil {
+		return &apperrors.Error{Code: apperrors.CodeValidation, Message: err.Error(), Field: "inn", Err: err}
+	}
+	return nil
+}
+
+type TaxIDService struct {
+	repo TaxIDRepository
+}
+
+func NewTaxIDService(repo TaxIDRepository) *TaxIDService {
+	return &TaxIDService{repo: repo}
+}
+
+// InvalidTaxIDs проверяет сохранённые ИНН пользователей, торговых точек и компаний и возвращает
+// не прошедшие проверку. Пустой entity означает объекты всех видов.
+func (s *TaxIDService) InvalidTaxIDs(ctx context.Context, entity models.TaxIDEntity) (*models.InvalidTaxIDReport, error) {
+	entities := []models.TaxIDEntity{models.TaxIDCompany, models.TaxIDUser, models.TaxIDTerminal}
+	if entity != "" {
+		entities = []models.TaxIDEntity{entity}
+	}
+
+	report := &models.InvalidTaxIDReport{Items: []models.InvalidTaxID{}}
+	for _, e := range entities {
+		err := s.repo.Stream(ctx, e, func(record models.TaxIDRecord) error {
+			report.Checked++
+			if err := taxid.Validate(record.INN); err != nil {
+				report.Items = append(report.Items, models.InvalidTaxID{TaxIDRecord: record, Reason: err.Error()})
+			}
+			return nil
+		})
+		if err != nil {
+			logger.ErrorLogger.Printf("Error checking stored tax IDs of %s: %v", e, err)
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -2,62 +2,237 @@ package services
 
 import (
 	"context"
+	"io"
+	"time"
 
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/health"
 	"github.com/idkOybek/internal/logger"
 	"github.com/idkOybek/internal/models"
-	"github.com/idkOybek/internal/repository"
+	"github.com/idkOybek/internal/tabular"
 )
 
 type TerminalService struct {
-	repo          *repository.TerminalRepository
+	repo          TerminalRepository
 	fiscalService *FiscalService
+	uow           UnitOfWork
 }
 
-func NewTerminalService(repo *repository.TerminalRepository, fiscalService *FiscalService) *TerminalService {
+func NewTerminalService(repo TerminalRepository, fiscalService *FiscalService, uow UnitOfWork) *TerminalService {
 	return &TerminalService{
 		repo:          repo,
 		fiscalService: fiscalService,
+		uow:           uow,
 	}
 }
 
-func (s *TerminalService) GetAllTerminals(ctx context.Context) ([]models.Terminal, error) {
-	terminals, err := s.repo.GetAll(ctx)
+func (s *TerminalService) ListTerminals(ctx context.Context, filter models.TerminalFilter) (*models.TerminalList, error) {
+	terminals, err := s.repo.List(ctx, filter)
 	if err != nil {
-		logger.ErrorLogger.Printf("Error retrieving terminals from repository: %v", err)
+		logger.ErrorLogger.Printf("Error listing terminals from repository: %v", err)
 		return nil, err
 	}
 	return terminals, nil
 }
 
+// ExportTerminals пишет в w торговые точки под фильтром в формате format; columns выбирает
+// и упорядочивает столбцы, пустой список означает все столбцы
+func (s *TerminalService) ExportTerminals(ctx context.Context, filter models.TerminalFilter, format tabular.Format, columns []string, w io.Writer) error {
+	err := writeExport(w, format, "Terminals", terminalExportColumns, columns, func(fn func(*models.Terminal) error) error {
+		return s.repo.Export(ctx, filter, fn)
+	})
+	if err != nil {
+		logger.ErrorLogger.Printf("Error exporting terminals: %v", err)
+	}
+	return err
+}
+
 func (s *TerminalService) GetTerminalByID(ctx context.Context, id int) (*models.Terminal, error) {
 	terminal, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		logger.ErrorLogger.Printf("Error retrieving terminal by ID from repository: %v", err)
-		return nil, err
+		return nil, apperrors.NotFound(err, "Terminal not found")
 	}
 	return terminal, nil
 }
 
-func (s *TerminalService) CreateTerminal(ctx context.Context, terminal *models.TerminalCreateRequest) error {
-	if err := s.repo.Create(ctx, terminal); err != nil {
-		logger.ErrorLogger.Printf("Error creating terminal in repository: %v", err)
+// CreateTerminal создаёт торговую точку с фискальным модулем из module_number
+// и возвращает сохранённую точку. Проверка, что модуль свободен, и привязка
+// выполняются в одной транзакции.
+func (s *TerminalService) CreateTerminal(ctx context.Context, terminal *models.TerminalCreateRequest) (*models.Terminal, error) {
+	if err := checkTaxID(terminal.INN); err != nil {
+		return nil, err
+	}
+
+	var created *models.Terminal
+	err := s.uow.Do(ctx, func(ctx context.Context, repos Repositories) error {
+		module, err := resolveFiscalModule(ctx, repos.Fiscal, terminal.ModuleNumber, 0)
+		if err != nil {
+			return err
+		}
+		created, err = repos.Terminals.Create(ctx, terminal, &module.ID, auditMeta(ctx))
 		return err
+	})
+	if err != nil {
+		logger.ErrorLogger.Printf("Error creating terminal: %v", err)
+		return nil, err
 	}
-	return nil
+	return created, nil
+}
+
+// UpdateTerminal изменяет только переданные в patch поля торговой точки версии version
+// и возвращает сохранённую точку. Переданный module_number заново привязывает
+// фискальный модуль, пустой — отвязывает.
+func (s *TerminalService) UpdateTerminal(ctx context.Context, id, version int, patch *models.TerminalUpdateRequest) (*models.Terminal, error) {
+	if patch.INN != nil {
+		if err := checkTaxID(*patch.INN); err != nil {
+			return nil, err
+		}
+	}
+
+	var updated *models.Terminal
+	err := s.uow.Do(ctx, func(ctx context.Context, repos Repositories) error {
+		terminal, err := repos.Terminals.GetByID(ctx, id)
+		if err != nil {
+			return apperrors.NotFound(err, "Terminal not found")
+		}
+		terminal.Version = version
+
+		setString := func(dst *string, v *string) {
+			if v != nil {
+				*dst = *v
+			}
+		}
+		setString(&terminal.INN, patch.INN)
+		setString(&terminal.Address, patch.Address)
+		setString(&terminal.CashRegisterNumber, patch.CashRegisterNumber)
+		setString(&terminal.AssemblyNumber, patch.AssemblyNumber)
+		if patch.LastRequestDate != nil {
+			terminal.LastRequestDate = patch.LastRequestDate
+		}
+		if patch.DatabaseUpdateDate != nil {
+			terminal.DatabaseUpdateDate = patch.DatabaseUpdateDate
+		}
+		if patch.UserID != nil {
+			terminal.UserID = *patch.UserID
+		}
+
+		if patch.ModuleNumber != nil {
+			terminal.ModuleNumber = *patch.ModuleNumber
+			terminal.FiscalModuleID = nil
+			if terminal.ModuleNumber != "" {
+				module, err := resolveFiscalModule(ctx, repos.Fiscal, terminal.ModuleNumber, terminal.ID)
+				if err != nil {
+					return err
+				}
+				terminal.FiscalModuleID = &module.ID
+			}
+		}
+
+		if err := repos.Terminals.Update(ctx, terminal, auditMeta(ctx)); err != nil {
+			return apperrors.NotFound(err, "Terminal not found")
+		}
+		updated, err = repos.Terminals.GetByID(ctx, id)
+		return err
+	})
+	if err != nil {
+		logger.ErrorLogger.Printf("Error updating terminal %d: %v", id, err)
+		return nil, err
+	}
+	return updated, nil
 }
 
-func (s *TerminalService) UpdateTerminal(ctx context.Context, terminal *models.Terminal) error {
-	if err := s.repo.Update(ctx, terminal); err != nil {
-		logger.ErrorLogger.Printf("Error updating terminal in repository: %v", err)
+// AttachFiscalModule подгружает привязанный к торговой точке фискальный модуль
+func (s *TerminalService) AttachFiscalModule(ctx context.Context, terminal *models.Terminal) error {
+	if terminal.FiscalModuleID == nil {
+		return nil
+	}
+	module, err := s.fiscalService.GetByID(ctx, *terminal.FiscalModuleID)
+	if err != nil {
 		return err
 	}
+	terminal.FiscalModule = module
 	return nil
 }
 
-func (s *TerminalService) DeleteTerminal(ctx context.Context, id int) error {
-	if err := s.repo.Delete(ctx, id); err != nil {
+var (
+	// ErrUnknownFiscalModule возвращается, если module_number не совпадает ни с одним модулем
+	ErrUnknownFiscalModule = &apperrors.Error{Code: apperrors.CodeInvalidReference, Message: "Fiscal module not found by module_number", Field: "module_number"}
+	// ErrFiscalModuleBound возвращается, если модуль уже обслуживает другую кассу
+	ErrFiscalModuleBound = &apperrors.Error{Code: apperrors.CodeConflict, Message: "Fiscal module is already bound to another terminal", Field: "module_number"}
+)
+
+// resolveFiscalModule находит модуль по заводскому или фискальному номеру и проверяет,
+// что он свободен или уже привязан к кассе terminalID
+func resolveFiscalModule(ctx context.Context, fiscal FiscalRepository, number string, terminalID int) (*models.FiscalModule, error) {
+	module, err := fiscal.GetByNumber(ctx, number)
+	if err != nil {
+		if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+			return nil, ErrUnknownFiscalModule
+		}
+		return nil, err
+	}
+
+	current, err := fiscal.GetCurrentTerminal(ctx, module.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.ID != terminalID {
+		logger.ErrorLogger.Printf("Fiscal module %d is already bound to terminal %d", module.ID, current.ID)
+		return nil, ErrFiscalModuleBound
+	}
+	return module, nil
+}
+
+func (s *TerminalService) DeleteTerminal(ctx context.Context, id, version int) error {
+	if err := s.repo.Delete(ctx, id, version, auditMeta(ctx)); err != nil {
 		logger.ErrorLogger.Printf("Error deleting terminal from repository: %v", err)
-		return err
+		return apperrors.NotFound(err, "Terminal not found")
 	}
 	return nil
 }
+
+// CheckIn фиксирует выход кассы на связь и сообщает, нужно ли ей обновить локальную базу.
+// Если ownerID задан, касса другого владельца считается ненайденной.
+func (s *TerminalService) CheckIn(ctx context.Context, req *models.TerminalCheckInRequest, ownerID *int) (*models.TerminalCheckInResponse, error) {
+	terminal, err := s.repo.CheckIn(ctx, req.CashRegisterNumber, req.ModuleNumber, ownerID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error checking in terminal %s/%s: %v", req.CashRegisterNumber, req.ModuleNumber, err)
+		return nil, apperrors.NotFound(err, "Terminal not found")
+	}
+
+	mustResync := terminal.DatabaseUpdateDate != nil &&
+		(req.DatabaseUpdateDate == nil || terminal.DatabaseUpdateDate.After(*req.DatabaseUpdateDate))
+
+	return &models.TerminalCheckInResponse{
+		TerminalID:         terminal.ID,
+		IsOnline:           terminal.IsOnline,
+		MustResync:         mustResync,
+		LastRequestDate:    *terminal.LastRequestDate,
+		DatabaseUpdateDate: terminal.DatabaseUpdateDate,
+	}, nil
+}
+
+// RunOfflineSweeper каждые interval переводит в офлайн кассы, молчащие дольше window,
+// и после каждого успешного прохода отмечается в heartbeat. Блокируется до отмены ctx.
+func (s *TerminalService) RunOfflineSweeper(ctx context.Context, interval, window time.Duration, heartbeat *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.repo.MarkOffline(ctx, window)
+			if err != nil {
+				logger.ErrorLogger.Printf("Error marking stale terminals offline: %v", err)
+				continue
+			}
+			heartbeat.Beat()
+			if count > 0 {
+				logger.InfoLogger.Printf("Marked %d terminal(s) offline after %s without check-in", count, window)
+			}
+		}
+	}
+}
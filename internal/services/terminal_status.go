@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
+	"github.com/idkOybek/internal/models"
+	"github.com/idkOybek/internal/repository"
+)
+
+var (
+	// ErrStatusReasonRequired возвращается при смене статуса без указания причины
+	ErrStatusReasonRequired = &apperrors.Error{Code: apperrors.CodeBadRequest, Message: "Reason is required to change terminal status", Field: "reason"}
+	// ErrConsumptionNotAllowed возвращается при списании записей заблокированной или выведенной точкой
+	ErrConsumptionNotAllowed = repository.ErrConsumptionNotAllowed
+	// ErrTerminalDecommissioned возвращается при изменении выведенной из эксплуатации точки
+	ErrTerminalDecommissioned = repository.ErrTerminalDecommissioned
+)
+
+// ChangeStatus переводит торговую точку в статус to, если переход разрешён жизненным циклом,
+// и возвращает точку в новом состоянии
+func (s *TerminalService) ChangeStatus(ctx context.Context, terminalID int, to models.TerminalStatus, actorID *int, reason string) (*models.Terminal, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrStatusReasonRequired
+	}
+
+	terminal, err := s.GetTerminalByID(ctx, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	if !terminal.Status.CanTransitionTo(to) {
+		logger.ErrorLogger.Printf("Rejected status transition of terminal %d from %s to %s", terminalID, terminal.Status, to)
+		return nil, apperrors.New(apperrors.CodeConflict, fmt.Sprintf("Terminal cannot change status from %s to %s", terminal.Status, to))
+	}
+
+	change := &models.TerminalStatusChange{
+		TerminalID: terminalID,
+		FromStatus: terminal.Status,
+		ToStatus:   to,
+		Reason:     reason,
+		ActorID:    actorID,
+	}
+	if err := s.repo.ChangeStatus(ctx, change, auditMeta(ctx)); err != nil {
+		logger.ErrorLogger.Printf("Error changing status of terminal %d to %s: %v", terminalID, to, err)
+		return nil, err
+	}
+	logger.InfoLogger.Printf("Terminal %d status changed from %s to %s: %s", terminalID, change.FromStatus, to, reason)
+
+	return s.GetTerminalByID(ctx, terminalID)
+}
+
+// GetStatusHistory возвращает историю смены статусов торговой точки
+func (s *TerminalService) GetStatusHistory(ctx context.Context, terminalID int) ([]models.TerminalStatusChange, error) {
+	history, err := s.repo.GetStatusHistory(ctx, terminalID)
+	if err != nil {
+		logger.ErrorLogger.Printf("Error retrieving status history for terminal %d: %v", terminalID, err)
+		return nil, err
+	}
+	return history, nil
+}
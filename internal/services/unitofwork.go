@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+
+	"github.com/idkOybek/internal/repository"
+)
+
+// sqlUnitOfWork выполняет единицы работы в транзакциях PostgreSQL
+type sqlUnitOfWork struct {
+	uow *repository.UnitOfWork
+}
+
+func NewSQLUnitOfWork(uow *repository.UnitOfWork) UnitOfWork {
+	return sqlUnitOfWork{uow: uow}
+}
+
+func (u sqlUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	return u.uow.Do(ctx, func(ctx context.Context, tx *repository.Tx) error {
+		return fn(ctx, Repositories{Users: tx.Users, Fiscal: tx.Fiscal, Terminals: tx.Terminals})
+	})
+}
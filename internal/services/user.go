@@ -3,34 +3,154 @@ package services
 import (
 	"context"
 
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/logger"
 	"github.com/idkOybek/internal/models"
-	"github.com/idkOybek/internal/repository"
 )
 
 type UserService struct {
-	repo *repository.UserRepository
+	repo        UserRepository
+	authService *AuthService
+	uow         UnitOfWork
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo UserRepository, authService *AuthService, uow UnitOfWork) *UserService {
+	return &UserService{
+		repo:        repo,
+		authService: authService,
+		uow:         uow,
+	}
 }
 
-func (s *UserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
-	return s.repo.GetAll(ctx)
+func (s *UserService) ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserList, error) {
+	return s.repo.List(ctx, filter)
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, id int) (*models.User, error) {
-	return s.repo.GetByID(ctx, id)
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, apperrors.NotFound(err, "User not found")
+	}
+	return user, nil
 }
 
+// CreateUser создаёт пользователя, сохраняя хеш его пароля
 func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
-	return s.repo.Create(ctx, user)
+	if err := normalizeRole(user); err != nil {
+		return err
+	}
+	if err := checkTaxID(user.INN); err != nil {
+		return err
+	}
+	hashed, err := s.authService.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	return s.repo.Create(ctx, user, auditMeta(ctx))
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, user *models.User) error {
-	return s.repo.Update(ctx, user)
+// UpdateUser изменяет только переданные в patch поля пользователя версии version
+// и возвращает сохранённого пользователя. Новый пароль хешируется.
+func (s *UserService) UpdateUser(ctx context.Context, id, version int, patch *models.UserUpdateRequest) (*models.User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user.Version = version
+
+	if patch.INN != nil {
+		if err := checkTaxID(*patch.INN); err != nil {
+			return nil, err
+		}
+		user.INN = *patch.INN
+	}
+	if patch.Username != nil {
+		user.Username = *patch.Username
+	}
+	if patch.IsActive != nil {
+		user.IsActive = *patch.IsActive
+	}
+	switch {
+	case patch.Role != nil:
+		user.Role = *patch.Role
+	case patch.IsAdmin != nil && *patch.IsAdmin:
+		user.Role = models.RoleAdmin
+	case patch.IsAdmin != nil && user.Role == models.RoleAdmin:
+		user.Role = models.RoleOwner
+	}
+	if err := normalizeRole(user); err != nil {
+		return nil, err
+	}
+	if patch.Password != nil {
+		if user.Password, err = s.authService.HashPassword(*patch.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Update(ctx, user, auditMeta(ctx)); err != nil {
+		return nil, apperrors.NotFound(err, "User not found")
+	}
+	return s.GetUserByID(ctx, id)
+}
+
+// ErrInvalidRole возвращается для неизвестной роли пользователя
+var ErrInvalidRole = apperrors.New(apperrors.CodeBadRequest, "Invalid role")
+
+// normalizeRole подставляет роль по умолчанию и держит is_admin в согласии с ролью
+func normalizeRole(user *models.User) error {
+	if user.Role == "" {
+		if user.IsAdmin {
+			user.Role = models.RoleAdmin
+		} else {
+			user.Role = models.RoleOwner
+		}
+	}
+	if !user.Role.Valid() {
+		return ErrInvalidRole
+	}
+	user.IsAdmin = user.Role == models.RoleAdmin
+	return nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, id int) error {
-	return s.repo.Delete(ctx, id)
+var (
+	// ErrReassignToSelf возвращается, если точки удаляемого пользователя передаются ему же
+	ErrReassignToSelf = &apperrors.Error{Code: apperrors.CodeBadRequest, Message: "Cannot reassign terminals to the user being deleted", Field: "reassign_to"}
+	// ErrUnknownReassignee возвращается, если пользователя, которому передаются точки, нет
+	ErrUnknownReassignee = &apperrors.Error{Code: apperrors.CodeInvalidReference, Message: "User to reassign terminals to not found", Field: "reassign_to"}
+)
+
+// DeleteUser удаляет пользователя версии version. Если reassignTo задан, его торговые точки
+// и фискальные модули в той же транзакции передаются пользователю reassignTo; иначе
+// пользователя, у которого они есть, удалить нельзя.
+func (s *UserService) DeleteUser(ctx context.Context, id, version int, reassignTo *int) error {
+	if reassignTo == nil {
+		return apperrors.NotFound(s.repo.Delete(ctx, id, version, auditMeta(ctx)), "User not found")
+	}
+	if *reassignTo == id {
+		return ErrReassignToSelf
+	}
+
+	return s.uow.Do(ctx, func(ctx context.Context, repos Repositories) error {
+		meta := auditMeta(ctx)
+		if _, err := repos.Users.GetByID(ctx, *reassignTo); err != nil {
+			if apperrors.Classify(err).Code == apperrors.CodeNotFound {
+				return ErrUnknownReassignee
+			}
+			return err
+		}
+		terminals, err := repos.Terminals.Reassign(ctx, id, *reassignTo, meta)
+		if err != nil {
+			return err
+		}
+		modules, err := repos.Fiscal.Reassign(ctx, id, *reassignTo, meta)
+		if err != nil {
+			return err
+		}
+		if err := repos.Users.Delete(ctx, id, version, meta); err != nil {
+			return apperrors.NotFound(err, "User not found")
+		}
+		logger.InfoLogger.Printf("Reassigned %d terminal(s) and %d fiscal module(s) of deleted user %d to user %d", terminals, modules, id, *reassignTo)
+		return nil
+	})
 }
@@ -0,0 +1,164 @@
+// Package tabular читает табличные файлы CSV и XLSX, в которых первая строка
+// содержит названия столбцов
+package tabular
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Format — формат табличного файла
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// ErrUnsupportedFormat возвращается для файлов, отличных от CSV и XLSX
+var ErrUnsupportedFormat = errors.New("unsupported file format, expected .csv or .xlsx")
+
+// FormatFromName определяет формат по расширению имени файла
+func FormatFromName(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Record — строка данных файла. Line — номер строки в файле, начиная с 1 (заголовок).
+type Record struct {
+	Line   int
+	values map[string]string
+}
+
+// Get возвращает значение столбца без окружающих пробелов или пустую строку, если столбца нет
+func (r Record) Get(column string) string {
+	return r.values[column]
+}
+
+// Table — содержимое файла: нормализованные названия столбцов и непустые строки данных
+type Table struct {
+	Columns []string
+	Records []Record
+}
+
+// Has сообщает, есть ли в файле столбец column
+func (t *Table) Has(column string) bool {
+	for _, c := range t.Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Read читает файл формата format. Названия столбцов приводятся к нижнему регистру,
+// пробелы в них заменяются подчёркиваниями; пустые строки пропускаются.
+func Read(r io.Reader, format Format) (*Table, error) {
+	var rows [][]string
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = readCSV(r)
+	case FormatXLSX:
+		rows, err = readXLSX(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	table := &Table{}
+	seen := make(map[string]bool)
+	for _, name := range rows[0] {
+		column := normalizeColumn(name)
+		if column != "" && seen[column] {
+			return nil, fmt.Errorf("duplicate column %q", column)
+		}
+		seen[column] = true
+		table.Columns = append(table.Columns, column)
+	}
+
+	for i, row := range rows[1:] {
+		record := Record{Line: i + 2, values: make(map[string]string, len(table.Columns))}
+		empty := true
+		for j, value := range row {
+			if j >= len(table.Columns) || table.Columns[j] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				empty = false
+			}
+			record.values[table.Columns[j]] = value
+		}
+		if !empty {
+			table.Records = append(table.Records, record)
+		}
+	}
+	return table, nil
+}
+
+func normalizeColumn(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// readCSV читает CSV с разделителем «,» или «;» (его использует Excel в русской локали)
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// readXLSX читает первый лист книги. Значения берутся без числового форматирования,
+// чтобы длинные номера не превращались в экспоненциальную запись.
+func readXLSX(r io.Reader) ([][]string, error) {
+	book, err := excelize.OpenReader(r, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer book.Close()
+
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	rows, err := book.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX: %w", err)
+	}
+	return rows, nil
+}
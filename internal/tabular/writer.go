@@ -0,0 +1,274 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// FormatPDF — печатный отчёт; поддерживается только для записи
+const FormatPDF Format = "pdf"
+
+// Writable сообщает, поддерживается ли запись в этом формате
+func (f Format) Writable() bool {
+	return f == FormatCSV || f == FormatXLSX || f == FormatPDF
+}
+
+// ContentType возвращает MIME-тип файла
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "application/octet-stream"
+}
+
+// Writer построчно записывает таблицу. Close дописывает файл и должен быть вызван
+// после последней строки.
+type Writer interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+// MaxPDFRows ограничивает число строк PDF-отчёта: fpdf собирает документ в памяти целиком
+var MaxPDFRows = 5000
+
+// ErrTooManyRows возвращается, когда в PDF-отчёт пишется больше MaxPDFRows строк
+var ErrTooManyRows = errors.New("too many rows for a PDF report")
+
+// NewWriter создаёт запись таблицы в формате format с заголовком columns.
+// CSV и XLSX пишутся потоком; PDF собирается в памяти и выводится в Close,
+// поэтому строк в нём не больше MaxPDFRows, а до Close в w ничего не пишется.
+func NewWriter(w io.Writer, format Format, title string, columns []string) (Writer, error) {
+	var writer Writer
+	var err error
+	switch format {
+	case FormatCSV:
+		writer, err = newCSVWriter(w, columns)
+	case FormatXLSX:
+		writer, err = newXLSXWriter(w, title, columns)
+	case FormatPDF:
+		writer = newPDFWriter(w, title, columns)
+	default:
+		err = ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// FormatValue приводит значение ячейки к строке для CSV и PDF; nil даёт пустую строку
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// csvFlushRows — через сколько строк буфер CSV сбрасывается в w
+const csvFlushRows = 500
+
+type csvWriter struct {
+	csv  *csv.Writer
+	rows int
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	// BOM нужен Excel, чтобы распознать UTF-8 и не исказить кириллицу
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	cw := &csvWriter{csv: csv.NewWriter(w)}
+	if err := cw.csv.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = FormatValue(v)
+	}
+	if err := w.csv.Write(record); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%csvFlushRows == 0 {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+type xlsxWriter struct {
+	out    io.Writer
+	book   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXWriter(w io.Writer, title string, columns []string) (*xlsxWriter, error) {
+	book := excelize.NewFile()
+	sheet := "Sheet1"
+	if title != "" && len(title) <= 31 {
+		if err := book.SetSheetName(sheet, title); err != nil {
+			return nil, err
+		}
+		sheet = title
+	}
+	stream, err := book.NewStreamWriter(sheet)
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+
+	xw := &xlsxWriter{out: w, book: book, stream: stream}
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = c
+	}
+	if err := xw.Write(header); err != nil {
+		book.Close()
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (w *xlsxWriter) Write(values []interface{}) error {
+	w.row++
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		// Время пишется строкой: без стиля даты Excel показал бы его числом
+		if t, ok := v.(time.Time); ok {
+			v = FormatValue(t)
+		}
+		row[i] = v
+	}
+	return w.stream.SetRow(cell, row)
+}
+
+func (w *xlsxWriter) Close() error {
+	defer w.book.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.book.Write(w.out)
+}
+
+const (
+	pdfFont     = "Go"
+	pdfFontSize = 8
+	pdfRowH     = 5
+)
+
+type pdfWriter struct {
+	out    io.Writer
+	pdf    *fpdf.Fpdf
+	widths []float64
+	rows   int
+}
+
+// newPDFWriter готовит альбомный A4 с заголовком отчёта и шапкой таблицы на каждой странице.
+// Шрифты Go содержат кириллицу, поэтому встраиваются вместо стандартных шрифтов PDF.
+func newPDFWriter(w io.Writer, title string, columns []string) *pdfWriter {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(pdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", gobold.TTF)
+	pdf.SetTitle(title, true)
+	pdf.SetAutoPageBreak(true, 12)
+	pdf.AliasNbPages("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	contentWidth := pageWidth - left - right
+	widths := make([]float64, len(columns))
+	for i := range widths {
+		widths[i] = contentWidth / float64(len(columns))
+	}
+	generated := time.Now().Format("2006-01-02 15:04")
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont(pdfFont, "B", 12)
+		pdf.CellFormat(contentWidth*0.75, 8, title, "", 0, "L", false, 0, "")
+		pdf.SetFont(pdfFont, "", pdfFontSize)
+		pdf.CellFormat(contentWidth*0.25, 8, generated, "", 1, "R", false, 0, "")
+		pdf.SetFont(pdfFont, "B", pdfFontSize)
+		pdf.SetFillColor(230, 230, 230)
+		for i, c := range columns {
+			pdf.CellFormat(widths[i], pdfRowH+1, fitText(pdf, c, widths[i]), "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont(pdfFont, "", pdfFontSize)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont(pdfFont, "", pdfFontSize)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	return &pdfWriter{out: w, pdf: pdf, widths: widths}
+}
+
+func (w *pdfWriter) Write(values []interface{}) error {
+	if w.rows == MaxPDFRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+	for i, v := range values {
+		w.pdf.CellFormat(w.widths[i], pdfRowH, fitText(w.pdf, FormatValue(v), w.widths[i]), "1", 0, "L", false, 0, "")
+	}
+	w.pdf.Ln(-1)
+	return w.pdf.Error()
+}
+
+func (w *pdfWriter) Close() error {
+	return w.pdf.Output(w.out)
+}
+
+// fitText укорачивает текст с многоточием, чтобы он поместился в ячейку шириной width
+func fitText(pdf *fpdf.Fpdf, text string, width float64) string {
+	const padding = 2
+	if pdf.GetStringWidth(text) <= width-padding {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width-padding {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,107 @@
+// Package taxid проверяет идентификаторы налогоплательщиков Узбекистана:
+// 9-значный ИНН (СТИР) и 14-значный ПИНФЛ (ЖШШИР) физического лица.
+package taxid
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	INNLength   = 9
+	PINFLLength = 14
+)
+
+var (
+	ErrINNFormat       = errors.New("INN must consist of 9 digits")
+	ErrINNChecksum     = errors.New("INN check digit does not match")
+	ErrPINFLFormat     = errors.New("PINFL must consist of 14 digits")
+	ErrPINFLChecksum   = errors.New("PINFL check digit does not match")
+	ErrPINFLBirthDate  = errors.New("PINFL does not contain a valid birth date")
+	ErrPINFLCentury    = errors.New("PINFL must start with a digit from 1 to 6")
+	ErrUnknownTaxIDLen = errors.New("Tax ID must be a 9-digit INN or a 14-digit PINFL")
+)
+
+// innWeights — веса первых восьми цифр ИНН при вычислении контрольной
+var innWeights = [INNLength - 1]int{37, 29, 23, 19, 17, 13, 7, 3}
+
+// pinflWeights повторяются по первым тринадцати цифрам ПИНФЛ
+var pinflWeights = [3]int{7, 3, 1}
+
+// Validate проверяет ИНН или ПИНФЛ, выбирая правило по длине значения
+func Validate(id string) error {
+	switch len(id) {
+	case INNLength:
+		return ValidateINN(id)
+	case PINFLLength:
+		return ValidatePINFL(id)
+	}
+	return ErrUnknownTaxIDLen
+}
+
+// ValidateINN проверяет ИНН: девятая цифра равна остатку от деления на 11
+// взвешенной суммы первых восьми. ИНН с остатком 10 не выдаются.
+func ValidateINN(inn string) error {
+	digits, ok := parseDigits(inn, INNLength)
+	if !ok {
+		return ErrINNFormat
+	}
+	sum := 0
+	for i, w := range innWeights {
+		sum += digits[i] * w
+	}
+	if sum%11 != digits[INNLength-1] {
+		return ErrINNChecksum
+	}
+	return nil
+}
+
+// ValidatePINFL проверяет ПИНФЛ. Первая цифра кодирует век и пол (1–6), следующие
+// шесть — дату рождения ДДММГГ, последняя — контрольная: взвешенная весами 7, 3, 1
+// сумма первых тринадцати цифр по модулю 10.
+func ValidatePINFL(pinfl string) error {
+	digits, ok := parseDigits(pinfl, PINFLLength)
+	if !ok {
+		return ErrPINFLFormat
+	}
+	if digits[0] < 1 || digits[0] > 6 {
+		return ErrPINFLCentury
+	}
+	if !validBirthDate(digits) {
+		return ErrPINFLBirthDate
+	}
+	sum := 0
+	for i := 0; i < PINFLLength-1; i++ {
+		sum += digits[i] * pinflWeights[i%len(pinflWeights)]
+	}
+	if sum%10 != digits[PINFLLength-1] {
+		return ErrPINFLChecksum
+	}
+	return nil
+}
+
+// validBirthDate проверяет дату рождения в цифрах 2–7 ПИНФЛ с учётом века из первой цифры
+func validBirthDate(digits []int) bool {
+	century := 1800 + 100*((digits[0]-1)/2)
+	day := digits[1]*10 + digits[2]
+	month := time.Month(digits[3]*10 + digits[4])
+	year := century + digits[5]*10 + digits[6]
+
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return date.Day() == day && date.Month() == month && date.Year() == year
+}
+
+func parseDigits(s string, length int) ([]int, bool) {
+	if len(s) != length {
+		return nil, false
+	}
+	digits := make([]int, length)
+	for i := 0; i < length; i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+		digits[i] = int(c - '0')
+	}
+	return digits, true
+}
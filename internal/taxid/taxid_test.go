@@ -0,0 +1,69 @@
+package taxid_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/idkOybek/internal/taxid"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		id   string
+		want error
+	}{
+		{"INN", "302563852", nil},
+		{"INN starting with 2", "201000011", nil},
+		{"INN with remainder 0", "300000070", nil},
+		{"INN with check digit 2", "308000052", nil},
+		{"INN with wrong check digit", "302563851", taxid.ErrINNChecksum},
+		// Взвешенная сумма 30000003 даёт остаток 10: такой ИНН не выдаётся ни с какой последней цифрой
+		{"INN with remainder 10", "300000030", taxid.ErrINNChecksum},
+		{"INN with remainder 10 and check digit 1", "300000031", taxid.ErrINNChecksum},
+		{"INN with letters", "30256385x", taxid.ErrINNFormat},
+		{"INN with sign", "+02563852", taxid.ErrINNFormat},
+
+		{"PINFL born in 1988", "31507880123457", nil},
+		{"PINFL born on 29 February 2000", "52902001234561", nil},
+		{"PINFL born in 1992", "43101920123457", nil},
+		{"PINFL born in 2020", "60101200123451", nil},
+		{"PINFL with wrong check digit", "31507880123450", taxid.ErrPINFLChecksum},
+		{"PINFL born on 29 February 1989", "32902890123456", taxid.ErrPINFLBirthDate},
+		{"PINFL with month 13", "31513880123457", taxid.ErrPINFLBirthDate},
+		{"PINFL with month 0", "31500880123457", taxid.ErrPINFLBirthDate},
+		{"PINFL with day 32", "33201880123457", taxid.ErrPINFLBirthDate},
+		{"PINFL with day 0", "30001880123457", taxid.ErrPINFLBirthDate},
+		{"PINFL with century 0", "01507880123457", taxid.ErrPINFLCentury},
+		{"PINFL with century 7", "71507880123457", taxid.ErrPINFLCentury},
+		{"PINFL with letters", "3150788012345x", taxid.ErrPINFLFormat},
+
+		{"empty", "", taxid.ErrUnknownTaxIDLen},
+		{"too short", "30256385", taxid.ErrUnknownTaxIDLen},
+		{"between lengths", "3025638520", taxid.ErrUnknownTaxIDLen},
+		{"too long", "315078801234570", taxid.ErrUnknownTaxIDLen},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := taxid.Validate(tc.id); !errors.Is(err, tc.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tc.id, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateByKind(t *testing.T) {
+	// Проверки отдельных видов не принимают значения другой длины
+	if err := taxid.ValidateINN("31507880123457"); !errors.Is(err, taxid.ErrINNFormat) {
+		t.Errorf("ValidateINN(PINFL) = %v, want %v", err, taxid.ErrINNFormat)
+	}
+	if err := taxid.ValidatePINFL("302563852"); !errors.Is(err, taxid.ErrPINFLFormat) {
+		t.Errorf("ValidatePINFL(INN) = %v, want %v", err, taxid.ErrPINFLFormat)
+	}
+	if err := taxid.ValidateINN("302563852"); err != nil {
+		t.Errorf("ValidateINN = %v", err)
+	}
+	if err := taxid.ValidatePINFL("31507880123457"); err != nil {
+		t.Errorf("ValidatePINFL = %v", err)
+	}
+}
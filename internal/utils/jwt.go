@@ -1,47 +1,92 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/idkOybek/internal/models"
 )
 
-var JwtKey = []byte("your_secret_key")
+// jwtKey задаётся из конфигурации при старте через SetJWTSecret
+var jwtKey []byte
+
+// ErrJWTSecretNotSet возвращается при выпуске или проверке токена до инициализации ключа
+var ErrJWTSecretNotSet = errors.New("jwt secret is not configured")
+
+// SetJWTSecret задаёт ключ подписи токенов доступа
+func SetJWTSecret(secret string) {
+	jwtKey = []byte(secret)
+}
 
 type Claims struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	ID        int         `json:"id"`
+	Username  string      `json:"username"`
+	IsAdmin   bool        `json:"is_admin"`
+	Role      models.Role `json:"role"`
+	SessionID int         `json:"sid"`
 	jwt.StandardClaims
 }
 
-// GenerateJWT создает новый JWT для пользователя
-func GenerateJWT(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateJWT создает новый JWT доступа для пользователя в рамках сессии sessionID
+func GenerateJWT(user *models.User, sessionID int, ttl time.Duration) (string, time.Time, error) {
+	expirationTime := time.Now().Add(ttl)
 	claims := &Claims{
-		ID:       user.ID,
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
+		ID:        user.ID,
+		Username:  user.Username,
+		IsAdmin:   user.IsAdmin,
+		Role:      user.Role,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
+	if len(jwtKey) == 0 {
+		return "", time.Time{}, ErrJWTSecretNotSet
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
+	tokenString, err := token.SignedString(jwtKey)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
+	}
+	return tokenString, expirationTime, nil
+}
+
+// GenerateRefreshToken создает случайный непрозрачный refresh токен и его SHA-256 хеш для хранения
+func GenerateRefreshToken() (token string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
 	}
-	return tokenString, nil
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken возвращает хеш refresh токена в том виде, в котором он хранится в базе
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // ParseJWT проверяет и парсит JWT токен
 func ParseJWT(tokenStr string) (*Claims, error) {
+	if len(jwtKey) == 0 {
+		return nil, ErrJWTSecretNotSet
+	}
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JwtKey, nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return jwtKey, nil
 	})
 
 	if err != nil {
@@ -14,6 +14,10 @@ func LoggerMiddleware(next http.Handler) http.Handler {
 		ww := &responseWriter{w, http.StatusOK}
 		defer func() {
 			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					// Обработчик сознательно оборвал ответ; соединение закрывает net/http
+					panic(err)
+				}
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				logger.ErrorLogger.Printf(
 					"[PANIC RECOVER] %s %s %s %d %s %v",
@@ -48,3 +52,8 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.status = status
 	rw.ResponseWriter.WriteHeader(status)
 }
+
+// Unwrap даёт http.ResponseController доступ к исходному ResponseWriter
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -4,11 +4,32 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/idkOybek/internal/apperrors"
 )
 
+// ErrorResponse — единый формат тела ответа с ошибкой
+type ErrorResponse struct {
+	Error  string                 `json:"error"`
+	Code   apperrors.Code         `json:"code"`
+	Field  string                 `json:"field,omitempty"`
+	Errors []apperrors.FieldError `json:"errors,omitempty"`
+}
+
 func RespondWithError(w http.ResponseWriter, code int, message string) {
 	log.Printf("RespondWithError: code=%d, message=%s", code, message)
-	RespondWithJSON(w, code, map[string]string{"error": message})
+	RespondWithJSON(w, code, ErrorResponse{Error: message, Code: apperrors.CodeForStatus(code)})
+}
+
+// RespondWithAppError классифицирует err и отвечает соответствующим статусом.
+// message используется для внутренних ошибок, текст которых клиенту не показывается.
+func RespondWithAppError(w http.ResponseWriter, err error, message string) {
+	appErr := apperrors.Classify(err)
+	if appErr.Message != "" && appErr.Code != apperrors.CodeInternal {
+		message = appErr.Message
+	}
+	log.Printf("RespondWithAppError: code=%s, message=%s, err=%v", appErr.Code, message, err)
+	RespondWithJSON(w, appErr.Status(), ErrorResponse{Error: message, Code: appErr.Code, Field: appErr.Field, Errors: appErr.Fields})
 }
 
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -21,7 +42,8 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	w.Write(response)
-	log.Printf("RespondWithJSON: code=%d, response=%s", code, response)
+	// Тело не логируется: ответы входа и обновления сессии содержат токены
+	log.Printf("RespondWithJSON: code=%d, bytes=%d", code, len(response))
 }
 
 func JSONMiddleware(next http.Handler) http.Handler {
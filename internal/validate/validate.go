@@ -0,0 +1,217 @@
+// Package validate проверяет структуры запросов по правилам из тега validate.
+//
+// Правила перечисляются через запятую:
+//
+//	required  значение задано: строка не пустая (без учёта пробелов), число не ноль,
+//	          время не нулевое, срез не пустой
+//	min=N     число не меньше N, длина строки или среза не меньше N
+//	max=N     число не больше N, длина строки или среза не больше N
+//	gt=N      число больше N
+//	enum      значение допустимо по его методу Valid() bool
+//	email     строка похожа на адрес электронной почты
+//	taxid     строка — ИНН или ПИНФЛ с верной контрольной цифрой
+//
+// Правила, кроме required, не проверяют пустые строки: необязательное поле можно не заполнять.
+// Поле-указатель nil пропускается целиком, поэтому частичные обновления проверяются
+// только по переданным полям; у заданного указателя required означает непустое значение.
+// Вложенные структуры и элементы срезов структур проверяются рекурсивно.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/idkOybek/internal/apperrors"
+	"github.com/idkOybek/internal/taxid"
+)
+
+// Message — сообщение ошибки, которую возвращает Struct
+const Message = "Request validation failed"
+
+type validator interface {
+	Valid() bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Struct проверяет v — структуру или указатель на неё — и возвращает ошибку с кодом
+// validation_failed и списком нарушений по полям или nil. Поля называются по тегу json.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", v))
+	}
+	var fields []apperrors.FieldError
+	checkStruct(value, "", &fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &apperrors.Error{Code: apperrors.CodeValidation, Message: Message, Field: fields[0].Field, Fields: fields}
+}
+
+func checkStruct(value reflect.Value, prefix string, errs *[]apperrors.FieldError) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := value.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			checkStruct(fv, prefix, errs)
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		checkValue(fv, prefix+name, field.Tag.Get("validate"), errs)
+	}
+}
+
+func checkValue(value reflect.Value, name, tag string, errs *[]apperrors.FieldError) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	} else if value.Kind() == reflect.String && value.Len() == 0 {
+		if hasRule(tag, "required") {
+			*errs = append(*errs, apperrors.FieldError{Field: name, Message: name + " is required"})
+		}
+		return
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "" {
+			continue
+		}
+		if message := checkRule(value, name, rule); message != "" {
+			*errs = append(*errs, apperrors.FieldError{Field: name, Message: message})
+			// Остальные правила поля после первого нарушения не проверяются
+			return
+		}
+	}
+
+	switch {
+	case value.Kind() == reflect.Struct && value.Type() != timeType:
+		checkStruct(value, name+".", errs)
+	case value.Kind() == reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			elem := reflect.Indirect(value.Index(i))
+			if elem.Kind() == reflect.Struct && elem.Type() != timeType {
+				checkStruct(elem, fmt.Sprintf("%s[%d].", name, i), errs)
+			}
+		}
+	}
+}
+
+// checkRule применяет одно правило и возвращает сообщение о нарушении или пустую строку
+func checkRule(value reflect.Value, name, rule string) string {
+	key, arg, _ := strings.Cut(rule, "=")
+	switch key {
+	case "required":
+		if isEmpty(value) {
+			return name + " is required"
+		}
+	case "min":
+		if n, ok := measure(value); ok && n < parseArg(rule, arg) {
+			return fmt.Sprintf("%s must be at least %s%s", name, arg, unit(value))
+		}
+	case "max":
+		if n, ok := measure(value); ok && n > parseArg(rule, arg) {
+			return fmt.Sprintf("%s must be at most %s%s", name, arg, unit(value))
+		}
+	case "gt":
+		if n, ok := measure(value); ok && n <= parseArg(rule, arg) {
+			return fmt.Sprintf("%s must be greater than %s", name, arg)
+		}
+	case "enum":
+		if v, ok := value.Interface().(validator); ok && !v.Valid() {
+			return fmt.Sprintf("%s has unsupported value %q", name, fmt.Sprint(value.Interface()))
+		}
+	case "email":
+		if _, err := mail.ParseAddress(value.String()); err != nil || strings.ContainsAny(value.String(), "<> ") {
+			return name + " must be a valid email address"
+		}
+	case "taxid":
+		if err := taxid.Validate(value.String()); err != nil {
+			return err.Error()
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q on %s", rule, name))
+	}
+	return ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Struct:
+		if value.Type() == timeType {
+			return value.Interface().(time.Time).IsZero()
+		}
+		return false
+	}
+	return value.IsZero()
+}
+
+// measure возвращает число для сравнения: значение числа или длину строки и среза
+func measure(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), true
+	}
+	return 0, false
+}
+
+func unit(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Map:
+		return " elements"
+	}
+	return ""
+}
+
+func parseArg(rule, arg string) float64 {
+	n, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: rule %q needs a numeric argument", rule))
+	}
+	return n
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
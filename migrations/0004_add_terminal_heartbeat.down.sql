@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_terminals_online_last_request;
+
+ALTER TABLE terminals DROP COLUMN IF EXISTS is_online;
@@ -0,0 +1,3 @@
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS is_online BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_terminals_online_last_request ON terminals (last_request_date) WHERE is_online;
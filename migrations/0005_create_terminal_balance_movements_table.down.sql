@@ -0,0 +1,3 @@
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_free_record_balance_non_negative;
+
+DROP TABLE IF EXISTS terminal_balance_movements;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS terminal_balance_movements (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('top_up', 'consumption', 'correction')),
+    amount INTEGER NOT NULL CHECK (amount <> 0),
+    balance_after INTEGER NOT NULL CHECK (balance_after >= 0),
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_terminal_balance_movements_terminal ON terminal_balance_movements (terminal_id, id);
+
+-- Отрицательный остаток нельзя перенести в журнал без потери данных, поэтому миграция
+-- останавливается и перечисляет такие кассы: их баланс нужно исправить вручную
+DO $$
+DECLARE
+    negative TEXT;
+BEGIN
+    SELECT string_agg(format('%s (%s)', id, free_record_balance), ', ' ORDER BY id)
+    INTO negative
+    FROM terminals
+    WHERE free_record_balance < 0;
+
+    IF negative IS NOT NULL THEN
+        RAISE EXCEPTION 'terminals with negative free_record_balance, fix them before migrating: %', negative;
+    END IF;
+END
+$$;
+
+-- Начальные остатки переносим в журнал, чтобы баланс сходился с суммой движений
+INSERT INTO terminal_balance_movements (terminal_id, kind, amount, balance_after, reason)
+SELECT id, 'correction', free_record_balance, free_record_balance, 'opening balance'
+FROM terminals
+WHERE free_record_balance <> 0;
+
+ALTER TABLE terminals ADD CONSTRAINT terminals_free_record_balance_non_negative CHECK (free_record_balance >= 0);
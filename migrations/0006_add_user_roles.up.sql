@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'owner'
+    CHECK (role IN ('admin', 'dealer', 'technician', 'owner', 'read_only'));
+
+UPDATE users SET role = 'admin' WHERE is_admin;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_inn;
+DROP INDEX IF EXISTS idx_fiscal_modules_user_id;
+DROP INDEX IF EXISTS idx_terminals_last_request_date;
+DROP INDEX IF EXISTS idx_terminals_company_name;
+DROP INDEX IF EXISTS idx_terminals_user_id;
+DROP INDEX IF EXISTS idx_terminals_inn;
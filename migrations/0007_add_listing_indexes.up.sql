@@ -0,0 +1,6 @@
+CREATE INDEX IF NOT EXISTS idx_terminals_inn ON terminals (inn, id);
+CREATE INDEX IF NOT EXISTS idx_terminals_user_id ON terminals (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_terminals_company_name ON terminals (company_name, id);
+CREATE INDEX IF NOT EXISTS idx_terminals_last_request_date ON terminals (last_request_date, id);
+CREATE INDEX IF NOT EXISTS idx_fiscal_modules_user_id ON fiscal_modules (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_users_inn ON users (inn, id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS fiscal_module_bindings;
+
+ALTER TABLE terminals DROP COLUMN IF EXISTS fiscal_module_id;
@@ -0,0 +1,41 @@
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS fiscal_module_id INTEGER REFERENCES fiscal_modules(id);
+
+-- Модуль кассы находится по module_number. Совпадение с фискальным номером предпочитается
+-- совпадению с заводским, поэтому каждой кассе достаётся не более одного модуля. Остаются
+-- без привязки и привязываются вручную:
+--   * касса, чей модуль нужен другой кассе с более сильным совпадением (по фискальному
+--     номеру против заводского) или с тем же совпадением и меньшим id;
+--   * касса, у которой совпадений нет.
+UPDATE terminals t
+SET fiscal_module_id = chosen.fiscal_module_id
+FROM (
+    SELECT DISTINCT ON (fiscal_module_id) terminal_id, fiscal_module_id
+    FROM (
+        SELECT DISTINCT ON (t.id) t.id AS terminal_id, f.id AS fiscal_module_id,
+            t.module_number <> f.fiscal_number AS by_factory_number
+        FROM terminals t
+        JOIN fiscal_modules f ON t.module_number IN (f.fiscal_number, f.factory_number)
+        ORDER BY t.id, by_factory_number, f.id
+    ) per_terminal
+    ORDER BY fiscal_module_id, by_factory_number, terminal_id
+) chosen
+WHERE t.id = chosen.terminal_id;
+
+ALTER TABLE terminals ADD CONSTRAINT terminals_fiscal_module_id_key UNIQUE (fiscal_module_id);
+
+CREATE TABLE IF NOT EXISTS fiscal_module_bindings (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id) ON DELETE CASCADE,
+    fiscal_module_id INTEGER NOT NULL REFERENCES fiscal_modules(id) ON DELETE CASCADE,
+    bound_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    unbound_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+-- Модуль может обслуживать не более одной кассы одновременно
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fiscal_module_bindings_active_module ON fiscal_module_bindings (fiscal_module_id) WHERE unbound_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fiscal_module_bindings_active_terminal ON fiscal_module_bindings (terminal_id) WHERE unbound_at IS NULL;
+
+INSERT INTO fiscal_module_bindings (terminal_id, fiscal_module_id, bound_at)
+SELECT id, fiscal_module_id, COALESCE(created_at, now())
+FROM terminals
+WHERE fiscal_module_id IS NOT NULL;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_terminals_status;
+DROP TABLE IF EXISTS terminal_status_changes;
+
+ALTER TABLE terminals DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_status_check;
+ALTER TABLE terminals ALTER COLUMN status DROP NOT NULL;
+ALTER TABLE terminals ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE terminals ALTER COLUMN status TYPE BOOLEAN USING status = 'active';
+ALTER TABLE terminals ALTER COLUMN status SET DEFAULT true;
@@ -0,0 +1,26 @@
+-- Статус торговой точки хранится строкой жизненного цикла вместо флага
+ALTER TABLE terminals ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE terminals ALTER COLUMN status TYPE VARCHAR(32)
+    USING CASE WHEN status IS NULL THEN 'registered' WHEN status THEN 'active' ELSE 'suspended' END;
+ALTER TABLE terminals ALTER COLUMN status SET DEFAULT 'registered';
+ALTER TABLE terminals ALTER COLUMN status SET NOT NULL;
+ALTER TABLE terminals ADD CONSTRAINT terminals_status_check
+    CHECK (status IN ('registered', 'active', 'suspended', 'blocked', 'decommissioned'));
+
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITHOUT TIME ZONE;
+UPDATE terminals SET status_changed_at = COALESCE(updated_at, created_at, now());
+ALTER TABLE terminals ALTER COLUMN status_changed_at SET DEFAULT now();
+ALTER TABLE terminals ALTER COLUMN status_changed_at SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS terminal_status_changes (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id) ON DELETE CASCADE,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    reason TEXT NOT NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    changed_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_terminal_status_changes_terminal ON terminal_status_changes (terminal_id, id);
+CREATE INDEX IF NOT EXISTS idx_terminals_status ON terminals (status);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS receipt_payments;
+DROP TABLE IF EXISTS receipt_items;
+DROP TABLE IF EXISTS receipts;
+ALTER TABLE fiscal_modules DROP COLUMN IF EXISTS last_receipt_number;
@@ -0,0 +1,43 @@
+-- Номер последнего принятого чека: номера чеков модуля должны строго возрастать
+ALTER TABLE fiscal_modules ADD COLUMN IF NOT EXISTS last_receipt_number BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS receipts (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id),
+    fiscal_module_id INTEGER NOT NULL REFERENCES fiscal_modules(id),
+    module_number VARCHAR(255) NOT NULL,
+    receipt_number BIGINT NOT NULL,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('sale', 'refund')),
+    inn VARCHAR(12) NOT NULL,
+    total BIGINT NOT NULL CHECK (total >= 0),
+    vat_total BIGINT NOT NULL CHECK (vat_total >= 0),
+    fiscal_sign VARCHAR(255) NOT NULL,
+    issued_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    CONSTRAINT receipts_receipt_number_key UNIQUE (fiscal_module_id, receipt_number)
+);
+
+CREATE TABLE IF NOT EXISTS receipt_items (
+    id SERIAL PRIMARY KEY,
+    receipt_id INTEGER NOT NULL REFERENCES receipts(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    quantity NUMERIC(12, 3) NOT NULL,
+    price BIGINT NOT NULL,
+    vat_rate INTEGER NOT NULL,
+    vat_amount BIGINT NOT NULL,
+    total BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS receipt_payments (
+    id SERIAL PRIMARY KEY,
+    receipt_id INTEGER NOT NULL REFERENCES receipts(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL,
+    amount BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipts_terminal_issued ON receipts (terminal_id, issued_at);
+CREATE INDEX IF NOT EXISTS idx_receipts_inn_issued ON receipts (inn, issued_at);
+CREATE INDEX IF NOT EXISTS idx_receipts_issued ON receipts (issued_at);
+CREATE INDEX IF NOT EXISTS idx_receipt_items_receipt ON receipt_items (receipt_id, position);
+CREATE INDEX IF NOT EXISTS idx_receipt_payments_receipt ON receipt_payments (receipt_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS z_reports;
+ALTER TABLE fiscal_modules DROP COLUMN IF EXISTS last_z_report_number;
+DROP INDEX IF EXISTS idx_receipts_shift;
+ALTER TABLE receipts DROP COLUMN IF EXISTS shift_id;
+DROP TABLE IF EXISTS shifts;
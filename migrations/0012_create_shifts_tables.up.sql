@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS shifts (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id),
+    fiscal_module_id INTEGER NOT NULL REFERENCES fiscal_modules(id),
+    opened_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    closed_at TIMESTAMP WITHOUT TIME ZONE,
+    opened_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    closed_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- У торговой точки не может быть двух открытых смен
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open_terminal ON shifts (terminal_id) WHERE closed_at IS NULL;
+
+ALTER TABLE receipts ADD COLUMN IF NOT EXISTS shift_id INTEGER REFERENCES shifts(id);
+CREATE INDEX IF NOT EXISTS idx_receipts_shift ON receipts (shift_id);
+
+ALTER TABLE fiscal_modules ADD COLUMN IF NOT EXISTS last_z_report_number INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS z_reports (
+    id SERIAL PRIMARY KEY,
+    shift_id INTEGER NOT NULL UNIQUE REFERENCES shifts(id),
+    fiscal_module_id INTEGER NOT NULL REFERENCES fiscal_modules(id),
+    report_number INTEGER NOT NULL,
+    report JSONB NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    CONSTRAINT z_reports_report_number_key UNIQUE (fiscal_module_id, report_number)
+);
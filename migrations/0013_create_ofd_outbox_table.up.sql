@@ -0,0 +1,21 @@
+-- Очередь отправки документов оператору фискальных данных (ОФД).
+-- Строка добавляется в той же транзакции, что и сам документ.
+CREATE TABLE IF NOT EXISTS ofd_outbox (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('receipt', 'z_report')),
+    receipt_id INTEGER UNIQUE REFERENCES receipts(id),
+    z_report_id INTEGER UNIQUE REFERENCES z_reports(id),
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'acknowledged', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    last_error TEXT,
+    ack_id VARCHAR(255),
+    acknowledged_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    CHECK ((kind = 'receipt') = (receipt_id IS NOT NULL) AND (kind = 'z_report') = (z_report_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ofd_outbox_due ON ofd_outbox (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_ofd_outbox_status ON ofd_outbox (status, id);
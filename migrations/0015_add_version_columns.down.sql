@@ -0,0 +1,3 @@
+ALTER TABLE fiscal_modules DROP COLUMN IF EXISTS version;
+ALTER TABLE terminals DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,4 @@
+-- Версия строки для оптимистической блокировки (ETag / If-Match)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE fiscal_modules ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
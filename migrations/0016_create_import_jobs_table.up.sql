@@ -0,0 +1,19 @@
+-- Задания массового импорта торговых точек и фискальных модулей из CSV/XLSX.
+-- errors хранит ошибки по строкам файла (не более первых 1000).
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL CHECK (kind IN ('terminals', 'fiscal_modules')),
+    file_name VARCHAR(255) NOT NULL,
+    format VARCHAR(8) NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'validating', 'importing', 'completed', 'failed')),
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    validated_rows INTEGER NOT NULL DEFAULT 0,
+    imported_rows INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    created_by INTEGER,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    started_at TIMESTAMP WITHOUT TIME ZONE,
+    finished_at TIMESTAMP WITHOUT TIME ZONE
+);
@@ -0,0 +1,26 @@
+-- Откат невозможен, пока сохранены 14-значные ПИНФЛ: миграция останавливается
+-- и перечисляет такие записи, их нужно удалить или исправить вручную
+DO $$
+DECLARE
+    long TEXT;
+BEGIN
+    SELECT string_agg(format('%s %s (%s)', source, id, inn), ', ' ORDER BY source, id)
+    INTO long
+    FROM (
+        SELECT 'users' AS source, id, inn FROM users
+        UNION ALL
+        SELECT 'terminals', id, inn FROM terminals
+        UNION ALL
+        SELECT 'receipts', id, inn FROM receipts
+    ) inns
+    WHERE length(inn) > 12;
+
+    IF long IS NOT NULL THEN
+        RAISE EXCEPTION 'rows with inn longer than 12 characters, fix them before rolling back: %', long;
+    END IF;
+END
+$$;
+
+ALTER TABLE receipts ALTER COLUMN inn TYPE VARCHAR(12);
+ALTER TABLE terminals ALTER COLUMN inn TYPE VARCHAR(12);
+ALTER TABLE users ALTER COLUMN inn TYPE VARCHAR(12);
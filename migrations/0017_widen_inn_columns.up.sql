@@ -0,0 +1,4 @@
+-- ИНН юридического лица занимает 9 цифр, ПИНФЛ физического лица — 14
+ALTER TABLE users ALTER COLUMN inn TYPE VARCHAR(14);
+ALTER TABLE terminals ALTER COLUMN inn TYPE VARCHAR(14);
+ALTER TABLE receipts ALTER COLUMN inn TYPE VARCHAR(14);
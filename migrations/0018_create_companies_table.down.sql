@@ -0,0 +1,9 @@
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS company_name VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE terminals t SET company_name = c.legal_name FROM companies c WHERE c.inn = t.inn;
+ALTER TABLE terminals ALTER COLUMN company_name DROP DEFAULT;
+-- Индекс из 0007 удалился вместе со столбцом
+CREATE INDEX IF NOT EXISTS idx_terminals_company_name ON terminals (company_name, id);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_inn_fkey;
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_inn_fkey;
+DROP TABLE IF EXISTS companies;
@@ -0,0 +1,34 @@
+-- Компании-налогоплательщики. Торговые точки и пользователи ссылаются на компанию по ИНН,
+-- поэтому название хранится в одном месте, а смена ИНН каскадно переносится на них.
+CREATE TABLE IF NOT EXISTS companies (
+    id SERIAL PRIMARY KEY,
+    inn VARCHAR(14) UNIQUE NOT NULL,
+    legal_name VARCHAR(255) NOT NULL DEFAULT '',
+    legal_address TEXT NOT NULL DEFAULT '',
+    vat_payer BOOLEAN NOT NULL DEFAULT false,
+    contact_person VARCHAR(255) NOT NULL DEFAULT '',
+    phone VARCHAR(64) NOT NULL DEFAULT '',
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_companies_legal_name ON companies (legal_name, id);
+
+-- Название и юридический адрес берутся из последней изменённой торговой точки с этим ИНН.
+-- Адрес точки остаётся у неё как адрес установки кассы.
+INSERT INTO companies (inn, legal_name, legal_address)
+SELECT DISTINCT ON (inn) inn, company_name, address
+FROM terminals
+ORDER BY inn, updated_at DESC NULLS LAST, id DESC
+ON CONFLICT (inn) DO NOTHING;
+
+-- Пользователи, у которых нет торговых точек, получают компанию без названия
+INSERT INTO companies (inn)
+SELECT DISTINCT inn FROM users
+ON CONFLICT (inn) DO NOTHING;
+
+ALTER TABLE terminals ADD CONSTRAINT terminals_inn_fkey FOREIGN KEY (inn) REFERENCES companies (inn) ON UPDATE CASCADE;
+ALTER TABLE users ADD CONSTRAINT users_inn_fkey FOREIGN KEY (inn) REFERENCES companies (inn) ON UPDATE CASCADE;
+ALTER TABLE terminals DROP COLUMN IF EXISTS company_name;
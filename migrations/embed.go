@@ -0,0 +1,9 @@
+// Package migrations содержит SQL миграции схемы, встроенные в бинарный файл
+package migrations
+
+import "embed"
+
+// FS содержит файлы вида NNNN_name.up.sql и NNNN_name.down.sql
+//
+//go:embed *.sql
+var FS embed.FS